@@ -0,0 +1,36 @@
+// Command backfill_counters fills the upvote_count, comment_count and
+// last_activity_at columns of existing posts from the upvotes and comments
+// tables. Run it once after deploying the counter columns; it is safe to rerun.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		log.Fatal("DATABASE_DSN must be set to the Postgres DSN of the database to backfill")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("failed to connect: %v", err)
+	}
+	// add the counter columns if the server has not migrated yet
+	if err := db.AutoMigrate(&models.Post{}); err != nil {
+		log.Fatalf("migrate posts: %v", err)
+	}
+	n, err := repository.NewPostRepository(db).BackfillPostCounters()
+	if err != nil {
+		log.Fatalf("backfill counters: %v", err)
+	}
+	fmt.Printf("Updated counters of %d posts\n", n)
+}
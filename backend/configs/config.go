@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -32,6 +33,178 @@ func GetJWTSecret() string {
 	return os.Getenv("JWT_SECRET")
 }
 
+// GetAdminEmails returns the comma-separated ADMIN_EMAILS. Users with these
+// emails are given the admin role when they next sign in with a verified
+// email; further admins are assigned through the roles API.
+func GetAdminEmails() []string {
+	return listFromEnv("ADMIN_EMAILS")
+}
+
+// GetSuperAdminEmails returns the comma-separated SUPER_ADMIN_EMAILS, whose
+// users are given the super_admin role (which can also manage admins).
+func GetSuperAdminEmails() []string {
+	return listFromEnv("SUPER_ADMIN_EMAILS")
+}
+
+// GetGoogleClientIDs returns the comma-separated GOOGLE_CLIENT_IDS, the
+// OAuth client IDs Google ID tokens must be issued to. Google sign-in is
+// disabled when it is empty.
+func GetGoogleClientIDs() []string {
+	return listFromEnv("GOOGLE_CLIENT_IDS")
+}
+
+// GetGoogleClientSecret returns GOOGLE_CLIENT_SECRET. With it Google is also
+// offered through the redirect sign-in flow at /auth/oidc/google/login.
+func GetGoogleClientSecret() string {
+	return os.Getenv("GOOGLE_CLIENT_SECRET")
+}
+
+// GetPublicBaseURL returns PUBLIC_BASE_URL, the externally visible URL of the
+// backend (e.g. https://api.example.com) used to build OIDC callback URLs.
+// When unset they are derived from the request.
+func GetPublicBaseURL() string {
+	return strings.TrimRight(strings.TrimSpace(os.Getenv("PUBLIC_BASE_URL")), "/")
+}
+
+// OIDCProviderConfig configures an OpenID Connect sign-in provider.
+type OIDCProviderConfig struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// RoleClaim is the ID token claim whose values RoleMap maps to roles.
+	RoleClaim string
+	RoleMap   map[string]string
+	// TrustEmail treats the provider's email claim as verified.
+	TrustEmail bool
+}
+
+// GetOIDCProviders returns the providers named in the comma-separated
+// OIDC_PROVIDERS. Provider "city" is configured by OIDC_CITY_ISSUER,
+// OIDC_CITY_CLIENT_ID, OIDC_CITY_CLIENT_SECRET, OIDC_CITY_DISPLAY_NAME,
+// OIDC_CITY_SCOPES (default "openid email profile"), OIDC_CITY_ROLE_CLAIM
+// (default "groups"), OIDC_CITY_ROLE_MAP ("claim value=role,...") and
+// OIDC_CITY_TRUST_EMAIL. Providers without an issuer or client ID are skipped.
+func GetOIDCProviders() []OIDCProviderConfig {
+	var out []OIDCProviderConfig
+	for _, name := range listFromEnv("OIDC_PROVIDERS") {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		get := func(key string) string { return strings.TrimSpace(os.Getenv(prefix + key)) }
+		c := OIDCProviderConfig{
+			Name:         name,
+			DisplayName:  get("DISPLAY_NAME"),
+			Issuer:       get("ISSUER"),
+			ClientID:     get("CLIENT_ID"),
+			ClientSecret: get("CLIENT_SECRET"),
+			Scopes:       strings.Fields(get("SCOPES")),
+			RoleClaim:    get("ROLE_CLAIM"),
+			RoleMap:      map[string]string{},
+			TrustEmail:   strings.ToLower(get("TRUST_EMAIL")) == "true",
+		}
+		if c.Issuer == "" || c.ClientID == "" {
+			log.Printf("OIDC provider %s needs %sISSUER and %sCLIENT_ID; skipping", name, prefix, prefix)
+			continue
+		}
+		if c.DisplayName == "" {
+			c.DisplayName = name
+		}
+		if len(c.Scopes) == 0 {
+			c.Scopes = []string{"openid", "email", "profile"}
+		}
+		if c.RoleClaim == "" {
+			c.RoleClaim = "groups"
+		}
+		for _, pair := range listFromEnv(prefix + "ROLE_MAP") {
+			if value, role, ok := strings.Cut(pair, "="); ok && strings.TrimSpace(value) != "" && strings.TrimSpace(role) != "" {
+				c.RoleMap[strings.TrimSpace(value)] = strings.TrimSpace(role)
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// GetFrontendURL returns the base URL of the frontend, used in links sent by
+// email. It defaults to PUBLIC_BASE_URL, where the backend serves the
+// frontend too.
+func GetFrontendURL() string {
+	if v := strings.TrimRight(strings.TrimSpace(os.Getenv("FRONTEND_URL")), "/"); v != "" {
+		return v
+	}
+	return GetPublicBaseURL()
+}
+
+// GetRequireVerifiedEmail reports whether users must verify their email
+// before submitting reports (REQUIRE_VERIFIED_EMAIL=true).
+func GetRequireVerifiedEmail() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("REQUIRE_VERIFIED_EMAIL"))) == "true"
+}
+
+// GetPasswordResetCooldown returns how long after a password reset email no
+// other one is sent to the same address. Default 5 minutes if unset or
+// invalid; PASSWORD_RESET_COOLDOWN_S=0 disables the cooldown.
+func GetPasswordResetCooldown() time.Duration {
+	v := strings.TrimSpace(os.Getenv("PASSWORD_RESET_COOLDOWN_S"))
+	if v == "" {
+		return 5 * time.Minute
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(n) * time.Second
+}
+
+// MailConfig configures how account emails are sent.
+type MailConfig struct {
+	// Driver is "smtp", "file" (one .eml file per message in Dir) or "log"
+	// (the default, for local development).
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	Dir          string
+}
+
+// GetMailConfig reads MAIL_DRIVER, MAIL_FROM, MAIL_DIR (default ./mail),
+// SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME and SMTP_PASSWORD.
+func GetMailConfig() MailConfig {
+	c := MailConfig{
+		Driver:       strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_DRIVER"))),
+		From:         strings.TrimSpace(os.Getenv("MAIL_FROM")),
+		SMTPHost:     strings.TrimSpace(os.Getenv("SMTP_HOST")),
+		SMTPPort:     587,
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		Dir:          strings.TrimSpace(os.Getenv("MAIL_DIR")),
+	}
+	if c.Driver == "" {
+		c.Driver = "log"
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("SMTP_PORT"))); err == nil && n > 0 {
+		c.SMTPPort = n
+	}
+	if c.Dir == "" {
+		c.Dir = "./mail"
+	}
+	return c
+}
+
+func listFromEnv(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 // GetRedisAddr returns the Redis address (HOST:PORT) from environment.
 func GetRedisAddr() string {
 	return os.Getenv("REDIS_ADDR")
@@ -86,15 +259,16 @@ func GetMLImageTimeout() time.Duration {
 }
 
 // GetFeedScoringMode controls how /feed computes priority scores.
-// Values: "ml" (call external ML), "heuristic" (local keywords), "none" (map from stored urgency only).
-// Default: "none" for performance.
+// Values: "ml" (call external ML), "heuristic" (local keywords), "none" (map from stored urgency only),
+// "incremental" (persisted score average) and "decay" (persisted score with time decay, SLA boost and
+// logarithmic upvotes). Default: "none" for performance.
 func GetFeedScoringMode() string {
 	m := strings.ToLower(strings.TrimSpace(os.Getenv("FEED_SCORING_MODE")))
 	if m == "" {
 		return "none"
 	}
 	switch m {
-	case "ml", "heuristic", "none", "incremental":
+	case "ml", "heuristic", "none", "incremental", "decay":
 		return m
 	default:
 		return "none"
@@ -134,3 +308,386 @@ func GetFeedLimit() int {
 	}
 	return n
 }
+
+// GetDuplicateMode controls duplicate detection when a report is submitted.
+// Values: "suggest" (reject with candidate duplicates so the client can offer
+// to upvote an existing report), "link" (attach the new post to the existing
+// issue), "off". Default: "suggest".
+func GetDuplicateMode() string {
+	m := strings.ToLower(strings.TrimSpace(os.Getenv("DUPLICATE_MODE")))
+	switch m {
+	case "suggest", "link", "off":
+		return m
+	default:
+		return "suggest"
+	}
+}
+
+// GetDuplicateRadiusMeters returns the radius around a new report in which
+// open posts are considered possible duplicates. Default 50m.
+func GetDuplicateRadiusMeters() float64 {
+	v := strings.TrimSpace(os.Getenv("DUPLICATE_RADIUS_M"))
+	if v == "" {
+		return 50
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		return 50
+	}
+	return f
+}
+
+// GetDuplicateMinSimilarity returns the minimum similarity (0..1) a nearby post
+// must reach to be reported as a duplicate. Default 0.35.
+func GetDuplicateMinSimilarity() float64 {
+	v := strings.TrimSpace(os.Getenv("DUPLICATE_MIN_SIMILARITY"))
+	if v == "" {
+		return 0.35
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		return 0.35
+	}
+	return f
+}
+
+// GetPostGISEnabled reports whether the Postgres PostGIS extension should be
+// used for map queries (ENABLE_POSTGIS=true). Off by default so plain
+// Postgres and sqlite keep working with the lat/lng B-tree index.
+func GetPostGISEnabled() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("ENABLE_POSTGIS"))) == "true"
+}
+
+// GetMapQueryLimit caps the number of posts returned by bbox/radius map queries.
+// Default 500 if unset or invalid.
+func GetMapQueryLimit() int {
+	v := strings.TrimSpace(os.Getenv("MAP_QUERY_LIMIT"))
+	if v == "" {
+		return 500
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 500
+	}
+	return n
+}
+
+// GetFeedRankWindow caps how many of the newest matching posts are scored when
+// paginating the score-ranked feed. Default 500 if unset or invalid.
+func GetFeedRankWindow() int {
+	v := strings.TrimSpace(os.Getenv("FEED_RANK_WINDOW"))
+	if v == "" {
+		return 500
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 500
+	}
+	return n
+}
+
+// GetMLBreakerFailures returns how many consecutive ML API failures open the
+// circuit breaker. Default 5 if unset or invalid.
+func GetMLBreakerFailures() int {
+	v := strings.TrimSpace(os.Getenv("ML_BREAKER_FAILURES"))
+	if v == "" {
+		return 5
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 5
+	}
+	return n
+}
+
+// GetMLBreakerOpenTimeout returns how long an open ML circuit breaker rejects
+// calls before probing the API again. Default 30000ms if unset or invalid.
+func GetMLBreakerOpenTimeout() time.Duration {
+	v := strings.TrimSpace(os.Getenv("ML_BREAKER_OPEN_MS"))
+	if v == "" {
+		return 30000 * time.Millisecond
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 30000 * time.Millisecond
+	}
+	return time.Duration(n) * time.Millisecond
+}
+
+// GetMLRetryAttempts returns the total number of attempts (including the first)
+// for ML API calls that fail with a transient error. Default 2; 1 disables retries.
+func GetMLRetryAttempts() int {
+	v := strings.TrimSpace(os.Getenv("ML_RETRY_ATTEMPTS"))
+	if v == "" {
+		return 2
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 2
+	}
+	return n
+}
+
+// GetMLRetryBaseDelay returns the base backoff before retrying an ML API call;
+// each retry waits a random delay up to base*2^(attempt-1). Default 200ms.
+func GetMLRetryBaseDelay() time.Duration {
+	v := strings.TrimSpace(os.Getenv("ML_RETRY_BASE_MS"))
+	if v == "" {
+		return 200 * time.Millisecond
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 200 * time.Millisecond
+	}
+	return time.Duration(n) * time.Millisecond
+}
+
+// GetMLModelVersion returns the deployed urgency model version (ML_MODEL_VERSION).
+// It is part of the prediction cache key, so changing it invalidates cached results.
+func GetMLModelVersion() string {
+	return strings.TrimSpace(os.Getenv("ML_MODEL_VERSION"))
+}
+
+// GetImageModelVersion returns the deployed image classification model version
+// (IMAGE_MODEL_VERSION); see GetMLModelVersion.
+func GetImageModelVersion() string {
+	return strings.TrimSpace(os.Getenv("IMAGE_MODEL_VERSION"))
+}
+
+// GetPredictionCacheTTL returns how long ML predictions are cached.
+// Default 24h if unset or invalid; PREDICTION_CACHE_TTL_S=0 disables the cache.
+func GetPredictionCacheTTL() time.Duration {
+	v := strings.TrimSpace(os.Getenv("PREDICTION_CACHE_TTL_S"))
+	if v == "" {
+		return 24 * time.Hour
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(n) * time.Second
+}
+
+// GetPredictionCacheSize caps the in-process prediction cache used when Redis
+// is not configured. Default 10000 entries if unset or invalid.
+func GetPredictionCacheSize() int {
+	v := strings.TrimSpace(os.Getenv("PREDICTION_CACHE_SIZE"))
+	if v == "" {
+		return 10000
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 10000
+	}
+	return n
+}
+
+// GetPredictionCacheDBEnabled reports whether predictions are also stored in
+// the database (PREDICTION_CACHE_DB=true) so they survive restarts.
+func GetPredictionCacheDBEnabled() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("PREDICTION_CACHE_DB"))) == "true"
+}
+
+// GetEnrichmentMode controls when ML enrichment of new reports runs.
+// Values: "async" (save the post immediately and enrich it in a background
+// worker), "sync" (call the models during the request). Default: "async".
+func GetEnrichmentMode() string {
+	m := strings.ToLower(strings.TrimSpace(os.Getenv("ENRICHMENT_MODE")))
+	switch m {
+	case "async", "sync":
+		return m
+	default:
+		return "async"
+	}
+}
+
+// GetEnrichmentWorkers returns the number of concurrent enrichment workers.
+// Default 4 if unset or invalid.
+func GetEnrichmentWorkers() int {
+	v := strings.TrimSpace(os.Getenv("ENRICHMENT_WORKERS"))
+	if v == "" {
+		return 4
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 4
+	}
+	return n
+}
+
+// GetEnrichmentMaxAttempts returns how often an enrichment job is tried before
+// the post is marked failed and scored with the heuristic. Default 5.
+func GetEnrichmentMaxAttempts() int {
+	v := strings.TrimSpace(os.Getenv("ENRICHMENT_MAX_ATTEMPTS"))
+	if v == "" {
+		return 5
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 5
+	}
+	return n
+}
+
+// GetMLBatchConcurrency bounds concurrent single ML calls when texts are
+// scored in bulk against an API without batch support. Default 4.
+func GetMLBatchConcurrency() int {
+	v := strings.TrimSpace(os.Getenv("ML_BATCH_CONCURRENCY"))
+	if v == "" {
+		return 4
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 4
+	}
+	return n
+}
+
+// GetScoringReloadInterval returns how often the active scoring profile is
+// re-read from the database so admin changes made through other instances
+// take effect. Default 30s.
+func GetScoringReloadInterval() time.Duration {
+	v := strings.TrimSpace(os.Getenv("SCORING_RELOAD_S"))
+	if v == "" {
+		return 30 * time.Second
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(n) * time.Second
+}
+
+// GetFeedRanking controls how score-ranked feeds are served: "materialized"
+// (default) reads post_rankings, which a background ranker keeps up to date;
+// "live" scores the newest posts on every request.
+func GetFeedRanking() string {
+	m := strings.ToLower(strings.TrimSpace(os.Getenv("FEED_RANKING")))
+	switch m {
+	case "materialized", "live":
+		return m
+	default:
+		return "materialized"
+	}
+}
+
+// GetFeedRankingSweepInterval returns how often all post rankings are
+// recomputed, which refreshes time-dependent scores and applies scoring
+// changes. Default 60s.
+func GetFeedRankingSweepInterval() time.Duration {
+	v := strings.TrimSpace(os.Getenv("FEED_RANKING_SWEEP_S"))
+	if v == "" {
+		return 60 * time.Second
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(n) * time.Second
+}
+
+// GetFeedDecayHalfLife returns the age at which a post's score is halved in
+// the "decay" feed scoring mode. Default 72h.
+func GetFeedDecayHalfLife() time.Duration {
+	return hoursFromEnv("FEED_DECAY_HALF_LIFE_H", 72)
+}
+
+// GetFeedSLA returns how long a report may stay unresolved before the "decay"
+// feed scoring mode starts boosting it. Default 168h (one week).
+func GetFeedSLA() time.Duration {
+	return hoursFromEnv("FEED_SLA_H", 168)
+}
+
+// GetFeedSLABoost returns the largest boost, as a fraction of the undecayed
+// score, given to unresolved reports past the SLA. Default 0.3, clamped to [0, 1].
+func GetFeedSLABoost() float64 {
+	v := strings.TrimSpace(os.Getenv("FEED_SLA_BOOST"))
+	if v == "" {
+		return 0.3
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0.3
+	}
+	return math.Max(0, math.Min(1, f))
+}
+
+// GetFeedUpvoteSaturation returns the upvote count at which the logarithmic
+// upvote score of the "decay" mode reaches 1. Default 50.
+func GetFeedUpvoteSaturation() int {
+	v := strings.TrimSpace(os.Getenv("FEED_UPVOTE_SATURATION"))
+	if v == "" {
+		return 50
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 50
+	}
+	return n
+}
+
+// hoursFromEnv reads a positive number of hours (fractions allowed).
+func hoursFromEnv(key string, def float64) time.Duration {
+	h := def
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 {
+			h = f
+		}
+	}
+	return time.Duration(h * float64(time.Hour))
+}
+
+// GetFeedPersonalDistanceBoost returns how much /feed?for=me raises the score
+// of posts near the user's saved places (score * (1 + boost) inside a place).
+// Default 1.0.
+func GetFeedPersonalDistanceBoost() float64 {
+	return nonNegativeFloatFromEnv("FEED_PERSONAL_DISTANCE_BOOST", 1.0)
+}
+
+// GetFeedPersonalCategoryBoost returns how much /feed?for=me raises the score
+// of posts in the categories the user interacts with most. Default 0.5.
+func GetFeedPersonalCategoryBoost() float64 {
+	return nonNegativeFloatFromEnv("FEED_PERSONAL_CATEGORY_BOOST", 0.5)
+}
+
+// GetIdempotencyTTL returns how long responses to POST /report, /comment and
+// /upvote sent with an Idempotency-Key are replayed. Default 24h if unset or
+// invalid; IDEMPOTENCY_TTL_S=0 disables idempotency keys.
+func GetIdempotencyTTL() time.Duration {
+	v := strings.TrimSpace(os.Getenv("IDEMPOTENCY_TTL_S"))
+	if v == "" {
+		return 24 * time.Hour
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(n) * time.Second
+}
+
+// GetRefreshTokenTTL returns how long a session started at sign-in can be
+// kept alive with refresh tokens. Default 30 days if unset or invalid;
+// REFRESH_TOKEN_TTL_H=0 disables refresh tokens.
+func GetRefreshTokenTTL() time.Duration {
+	v := strings.TrimSpace(os.Getenv("REFRESH_TOKEN_TTL_H"))
+	if v == "" {
+		return 30 * 24 * time.Hour
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(n) * time.Hour
+}
+
+func nonNegativeFloatFromEnv(key string, def float64) float64 {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return def
+	}
+	return f
+}
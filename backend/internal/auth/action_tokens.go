@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Purposes of action tokens. A token is only accepted for its own purpose.
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// ErrInvalidActionToken is returned for action tokens that are malformed,
+// forged, expired or meant for another purpose.
+var ErrInvalidActionToken = errors.New("invalid or expired link")
+
+// ActionToken authorizes one account action sent to a user by email, such as
+// verifying their address or resetting their password.
+type ActionToken struct {
+	Purpose string
+	UserID  uuid.UUID
+	// Binding ties the token to the state it changes (the email being
+	// verified, the password being replaced). Once the action is done the
+	// state no longer matches, so the token cannot be used again.
+	Binding string
+}
+
+// SignActionToken returns t as a signed token valid for ttl. It carries no
+// user_id claim, so it is never accepted as an access token.
+func (s *JWTService) SignActionToken(t ActionToken, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"typ": t.Purpose,
+		"sub": t.UserID.String(),
+		"bnd": t.Binding,
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.secret))
+}
+
+// ParseActionToken validates a token from SignActionToken for purpose.
+func (s *JWTService) ParseActionToken(tokenStr, purpose string) (ActionToken, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(s.secret), nil
+	}, jwt.WithValidMethods([]string{"HS256"}))
+	if err != nil {
+		return ActionToken{}, ErrInvalidActionToken
+	}
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil {
+		return ActionToken{}, ErrInvalidActionToken
+	}
+	if typ, _ := claims["typ"].(string); typ != purpose {
+		return ActionToken{}, ErrInvalidActionToken
+	}
+	sub, _ := claims.GetSubject()
+	id, err := uuid.Parse(sub)
+	if err != nil {
+		return ActionToken{}, ErrInvalidActionToken
+	}
+	t := ActionToken{Purpose: purpose, UserID: id}
+	t.Binding, _ = claims["bnd"].(string)
+	return t, nil
+}
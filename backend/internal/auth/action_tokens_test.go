@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestActionTokens(t *testing.T) {
+	s := &JWTService{secret: "test-secret", expiryMinutes: 15}
+	want := ActionToken{Purpose: PurposeResetPassword, UserID: uuid.New(), Binding: "abc"}
+	tok, err := s.SignActionToken(want, time.Hour)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	got, err := s.ParseActionToken(tok, PurposeResetPassword)
+	if err != nil || got != want {
+		t.Fatalf("expected %+v, got %+v (%v)", want, got, err)
+	}
+	if _, err := s.ParseActionToken(tok, PurposeVerifyEmail); !errors.Is(err, ErrInvalidActionToken) {
+		t.Fatalf("expected a token for another purpose to be refused, got %v", err)
+	}
+	if _, err := s.ParseToken(tok); err == nil {
+		t.Fatal("expected an action token not to pass as an access token")
+	}
+	other := &JWTService{secret: "other-secret"}
+	if _, err := other.ParseActionToken(tok, PurposeResetPassword); !errors.Is(err, ErrInvalidActionToken) {
+		t.Fatalf("expected a token signed with another secret to be refused, got %v", err)
+	}
+	expired, _ := s.SignActionToken(want, -time.Minute)
+	if _, err := s.ParseActionToken(expired, PurposeResetPassword); !errors.Is(err, ErrInvalidActionToken) {
+		t.Fatalf("expected an expired token to be refused, got %v", err)
+	}
+}
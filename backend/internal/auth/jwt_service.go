@@ -47,6 +47,99 @@ func (s *JWTService) GenerateTokenWithRole(userID uuid.UUID, role string) (strin
 	return token.SignedString([]byte(s.secret))
 }
 
+// GenerateTokenWithGrants returns a signed JWT containing the user ID, their
+// most privileged role and all their roles and permissions.
+func (s *JWTService) GenerateTokenWithGrants(userID uuid.UUID, role string, roles, permissions []string) (string, error) {
+	return s.IssueToken(TokenClaims{UserID: userID, Role: role, Roles: roles, Permissions: permissions})
+}
+
+// IssueToken returns a signed access token with the given claims. The session
+// ID is included when set.
+func (s *JWTService) IssueToken(c TokenClaims) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id":     c.UserID.String(),
+		"role":        c.Role,
+		"roles":       c.Roles,
+		"permissions": c.Permissions,
+		"exp":         time.Now().Add(s.AccessTokenTTL()).Unix(),
+		"iat":         time.Now().Unix(),
+	}
+	if c.SessionID != uuid.Nil {
+		claims["sid"] = c.SessionID.String()
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(s.secret))
+}
+
+// AccessTokenTTL returns how long issued access tokens are valid.
+func (s *JWTService) AccessTokenTTL() time.Duration {
+	return time.Duration(s.expiryMinutes) * time.Minute
+}
+
+// TokenClaims are the claims of a validated access token.
+type TokenClaims struct {
+	UserID      uuid.UUID
+	Role        string
+	Roles       []string
+	Permissions []string
+	// SessionID is the session the token was issued for, or uuid.Nil for
+	// tokens issued without one.
+	SessionID uuid.UUID
+}
+
+// ParseToken validates a token and returns its claims. Tokens without a role
+// claim get the role "user"; tokens without roles or permissions claims
+// (issued before roles were stored) carry none.
+func (s *JWTService) ParseToken(tokenStr string) (TokenClaims, error) {
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(s.secret), nil
+	})
+	if err != nil {
+		return TokenClaims{}, err
+	}
+	if !token.Valid {
+		return TokenClaims{}, errors.New("invalid token")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return TokenClaims{}, errors.New("invalid token claims")
+	}
+	uidRaw, ok := claims["user_id"].(string)
+	if !ok {
+		return TokenClaims{}, errors.New("user_id claim missing")
+	}
+	uid, err := uuid.Parse(uidRaw)
+	if err != nil {
+		return TokenClaims{}, err
+	}
+	out := TokenClaims{UserID: uid, Role: "user"}
+	if role, ok := claims["role"].(string); ok {
+		out.Role = role
+	}
+	out.Roles = stringsClaim(claims["roles"])
+	out.Permissions = stringsClaim(claims["permissions"])
+	if sid, ok := claims["sid"].(string); ok {
+		if id, err := uuid.Parse(sid); err == nil {
+			out.SessionID = id
+		}
+	}
+	return out, nil
+}
+
+func stringsClaim(v interface{}) []string {
+	list, _ := v.([]interface{})
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 // ValidateToken parses and validates a token, returning the user UUID if valid.
 func (s *JWTService) ValidateToken(tokenStr string) (uuid.UUID, error) {
 	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
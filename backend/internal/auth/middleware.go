@@ -17,6 +17,8 @@ type contextKey string
 
 const ContextUserID contextKey = "user_id"
 const ContextUserRole contextKey = "user_role"
+const ContextUserPermissions contextKey = "user_permissions"
+const ContextSessionID contextKey = "session_id"
 
 type errorResp struct {
 	Error string `json:"error"`
@@ -29,6 +31,27 @@ func writeJSONError(w http.ResponseWriter, msg string, code int) {
 	_ = json.NewEncoder(w).Encode(errorResp{Error: msg})
 }
 
+type tokenCandidate struct{ src, val string }
+
+// tokenCandidates returns the access tokens a request carries, in the order
+// they are tried: Authorization header, access_token cookie, token query param.
+func tokenCandidates(r *http.Request) []tokenCandidate {
+	candidates := make([]tokenCandidate, 0, 3)
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		parts := strings.SplitN(auth, " ", 2)
+		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+			candidates = append(candidates, tokenCandidate{src: "authorization_header", val: parts[1]})
+		}
+	}
+	if c, err := r.Cookie("access_token"); err == nil && c.Value != "" {
+		candidates = append(candidates, tokenCandidate{src: "cookie", val: c.Value})
+	}
+	if t := r.URL.Query().Get("token"); t != "" {
+		candidates = append(candidates, tokenCandidate{src: "query_param", val: t})
+	}
+	return candidates
+}
+
 // AuthMiddleware returns an http middleware that validates the Bearer token
 // and injects the user UUID into the request context under `ContextUserID`.
 // It supports tokens in the Authorization header (Bearer), a cookie named
@@ -46,20 +69,7 @@ func AuthMiddleware(jwtSvc *JWTService, rdb *redis.Client) func(http.Handler) ht
 			// Extract token candidates in preferred order and validate the first that works.
 			// This makes the middleware robust if, for example, a stale Authorization header
 			// exists but a valid cookie is also present.
-			type candidate struct{ src, val string }
-			candidates := make([]candidate, 0, 3)
-			if auth := r.Header.Get("Authorization"); auth != "" {
-				parts := strings.SplitN(auth, " ", 2)
-				if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
-					candidates = append(candidates, candidate{src: "authorization_header", val: parts[1]})
-				}
-			}
-			if c, err := r.Cookie("access_token"); err == nil && c.Value != "" {
-				candidates = append(candidates, candidate{src: "cookie", val: c.Value})
-			}
-			if t := r.URL.Query().Get("token"); t != "" {
-				candidates = append(candidates, candidate{src: "query_param", val: t})
-			}
+			candidates := tokenCandidates(r)
 
 			if len(candidates) == 0 {
 				log.Printf("auth: missing access token for %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
@@ -77,14 +87,10 @@ func AuthMiddleware(jwtSvc *JWTService, rdb *redis.Client) func(http.Handler) ht
 						return
 					}
 				}
-				if uid, err := jwtSvc.ValidateToken(cnd.val); err == nil {
+				if claims, err := jwtSvc.ParseToken(cnd.val); err == nil {
 					log.Printf("auth: accepted token source=%s method=%s path=%s remote=%s", cnd.src, r.Method, r.URL.Path, r.RemoteAddr)
-					// Extract role from token
-					role, _ := jwtSvc.GetRoleFromToken(cnd.val)
-					// inject user_id and role into context and proceed
-					ctx := context.WithValue(r.Context(), ContextUserID, uid)
-					ctx = context.WithValue(ctx, ContextUserRole, role)
-					next.ServeHTTP(w, r.WithContext(ctx))
+					// inject user_id, role and permissions into context and proceed
+					next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
 					validated = true
 					break
 				} else {
@@ -100,6 +106,35 @@ func AuthMiddleware(jwtSvc *JWTService, rdb *redis.Client) func(http.Handler) ht
 	}
 }
 
+// OptionalAuthMiddleware is like AuthMiddleware for endpoints that also serve
+// anonymous users: a valid token injects the user into the context, while a
+// missing, invalid or revoked token lets the request through unauthenticated.
+func OptionalAuthMiddleware(jwtSvc *JWTService, rdb *redis.Client) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, cnd := range tokenCandidates(r) {
+				if rdb != nil {
+					if ok, err := cache.IsTokenBlacklisted(context.Background(), rdb, cnd.val); err == nil && ok {
+						break
+					}
+				}
+				if claims, err := jwtSvc.ParseToken(cnd.val); err == nil {
+					r = r.WithContext(withClaims(r.Context(), claims))
+					break
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func withClaims(ctx context.Context, claims TokenClaims) context.Context {
+	ctx = context.WithValue(ctx, ContextUserID, claims.UserID)
+	ctx = context.WithValue(ctx, ContextUserRole, claims.Role)
+	ctx = context.WithValue(ctx, ContextSessionID, claims.SessionID)
+	return context.WithValue(ctx, ContextUserPermissions, claims.Permissions)
+}
+
 // GetUserIDFromContext retrieves the user UUID from the request context.
 func GetUserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
 	v := ctx.Value(ContextUserID)
@@ -122,11 +157,12 @@ func GetUserRoleFromContext(ctx context.Context) (string, bool) {
 
 // AdminMiddleware returns an http middleware that checks if the user has admin role.
 // It should be used after AuthMiddleware to ensure user is authenticated.
-// If user is not admin, returns 403 Forbidden.
+// If user is not admin (or super_admin), returns 403 Forbidden. Prefer
+// RequirePermission for new routes.
 func AdminMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		role, ok := GetUserRoleFromContext(r.Context())
-		if !ok || role != "admin" {
+		if !ok || (role != "admin" && role != "super_admin") {
 			log.Printf("admin: access denied for role=%s path=%s remote=%s", role, r.URL.Path, r.RemoteAddr)
 			writeJSONError(w, "admin access required", http.StatusForbidden)
 			return
@@ -134,3 +170,46 @@ func AdminMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// GetSessionIDFromContext retrieves the session of the user's token from the
+// request context; it is uuid.Nil for tokens issued without a session.
+func GetSessionIDFromContext(ctx context.Context) uuid.UUID {
+	sid, _ := ctx.Value(ContextSessionID).(uuid.UUID)
+	return sid
+}
+
+// GetUserPermissionsFromContext retrieves the permissions of the user's token
+// from the request context.
+func GetUserPermissionsFromContext(ctx context.Context) []string {
+	perms, _ := ctx.Value(ContextUserPermissions).([]string)
+	return perms
+}
+
+// HasPermission reports whether the authenticated user holds perm.
+func HasPermission(ctx context.Context, perm string) bool {
+	for _, p := range GetUserPermissionsFromContext(ctx) {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission returns an http middleware that only lets users whose
+// token carries perm through, answering 403 Forbidden otherwise. Like
+// AdminMiddleware it must run after AuthMiddleware. Permissions come from the
+// user's stored roles when the token is issued, so a role change takes effect
+// with the next token.
+func RequirePermission(perm string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasPermission(r.Context(), perm) {
+				role, _ := GetUserRoleFromContext(r.Context())
+				log.Printf("auth: permission %s denied for role=%s path=%s remote=%s", perm, role, r.URL.Path, r.RemoteAddr)
+				writeJSONError(w, "permission "+perm+" required", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
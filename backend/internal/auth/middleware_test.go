@@ -49,3 +49,69 @@ func TestAuthMiddleware_SucceedsAndFails(t *testing.T) {
 		t.Fatalf("expected 401 Unauthorized for missing token, got %d", rr2.Code)
 	}
 }
+
+func TestOptionalAuthMiddleware(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	jwt := NewJWTService()
+	uid := uuid.New()
+	tok, err := jwt.GenerateToken(uid)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	handler := OptionalAuthMiddleware(jwt, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := GetUserIDFromContext(r.Context()); ok {
+			w.Write([]byte(u.String()))
+			return
+		}
+		w.Write([]byte("anonymous"))
+	}))
+
+	for name, tc := range map[string]struct {
+		header string
+		want   string
+	}{
+		"valid token":   {"Bearer " + tok, uid.String()},
+		"no token":      {"", "anonymous"},
+		"invalid token": {"Bearer not-a-token", "anonymous"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK || rr.Body.String() != tc.want {
+			t.Errorf("%s: got %d %q, want 200 %q", name, rr.Code, rr.Body.String(), tc.want)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	jwt := NewJWTService()
+	uid := uuid.New()
+	handler := AuthMiddleware(jwt, nil)(RequirePermission("posts:update_status")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	staff, _ := jwt.GenerateTokenWithGrants(uid, "moderator", []string{"moderator", "citizen"}, []string{"issues:view_all", "posts:update_status"})
+	citizen, _ := jwt.GenerateTokenWithGrants(uid, "citizen", []string{"citizen"}, []string{})
+	legacyAdmin, _ := jwt.GenerateTokenWithRole(uid, "admin")
+
+	for name, tc := range map[string]struct {
+		token string
+		want  int
+	}{
+		"permission held":         {staff, http.StatusOK},
+		"permission missing":      {citizen, http.StatusForbidden},
+		"token without any perms": {legacyAdmin, http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/post-status", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", name, rr.Code, tc.want)
+		}
+	}
+}
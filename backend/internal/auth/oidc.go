@@ -0,0 +1,343 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GoogleJWKSURL is where Google publishes the keys it signs ID tokens with.
+const GoogleJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// GoogleIssuers are the iss values of Google ID tokens.
+var GoogleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+var (
+	// ErrInvalidIDToken is returned for ID tokens with a bad signature, wrong
+	// issuer or audience, or that have expired.
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	// ErrEmailNotVerified is returned for valid ID tokens whose email the
+	// provider has not verified.
+	ErrEmailNotVerified = errors.New("ID token email is not verified")
+	// ErrUnknownKey is returned by a KeySource that has no key with the
+	// requested key ID.
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// KeySource provides the public keys an identity provider signs ID tokens
+// with.
+type KeySource interface {
+	// Key returns the key with the given key ID (the token's kid header).
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// KeySet is a fixed set of public keys by key ID.
+type KeySet map[string]crypto.PublicKey
+
+func (s KeySet) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if k, ok := s[kid]; ok {
+		return k, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// JWK is a public key in JSON Web Key format. Only RSA and EC keys are
+// supported.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// PublicKey decodes the key.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %s: modulus: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("jwk %s: invalid exponent", k.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("jwk %s: unsupported curve %q", k.Kid, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %s: x: %w", k.Kid, err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %s: y: %w", k.Kid, err)
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("jwk %s: point not on curve", k.Kid)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("jwk %s: unsupported key type %q", k.Kid, k.Kty)
+	}
+}
+
+// ParseJWKS decodes a JSON Web Key Set document into the signing keys it
+// holds. Encryption keys and keys of unsupported types are skipped.
+func ParseJWKS(data []byte) (KeySet, error) {
+	var doc struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keys := KeySet{}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			log.Printf("jwks: skipping key: %v", err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// RemoteKeySource fetches a provider's JWKS document and caches it for the
+// response's Cache-Control max-age, or TTL if it has none. Providers rotate
+// keys by publishing the new one before signing with it, so a token naming an
+// unknown key ID triggers a refetch, at most once per MinRefreshInterval. If
+// a refetch fails the cached keys keep being used.
+type RemoteKeySource struct {
+	URL                string
+	Client             *http.Client
+	TTL                time.Duration
+	MinRefreshInterval time.Duration
+
+	mu        sync.Mutex
+	keys      KeySet
+	expires   time.Time
+	lastFetch time.Time
+	now       func() time.Time
+}
+
+func NewRemoteKeySource(url string) *RemoteKeySource {
+	return &RemoteKeySource{
+		URL:                url,
+		Client:             &http.Client{Timeout: 10 * time.Second},
+		TTL:                time.Hour,
+		MinRefreshInterval: time.Minute,
+		now:                time.Now,
+	}
+}
+
+func (s *RemoteKeySource) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if s.keys == nil || !now.Before(s.expires) {
+		if err := s.fetch(ctx, now); err != nil {
+			if s.keys == nil {
+				return nil, err
+			}
+			log.Printf("jwks: refreshing %s failed, using cached keys: %v", s.URL, err)
+		}
+	}
+	if k, ok := s.keys[kid]; ok {
+		return k, nil
+	}
+	if now.Sub(s.lastFetch) >= s.MinRefreshInterval {
+		if err := s.fetch(ctx, now); err != nil {
+			return nil, err
+		}
+		if k, ok := s.keys[kid]; ok {
+			return k, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+func (s *RemoteKeySource) fetch(ctx context.Context, now time.Time) error {
+	s.lastFetch = now
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks: %s returned %d", s.URL, resp.StatusCode)
+	}
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+	keys, err := ParseJWKS(body)
+	if err != nil {
+		return err
+	}
+	s.keys = keys
+	s.expires = now.Add(maxAge(resp.Header.Get("Cache-Control"), s.TTL))
+	return nil
+}
+
+// maxAge returns the max-age of a Cache-Control header, or def if it has none.
+func maxAge(cacheControl string, def time.Duration) time.Duration {
+	for _, d := range strings.Split(cacheControl, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(d), "=")
+		if !ok || !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return def
+}
+
+// IDTokenClaims are the verified claims of an ID token.
+type IDTokenClaims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+	// Raw holds all claims of the token.
+	Raw map[string]interface{}
+}
+
+// IDTokenVerifier verifies OpenID Connect ID tokens of one provider: the
+// signature against the provider's keys, the issuer, that the token was
+// issued to one of our client IDs, its lifetime, and that it carries a
+// verified email.
+type IDTokenVerifier struct {
+	Keys KeySource
+	// Issuers are the accepted iss values.
+	Issuers []string
+	// Audiences are our client IDs at the provider.
+	Audiences []string
+	// Leeway allows for clock skew when checking exp, nbf and iat.
+	Leeway time.Duration
+	// TrustEmail accepts the email claim without email_verified, for
+	// providers that only issue addresses they own (e.g. a city directory).
+	TrustEmail bool
+
+	now func() time.Time
+}
+
+func NewIDTokenVerifier(keys KeySource, issuers, audiences []string) *IDTokenVerifier {
+	return &IDTokenVerifier{Keys: keys, Issuers: issuers, Audiences: audiences, Leeway: time.Minute, now: time.Now}
+}
+
+// NewGoogleVerifier returns a verifier for Google ID tokens issued to the
+// given client IDs.
+func NewGoogleVerifier(keys KeySource, clientIDs []string) *IDTokenVerifier {
+	return NewIDTokenVerifier(keys, GoogleIssuers, clientIDs)
+}
+
+// Verify checks an ID token and returns its claims. Errors wrap
+// ErrInvalidIDToken or ErrEmailNotVerified.
+func (v *IDTokenVerifier) Verify(ctx context.Context, raw string) (*IDTokenClaims, error) {
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.Keys.Key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithLeeway(v.Leeway),
+		jwt.WithTimeFunc(now),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	// exp is only checked by the parser when present
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil {
+		return nil, fmt.Errorf("%w: missing exp", ErrInvalidIDToken)
+	}
+	iss, _ := claims.GetIssuer()
+	if !containsString(v.Issuers, iss) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, iss)
+	}
+	aud, _ := claims.GetAudience()
+	if !anyString(aud, v.Audiences) {
+		return nil, fmt.Errorf("%w: not issued to this client", ErrInvalidIDToken)
+	}
+	out := &IDTokenClaims{Issuer: iss, Raw: claims}
+	out.Subject, _ = claims.GetSubject()
+	out.Email, _ = claims["email"].(string)
+	out.Name, _ = claims["name"].(string)
+	out.Picture, _ = claims["picture"].(string)
+	// some providers send email_verified as a string
+	switch ev := claims["email_verified"].(type) {
+	case bool:
+		out.EmailVerified = ev
+	case string:
+		out.EmailVerified = ev == "true"
+	}
+	if out.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	if out.Email == "" || !(out.EmailVerified || v.TrustEmail) {
+		return nil, ErrEmailNotVerified
+	}
+	return out, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func anyString(list, want []string) bool {
+	for _, v := range list {
+		if containsString(want, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,359 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ErrNonceMismatch is returned when the ID token from a code exchange was not
+// issued for the sign-in that started it.
+var ErrNonceMismatch = errors.New("ID token nonce does not match")
+
+// OIDCDiscovery is the part of a provider's discovery document
+// (/.well-known/openid-configuration) the sign-in flow uses.
+type OIDCDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// OIDCProvider is an OpenID Connect identity provider users sign in with
+// through the authorization code flow with PKCE. Its endpoints and signing
+// keys come from the issuer's discovery document, fetched on first use so a
+// provider that is down at startup does not stop the server.
+type OIDCProvider struct {
+	// Name identifies the provider in URLs and linked identities.
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// RoleClaim is the ID token claim (e.g. "groups") whose values RoleMap
+	// maps to role names. Without a RoleMap the provider grants no roles.
+	RoleClaim string
+	RoleMap   map[string]string
+	// CodeFlow is whether users can be sent to the provider to sign in;
+	// providers without it only verify ID tokens posted by the frontend.
+	CodeFlow bool
+	Verifier *IDTokenVerifier
+	Client   *http.Client
+
+	mu        sync.Mutex
+	discovery *OIDCDiscovery
+	keys      *RemoteKeySource
+}
+
+// NewOIDCProvider returns a provider for the given issuer whose ID tokens must
+// be issued to clientID. The client secret may be empty for public clients.
+func NewOIDCProvider(name, issuer, clientID, clientSecret string) *OIDCProvider {
+	p := &OIDCProvider{
+		Name:         name,
+		DisplayName:  name,
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		CodeFlow:     true,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	p.Verifier = NewIDTokenVerifier(providerKeys{p}, []string{issuer}, []string{clientID})
+	return p
+}
+
+// NewGoogleProvider returns the Google provider. ID tokens issued to any of
+// clientIDs are accepted; the code flow uses the first one and is only
+// offered with a client secret.
+func NewGoogleProvider(clientIDs []string, clientSecret string) *OIDCProvider {
+	p := NewOIDCProvider("google", GoogleIssuers[0], clientIDs[0], clientSecret)
+	p.DisplayName = "Google"
+	p.CodeFlow = clientSecret != ""
+	p.Verifier = NewGoogleVerifier(NewRemoteKeySource(GoogleJWKSURL), clientIDs)
+	return p
+}
+
+// Discover returns the provider's discovery document.
+func (p *OIDCProvider) Discover(ctx context.Context) (*OIDCDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	u := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc %s: discovery: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc %s: discovery returned %d", p.Name, resp.StatusCode)
+	}
+	var d OIDCDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, fmt.Errorf("oidc %s: discovery: %w", p.Name, err)
+	}
+	if d.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc %s: discovery issuer %q does not match %q", p.Name, d.Issuer, p.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc %s: discovery document is missing endpoints", p.Name)
+	}
+	p.discovery = &d
+	p.keys = NewRemoteKeySource(d.JWKSURI)
+	p.keys.Client = p.Client
+	return p.discovery, nil
+}
+
+// providerKeys serves a provider's signing keys from the jwks_uri of its
+// discovery document.
+type providerKeys struct {
+	p *OIDCProvider
+}
+
+func (k providerKeys) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if _, err := k.p.Discover(ctx); err != nil {
+		return nil, err
+	}
+	return k.p.keys.Key(ctx, kid)
+}
+
+// AuthCodeURL returns the provider URL that starts a sign-in, returning to
+// redirectURL with the given state. nonce ends up in the ID token and
+// challenge is the PKCE S256 challenge of the flow's code verifier.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, redirectURL, state, nonce, challenge string) (string, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc %s: authorization endpoint: %w", p.Name, err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", redirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of
+// the ID token, which must carry nonce.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, redirectURL, codeVerifier, nonce string) (*IDTokenClaims, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.ClientID},
+	}
+	// client_secret_basic is the default; use client_secret_post only for
+	// providers that do not support it
+	postSecret := p.ClientSecret != "" && containsString(d.TokenAuthMethods, "client_secret_post") &&
+		!containsString(d.TokenAuthMethods, "client_secret_basic")
+	if postSecret {
+		form.Set("client_secret", p.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" && !postSecret {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc %s: token exchange: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("oidc %s: token exchange returned %d: %w", p.Name, resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return nil, fmt.Errorf("oidc %s: token exchange returned %d: %s %s", p.Name, resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	claims, err := p.Verifier.Verify(ctx, body.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if got, _ := claims.Raw["nonce"].(string); got == "" || got != nonce {
+		return nil, ErrNonceMismatch
+	}
+	return claims, nil
+}
+
+// Roles maps the values of the provider's RoleClaim to role names. It
+// returns nil for providers without a role mapping and an empty list when no
+// value maps to a role.
+func (p *OIDCProvider) Roles(claims *IDTokenClaims) []string {
+	if len(p.RoleMap) == 0 {
+		return nil
+	}
+	var values []string
+	switch v := claims.Raw[p.RoleClaim].(type) {
+	case string:
+		values = strings.Fields(strings.ReplaceAll(v, ",", " "))
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	roles := []string{}
+	for _, v := range values {
+		if role, ok := p.RoleMap[v]; ok && !containsString(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// OIDCRegistry holds the identity providers users can sign in with, by name.
+type OIDCRegistry struct {
+	providers map[string]*OIDCProvider
+	names     []string
+}
+
+func NewOIDCRegistry() *OIDCRegistry {
+	return &OIDCRegistry{providers: map[string]*OIDCProvider{}}
+}
+
+// Register adds a provider, replacing one with the same name.
+func (r *OIDCRegistry) Register(p *OIDCProvider) {
+	if _, ok := r.providers[p.Name]; !ok {
+		r.names = append(r.names, p.Name)
+	}
+	r.providers[p.Name] = p
+}
+
+// Get returns the named provider. A nil registry has none.
+func (r *OIDCRegistry) Get(name string) (*OIDCProvider, bool) {
+	if r == nil {
+		return nil, false
+	}
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Providers returns the providers in the order they were registered.
+func (r *OIDCRegistry) Providers() []*OIDCProvider {
+	if r == nil {
+		return nil
+	}
+	out := make([]*OIDCProvider, 0, len(r.names))
+	for _, n := range r.names {
+		out = append(out, r.providers[n])
+	}
+	return out
+}
+
+// NewPKCEVerifier returns a random PKCE code verifier; it is also used for
+// the state and nonce of a sign-in.
+func NewPKCEVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PKCEChallenge returns the S256 challenge of a code verifier.
+func PKCEChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// OIDCFlowState is what the server needs to finish a sign-in when the user
+// comes back from the provider. It travels in a short-lived signed cookie so
+// any instance can handle the callback.
+type OIDCFlowState struct {
+	Provider     string
+	State        string
+	Nonce        string
+	CodeVerifier string
+	// Redirect is the frontend path to return to.
+	Redirect string
+	// LinkUserID is set when a signed-in user links a new identity.
+	LinkUserID uuid.UUID
+}
+
+// SignOIDCState returns st as a signed token valid for ttl. It carries no
+// user_id claim, so it is never accepted as an access token.
+func (s *JWTService) SignOIDCState(st OIDCFlowState, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"typ":      "oidc_state",
+		"provider": st.Provider,
+		"state":    st.State,
+		"nonce":    st.Nonce,
+		"verifier": st.CodeVerifier,
+		"redirect": st.Redirect,
+		"exp":      time.Now().Add(ttl).Unix(),
+	}
+	if st.LinkUserID != uuid.Nil {
+		claims["link_user_id"] = st.LinkUserID.String()
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.secret))
+}
+
+// ParseOIDCState validates a token from SignOIDCState.
+func (s *JWTService) ParseOIDCState(tokenStr string) (OIDCFlowState, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(s.secret), nil
+	}, jwt.WithValidMethods([]string{"HS256"}))
+	if err != nil {
+		return OIDCFlowState{}, err
+	}
+	if typ, _ := claims["typ"].(string); typ != "oidc_state" {
+		return OIDCFlowState{}, errors.New("not a sign-in state token")
+	}
+	var st OIDCFlowState
+	st.Provider, _ = claims["provider"].(string)
+	st.State, _ = claims["state"].(string)
+	st.Nonce, _ = claims["nonce"].(string)
+	st.CodeVerifier, _ = claims["verifier"].(string)
+	st.Redirect, _ = claims["redirect"].(string)
+	if v, ok := claims["link_user_id"].(string); ok {
+		if id, err := uuid.Parse(v); err == nil {
+			st.LinkUserID = id
+		}
+	}
+	return st, nil
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = kid
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return s
+}
+
+func googleClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            "client-1",
+		"sub":            "1234567890",
+		"email":          "ana@example.com",
+		"email_verified": true,
+		"name":           "Ana",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+func jwksJSON(keys map[string]*rsa.PrivateKey) []byte {
+	var doc struct {
+		Keys []JWK `json:"keys"`
+	}
+	for kid, k := range keys {
+		doc.Keys = append(doc.Keys, JWK{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		})
+	}
+	b, _ := json.Marshal(doc)
+	return b
+}
+
+func TestIDTokenVerifier(t *testing.T) {
+	key := newTestKey(t)
+	other := newTestKey(t)
+	keys, err := ParseJWKS(jwksJSON(map[string]*rsa.PrivateKey{"k1": key}))
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("parse jwks: %v %d", err, len(keys))
+	}
+	v := NewGoogleVerifier(keys, []string{"client-1"})
+	now := time.Now()
+	ctx := context.Background()
+
+	claims, err := v.Verify(ctx, signIDToken(t, key, "k1", googleClaims(now)))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if claims.Email != "ana@example.com" || claims.Subject != "1234567890" || claims.Name != "Ana" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	cases := []struct {
+		name   string
+		kid    string
+		key    *rsa.PrivateKey
+		mutate func(jwt.MapClaims)
+		want   error
+	}{
+		{"wrong audience", "k1", key, func(c jwt.MapClaims) { c["aud"] = "someone-else" }, ErrInvalidIDToken},
+		{"wrong issuer", "k1", key, func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, ErrInvalidIDToken},
+		{"expired", "k1", key, func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() }, ErrInvalidIDToken},
+		{"no expiry", "k1", key, func(c jwt.MapClaims) { delete(c, "exp") }, ErrInvalidIDToken},
+		{"forged signature", "k1", other, func(jwt.MapClaims) {}, ErrInvalidIDToken},
+		{"unknown key", "k2", other, func(jwt.MapClaims) {}, ErrInvalidIDToken},
+		{"unverified email", "k1", key, func(c jwt.MapClaims) { c["email_verified"] = false }, ErrEmailNotVerified},
+		{"string email_verified", "k1", key, func(c jwt.MapClaims) { c["email_verified"] = "false" }, ErrEmailNotVerified},
+		{"missing email", "k1", key, func(c jwt.MapClaims) { delete(c, "email") }, ErrEmailNotVerified},
+	}
+	for _, tc := range cases {
+		c := googleClaims(now)
+		tc.mutate(c)
+		if _, err := v.Verify(ctx, signIDToken(t, tc.key, tc.kid, c)); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	// An HMAC token signed with the public key must not pass as RS256.
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, googleClaims(now))
+	hs.Header["kid"] = "k1"
+	forged, _ := hs.SignedString(key.PublicKey.N.Bytes())
+	if _, err := v.Verify(ctx, forged); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("expected HS256 token to be rejected, got %v", err)
+	}
+}
+
+func TestRemoteKeySourceCachingAndRotation(t *testing.T) {
+	key1 := newTestKey(t)
+	key2 := newTestKey(t)
+	var served atomic.Value
+	served.Store(jwksJSON(map[string]*rsa.PrivateKey{"k1": key1}))
+	var fetches, failing int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=300, must-revalidate")
+		w.Write(served.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	src := NewRemoteKeySource(srv.URL)
+	src.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := src.Key(ctx, "k1"); err != nil {
+			t.Fatalf("key k1: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("expected the key set to be cached, got %d fetches", n)
+	}
+
+	// The provider rotates to k2: the unknown kid triggers one refetch.
+	served.Store(jwksJSON(map[string]*rsa.PrivateKey{"k1": key1, "k2": key2}))
+	now = now.Add(2 * time.Minute)
+	if _, err := src.Key(ctx, "k2"); err != nil {
+		t.Fatalf("key k2 after rotation: %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Fatalf("expected a refetch for the new key, got %d fetches", n)
+	}
+	// Unknown kids do not refetch more than once per MinRefreshInterval.
+	if _, err := src.Key(ctx, "k3"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Fatalf("expected no refetch within the minimum interval, got %d fetches", n)
+	}
+
+	// After max-age the set is refetched; if that fails the cached keys stay.
+	atomic.StoreInt32(&failing, 1)
+	now = now.Add(6 * time.Minute)
+	if _, err := src.Key(ctx, "k2"); err != nil {
+		t.Fatalf("expected cached keys while the provider is down: %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 3 {
+		t.Fatalf("expected a refetch after max-age, got %d fetches", n)
+	}
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cooldowns lets an action happen at most once per TTL for each key. Claims
+// are kept in Redis when configured, so all instances share them, and in
+// process memory otherwise.
+type Cooldowns struct {
+	Client *redis.Client
+	Prefix string
+	TTL    time.Duration
+
+	mu    sync.Mutex
+	until map[string]time.Time
+	now   func() time.Time
+}
+
+func NewCooldowns(rdb *redis.Client, prefix string, ttl time.Duration) *Cooldowns {
+	return &Cooldowns{Client: rdb, Prefix: prefix, TTL: ttl, until: make(map[string]time.Time), now: time.Now}
+}
+
+// Claim reports whether the action for key may run now, and if so starts its
+// cooldown. A TTL of zero or less disables the cooldown.
+func (c *Cooldowns) Claim(ctx context.Context, key string) (bool, error) {
+	if c.TTL <= 0 {
+		return true, nil
+	}
+	if c.Client != nil {
+		return c.Client.SetNX(ctx, "cooldown:"+c.Prefix+":"+key, "1", c.TTL).Result()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for k, t := range c.until {
+		if !now.Before(t) {
+			delete(c.until, k)
+		}
+	}
+	if _, held := c.until[key]; held {
+		return false, nil
+	}
+	c.until[key] = now.Add(c.TTL)
+	return true, nil
+}
@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCooldownsInProcess(t *testing.T) {
+	ctx := context.Background()
+	c := NewCooldowns(nil, "test", time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	if ok, err := c.Claim(ctx, "a"); !ok || err != nil {
+		t.Fatalf("first claim: %v %v", ok, err)
+	}
+	if ok, _ := c.Claim(ctx, "a"); ok {
+		t.Fatal("expected a second claim within the cooldown to be refused")
+	}
+	if ok, _ := c.Claim(ctx, "b"); !ok {
+		t.Fatal("expected another key to be claimable")
+	}
+	now = now.Add(time.Minute)
+	if ok, _ := c.Claim(ctx, "a"); !ok {
+		t.Fatal("expected the key to be claimable after the cooldown")
+	}
+	if ok, _ := NewCooldowns(nil, "test", 0).Claim(ctx, "a"); !ok {
+		t.Fatal("expected a zero TTL to disable the cooldown")
+	}
+}
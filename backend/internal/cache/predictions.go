@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PredictionEntry is a cached ML result. Urgency and Score are set for text
+// predictions, Class for image classifications. Stores fill in ExpiresAt on
+// Get; it is zero for entries that never expire or whose expiry is unknown.
+type PredictionEntry struct {
+	ModelID   string    `json:"model_id"`
+	Urgency   int       `json:"urgency,omitempty"`
+	Score     float64   `json:"score,omitempty"`
+	Class     string    `json:"class,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// PredictionStore is a cache tier for ML predictions. Get reports a miss with
+// ok=false and a nil error. Invalidate drops every entry of a model, which is
+// used when the deployed model version changes.
+type PredictionStore interface {
+	Get(ctx context.Context, key string) (PredictionEntry, bool, error)
+	Set(ctx context.Context, key string, e PredictionEntry, ttl time.Duration) error
+	Invalidate(ctx context.Context, modelID string) error
+}
+
+// NormalizeText folds case and whitespace so trivially different texts share
+// a cache entry.
+func NormalizeText(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// PredictionKey returns the cache key for input scored by modelID. Both parts
+// are hashed so keys have a fixed length; the model prefix allows
+// invalidating one model with a key pattern.
+func PredictionKey(modelID, input string) string {
+	in := sha256.Sum256([]byte(input))
+	return modelKeyPrefix(modelID) + hex.EncodeToString(in[:])
+}
+
+func modelKeyPrefix(modelID string) string {
+	m := sha256.Sum256([]byte(modelID))
+	return "pred:" + hex.EncodeToString(m[:6]) + ":"
+}
+
+// RedisPredictionStore keeps predictions in Redis as JSON values.
+type RedisPredictionStore struct {
+	Client *redis.Client
+}
+
+func NewRedisPredictionStore(rdb *redis.Client) *RedisPredictionStore {
+	return &RedisPredictionStore{Client: rdb}
+}
+
+func (s *RedisPredictionStore) Get(ctx context.Context, key string) (PredictionEntry, bool, error) {
+	var e PredictionEntry
+	b, err := s.Client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return e, false, nil
+	}
+	if err != nil {
+		return e, false, err
+	}
+	if err := json.Unmarshal(b, &e); err != nil {
+		return e, false, err
+	}
+	return e, true, nil
+}
+
+func (s *RedisPredictionStore) Set(ctx context.Context, key string, e PredictionEntry, ttl time.Duration) error {
+	e.ExpiresAt = time.Time{}
+	if ttl > 0 {
+		e.ExpiresAt = time.Now().Add(ttl)
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.Client.Set(ctx, key, b, ttl).Err()
+}
+
+func (s *RedisPredictionStore) Invalidate(ctx context.Context, modelID string) error {
+	iter := s.Client.Scan(ctx, 0, modelKeyPrefix(modelID)+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		if err := s.Client.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// LRUPredictionStore is a bounded in-process cache used when Redis is not
+// configured. Entries expire after their TTL; the least recently used entry
+// is evicted once Capacity is reached.
+type LRUPredictionStore struct {
+	Capacity int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+type lruItem struct {
+	key       string
+	entry     PredictionEntry
+	expiresAt time.Time
+}
+
+func NewLRUPredictionStore(capacity int) *LRUPredictionStore {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &LRUPredictionStore{
+		Capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+func (s *LRUPredictionStore) Get(_ context.Context, key string) (PredictionEntry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return PredictionEntry{}, false, nil
+	}
+	it := el.Value.(*lruItem)
+	if !it.expiresAt.IsZero() && !s.now().Before(it.expiresAt) {
+		s.removeElement(el)
+		return PredictionEntry{}, false, nil
+	}
+	s.ll.MoveToFront(el)
+	e := it.entry
+	e.ExpiresAt = it.expiresAt
+	return e, true, nil
+}
+
+func (s *LRUPredictionStore) Set(_ context.Context, key string, e PredictionEntry, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = s.now().Add(ttl)
+	}
+	if el, ok := s.items[key]; ok {
+		el.Value = &lruItem{key: key, entry: e, expiresAt: expiresAt}
+		s.ll.MoveToFront(el)
+		return nil
+	}
+	s.items[key] = s.ll.PushFront(&lruItem{key: key, entry: e, expiresAt: expiresAt})
+	for s.ll.Len() > s.Capacity {
+		s.removeElement(s.ll.Back())
+	}
+	return nil
+}
+
+func (s *LRUPredictionStore) Invalidate(_ context.Context, modelID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for el := s.ll.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*lruItem).entry.ModelID == modelID {
+			s.removeElement(el)
+		}
+		el = next
+	}
+	return nil
+}
+
+// Len returns the number of entries currently held, including expired ones
+// not yet evicted.
+func (s *LRUPredictionStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
+
+func (s *LRUPredictionStore) removeElement(el *list.Element) {
+	s.ll.Remove(el)
+	delete(s.items, el.Value.(*lruItem).key)
+}
+
+// TieredPredictionStore reads through its tiers in order (fastest first) and
+// copies a hit from a slower tier into the faster ones for the time the hit
+// has left, or for TTL if its expiry is unknown. Writes and invalidations go
+// to every tier.
+type TieredPredictionStore struct {
+	Tiers []PredictionStore
+	TTL   time.Duration
+
+	now func() time.Time
+}
+
+func NewTieredPredictionStore(ttl time.Duration, tiers ...PredictionStore) *TieredPredictionStore {
+	return &TieredPredictionStore{Tiers: tiers, TTL: ttl, now: time.Now}
+}
+
+func (s *TieredPredictionStore) Get(ctx context.Context, key string) (PredictionEntry, bool, error) {
+	var firstErr error
+	for i, tier := range s.Tiers {
+		e, ok, err := tier.Get(ctx, key)
+		if err != nil {
+			// a broken tier should not hide the others
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if ok {
+			ttl := s.TTL
+			if !e.ExpiresAt.IsZero() {
+				ttl = e.ExpiresAt.Sub(s.now())
+			}
+			if ttl > 0 {
+				for _, faster := range s.Tiers[:i] {
+					_ = faster.Set(ctx, key, e, ttl)
+				}
+			}
+			return e, true, nil
+		}
+	}
+	return PredictionEntry{}, false, firstErr
+}
+
+func (s *TieredPredictionStore) Set(ctx context.Context, key string, e PredictionEntry, ttl time.Duration) error {
+	var firstErr error
+	for _, tier := range s.Tiers {
+		if err := tier.Set(ctx, key, e, ttl); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (s *TieredPredictionStore) Invalidate(ctx context.Context, modelID string) error {
+	var firstErr error
+	for _, tier := range s.Tiers {
+		if err := tier.Invalidate(ctx, modelID); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRUPredictionStoreEvictsAndExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewLRUPredictionStore(2)
+	s.now = func() time.Time { return now }
+
+	s.Set(ctx, "a", PredictionEntry{ModelID: "m1", Urgency: 1}, time.Minute)
+	s.Set(ctx, "b", PredictionEntry{ModelID: "m1", Urgency: 2}, time.Minute)
+	s.Get(ctx, "a") // a becomes most recently used
+	s.Set(ctx, "c", PredictionEntry{ModelID: "m2", Urgency: 3}, time.Minute)
+
+	if _, ok, _ := s.Get(ctx, "b"); ok {
+		t.Error("expected b to be evicted as least recently used")
+	}
+	if e, ok, _ := s.Get(ctx, "a"); !ok || e.Urgency != 1 {
+		t.Errorf("expected a to be cached, got %+v %v", e, ok)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := s.Get(ctx, "a"); ok {
+		t.Error("expected a to have expired")
+	}
+}
+
+func TestLRUPredictionStoreInvalidatesModel(t *testing.T) {
+	ctx := context.Background()
+	s := NewLRUPredictionStore(10)
+	s.Set(ctx, PredictionKey("m1", "x"), PredictionEntry{ModelID: "m1"}, time.Minute)
+	s.Set(ctx, PredictionKey("m1", "y"), PredictionEntry{ModelID: "m1"}, time.Minute)
+	s.Set(ctx, PredictionKey("m2", "x"), PredictionEntry{ModelID: "m2"}, time.Minute)
+
+	s.Invalidate(ctx, "m1")
+	if s.Len() != 1 {
+		t.Fatalf("expected only the m2 entry to remain, have %d entries", s.Len())
+	}
+	if _, ok, _ := s.Get(ctx, PredictionKey("m2", "x")); !ok {
+		t.Error("m2 entry should survive invalidating m1")
+	}
+}
+
+func TestTieredPredictionStorePromotesHits(t *testing.T) {
+	ctx := context.Background()
+	fast, slow := NewLRUPredictionStore(10), NewLRUPredictionStore(10)
+	s := NewTieredPredictionStore(time.Minute, fast, slow)
+
+	slow.Set(ctx, "k", PredictionEntry{ModelID: "m", Score: 0.7}, time.Minute)
+	e, ok, err := s.Get(ctx, "k")
+	if err != nil || !ok || e.Score != 0.7 {
+		t.Fatalf("expected hit from slow tier, got %+v %v %v", e, ok, err)
+	}
+	if _, ok, _ := fast.Get(ctx, "k"); !ok {
+		t.Error("expected hit to be copied into the fast tier")
+	}
+}
+
+func TestTieredPredictionStoreKeepsRemainingTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	fast, slow := NewLRUPredictionStore(10), NewLRUPredictionStore(10)
+	fast.now, slow.now = clock, clock
+	s := NewTieredPredictionStore(time.Hour, fast, slow)
+	s.now = clock
+
+	slow.Set(ctx, "k", PredictionEntry{ModelID: "m", Score: 0.7}, time.Minute)
+	now = now.Add(50 * time.Second)
+	if _, ok, _ := s.Get(ctx, "k"); !ok {
+		t.Fatal("expected hit from slow tier")
+	}
+	if _, ok, _ := fast.Get(ctx, "k"); !ok {
+		t.Fatal("expected hit to be copied into the fast tier")
+	}
+
+	now = now.Add(20 * time.Second)
+	if _, ok, _ := fast.Get(ctx, "k"); ok {
+		t.Error("expected the copy to expire with the slow tier's entry, not a fresh TTL later")
+	}
+}
+
+func TestPredictionKeyNormalization(t *testing.T) {
+	a := PredictionKey("m", NormalizeText("  Water   LEAK near\tschool "))
+	b := PredictionKey("m", NormalizeText("water leak near school"))
+	if a != b {
+		t.Error("expected normalized texts to share a key")
+	}
+	if a == PredictionKey("other", NormalizeText("water leak near school")) {
+		t.Error("expected different models to use different keys")
+	}
+}
@@ -0,0 +1,51 @@
+package geo
+
+import "math"
+
+// earthRadiusM is the mean Earth radius in meters used for haversine distances.
+const earthRadiusM = 6371000.0
+
+// BBox is an axis-aligned latitude/longitude rectangle.
+type BBox struct {
+	MinLat float64
+	MinLng float64
+	MaxLat float64
+	MaxLng float64
+}
+
+// Contains reports whether the point lies inside the box (edges included).
+func (b BBox) Contains(lat, lng float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+}
+
+// HaversineMeters returns the great-circle distance between two points in meters.
+func HaversineMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusM * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// BoundingBox returns a box that fully contains the circle of radiusM meters
+// around the point. It is used to pre-filter rows with plain comparisons (which
+// any database can answer from a B-tree index) before computing exact distances.
+func BoundingBox(lat, lng, radiusM float64) BBox {
+	dLat := radiusM / earthRadiusM * 180 / math.Pi
+	// Longitude degrees shrink towards the poles; guard against cos(90°) = 0.
+	cosLat := math.Cos(toRad(lat))
+	if cosLat < 1e-6 {
+		cosLat = 1e-6
+	}
+	dLng := dLat / cosLat
+	return BBox{
+		MinLat: math.Max(-90, lat-dLat),
+		MinLng: math.Max(-180, lng-dLng),
+		MaxLat: math.Min(90, lat+dLat),
+		MaxLng: math.Min(180, lng+dLng),
+	}
+}
+
+func toRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
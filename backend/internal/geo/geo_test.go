@@ -0,0 +1,46 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversineMeters(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want                   float64
+		tolerance              float64
+	}{
+		{name: "same point", lat1: 26.9, lng1: 75.8, lat2: 26.9, lng2: 75.8, want: 0, tolerance: 0.001},
+		{name: "about 20m north", lat1: 26.9, lng1: 75.8, lat2: 26.90018, lng2: 75.8, want: 20, tolerance: 0.5},
+		{name: "one degree of longitude at the equator", lat1: 0, lng1: 0, lat2: 0, lng2: 1, want: 111195, tolerance: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HaversineMeters(tt.lat1, tt.lng1, tt.lat2, tt.lng2)
+			if math.Abs(got-tt.want) > tt.tolerance {
+				t.Errorf("HaversineMeters = %.2f, want %.2f ± %.2f", got, tt.want, tt.tolerance)
+			}
+		})
+	}
+}
+
+func TestBoundingBoxContainsRadius(t *testing.T) {
+	lat, lng, radius := 26.9, 75.8, 100.0
+	box := BoundingBox(lat, lng, radius)
+	// Points exactly radius meters away in each direction must be inside the box.
+	for _, p := range [][2]float64{
+		{lat + 0.0009, lng},
+		{lat - 0.0009, lng},
+		{lat, lng + 0.001},
+		{lat, lng - 0.001},
+	} {
+		if HaversineMeters(lat, lng, p[0], p[1]) <= radius && !box.Contains(p[0], p[1]) {
+			t.Errorf("point %v within %.0fm not contained in %+v", p, radius, box)
+		}
+	}
+	if box.Contains(lat+0.01, lng) {
+		t.Errorf("point ~1.1km away should be outside %+v", box)
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+)
+
+// accountMailTimeout bounds sending a password reset email, which happens
+// after the response is written.
+const accountMailTimeout = 30 * time.Second
+
+const forgotPasswordMessage = "if an account exists for this email, a password reset link has been sent"
+
+type verifyEmailReq struct {
+	Token string `json:"token"`
+}
+
+type forgotPasswordReq struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// VerifyEmail handles POST /auth/verify-email with the token from the
+// verification email.
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if h.Accounts == nil {
+		http.Error(w, "email verification is disabled", http.StatusNotFound)
+		return
+	}
+	var req verifyEmailReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	user, err := h.Accounts.VerifyEmail(req.Token)
+	if err != nil {
+		h.accountError(w, "verify email", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message":           "email verified",
+		"email_verified_at": user.EmailVerifiedAt,
+	})
+}
+
+// ResendVerification handles POST /auth/verify-email/resend, mailing the
+// caller a new verification link.
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok || h.Accounts == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.AuthService.UserRepo.GetByID(userID)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		writeJSON(w, http.StatusOK, map[string]string{"message": "email already verified"})
+		return
+	}
+	if err := h.Accounts.SendVerification(r.Context(), user); err != nil {
+		log.Printf("verify email: cannot send to user %s: %v", user.ID, err)
+		http.Error(w, "failed to send verification email", http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "verification email sent"})
+}
+
+// ForgotPassword handles POST /auth/forgot-password. The response is the same
+// whether or not an account has the email, and the email is sent after
+// responding, so neither the answer nor its timing reveals accounts. While an
+// address is in its ResetCooldowns cooldown, requests for it send nothing.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if h.Accounts == nil {
+		http.Error(w, "password reset is disabled", http.StatusNotFound)
+		return
+	}
+	var req forgotPasswordReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if h.ResetCooldowns != nil {
+		sum := sha256.Sum256([]byte(strings.ToLower(email)))
+		ok, err := h.ResetCooldowns.Claim(r.Context(), hex.EncodeToString(sum[:]))
+		if err != nil {
+			// better an extra email than none while Redis is unavailable
+			log.Printf("forgot password: cooldown: %v", err)
+		} else if !ok {
+			writeJSON(w, http.StatusAccepted, map[string]string{"message": forgotPasswordMessage})
+			return
+		}
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), accountMailTimeout)
+		defer cancel()
+		if err := h.Accounts.RequestPasswordReset(ctx, email); err != nil {
+			log.Printf("forgot password: %v", err)
+		}
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": forgotPasswordMessage})
+}
+
+// ResetPassword handles POST /auth/reset-password with the token from the
+// reset email and the new password. All of the user's sessions are signed
+// out.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if h.Accounts == nil {
+		http.Error(w, "password reset is disabled", http.StatusNotFound)
+		return
+	}
+	var req resetPasswordReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := h.Accounts.ResetPassword(req.Token, req.Password); err != nil {
+		h.accountError(w, "reset password", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "password updated, please sign in again"})
+}
+
+// RequireVerifiedEmail wraps next so only users with a verified email get
+// through; it runs after AuthMiddleware.
+func (h *AuthHandler) RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, err := h.AuthService.UserRepo.GetByID(userID)
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if user.EmailVerifiedAt == nil {
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"error": "email_not_verified",
+				"message": "please verify your email address first; " +
+					"POST /auth/verify-email/resend sends a new link",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *AuthHandler) accountError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidActionToken), errors.Is(err, services.ErrWeakPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrActionTokenUsed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("%s: %v", action, err)
+		http.Error(w, "request failed", http.StatusInternalServerError)
+	}
+}
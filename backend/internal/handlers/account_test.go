@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/cache"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/mail"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+)
+
+// recordingMailer hands sent messages to the test.
+type recordingMailer struct {
+	sent chan mail.Message
+}
+
+func (m *recordingMailer) Send(_ context.Context, msg mail.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+func (m *recordingMailer) next(t *testing.T) mail.Message {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email sent")
+		return mail.Message{}
+	}
+}
+
+var linkToken = regexp.MustCompile(`https://civic\.example\.com/([a-z-]+)\.html\?token=(\S+)`)
+
+// linkIn returns the page and token of the link in an account email.
+func linkIn(t *testing.T, msg mail.Message) (page, token string) {
+	t.Helper()
+	m := linkToken.FindStringSubmatch(msg.Body)
+	if m == nil {
+		t.Fatalf("no link in email %q", msg.Body)
+	}
+	token, err := url.QueryUnescape(m[2])
+	if err != nil {
+		t.Fatalf("unescape token: %v", err)
+	}
+	return m[1], token
+}
+
+func TestEmailVerificationAndPasswordReset(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	db := setupReportDB(t, "accounts")
+	setupSessionTables(t, db)
+	userRepo := repository.NewUserRepository(db)
+	authSvc := services.NewAuthService(userRepo)
+	jwtSvc := auth.NewJWTService()
+	mailer := &recordingMailer{sent: make(chan mail.Message, 4)}
+
+	authHandler := NewAuthHandler(authSvc, jwtSvc, nil)
+	authHandler.Sessions = services.NewSessionService(repository.NewSessionRepository(db), 24*time.Hour)
+	authHandler.Accounts = services.NewAccountService(userRepo, jwtSvc, mailer, "https://civic.example.com")
+	authHandler.Accounts.Sessions = authHandler.Sessions
+	authHandler.ResetCooldowns = cache.NewCooldowns(nil, "reset", time.Hour)
+	authMw := auth.AuthMiddleware(jwtSvc, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /register", authHandler.Register)
+	mux.HandleFunc("POST /login", authHandler.Login)
+	mux.HandleFunc("POST /auth/refresh", authHandler.Refresh)
+	mux.HandleFunc("POST /auth/verify-email", authHandler.VerifyEmail)
+	mux.HandleFunc("POST /auth/forgot-password", authHandler.ForgotPassword)
+	mux.HandleFunc("POST /auth/reset-password", authHandler.ResetPassword)
+	mux.Handle("POST /auth/verify-email/resend", authMw(http.HandlerFunc(authHandler.ResendVerification)))
+	mux.Handle("POST /report", authMw(authHandler.RequireVerifiedEmail(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))))
+
+	do := func(path, token string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(http.MethodPost, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	login := func(password string) (tokenResp, int) {
+		rr := do("/login", "", loginReq{Email: "lee@example.com", Password: password})
+		var tr tokenResp
+		json.NewDecoder(rr.Body).Decode(&tr)
+		return tr, rr.Code
+	}
+
+	// Registering mails a verification link; reporting waits for it.
+	rr := do("/register", "", registerReq{Name: "Lee", Email: "lee@example.com", Password: "first-pass"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("register: %d %s", rr.Code, rr.Body.String())
+	}
+	var session tokenResp
+	json.NewDecoder(rr.Body).Decode(&session)
+	msg := mailer.next(t)
+	page, verifyToken := linkIn(t, msg)
+	if msg.To != "lee@example.com" || page != "verify-email" {
+		t.Fatalf("unexpected verification email %+v", msg)
+	}
+	if rr := do("/report", session.AccessToken, nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected reporting to need a verified email, got %d", rr.Code)
+	}
+	if rr := do("/auth/verify-email/resend", session.AccessToken, nil); rr.Code != http.StatusAccepted {
+		t.Fatalf("resend: %d", rr.Code)
+	}
+	mailer.next(t)
+
+	if rr := do("/auth/reset-password", "", resetPasswordReq{Token: verifyToken, Password: "other-pass"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a verification token to be refused for a reset, got %d", rr.Code)
+	}
+	if rr := do("/auth/verify-email", "", verifyEmailReq{Token: verifyToken}); rr.Code != http.StatusOK {
+		t.Fatalf("verify: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do("/auth/verify-email", "", verifyEmailReq{Token: verifyToken}); rr.Code != http.StatusConflict {
+		t.Fatalf("expected a used verification link to be refused, got %d", rr.Code)
+	}
+	if rr := do("/report", session.AccessToken, nil); rr.Code != http.StatusCreated {
+		t.Fatalf("expected a verified user to report, got %d", rr.Code)
+	}
+
+	// Forgot password answers the same for unknown emails and sends nothing.
+	if rr := do("/auth/forgot-password", "", forgotPasswordReq{Email: "nobody@example.com"}); rr.Code != http.StatusAccepted {
+		t.Fatalf("forgot password (unknown): %d", rr.Code)
+	}
+	if rr := do("/auth/forgot-password", "", forgotPasswordReq{Email: "lee@example.com"}); rr.Code != http.StatusAccepted {
+		t.Fatalf("forgot password: %d", rr.Code)
+	}
+	msg = mailer.next(t)
+	page, resetToken := linkIn(t, msg)
+	if msg.To != "lee@example.com" || page != "reset-password" {
+		t.Fatalf("unexpected reset email %+v", msg)
+	}
+	// Asking again during the cooldown answers the same but sends nothing.
+	if rr := do("/auth/forgot-password", "", forgotPasswordReq{Email: "LEE@example.com"}); rr.Code != http.StatusAccepted {
+		t.Fatalf("forgot password again: %d", rr.Code)
+	}
+	select {
+	case msg := <-mailer.sent:
+		t.Fatalf("expected no email during the cooldown, got %+v", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if rr := do("/auth/reset-password", "", resetPasswordReq{Token: resetToken, Password: "short"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a short password to be refused, got %d", rr.Code)
+	}
+	if rr := do("/auth/reset-password", "", resetPasswordReq{Token: resetToken + "x", Password: "second-pass"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a tampered token to be refused, got %d", rr.Code)
+	}
+	if rr := do("/auth/reset-password", "", resetPasswordReq{Token: resetToken, Password: "second-pass"}); rr.Code != http.StatusOK {
+		t.Fatalf("reset: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do("/auth/reset-password", "", resetPasswordReq{Token: resetToken, Password: "third-pass"}); rr.Code != http.StatusConflict {
+		t.Fatalf("expected a used reset link to be refused, got %d", rr.Code)
+	}
+	if _, code := login("first-pass"); code != http.StatusUnauthorized {
+		t.Fatalf("expected the old password to stop working, got %d", code)
+	}
+	if _, code := login("second-pass"); code != http.StatusOK {
+		t.Fatalf("expected the new password to work, got %d", code)
+	}
+	// Sessions from before the reset are signed out.
+	if rr := do("/auth/refresh", "", refreshReq{RefreshToken: session.RefreshToken}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the old session to be revoked, got %d", rr.Code)
+	}
+}
@@ -2,24 +2,46 @@ package handlers
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
+	"log"
 	"time"
 
 	config "crowdsourcedurbanissuereportingwithai/backend/configs"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/cache"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
 	"encoding/json"
 	"net/http"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
 	AuthService *services.AuthService
 	JWTService  *auth.JWTService
 	RedisClient *redis.Client
+	// Roles resolves the roles put into issued tokens; without it every user
+	// is a citizen.
+	Roles *services.RoleService
+	// Sessions issues refresh tokens at sign-in; without it only access
+	// tokens are issued.
+	Sessions *services.SessionService
+	// Providers are the identity providers users can sign in with; the
+	// "google" provider also verifies ID tokens sent to /google-login.
+	Providers *auth.OIDCRegistry
+	// Identities links provider accounts to users; sign-in through providers
+	// needs it.
+	Identities *services.IdentityService
+	// Accounts sends verification and password reset emails; without it
+	// those endpoints are unavailable.
+	Accounts *services.AccountService
+	// ResetCooldowns limits how often password reset emails go to one
+	// address; without it every request sends one.
+	ResetCooldowns *cache.Cooldowns
 }
 
 func NewAuthHandler(authSvc *services.AuthService, jwtSvc *auth.JWTService, rdb *redis.Client) *AuthHandler {
@@ -38,25 +60,102 @@ type loginReq struct {
 }
 
 type tokenResp struct {
-	AccessToken string `json:"access_token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// ExpiresIn is the access token lifetime in seconds, sent along with a
+	// refresh token so clients know when to refresh.
+	ExpiresIn int64 `json:"expires_in,omitempty"`
 }
 
-// GoogleLoginRequest allows sign-in/up using a trusted identity provider (Google)
+type refreshReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshCookieName is the HttpOnly cookie holding the refresh token. It is
+// only sent to /auth/ endpoints.
+const refreshCookieName = "refresh_token"
+
+// signIn issues the tokens for a user who just signed in. With sessions
+// enabled it starts a session, sets the refresh token cookie and includes the
+// refresh token in the response.
+func (h *AuthHandler) signIn(w http.ResponseWriter, r *http.Request, user *models.User) (tokenResp, error) {
+	var resp tokenResp
+	sessionID := uuid.Nil
+	if h.Sessions != nil {
+		session, refresh, err := h.Sessions.Start(user.ID, r.UserAgent(), r.RemoteAddr)
+		if err != nil {
+			return resp, err
+		}
+		sessionID = session.ID
+		resp.RefreshToken = refresh
+		resp.ExpiresIn = int64(h.JWTService.AccessTokenTTL().Seconds())
+		http.SetCookie(w, authCookie(refreshCookieName, refresh, "/auth", session.ExpiresAt))
+	}
+	token, err := h.issueToken(user, sessionID)
+	resp.AccessToken = token
+	return resp, err
+}
+
+// issueToken returns an access token carrying the user's stored roles and
+// permissions, tied to the given session (uuid.Nil for none).
+func (h *AuthHandler) issueToken(user *models.User, sessionID uuid.UUID) (string, error) {
+	grants := services.Grants{Role: models.RoleCitizen, Roles: []string{models.RoleCitizen}, Permissions: []string{}}
+	if h.Roles != nil {
+		var err error
+		if grants, err = h.Roles.GrantsFor(user); err != nil {
+			return "", err
+		}
+	}
+	return h.JWTService.IssueToken(auth.TokenClaims{
+		UserID:      user.ID,
+		Role:        grants.Role,
+		Roles:       grants.Roles,
+		Permissions: grants.Permissions,
+		SessionID:   sessionID,
+	})
+}
+
+// authCookie returns an HttpOnly cookie for a token. If ALLOWED_ORIGIN is
+// configured (cross-origin) it is SameSite=None, and Secure unless the origin
+// is local; otherwise SameSite=Lax.
+func authCookie(name, value, path string, expires time.Time) *http.Cookie {
+	c := &http.Cookie{Name: name, Value: value, Path: path, Expires: expires, HttpOnly: true}
+	if value == "" {
+		c.MaxAge = -1
+	}
+	if ao := config.GetAllowedOrigin(); ao != "" {
+		c.SameSite = http.SameSiteNoneMode
+		if !strings.Contains(ao, "localhost") && !strings.Contains(ao, "127.0.0.1") {
+			c.Secure = true
+		}
+	} else {
+		c.SameSite = http.SameSiteLaxMode
+	}
+	return c
+}
+
+// googleLoginReq carries the ID token (credential) Google Identity Services
+// hands the page after sign-in.
 type googleLoginReq struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Credential string `json:"credential"`
 }
 
-// GoogleLogin finds or creates a user by email (from verified Google identity)
-// and returns a JWT. This avoids password handling for social sign-in.
+// GoogleLogin verifies a Google ID token, finds or creates the user with its
+// verified email and returns a JWT. This avoids password handling for social
+// sign-in.
 func (h *AuthHandler) GoogleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	google, ok := h.Providers.Get("google")
+	if !ok || h.Identities == nil {
+		http.Error(w, "google sign-in is not configured", http.StatusServiceUnavailable)
+		return
+	}
 	// Two forms accepted:
-	// 1) application/json: { name, email }
-	// 2) form POST from Google redirect: credential=<JWT>
+	// 1) application/json: { credential } from the JS callback
+	// 2) form POST from Google redirect: credential=<JWT>&g_csrf_token=...
 	var req googleLoginReq
 	ct := r.Header.Get("Content-Type")
 	if strings.Contains(ct, "application/json") {
@@ -64,89 +163,55 @@ func (h *AuthHandler) GoogleLogin(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "invalid request", http.StatusBadRequest)
 			return
 		}
-		if strings.TrimSpace(req.Email) == "" {
-			http.Error(w, "email is required", http.StatusBadRequest)
-			return
-		}
 	} else {
 		// Assume form post
 		if err := r.ParseForm(); err != nil {
 			http.Error(w, "invalid form", http.StatusBadRequest)
 			return
 		}
-		if idToken := r.FormValue("credential"); idToken != "" {
-			// Decode JWT payload (unverified) to extract email/name for demo purposes
-			// Format: header.payload.signature (base64url)
-			parts := strings.Split(idToken, ".")
-			if len(parts) >= 2 {
-				payloadB64 := parts[1]
-				// base64url decode
-				payloadB64 = strings.ReplaceAll(payloadB64, "-", "+")
-				payloadB64 = strings.ReplaceAll(payloadB64, "_", "/")
-				// add padding
-				switch len(payloadB64) % 4 {
-				case 2:
-					payloadB64 += "=="
-				case 3:
-					payloadB64 += "="
-				}
-				if decoded, err := base64.StdEncoding.DecodeString(payloadB64); err == nil {
-					var claims map[string]any
-					if json.Unmarshal(decoded, &claims) == nil {
-						if v, ok := claims["email"].(string); ok {
-							req.Email = v
-						}
-						if v, ok := claims["name"].(string); ok {
-							req.Name = v
-						}
-					}
-				}
-			}
-			if strings.TrimSpace(req.Email) == "" {
-				http.Error(w, "failed to extract email from credential", http.StatusBadRequest)
-				return
-			}
-		} else {
-			http.Error(w, "missing credential", http.StatusBadRequest)
+		// Google's redirect mode uses a double-submit cookie against CSRF
+		c, err := r.Cookie("g_csrf_token")
+		if err != nil || c.Value == "" || c.Value != r.FormValue("g_csrf_token") {
+			http.Error(w, "invalid csrf token", http.StatusBadRequest)
 			return
 		}
+		req.Credential = r.FormValue("credential")
 	}
-
-	// Try to find existing user; if not found, create one with a random password
-	user, err := h.AuthService.UserRepo.GetByEmail(req.Email)
+	if req.Credential == "" {
+		http.Error(w, "missing credential", http.StatusBadRequest)
+		return
+	}
+	claims, err := google.Verifier.Verify(r.Context(), req.Credential)
 	if err != nil {
-		// Not found -> register a new user with a generated password
-		// Use the existing Register flow to handle hashing and persistence
-		if req.Name == "" {
-			req.Name = req.Email
-		}
-		// Use a time-based random string as password; it won't be used directly
-		genPass := time.Now().UTC().Format(time.RFC3339Nano)
-		user, err = h.AuthService.Register(req.Name, req.Email, genPass)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("google-login: rejected credential: %v", err)
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			http.Error(w, "google account email is not verified", http.StatusUnauthorized)
 			return
 		}
+		http.Error(w, "invalid credential", http.StatusUnauthorized)
+		return
+	}
+	// Find the user linked to this Google account, or by email; create one
+	// if needed
+	user, err := h.Identities.SignIn(services.ExternalIdentity{
+		Provider: google.Name,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		Name:     claims.Name,
+		Roles:    google.Roles(claims),
+	}, uuid.Nil)
+	if err != nil {
+		http.Error(w, "failed to sign in", http.StatusInternalServerError)
+		return
 	}
 
-	// Issue JWT for the user with appropriate role
-	role := "user"
-	// Check if user is admin (hardcoded list for now)
-	adminEmails := map[string]bool{
-		"admin@example.com":   true,
-		"231b322@juetguna.in": true,
-		"231b328@juetguna.in": true,
-		"231b315@juetguna.in": true,
-		// Add more admin emails as needed
-	}
-	if adminEmails[user.Email] {
-		role = "admin"
-	}
-	token, err := h.JWTService.GenerateTokenWithRole(user.ID, role)
+	// Issue JWT for the user with their stored roles
+	resp, err := h.signIn(w, r, user)
 	if err != nil {
 		http.Error(w, "failed to generate token", http.StatusInternalServerError)
 		return
 	}
+	token := resp.AccessToken
 
 	// Set cookie similar to Login/Register
 	cookie := &http.Cookie{
@@ -169,12 +234,13 @@ func (h *AuthHandler) GoogleLogin(w http.ResponseWriter, r *http.Request) {
 	// submission from Google, redirect to the app.
 	if strings.Contains(ct, "application/json") {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(tokenResp{AccessToken: token})
+		json.NewEncoder(w).Encode(resp)
 		return
 	}
 	// Redirect to index within the same server (serving frontend)
 	http.Redirect(w, r, "/index.html", http.StatusFound)
 }
+
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req registerReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -186,23 +252,18 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	// generate token with user role (default)
-	role := "user"
-	// Check if user is admin
-	adminEmails := map[string]bool{
-		"admin@example.com":   true,
-		"231b322@juetguna.in": true,
-		"231b328@juetguna.in": true,
-		"231b315@juetguna.in": true,
-	}
-	if adminEmails[user.Email] {
-		role = "admin"
+	if h.Accounts != nil {
+		if err := h.Accounts.SendVerification(r.Context(), user); err != nil {
+			log.Printf("register: cannot send verification email to user %s: %v", user.ID, err)
+		}
 	}
-	token, err := h.JWTService.GenerateTokenWithRole(user.ID, role)
+	// generate token with the user's roles (citizen unless bootstrapped as admin)
+	resp, err := h.signIn(w, r, user)
 	if err != nil {
 		http.Error(w, "failed to generate token", http.StatusInternalServerError)
 		return
 	}
+	token := resp.AccessToken
 	// set cookie for convenience so browsers will send it automatically
 	// If ALLOWED_ORIGIN is configured (cross-origin), set SameSite=None and Secure
 	// so browsers will include the cookie for cross-site requests when the client
@@ -227,7 +288,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 	http.SetCookie(w, cookie)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tokenResp{AccessToken: token})
+	json.NewEncoder(w).Encode(resp)
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -241,22 +302,12 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
-	role := "user"
-	// Check if user is admin
-	adminEmails := map[string]bool{
-		"admin@example.com":   true,
-		"231b322@juetguna.in": true,
-		"231b328@juetguna.in": true,
-		"231b315@juetguna.in": true,
-	}
-	if adminEmails[user.Email] {
-		role = "admin"
-	}
-	token, err := h.JWTService.GenerateTokenWithRole(user.ID, role)
+	resp, err := h.signIn(w, r, user)
 	if err != nil {
 		http.Error(w, "failed to generate token", http.StatusInternalServerError)
 		return
 	}
+	token := resp.AccessToken
 	// set cookie so subsequent requests include the token. Use SameSite=None+Secure
 	// when ALLOWED_ORIGIN is configured for cross-origin clients.
 	cookie2 := &http.Cookie{
@@ -276,7 +327,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 	http.SetCookie(w, cookie2)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tokenResp{AccessToken: token})
+	json.NewEncoder(w).Encode(resp)
 }
 
 // Logout reads the token from Authorization header/cookie/query and blacklists it in Redis
@@ -305,6 +356,17 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing token", http.StatusBadRequest)
 		return
 	}
+	// end the session so its refresh token stops working too
+	if h.Sessions != nil {
+		if sid := auth.GetSessionIDFromContext(r.Context()); sid != uuid.Nil {
+			userID, _ := auth.GetUserIDFromContext(r.Context())
+			if err := h.Sessions.Revoke(userID, sid); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				http.Error(w, "failed to revoke session", http.StatusInternalServerError)
+				return
+			}
+		}
+		http.SetCookie(w, authCookie(refreshCookieName, "", "/auth", time.Unix(0, 0)))
+	}
 
 	if h.RedisClient == nil {
 		// Nothing to blacklist against - accept logout as successful
@@ -348,3 +410,112 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "logout successful"})
 }
+
+// Refresh handles POST /auth/refresh. It exchanges a refresh token, taken from
+// the JSON body or the refresh_token cookie, for a new access token and
+// refresh token. Each refresh token works once: presenting it again means it
+// leaked, so its whole session is revoked and both tokens stop working.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if h.Sessions == nil {
+		http.Error(w, "refresh tokens are disabled", http.StatusNotFound)
+		return
+	}
+	var req refreshReq
+	if strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.RefreshToken == "" {
+		if c, err := r.Cookie(refreshCookieName); err == nil {
+			req.RefreshToken = c.Value
+		}
+	}
+	if req.RefreshToken == "" {
+		http.Error(w, "missing refresh token", http.StatusBadRequest)
+		return
+	}
+	session, refresh, err := h.Sessions.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			http.SetCookie(w, authCookie(refreshCookieName, "", "/auth", time.Unix(0, 0)))
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+	// roles are looked up again so changes apply from the next refresh
+	user, err := h.AuthService.UserRepo.GetByID(session.UserID)
+	if err != nil {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	token, err := h.issueToken(user, session.ID)
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, authCookie("access_token", token, "/", time.Now().Add(h.JWTService.AccessTokenTTL())))
+	http.SetCookie(w, authCookie(refreshCookieName, refresh, "/auth", session.ExpiresAt))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokenResp{
+		AccessToken:  token,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(h.JWTService.AccessTokenTTL().Seconds()),
+	})
+}
+
+// SessionResp is a signed-in device as listed by GET /auth/sessions. Current
+// marks the session of the token making the request.
+type SessionResp struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// ListSessions handles GET /auth/sessions, returning the caller's active
+// sessions, most recently used first.
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok || h.Sessions == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sessions, err := h.Sessions.List(userID)
+	if err != nil {
+		http.Error(w, "failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+	current := auth.GetSessionIDFromContext(r.Context())
+	out := make([]SessionResp, 0, len(sessions))
+	for _, s := range sessions {
+		out = append(out, SessionResp{Session: s, Current: s.ID == current})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// RevokeSession handles DELETE /auth/sessions/{id}. The session's refresh
+// token stops working at once; access tokens already issued for it last until
+// they expire.
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok || h.Sessions == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sessionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid session id", http.StatusBadRequest)
+		return
+	}
+	if err := h.Sessions.Revoke(userID, sessionID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
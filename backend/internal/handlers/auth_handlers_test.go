@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
@@ -15,6 +20,7 @@ import (
 	// "crowdsourcedurbanissuereportingwithai/backend/models"
 
 	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
@@ -29,6 +35,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		name TEXT NOT NULL,
 		email TEXT NOT NULL UNIQUE,
 		password_hash TEXT NOT NULL,
+		email_verified_at DATETIME,
 		created_at DATETIME,
 		updated_at DATETIME
 	);`
@@ -80,3 +87,101 @@ func TestRegisterAndLoginHandlers(t *testing.T) {
 		t.Fatalf("expected access_token in login response")
 	}
 }
+
+func TestGoogleLoginVerifiesIDToken(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	setupIdentityTable(t, db)
+	authSvc := services.NewAuthService(userRepo)
+	authHandler := NewAuthHandler(authSvc, auth.NewJWTService(), nil)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/google-login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		authHandler.GoogleLogin(rr, req)
+		return rr
+	}
+	if rr := post(`{"credential":"x"}`); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without a verifier, got %d", rr.Code)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	attacker, _ := rsa.GenerateKey(rand.Reader, 2048)
+	google := auth.NewGoogleProvider([]string{"client-1"}, "")
+	google.Verifier = auth.NewGoogleVerifier(auth.KeySet{"k1": &key.PublicKey}, []string{"client-1"})
+	authHandler.Providers = auth.NewOIDCRegistry()
+	authHandler.Providers.Register(google)
+	authHandler.Identities = services.NewIdentityService(repository.NewIdentityRepository(db), authSvc, nil)
+	sign := func(k *rsa.PrivateKey, email string, verified bool) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            "accounts.google.com",
+			"aud":            "client-1",
+			"sub":            "g-" + email,
+			"email":          email,
+			"email_verified": verified,
+			"name":           "Gina",
+			"exp":            time.Now().Add(time.Hour).Unix(),
+		})
+		tok.Header["kid"] = "k1"
+		s, err := tok.SignedString(k)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+	credential := func(tok string) string {
+		b, _ := json.Marshal(googleLoginReq{Credential: tok})
+		return string(b)
+	}
+
+	// The old unauthenticated body is no longer accepted.
+	if rr := post(`{"name":"Mallory","email":"admin@example.com"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a bare email to be rejected, got %d", rr.Code)
+	}
+	if rr := post(credential(sign(attacker, "admin@example.com", true))); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a forged credential to be rejected, got %d", rr.Code)
+	}
+	if rr := post(credential(sign(key, "gina@example.com", false))); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an unverified email to be rejected, got %d", rr.Code)
+	}
+
+	rr := post(credential(sign(key, "gina@example.com", true)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("google login: %d %s", rr.Code, rr.Body.String())
+	}
+	var tr map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&tr); err != nil || tr["access_token"] == "" {
+		t.Fatalf("expected access_token in google login response: %v", err)
+	}
+	u, err := userRepo.GetByEmail("gina@example.com")
+	if err != nil || u.Name != "Gina" {
+		t.Fatalf("expected the user to be created: %+v %v", u, err)
+	}
+	if id, err := repository.NewIdentityRepository(db).FindIdentity("google", "g-gina@example.com"); err != nil || id.UserID != u.ID {
+		t.Fatalf("expected the Google identity to be linked: %+v %v", id, err)
+	}
+
+	// The redirect flow needs Google's double-submit CSRF cookie.
+	form := url.Values{"credential": {sign(key, "gina@example.com", true)}, "g_csrf_token": {"abc"}}
+	formPost := func(cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/google-login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "g_csrf_token", Value: cookie})
+		}
+		rr := httptest.NewRecorder()
+		authHandler.GoogleLogin(rr, req)
+		return rr
+	}
+	if rr := formPost(""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a form post without the CSRF cookie to be rejected, got %d", rr.Code)
+	}
+	if rr := formPost("abc"); rr.Code != http.StatusFound {
+		t.Fatalf("expected a redirect after form sign-in, got %d", rr.Code)
+	}
+}
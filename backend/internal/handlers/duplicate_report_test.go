@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// setupReportDB opens a named in-memory sqlite database with the tables the
+// report flow touches.
+func setupReportDB(t *testing.T, name string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS users (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			email TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			email_verified_at DATETIME,
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS issues (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT,
+			category TEXT NOT NULL,
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS posts (
+			id TEXT PRIMARY KEY,
+			issue_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			description TEXT,
+			language TEXT,
+			status TEXT NOT NULL,
+			urgency INTEGER NOT NULL,
+			classified_as TEXT,
+			lat REAL NOT NULL,
+			lng REAL NOT NULL,
+			media_url TEXT NOT NULL,
+			score_sum REAL DEFAULT 0,
+			score_count INTEGER DEFAULT 0,
+			upvote_count INTEGER NOT NULL DEFAULT 0,
+			comment_count INTEGER NOT NULL DEFAULT 0,
+			last_activity_at DATETIME,
+			enrichment_status TEXT DEFAULT 'done',
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS comments (
+			id TEXT PRIMARY KEY,
+			post_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			content TEXT NOT NULL,
+			language TEXT,
+			created_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS upvotes (
+			id TEXT PRIMARY KEY,
+			post_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			created_at DATETIME,
+			UNIQUE (post_id, user_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS post_urgency_explanations (
+			post_id TEXT PRIMARY KEY,
+			explanation TEXT NOT NULL,
+			updated_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS user_places (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			name TEXT,
+			lat REAL NOT NULL,
+			lng REAL NOT NULL,
+			radius_m REAL NOT NULL,
+			created_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS post_rankings (
+			post_id TEXT PRIMARY KEY,
+			score REAL NOT NULL,
+			post_created_at DATETIME NOT NULL,
+			computed_urgency INTEGER NOT NULL DEFAULT 0,
+			computed_at DATETIME NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS enrichment_jobs (
+			id TEXT PRIMARY KEY,
+			post_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			run_after DATETIME NOT NULL,
+			locked_until DATETIME,
+			last_error TEXT,
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("create table: %v", err)
+		}
+	}
+	return db
+}
+
+func TestReportSuggestsNearbyDuplicate(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	os.Setenv("DUPLICATE_MODE", "suggest")
+	defer os.Unsetenv("DUPLICATE_MODE")
+
+	db := setupReportDB(t, "duplicates")
+	userRepo := repository.NewUserRepository(db)
+	authSvc := services.NewAuthService(userRepo)
+	reportSvc := services.NewReportService(repository.NewPostRepository(db), nil, nil)
+	jwtSvc := auth.NewJWTService()
+	report := auth.AuthMiddleware(jwtSvc, nil)(http.HandlerFunc(NewReportHandler(reportSvc).ServeReport))
+
+	user, err := authSvc.Register("Dup", "dup@example.com", "password")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	token, _ := jwtSvc.GenerateToken(user.ID)
+
+	submit := func(name string, lat, lng float64, forceNew bool) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"issue_name": name,
+			"issue_cat":  "Road",
+			"post_desc":  "Deep pothole in the middle of the road near the bus stop",
+			"status":     "open",
+			"urgency":    2,
+			"lat":        lat,
+			"lng":        lng,
+			"media_url":  "http://example.com/p.jpg",
+			"force_new":  forceNew,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/report", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		report.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := submit("Pothole A", 26.9000, 75.8000, false); rr.Code != http.StatusOK {
+		t.Fatalf("first report failed: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// ~20m away, same category and description: should be flagged
+	rr := submit("Pothole B", 26.90018, 75.8000, false)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for nearby duplicate, got %d %s", rr.Code, rr.Body.String())
+	}
+	var dup DuplicateReportResponse
+	if err := json.NewDecoder(rr.Body).Decode(&dup); err != nil {
+		t.Fatalf("decode duplicate response: %v", err)
+	}
+	if len(dup.Duplicates) != 1 || dup.Duplicates[0].IssueName != "Pothole A" {
+		t.Fatalf("expected Pothole A as the only candidate, got %+v", dup.Duplicates)
+	}
+	if d := dup.Duplicates[0].DistanceM; d < 15 || d > 25 {
+		t.Fatalf("expected distance around 20m, got %.1f", d)
+	}
+
+	// The user confirmed it is a different problem
+	if rr := submit("Pothole B", 26.90018, 75.8000, true); rr.Code != http.StatusOK {
+		t.Fatalf("forced report failed: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// ~2km away is outside the radius
+	if rr := submit("Pothole C", 26.9180, 75.8000, false); rr.Code != http.StatusOK {
+		t.Fatalf("distant report failed: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestReportIgnoresUnrelatedNearbyReport(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	defer os.Unsetenv("DUPLICATE_MODE")
+
+	db := setupReportDB(t, "unrelated_nearby")
+	authSvc := services.NewAuthService(repository.NewUserRepository(db))
+	reportSvc := services.NewReportService(repository.NewPostRepository(db), nil, nil)
+	user, err := authSvc.Register("Near", "near@example.com", "password")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if _, err := reportSvc.ReportIssueViaPost(user.ID.String(), "Streetlight out", "", "Electricity", "Streetlight is not working at night", 2, 26.9000, 75.8000, "http://example.com/l.jpg", false); err != nil {
+		t.Fatalf("first report: %v", err)
+	}
+
+	// A few metres away, same category, descriptions with nothing in common:
+	// neither flagged nor re-filed.
+	for _, c := range []struct{ mode, name, category, desc string }{
+		{"suggest", "Exposed wires", "Electricity", "Exposed wires hanging from the transformer box"},
+		{"link", "Power cut", "Electricity", "Power cut in the whole lane since morning"},
+	} {
+		os.Setenv("DUPLICATE_MODE", c.mode)
+		post, err := reportSvc.ReportIssueViaPost(user.ID.String(), c.name, "", c.category, c.desc, 2, 26.90003, 75.8000, "http://example.com/x.jpg", false)
+		if err != nil {
+			t.Fatalf("%s mode: expected an unrelated report to be accepted, got %v", c.mode, err)
+		}
+		var issue models.Issue
+		db.First(&issue, "id = ?", post.IssueID)
+		if issue.Name != c.name {
+			t.Fatalf("%s mode: expected the report under its own issue, got %q", c.mode, issue.Name)
+		}
+	}
+}
+
+func TestAddUpvoteKeepsExistingUpvote(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	db := setupReportDB(t, "addupvote")
+	reportSvc := services.NewReportService(repository.NewPostRepository(db), nil, nil)
+	jwtSvc := auth.NewJWTService()
+	mux := http.NewServeMux()
+	mux.Handle("PUT /api/posts/{id}/upvote", auth.AuthMiddleware(jwtSvc, nil)(http.HandlerFunc(NewReportHandler(reportSvc).ServeAddUpvote)))
+
+	user := models.User{ID: uuid.New(), Name: "Voice", Email: "voice@example.com", PasswordHash: "x"}
+	issue := models.Issue{ID: uuid.New(), Name: "Existing pothole", Category: "Road"}
+	db.Create(&user)
+	db.Create(&issue)
+	post := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Status: models.StatusOpen, Urgency: 2}
+	db.Create(&post)
+	token, _ := jwtSvc.GenerateToken(user.ID)
+	put := func(id string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/posts/"+id+"/upvote", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// The user upvoted the report before; adding their voice again keeps it.
+	if _, err := reportSvc.ToggleUpvote(user.ID.String(), post.ID.String()); err != nil {
+		t.Fatalf("upvote: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if code := put(post.ID.String()); code != http.StatusOK {
+			t.Fatalf("add upvote: %d", code)
+		}
+	}
+	var got models.Post
+	db.First(&got, "id = ?", post.ID)
+	var n int64
+	db.Model(&models.Upvote{}).Where("post_id = ?", post.ID).Count(&n)
+	if n != 1 || got.UpvoteCount != 1 {
+		t.Fatalf("expected the one upvote to stay, got %d rows and count %d", n, got.UpvoteCount)
+	}
+	if code := put(uuid.NewString()); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown post, got %d", code)
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestFeedCountersAndViewerUpvote(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	db := setupReportDB(t, "feedcounters")
+	postRepo := repository.NewPostRepository(db)
+	feedSvc := services.NewFeedService(postRepo, nil)
+	reportSvc := services.NewReportService(postRepo, nil, nil)
+	h := NewFeedHandler(feedSvc)
+	jwtSvc := auth.NewJWTService()
+	feedMw := auth.OptionalAuthMiddleware(jwtSvc, nil)(http.HandlerFunc(h.ServeFeed))
+
+	alice := models.User{ID: uuid.New(), Name: "Alice", Email: "alice@example.com", PasswordHash: "x"}
+	bob := models.User{ID: uuid.New(), Name: "Bob", Email: "bob@example.com", PasswordHash: "x"}
+	issue := models.Issue{ID: uuid.New(), Name: "Counted Pothole", Category: "Road"}
+	db.Create(&alice)
+	db.Create(&bob)
+	db.Create(&issue)
+	created := time.Now().Add(-time.Hour)
+	post := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: alice.ID, Description: "Pothole", Status: "open", Urgency: 2, CreatedAt: created, LastActivityAt: created}
+	db.Create(&post)
+
+	for _, u := range []models.User{alice, bob, bob, bob} { // bob toggles on, off, on
+		if _, err := reportSvc.ToggleUpvote(u.ID.String(), post.ID.String()); err != nil {
+			t.Fatalf("upvote: %v", err)
+		}
+	}
+	if _, err := reportSvc.AddComment(bob.ID.String(), post.ID.String(), "Still there"); err != nil {
+		t.Fatalf("comment: %v", err)
+	}
+
+	feed := func(token string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		feedMw.ServeHTTP(rr, req)
+		var items []map[string]interface{}
+		if err := json.NewDecoder(rr.Body).Decode(&items); err != nil || len(items) != 1 {
+			t.Fatalf("feed: %d %v %d items", rr.Code, err, len(items))
+		}
+		return items[0]
+	}
+
+	item := feed("")
+	if item["upvote_count"] != 2.0 || item["comment_count"] != 1.0 || item["viewer_has_upvoted"] != false {
+		t.Fatalf("unexpected anonymous item %v", item)
+	}
+	if _, ok := item["comments"]; ok {
+		t.Fatal("feed items must not embed comments")
+	}
+	if _, ok := item["upvotes"]; ok {
+		t.Fatal("feed items must not embed upvotes")
+	}
+	if last, _ := time.Parse(time.RFC3339Nano, item["last_activity_at"].(string)); !last.After(created) {
+		t.Fatalf("expected last_activity_at to move past creation, got %v", item["last_activity_at"])
+	}
+	token, _ := jwtSvc.GenerateToken(bob.ID)
+	if item := feed(token); item["viewer_has_upvoted"] != true {
+		t.Fatalf("expected bob to see his upvote, got %v", item["viewer_has_upvoted"])
+	}
+
+	// Comments are fetched per post.
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/"+post.ID.String()+"/comments", nil)
+	req.SetPathValue("id", post.ID.String())
+	rr := httptest.NewRecorder()
+	h.ServePostComments(rr, req)
+	var comments []services.FeedComment
+	json.NewDecoder(rr.Body).Decode(&comments)
+	if rr.Code != http.StatusOK || len(comments) != 1 || comments[0].User.Name != "Bob" {
+		t.Fatalf("comments: %d %+v", rr.Code, comments)
+	}
+
+	// The backfill recomputes counters that drifted or predate the columns.
+	db.Exec("UPDATE posts SET upvote_count = 0, comment_count = 0, last_activity_at = NULL")
+	if n, err := postRepo.BackfillPostCounters(); err != nil || n != 1 {
+		t.Fatalf("backfill: %d, %v", n, err)
+	}
+	got, _ := postRepo.GetPost(post.ID)
+	if got.UpvoteCount != 2 || got.CommentCount != 1 || !got.LastActivityAt.After(created) {
+		t.Fatalf("unexpected counters after backfill: %d upvotes, %d comments, last activity %v", got.UpvoteCount, got.CommentCount, got.LastActivityAt)
+	}
+}
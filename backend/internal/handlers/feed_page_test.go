@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestFeedCursorPaginationAndFilters(t *testing.T) {
+	db := setupReportDB(t, "feedpage")
+	h := NewFeedHandler(services.NewFeedService(repository.NewPostRepository(db), nil))
+
+	user := models.User{ID: uuid.New(), Name: "Pager", Email: "pager@example.com", PasswordHash: "x"}
+	road := models.Issue{ID: uuid.New(), Name: "Paged Road", Category: "Road"}
+	light := models.Issue{ID: uuid.New(), Name: "Paged Light", Category: "Lighting"}
+	db.Create(&user)
+	db.Create(&road)
+	db.Create(&light)
+	base := time.Now().Add(-time.Hour)
+	// Several posts share urgency (and therefore score) so ties must be broken stably.
+	for i := 0; i < 7; i++ {
+		p := models.Post{ID: uuid.New(), IssueID: road.ID, UserID: user.ID, Status: "open", Urgency: 1 + i%2, CreatedAt: base.Add(time.Duration(i%3) * time.Minute)}
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+	}
+	closed := models.Post{ID: uuid.New(), IssueID: light.ID, UserID: user.ID, Status: "closed", Urgency: 3, CreatedAt: base}
+	db.Create(&closed)
+
+	fetch := func(params url.Values) services.FeedPage {
+		req := httptest.NewRequest(http.MethodGet, "/feed?"+params.Encode(), nil)
+		rr := httptest.NewRecorder()
+		h.ServeFeed(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("feed %s: %d %s", params.Encode(), rr.Code, rr.Body.String())
+		}
+		var page services.FeedPage
+		if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+			t.Fatalf("decode page: %v", err)
+		}
+		return page
+	}
+
+	for _, sortOrder := range []string{"score", "recent"} {
+		seen := map[uuid.UUID]bool{}
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > 5 {
+				t.Fatalf("%s: too many pages", sortOrder)
+			}
+			params := url.Values{"sort": {sortOrder}, "category": {"Road"}, "limit": {"3"}}
+			if cursor != "" {
+				params.Set("cursor", cursor)
+			}
+			page := fetch(params)
+			for _, p := range page.Items {
+				if seen[p.ID] {
+					t.Fatalf("%s: post %s returned twice", sortOrder, p.ID)
+				}
+				seen[p.ID] = true
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		if len(seen) != 7 {
+			t.Fatalf("%s: expected 7 road posts across pages, got %d", sortOrder, len(seen))
+		}
+	}
+
+	if page := fetch(url.Values{"status": {"closed"}}); len(page.Items) != 1 || page.Items[0].ID != closed.ID {
+		t.Fatalf("status filter: expected only the closed post, got %d items", len(page.Items))
+	}
+	if page := fetch(url.Values{"min_urgency": {"2"}, "category": {"Road"}}); len(page.Items) != 3 {
+		t.Fatalf("urgency filter: expected 3 posts, got %d", len(page.Items))
+	}
+
+	// A cursor from one sort order is rejected by the other.
+	first := fetch(url.Values{"sort": {"score"}, "limit": {"2"}})
+	req := httptest.NewRequest(http.MethodGet, "/feed?sort=recent&cursor="+first.NextCursor, nil)
+	rr := httptest.NewRecorder()
+	h.ServeFeed(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for mismatched cursor, got %d", rr.Code)
+	}
+}
+
+func TestFeedDateFilterIncludesToDate(t *testing.T) {
+	db := setupReportDB(t, "feeddates")
+	h := NewFeedHandler(services.NewFeedService(repository.NewPostRepository(db), nil))
+
+	user := models.User{ID: uuid.New(), Name: "Dated", Email: "dated@example.com", PasswordHash: "x"}
+	issue := models.Issue{ID: uuid.New(), Name: "Dated Road", Category: "Road"}
+	db.Create(&user)
+	db.Create(&issue)
+	afternoon := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Status: "open", Urgency: 1, CreatedAt: time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)}
+	nextDay := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Status: "open", Urgency: 1, CreatedAt: time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)}
+	db.Create(&afternoon)
+	db.Create(&nextDay)
+
+	ids := func(params url.Values) []uuid.UUID {
+		req := httptest.NewRequest(http.MethodGet, "/feed?"+params.Encode(), nil)
+		rr := httptest.NewRecorder()
+		h.ServeFeed(rr, req)
+		var page services.FeedPage
+		if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&page) != nil {
+			t.Fatalf("feed %s: %d %s", params.Encode(), rr.Code, rr.Body.String())
+		}
+		var out []uuid.UUID
+		for _, p := range page.Items {
+			out = append(out, p.ID)
+		}
+		return out
+	}
+
+	// A date-only to= includes the whole named day.
+	if got := ids(url.Values{"from": {"2024-03-10"}, "to": {"2024-03-10"}}); len(got) != 1 || got[0] != afternoon.ID {
+		t.Fatalf("expected only the post of 2024-03-10, got %v", got)
+	}
+	if got := ids(url.Values{"to": {"2024-03-11"}}); len(got) != 2 {
+		t.Fatalf("expected both posts up to 2024-03-11, got %v", got)
+	}
+	// A timestamp stays an exclusive bound.
+	if got := ids(url.Values{"to": {"2024-03-10T15:00:00Z"}}); len(got) != 0 {
+		t.Fatalf("expected nothing before 15:00, got %v", got)
+	}
+}
+
+func TestRankedFeedPageUsesStoredScoresAcrossWindow(t *testing.T) {
+	os.Setenv("FEED_SCORING_MODE", "heuristic")
+	defer os.Unsetenv("FEED_SCORING_MODE")
+	db := setupReportDB(t, "feedwindow")
+	h := NewFeedHandler(services.NewFeedService(repository.NewPostRepository(db), nil))
+
+	user := models.User{ID: uuid.New(), Name: "Window", Email: "window@example.com", PasswordHash: "x"}
+	issue := models.Issue{ID: uuid.New(), Name: "Window Road", Category: "Road"}
+	db.Create(&user)
+	db.Create(&issue)
+	base := time.Now().Add(-time.Hour)
+	// The most urgent post is the oldest of 60, past the first 50 texts
+	// that live text scoring would reach.
+	var urgent models.Post
+	for i := 0; i < 60; i++ {
+		p := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Description: "Pothole on the road", Status: "open", Urgency: 1, ScoreSum: 0.2, ScoreCount: 1, CreatedAt: base.Add(time.Duration(i) * time.Second)}
+		if i == 0 {
+			p.ScoreSum = 0.9
+			urgent = p
+		}
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/feed?sort=score&category=Road&limit=5", nil)
+	rr := httptest.NewRecorder()
+	h.ServeFeed(rr, req)
+	var page services.FeedPage
+	if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&page) != nil || len(page.Items) != 5 {
+		t.Fatalf("feed: %d %s", rr.Code, rr.Body.String())
+	}
+	if page.Items[0].ID != urgent.ID {
+		t.Fatalf("expected the post with the highest stored score first, got %s", page.Items[0].ID)
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestMaterializedFeedRanking(t *testing.T) {
+	db := setupReportDB(t, "feedranking")
+	postRepo := repository.NewPostRepository(db)
+	feedSvc := services.NewFeedService(postRepo, nil)
+	feedSvc.Rankings = true
+	ranker := services.NewFeedRanker(feedSvc)
+	reportSvc := services.NewReportService(postRepo, nil, nil)
+	reportSvc.Ranker = ranker
+	h := NewFeedHandler(feedSvc)
+
+	user := models.User{ID: uuid.New(), Name: "Ranker", Email: "ranker@example.com", PasswordHash: "x"}
+	issue := models.Issue{ID: uuid.New(), Name: "Ranked Pothole", Category: "Road"}
+	db.Create(&user)
+	db.Create(&issue)
+	base := time.Now().Add(-time.Hour)
+	var posts []models.Post
+	for i := 0; i < 3; i++ {
+		p := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Description: "Pothole", Status: "open", Urgency: 2, CreatedAt: base.Add(time.Duration(i) * time.Minute)}
+		db.Create(&p)
+		posts = append(posts, p)
+	}
+	oldest, newest := posts[0], posts[2]
+
+	feed := func(target string) []models.Post {
+		rr := httptest.NewRecorder()
+		h.ServeFeed(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("feed: %d %s", rr.Code, rr.Body.String())
+		}
+		var got []models.Post
+		json.NewDecoder(rr.Body).Decode(&got)
+		return got
+	}
+
+	// Before the first sweep the feed is scored live.
+	if got := feed("/feed"); len(got) != 3 {
+		t.Fatalf("expected live fallback with 3 posts, got %d", len(got))
+	}
+	if n, err := ranker.Sweep(); err != nil || n != 3 {
+		t.Fatalf("sweep: %d, %v", n, err)
+	}
+	got := feed("/feed")
+	if len(got) != 3 || got[0].ID != newest.ID || got[0].Score == 0 {
+		t.Fatalf("expected ranked feed led by the newest post, got %+v", got)
+	}
+
+	// An upvote is reflected once the ranker has processed the notification.
+	if _, err := reportSvc.ToggleUpvote(user.ID.String(), oldest.ID.String()); err != nil {
+		t.Fatalf("upvote: %v", err)
+	}
+	if got := feed("/feed"); got[0].ID == oldest.ID {
+		t.Fatal("feed changed before the ranking was recomputed")
+	}
+	if n, err := ranker.RecomputePending(); err != nil || n != 1 {
+		t.Fatalf("recompute: %d, %v", n, err)
+	}
+	if got := feed("/feed"); got[0].ID != oldest.ID {
+		t.Fatalf("expected the upvoted post first, got %s", got[0].ID)
+	}
+
+	// Score-ranked pages are read from the rankings with a keyset cursor.
+	seen := map[uuid.UUID]bool{}
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		rr := httptest.NewRecorder()
+		h.ServeFeed(rr, httptest.NewRequest(http.MethodGet, "/feed?limit=2&cursor="+cursor, nil))
+		var page services.FeedPage
+		json.NewDecoder(rr.Body).Decode(&page)
+		if pages == 0 && page.Items[0].ID != oldest.ID {
+			t.Fatalf("expected the upvoted post to lead the first page, got %s", page.Items[0].ID)
+		}
+		for _, p := range page.Items {
+			if seen[p.ID] {
+				t.Fatalf("post %s returned twice", p.ID)
+			}
+			seen[p.ID] = true
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected 3 posts across pages, got %d", len(seen))
+	}
+
+	// Posts that fall out of the sweep window lose their ranking.
+	ranker.Window = 2
+	if n, err := ranker.Sweep(); err != nil || n != 2 {
+		t.Fatalf("windowed sweep: %d, %v", n, err)
+	}
+	if got := feed("/feed"); len(got) != 2 {
+		t.Fatalf("expected 2 ranked posts after pruning, got %d", len(got))
+	}
+}
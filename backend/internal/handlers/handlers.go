@@ -2,11 +2,19 @@ package handlers
 
 import (
 	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/geo"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type ReportHandler struct {
@@ -28,11 +36,20 @@ type ReportRequest struct {
 	IssueDesc string  `json:"issue_desc"`
 	IssueCat  string  `json:"issue_cat"`
 	PostDesc  string  `json:"post_desc"`
-	Status    string  `json:"status"`
 	Urgency   int     `json:"urgency"`
 	Lat       float64 `json:"lat"`
 	Lng       float64 `json:"lng"`
 	MediaURL  string  `json:"media_url"`
+	// ForceNew skips duplicate detection, e.g. after the user has seen the
+	// suggested duplicates and confirmed this is a different problem.
+	ForceNew bool `json:"force_new"`
+}
+
+// DuplicateReportResponse is returned with 409 Conflict when a report looks
+// like an existing open report.
+type DuplicateReportResponse struct {
+	Error      string                        `json:"error"`
+	Duplicates []services.DuplicateCandidate `json:"duplicates"`
 }
 
 func (h *ReportHandler) ServeReport(w http.ResponseWriter, r *http.Request) {
@@ -54,7 +71,14 @@ func (h *ReportHandler) ServeReport(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid or missing user ID", http.StatusBadRequest)
 		return
 	}
-	post, err := h.ReportService.ReportIssueViaPost(uid.String(), req.IssueName, req.IssueDesc, req.IssueCat, req.PostDesc, req.Status, req.Urgency, req.Lat, req.Lng, req.MediaURL)
+	post, err := h.ReportService.ReportIssueViaPost(uid.String(), req.IssueName, req.IssueDesc, req.IssueCat, req.PostDesc, req.Urgency, req.Lat, req.Lng, req.MediaURL, req.ForceNew)
+	var dupErr *services.DuplicateReportError
+	if errors.As(err, &dupErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(DuplicateReportResponse{Error: dupErr.Error(), Duplicates: dupErr.Candidates})
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to report issue", http.StatusInternalServerError)
 		return
@@ -115,11 +139,36 @@ func (h *ReportHandler) ServeUpvote(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]bool{"upvoted": created})
 }
 
-// Admin: Update post status (open -> closed, etc)
+// ServeAddUpvote handles PUT /api/posts/{id}/upvote: the caller upvotes the
+// post, and an existing upvote is kept rather than toggled off.
+func (h *ReportHandler) ServeAddUpvote(w http.ResponseWriter, r *http.Request) {
+	postID := r.PathValue("id")
+	if _, err := uuid.Parse(postID); err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	uidCtx, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.ReportService.AddUpvote(uidCtx.String(), postID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to upvote", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"upvoted": true})
+}
+
+// Admin: Update post status (open -> triaged, inprogress -> resolved, etc)
 type StatusUpdateRequest struct {
 	PostID  string `json:"post_id"`
-	Status  string `json:"status"` // "open", "inprogress", "closed"
-	Notes   string `json:"notes"`  // optional notes from admin
+	Status  string `json:"status"` // one of the models.Status* values
+	Notes   string `json:"notes"`  // optional notes from admin, stored in the status history
 }
 
 func (h *ReportHandler) ServeUpdateStatus(w http.ResponseWriter, r *http.Request) {
@@ -137,28 +186,96 @@ func (h *ReportHandler) ServeUpdateStatus(w http.ResponseWriter, r *http.Request
 	}
 	
 	// Verify user is authenticated (middleware ensures this for protected routes)
-	_, ok := auth.GetUserIDFromContext(r.Context())
+	actorID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 	
-	post, err := h.ReportService.UpdatePostStatus(req.PostID, req.Status, req.Notes)
+	post, err := h.ReportService.UpdatePostStatus(req.PostID, actorID.String(), req.Status, req.Notes)
 	if err != nil {
-		http.Error(w, "Failed to update status: "+err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, services.ErrInvalidStatus), errors.Is(err, services.ErrInvalidTransition):
+			http.Error(w, "Failed to update status: "+err.Error(), http.StatusBadRequest)
+		case errors.Is(err, repository.ErrStatusChanged):
+			http.Error(w, "Failed to update status: "+err.Error(), http.StatusConflict)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			http.Error(w, "Post not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to update status: "+err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 	
 	json.NewEncoder(w).Encode(post)
 }
 
+// ServeStatusHistory returns the status transitions of the post identified by
+// the {id} path segment, oldest first.
+func (h *ReportHandler) ServeStatusHistory(w http.ResponseWriter, r *http.Request) {
+	postID := r.PathValue("id")
+	if _, err := uuid.Parse(postID); err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	history, err := h.ReportService.GetPostStatusHistory(postID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch status history", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// ServeUrgencyExplanation returns why the post identified by the {id} path
+// segment has its urgency: matched keywords, ML vs heuristic scores, comment
+// contributions and the upvote component. It only reads the stored
+// explanation; ServeRecomputeUrgency refreshes it. Posts reported before
+// explanations were recorded have none and get 404 until recomputed.
+func (h *ReportHandler) ServeUrgencyExplanation(w http.ResponseWriter, r *http.Request) {
+	h.serveUrgency(w, r, h.ReportService.ExplainPostUrgency)
+}
+
+// ServeRecomputeUrgency scores the post identified by the {id} path segment
+// again from its description and comments, calling the ML model, and stores
+// the new urgency, score and explanation.
+func (h *ReportHandler) ServeRecomputeUrgency(w http.ResponseWriter, r *http.Request) {
+	h.serveUrgency(w, r, h.ReportService.RecomputePostUrgency)
+}
+
+func (h *ReportHandler) serveUrgency(w http.ResponseWriter, r *http.Request, explain func(string) (*services.UrgencyExplanation, error)) {
+	postID := r.PathValue("id")
+	if _, err := uuid.Parse(postID); err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	explanation, err := explain(postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			http.Error(w, "Post not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrNoUrgencyExplanation):
+			http.Error(w, "No urgency explanation recorded for this post", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to explain urgency", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(explanation)
+}
+
 // Admin: Get all issues for admin dashboard
 func (h *FeedHandler) ServeAdminFeed(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
 	
 	// Get filter params from query (optional)
-	status := r.URL.Query().Get("status") // "open", "inprogress", "closed"
+	status := r.URL.Query().Get("status") // e.g. "open", "inprogress", "resolved"
 	limit := 100
 	
 	posts, err := h.FeedService.GetAllPostsForAdmin(status, limit)
@@ -178,8 +295,40 @@ func NewFeedHandler(feedService *services.FeedService) *FeedHandler {
 	return &FeedHandler{FeedService: feedService}
 }
 
+// feedPageParams are the query parameters that switch /feed from the legacy
+// plain array to the paginated {items, next_cursor} envelope.
+var feedPageParams = []string{"cursor", "limit", "sort", "category", "status", "min_urgency", "max_urgency", "reporter", "from", "to", "classified_as"}
+
+// ServeFeed serves /feed as services.FeedItems, which carry upvote and
+// comment counts and, for a signed-in user (see auth.OptionalAuthMiddleware),
+// viewer_has_upvoted. With ?for=me the legacy array is ranked for that user;
+// the personal ranking has no pages, so it cannot be combined with the
+// paginated envelope's parameters.
 func (h *FeedHandler) ServeFeed(w http.ResponseWriter, r *http.Request) {
-	posts, err := h.FeedService.GetFeed()
+	for _, p := range feedPageParams {
+		if r.URL.Query().Has(p) {
+			if r.URL.Query().Get("for") == "me" {
+				http.Error(w, "for=me cannot be combined with "+p, http.StatusBadRequest)
+				return
+			}
+			h.serveFeedPage(w, r)
+			return
+		}
+	}
+	var posts []models.Post
+	var err error
+	// ?for=me ranks for the signed-in user; anonymous users get the global feed
+	viewer, signedIn := auth.GetUserIDFromContext(r.Context())
+	if signedIn && r.URL.Query().Get("for") == "me" {
+		posts, err = h.FeedService.GetPersonalFeed(viewer)
+	} else {
+		posts, err = h.FeedService.GetFeed()
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch feed", http.StatusInternalServerError)
+		return
+	}
+	items, err := h.FeedService.FeedItems(posts, viewer)
 	if err != nil {
 		http.Error(w, "Failed to fetch feed", http.StatusInternalServerError)
 		return
@@ -189,5 +338,227 @@ func (h *FeedHandler) ServeFeed(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Expires", "0")
+	json.NewEncoder(w).Encode(items)
+}
+
+// ServePosts returns posts for the map view, restricted either to a bounding
+// box (?bbox=minLng,minLat,maxLng,maxLat) or to a radius around a point
+// (?near=lat,lng&radius_m=500). An optional ?limit= caps the result size.
+func (h *FeedHandler) ServePosts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	var posts []models.Post
+	var err error
+	switch {
+	case q.Get("bbox") != "":
+		box, perr := parseBBox(q.Get("bbox"))
+		if perr != nil {
+			http.Error(w, "Invalid bbox: "+perr.Error(), http.StatusBadRequest)
+			return
+		}
+		posts, err = h.FeedService.GetPostsInBBox(box, limit)
+	case q.Get("near") != "":
+		lat, lng, perr := parseLatLng(q.Get("near"))
+		if perr != nil {
+			http.Error(w, "Invalid near: "+perr.Error(), http.StatusBadRequest)
+			return
+		}
+		radius, perr := strconv.ParseFloat(q.Get("radius_m"), 64)
+		if perr != nil || radius <= 0 || radius > maxRadiusM {
+			http.Error(w, "radius_m must be a number between 0 and 50000", http.StatusBadRequest)
+			return
+		}
+		posts, err = h.FeedService.GetPostsNear(lat, lng, radius, limit)
+	default:
+		http.Error(w, "Either bbox or near is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(posts)
 }
+
+// maxClusterZoom matches the deepest zoom level of common web map tiles.
+const maxClusterZoom = 22
+
+// ServePostClusters returns marker clusters for the map at the given zoom:
+// /api/posts/clusters?bbox=minLng,minLat,maxLng,maxLat&zoom=12
+func (h *FeedHandler) ServePostClusters(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	box, err := parseBBox(q.Get("bbox"))
+	if err != nil {
+		http.Error(w, "Invalid bbox: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	zoom, err := strconv.Atoi(q.Get("zoom"))
+	if err != nil || zoom < 0 || zoom > maxClusterZoom {
+		http.Error(w, "zoom must be an integer between 0 and 22", http.StatusBadRequest)
+		return
+	}
+	clusters, err := h.FeedService.GetPostClusters(box, zoom)
+	if err != nil {
+		http.Error(w, "Failed to cluster posts", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clusters)
+}
+
+// maxRadiusM bounds radius queries so a single request cannot scan the whole city.
+const maxRadiusM = 50000
+
+// parseBBox parses "minLng,minLat,maxLng,maxLat" (the order used by map libraries).
+func parseBBox(v string) (geo.BBox, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) != 4 {
+		return geo.BBox{}, errors.New("expected minLng,minLat,maxLng,maxLat")
+	}
+	var nums [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return geo.BBox{}, errors.New("coordinates must be numbers")
+		}
+		nums[i] = f
+	}
+	box := geo.BBox{MinLng: nums[0], MinLat: nums[1], MaxLng: nums[2], MaxLat: nums[3]}
+	if box.MinLat < -90 || box.MaxLat > 90 || box.MinLat > box.MaxLat {
+		return geo.BBox{}, errors.New("latitudes out of range")
+	}
+	if box.MinLng < -180 || box.MaxLng > 180 {
+		return geo.BBox{}, errors.New("longitudes out of range")
+	}
+	return box, nil
+}
+
+// parseLatLng parses "lat,lng".
+func parseLatLng(v string) (float64, float64, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) != 2 {
+		return 0, 0, errors.New("expected lat,lng")
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lng, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, errors.New("coordinates must be numbers")
+	}
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return 0, 0, errors.New("coordinates out of range")
+	}
+	return lat, lng, nil
+}
+
+// serveFeedPage serves one page of the filtered feed, e.g.
+// /feed?category=Road&status=open&min_urgency=2&limit=20&cursor=...
+func (h *FeedHandler) serveFeedPage(w http.ResponseWriter, r *http.Request) {
+	q, err := parseFeedQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := h.FeedService.GetFeedPage(q)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to fetch feed", http.StatusInternalServerError)
+		return
+	}
+	viewer, _ := auth.GetUserIDFromContext(r.Context())
+	items, err := h.FeedService.FeedItems(page.Items, viewer)
+	if err != nil {
+		http.Error(w, "Failed to fetch feed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+	json.NewEncoder(w).Encode(services.FeedItemPage{Items: items, NextCursor: page.NextCursor})
+}
+
+// ServePostComments returns the comments of the post identified by the {id}
+// path segment, oldest first. The feed only carries comment counts.
+func (h *FeedHandler) ServePostComments(w http.ResponseWriter, r *http.Request) {
+	postID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	comments, err := h.FeedService.GetPostComments(postID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+func parseFeedQuery(r *http.Request) (services.FeedQuery, error) {
+	v := r.URL.Query()
+	q := services.FeedQuery{
+		Sort:   v.Get("sort"),
+		Cursor: v.Get("cursor"),
+		Filter: repository.PostFilter{
+			Category:     v.Get("category"),
+			Status:       v.Get("status"),
+			ClassifiedAs: v.Get("classified_as"),
+		},
+	}
+	if q.Sort != "" && q.Sort != services.FeedSortScore && q.Sort != services.FeedSortRecent {
+		return q, errors.New("sort must be score or recent")
+	}
+	var err error
+	if q.Limit, err = optionalInt(v.Get("limit")); err != nil {
+		return q, errors.New("limit must be a number")
+	}
+	if q.Filter.MinUrgency, err = optionalInt(v.Get("min_urgency")); err != nil {
+		return q, errors.New("min_urgency must be a number")
+	}
+	if q.Filter.MaxUrgency, err = optionalInt(v.Get("max_urgency")); err != nil {
+		return q, errors.New("max_urgency must be a number")
+	}
+	if rep := v.Get("reporter"); rep != "" {
+		if q.Filter.UserID, err = uuid.Parse(rep); err != nil {
+			return q, errors.New("reporter must be a user id")
+		}
+	}
+	if q.Filter.CreatedFrom, err = optionalTime(v.Get("from"), false); err != nil {
+		return q, errors.New("from must be an RFC3339 timestamp or YYYY-MM-DD date")
+	}
+	if q.Filter.CreatedTo, err = optionalTime(v.Get("to"), true); err != nil {
+		return q, errors.New("to must be an RFC3339 timestamp or YYYY-MM-DD date")
+	}
+	return q, nil
+}
+
+func optionalInt(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// optionalTime accepts RFC3339 timestamps or plain dates (interpreted as UTC
+// midnight). With endOfDay a plain date means the following midnight, so an
+// exclusive upper bound such as to=2024-03-10 still includes that whole day.
+func optionalTime(v string, endOfDay bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := time.Parse("2006-01-02", v)
+	if err == nil && endOfDay {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d, err
+}
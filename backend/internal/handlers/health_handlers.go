@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"encoding/json"
+	"net/http"
+)
+
+// HealthHandler reports liveness together with the state of the ML circuit
+// breakers, so operators can see when predictions are served by the fallback.
+type HealthHandler struct {
+	Breakers []*services.CircuitBreaker
+}
+
+func NewHealthHandler(breakers ...*services.CircuitBreaker) *HealthHandler {
+	return &HealthHandler{Breakers: breakers}
+}
+
+// HealthResponse is the body of GET /health. Status is "degraded" while any
+// breaker is not closed; the endpoint still answers 200 because the API keeps
+// working on the heuristic fallback.
+type HealthResponse struct {
+	Status   string                   `json:"status"`
+	Breakers []services.BreakerStatus `json:"breakers"`
+}
+
+func (h *HealthHandler) ServeHealth(w http.ResponseWriter, r *http.Request) {
+	resp := HealthResponse{Status: "ok", Breakers: []services.BreakerStatus{}}
+	for _, b := range h.Breakers {
+		st := b.Status()
+		if st.State != services.BreakerClosed {
+			resp.Status = "degraded"
+		}
+		resp.Breakers = append(resp.Breakers, st)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
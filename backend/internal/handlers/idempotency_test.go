@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/middleware"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestIdempotencyKeysReplaySubmissions(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	db := setupReportDB(t, "idempotency")
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			idempotency_key TEXT PRIMARY KEY,
+			fingerprint TEXT NOT NULL,
+			status INTEGER,
+			header TEXT,
+			body BLOB,
+			created_at DATETIME,
+			expires_at DATETIME
+		);`).Error; err != nil {
+		t.Fatalf("create idempotency_keys: %v", err)
+	}
+	postRepo := repository.NewPostRepository(db)
+	h := NewReportHandler(services.NewReportService(postRepo, nil, nil))
+	jwtSvc := auth.NewJWTService()
+	authMw := auth.AuthMiddleware(jwtSvc, nil)
+	idem := middleware.NewIdempotency(repository.NewIdempotencyRepository(db), time.Hour)
+	routes := map[string]http.Handler{
+		"/report":  authMw(idem.Wrap(http.HandlerFunc(h.ServeReport))),
+		"/comment": authMw(idem.Wrap(http.HandlerFunc(h.ServeComment))),
+		"/upvote":  authMw(idem.Wrap(http.HandlerFunc(h.ServeUpvote))),
+	}
+
+	alice := models.User{ID: uuid.New(), Name: "Alice", Email: "alice@example.com", PasswordHash: "x"}
+	bob := models.User{ID: uuid.New(), Name: "Bob", Email: "bob@example.com", PasswordHash: "x"}
+	issue := models.Issue{ID: uuid.New(), Name: "Broken Streetlight", Category: "Streetlight"}
+	db.Create(&alice)
+	db.Create(&bob)
+	db.Create(&issue)
+	post := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: alice.ID, Description: "Dark corner", Status: "open", Urgency: 2}
+	db.Create(&post)
+	aliceToken, _ := jwtSvc.GenerateToken(alice.ID)
+	bobToken, _ := jwtSvc.GenerateToken(bob.ID)
+
+	send := func(path, token, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if key != "" {
+			req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		routes[path].ServeHTTP(rr, req)
+		return rr
+	}
+	count := func(model interface{}, where string, args ...interface{}) int64 {
+		var n int64
+		db.Model(model).Where(where, args...).Count(&n)
+		return n
+	}
+
+	// A retried comment is created once and the retry sees the same response.
+	comment := `{"post_id":"` + post.ID.String() + `","content":"Still dark"}`
+	first := send("/comment", aliceToken, "c-1", comment)
+	retry := send("/comment", aliceToken, "c-1", comment)
+	if first.Code != http.StatusOK || retry.Code != http.StatusOK {
+		t.Fatalf("comment: %d then %d", first.Code, retry.Code)
+	}
+	if retry.Body.String() != first.Body.String() || retry.Header().Get(middleware.IdempotentReplayedHeader) != "true" {
+		t.Fatalf("expected replay of %q, got %q (%v)", first.Body.String(), retry.Body.String(), retry.Header())
+	}
+	if n := count(&models.Comment{}, "post_id = ?", post.ID); n != 1 {
+		t.Fatalf("expected 1 comment, got %d", n)
+	}
+
+	// Reusing a key for a different body is rejected.
+	if rr := send("/comment", aliceToken, "c-1", `{"post_id":"`+post.ID.String()+`","content":"Other"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a reused key, got %d", rr.Code)
+	}
+	// Keys are per user: bob's request with the same key is handled.
+	if rr := send("/comment", bobToken, "c-1", comment); rr.Code != http.StatusOK || rr.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+		t.Fatalf("expected bob's comment to be handled, got %d %v", rr.Code, rr.Header())
+	}
+	if n := count(&models.Comment{}, "post_id = ?", post.ID); n != 2 {
+		t.Fatalf("expected 2 comments, got %d", n)
+	}
+
+	// A retried upvote must not toggle the upvote back off.
+	upvote := `{"post_id":"` + post.ID.String() + `"}`
+	for i := 0; i < 2; i++ {
+		if rr := send("/upvote", bobToken, "u-1", upvote); rr.Code != http.StatusOK || rr.Body.String() != "{\"upvoted\":true}\n" {
+			t.Fatalf("upvote attempt %d: %d %s", i, rr.Code, rr.Body.String())
+		}
+	}
+	if n := count(&models.Upvote{}, "post_id = ? AND user_id = ?", post.ID, bob.ID); n != 1 {
+		t.Fatalf("expected bob's upvote to stay, got %d", n)
+	}
+	// Without a key the same request toggles as before.
+	if rr := send("/upvote", bobToken, "", upvote); rr.Body.String() != "{\"upvoted\":false}\n" {
+		t.Fatalf("expected an unkeyed upvote to toggle off, got %s", rr.Body.String())
+	}
+
+	// A retried report creates one post.
+	report := `{"issue_name":"Open Manhole","issue_desc":"Uncovered manhole","issue_cat":"Road","post_desc":"Uncovered manhole near the school","status":"open","urgency":3,"lat":12.97,"lng":77.59}`
+	for i := 0; i < 3; i++ {
+		if rr := send("/report", aliceToken, "r-1", report); rr.Code != http.StatusOK {
+			t.Fatalf("report attempt %d: %d %s", i, rr.Code, rr.Body.String())
+		}
+	}
+	if n := count(&models.Post{}, "description = ?", "Uncovered manhole near the school"); n != 1 {
+		t.Fatalf("expected 1 reported post, got %d", n)
+	}
+
+	// Server errors are not stored, so the retry is handled again.
+	invalid := `{"post_id":"not-a-post","content":"Hello"}`
+	if rr := send("/comment", aliceToken, "c-2", invalid); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected comment on an invalid post id to fail, got %d", rr.Code)
+	}
+	if rr := send("/comment", aliceToken, "c-2", invalid); rr.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+		t.Fatal("a failed request must not be replayed")
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestServePostsBBoxRadiusAndClusters(t *testing.T) {
+	db := setupReportDB(t, "mapposts")
+	postRepo := repository.NewPostRepository(db)
+	h := NewFeedHandler(services.NewFeedService(postRepo, nil))
+
+	user := models.User{ID: uuid.New(), Name: "Mapper", Email: "mapper@example.com", PasswordHash: "x"}
+	issue := models.Issue{ID: uuid.New(), Name: "Map Issue", Category: "Road"}
+	db.Create(&user)
+	db.Create(&issue)
+	for _, loc := range [][2]float64{{26.9000, 75.8000}, {26.9010, 75.8010}, {28.6000, 77.2000}} {
+		p := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Status: "open", Urgency: 1, Lat: loc[0], Lng: loc[1]}
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+	}
+
+	get := func(query string) (int, []models.Post) {
+		req := httptest.NewRequest(http.MethodGet, "/api/posts?"+query, nil)
+		rr := httptest.NewRecorder()
+		h.ServePosts(rr, req)
+		var posts []models.Post
+		if rr.Code == http.StatusOK {
+			if err := json.NewDecoder(rr.Body).Decode(&posts); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return rr.Code, posts
+	}
+
+	if code, posts := get("bbox=75.7,26.8,75.9,27.0"); code != http.StatusOK || len(posts) != 2 {
+		t.Fatalf("bbox: expected 2 posts, got code=%d n=%d", code, len(posts))
+	}
+	code, posts := get("near=26.9,75.8&radius_m=50")
+	if code != http.StatusOK || len(posts) != 1 {
+		t.Fatalf("near: expected 1 post within 50m, got code=%d n=%d", code, len(posts))
+	}
+	if posts[0].DistanceM > 1 {
+		t.Fatalf("expected nearest post at the query point, got distance %.1f", posts[0].DistanceM)
+	}
+	if code, _ := get("bbox=1,2,3"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for malformed bbox, got %d", code)
+	}
+	if code, _ := get(""); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without bbox or near, got %d", code)
+	}
+
+	// At zoom 10 the two Jaipur posts share a cell while Delhi gets its own.
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/clusters?bbox=75,26,78,29&zoom=10", nil)
+	rr := httptest.NewRecorder()
+	h.ServePostClusters(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("clusters: %d %s", rr.Code, rr.Body.String())
+	}
+	var clusters []repository.PostCluster
+	if err := json.NewDecoder(rr.Body).Decode(&clusters); err != nil {
+		t.Fatalf("decode clusters: %v", err)
+	}
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %+v", clusters)
+	}
+	for _, c := range clusters {
+		if c.DominantCategory != "Road" || c.MaxUrgency != 1 {
+			t.Fatalf("unexpected cluster summary %+v", c)
+		}
+		if c.Count == 2 && (c.Lat < 26.9 || c.Lat > 26.901) {
+			t.Fatalf("expected Jaipur centroid, got %+v", c)
+		}
+	}
+}
+
+func TestFindPostsNearReadsNearestFirst(t *testing.T) {
+	db := setupReportDB(t, "postsnear")
+	postRepo := repository.NewPostRepository(db)
+	user := models.User{ID: uuid.New(), Name: "Near", Email: "near@example.com", PasswordHash: "x"}
+	issue := models.Issue{ID: uuid.New(), Name: "Near Issue", Category: "Road"}
+	db.Create(&user)
+	db.Create(&issue)
+	// inserted farthest first, ~400m, ~200m and ~20m north of the query point
+	var ids []uuid.UUID
+	for _, lat := range []float64{26.9036, 26.9018, 26.90018} {
+		p := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Status: "open", Urgency: 1, Lat: lat, Lng: 75.8}
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+		ids = append(ids, p.ID)
+	}
+
+	nearby, err := postRepo.FindPostsNear(26.9, 75.8, 1000, "", nil, 2)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(nearby) != 2 || nearby[0].Post.ID != ids[2] || nearby[1].Post.ID != ids[1] {
+		t.Fatalf("expected the two nearest posts, nearest first, got %+v", nearby)
+	}
+}
@@ -7,11 +7,20 @@ import (
 )
 
 type MLHandler struct {
-	// Empty for now - we'll call service functions directly
+	Predictor  services.UrgencyPredictor
+	Classifier services.ImageClassifier
 }
 
-func NewMLHandler() *MLHandler {
-	return &MLHandler{}
+// NewMLHandler creates an MLHandler. Nil arguments fall back to the local
+// heuristic predictor and a no-op classifier.
+func NewMLHandler(predictor services.UrgencyPredictor, classifier services.ImageClassifier) *MLHandler {
+	if predictor == nil {
+		predictor = services.HeuristicPredictor{}
+	}
+	if classifier == nil {
+		classifier = services.NoopImageClassifier{}
+	}
+	return &MLHandler{Predictor: predictor, Classifier: classifier}
 }
 
 // ClassifyImageRequest contains the image URL to classify
@@ -45,7 +54,7 @@ func (h *MLHandler) ServeClassifyImage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call the ML service to classify the image
-	classified, err := services.ClassifyImage(req.ImageURL)
+	classified, err := h.Classifier.ClassifyImage(req.ImageURL)
 	if err != nil {
 		// Return 200 with error message so frontend can degrade gracefully without console 500s
 		w.Header().Set("Content-Type", "application/json")
@@ -70,10 +79,14 @@ type PredictUrgencyRequest struct {
 	Text string `json:"text"`
 }
 
-// PredictUrgencyResponse contains the predicted urgency
+// PredictUrgencyResponse contains the predicted urgency and the factors
+// behind it
 type PredictUrgencyResponse struct {
-	Urgency int    `json:"urgency"`
-	Error   string `json:"error,omitempty"`
+	Urgency     int                          `json:"urgency"`
+	Score       float64                      `json:"score"`
+	Source      string                       `json:"source"`
+	Explanation *services.UrgencyExplanation `json:"explanation,omitempty"`
+	Error       string                       `json:"error,omitempty"`
 }
 
 // ServePredictUrgency handles urgency prediction requests from the frontend
@@ -95,18 +108,17 @@ func (h *MLHandler) ServePredictUrgency(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-    // Call the ML service to predict urgency. Service now internally falls back to heuristic.
-    urgency, err := services.PredictUrgency(req.Text)
-    if err != nil {
-        // Graceful heuristic fallback if error surfaces (e.g. legacy code path)
-        scoreUrg, _, _ := services.PredictUrgencyDetailed(req.Text)
-        urgency = scoreUrg
-    }
+	// Call the configured predictor; the explanation falls back to the local
+	// heuristic so the frontend never sees a 500 while the user is typing.
+	explanation := services.ExplainUrgency(h.Predictor, req.Text)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(PredictUrgencyResponse{
-		Urgency: urgency,
-		Error:   "", // Always blank; fallback prevents 500
+		Urgency:     explanation.Urgency,
+		Score:       explanation.Score,
+		Source:      explanation.Source,
+		Explanation: &explanation,
+		Error:       "", // Always blank; fallback prevents 500
 	})
 }
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	config "crowdsourcedurbanissuereportingwithai/backend/configs"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+
+	"github.com/google/uuid"
+)
+
+// oidcStateCookie holds the signed state of a sign-in in progress at an
+// identity provider.
+const oidcStateCookie = "oidc_state"
+
+// oidcStateTTL is how long a user has to complete a sign-in at a provider.
+const oidcStateTTL = 10 * time.Minute
+
+// ProviderResp describes an identity provider on GET /auth/providers.
+type ProviderResp struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
+
+// ServeProviders handles GET /auth/providers, listing the identity providers
+// users can be sent to for sign-in.
+func (h *AuthHandler) ServeProviders(w http.ResponseWriter, r *http.Request) {
+	out := []ProviderResp{}
+	for _, p := range h.Providers.Providers() {
+		if p.CodeFlow {
+			out = append(out, ProviderResp{Name: p.Name, DisplayName: p.DisplayName, LoginURL: "/auth/oidc/" + p.Name + "/login"})
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// OIDCLogin handles GET /auth/oidc/{provider}/login?redirect=/path. It sends
+// the browser to the provider with a fresh state, nonce and PKCE challenge,
+// remembered in a signed cookie for the callback.
+func (h *AuthHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.codeFlowProvider(w, r)
+	if !ok {
+		return
+	}
+	authURL, err := h.beginOIDC(w, r, p, uuid.Nil)
+	if err != nil {
+		log.Printf("oidc %s: cannot start sign-in: %v", p.Name, err)
+		http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCLink handles POST /auth/oidc/{provider}/link?redirect=/path for a
+// signed-in user. It answers with the provider URL to send the browser to;
+// once the user signs in there, the provider account is linked to theirs.
+// Only users with a verified email can link providers.
+func (h *AuthHandler) OIDCLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.AuthService.UserRepo.GetByID(userID)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if user.EmailVerifiedAt == nil {
+		http.Error(w, "verify your email before linking another sign-in method", http.StatusForbidden)
+		return
+	}
+	p, ok := h.codeFlowProvider(w, r)
+	if !ok {
+		return
+	}
+	authURL, err := h.beginOIDC(w, r, p, userID)
+	if err != nil {
+		log.Printf("oidc %s: cannot start linking: %v", p.Name, err)
+		http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"authorization_url": authURL})
+}
+
+// OIDCCallback handles GET /auth/oidc/{provider}/callback, where the provider
+// sends the browser back with an authorization code. The code is exchanged
+// for an ID token, the user it names is signed in, and the browser is
+// redirected to the frontend with the tokens in the URL fragment, which never
+// reaches a server.
+func (h *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.codeFlowProvider(w, r)
+	if !ok {
+		return
+	}
+	c, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		http.Error(w, "sign-in expired, please try again", http.StatusBadRequest)
+		return
+	}
+	st, err := h.JWTService.ParseOIDCState(c.Value)
+	q := r.URL.Query()
+	if err != nil || st.Provider != p.Name || st.State == "" || q.Get("state") != st.State {
+		http.Error(w, "invalid sign-in state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, authCookie(oidcStateCookie, "", "/auth/oidc/", time.Unix(0, 0)))
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "sign-in was not completed: "+e, http.StatusUnauthorized)
+		return
+	}
+	claims, err := p.Exchange(r.Context(), q.Get("code"), h.oidcRedirectURL(r, p), st.CodeVerifier, st.Nonce)
+	if err != nil {
+		log.Printf("oidc %s: sign-in failed: %v", p.Name, err)
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			http.Error(w, "your account at the identity provider has no verified email", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "sign-in failed", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.Identities.SignIn(services.ExternalIdentity{
+		Provider: p.Name,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		Name:     claims.Name,
+		Roles:    p.Roles(claims),
+	}, st.LinkUserID)
+	if err != nil {
+		if errors.Is(err, services.ErrIdentityLinked) {
+			http.Error(w, "this account is already linked to another user", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrLinkUnverified) {
+			http.Error(w, "verify your email before linking another sign-in method", http.StatusForbidden)
+			return
+		}
+		log.Printf("oidc %s: cannot sign in %s: %v", p.Name, claims.Subject, err)
+		http.Error(w, "failed to sign in", http.StatusInternalServerError)
+		return
+	}
+	resp, err := h.signIn(w, r, user)
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, authCookie("access_token", resp.AccessToken, "/", time.Now().Add(h.JWTService.AccessTokenTTL())))
+	fragment := url.Values{"access_token": {resp.AccessToken}}
+	if resp.RefreshToken != "" {
+		fragment.Set("refresh_token", resp.RefreshToken)
+		fragment.Set("expires_in", strconv.FormatInt(resp.ExpiresIn, 10))
+	}
+	http.Redirect(w, r, st.Redirect+"#"+fragment.Encode(), http.StatusFound)
+}
+
+// ListIdentities handles GET /auth/identities, returning the provider
+// accounts linked to the caller.
+func (h *AuthHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok || h.Identities == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	identities, err := h.Identities.List(userID)
+	if err != nil {
+		http.Error(w, "failed to fetch identities", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, identities)
+}
+
+func (h *AuthHandler) codeFlowProvider(w http.ResponseWriter, r *http.Request) (*auth.OIDCProvider, bool) {
+	p, ok := h.Providers.Get(r.PathValue("provider"))
+	if !ok || !p.CodeFlow || h.Identities == nil {
+		http.Error(w, "unknown identity provider", http.StatusNotFound)
+		return nil, false
+	}
+	return p, true
+}
+
+// beginOIDC stores the state of a new sign-in in a cookie and returns the
+// provider URL that starts it.
+func (h *AuthHandler) beginOIDC(w http.ResponseWriter, r *http.Request, p *auth.OIDCProvider, linkTo uuid.UUID) (string, error) {
+	st := auth.OIDCFlowState{Provider: p.Name, Redirect: safeRedirect(r.URL.Query().Get("redirect")), LinkUserID: linkTo}
+	for _, v := range []*string{&st.State, &st.Nonce, &st.CodeVerifier} {
+		var err error
+		if *v, err = auth.NewPKCEVerifier(); err != nil {
+			return "", err
+		}
+	}
+	authURL, err := p.AuthCodeURL(r.Context(), h.oidcRedirectURL(r, p), st.State, st.Nonce, auth.PKCEChallenge(st.CodeVerifier))
+	if err != nil {
+		return "", err
+	}
+	signed, err := h.JWTService.SignOIDCState(st, oidcStateTTL)
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, authCookie(oidcStateCookie, signed, "/auth/oidc/", time.Now().Add(oidcStateTTL)))
+	return authURL, nil
+}
+
+// oidcRedirectURL returns the callback URL registered at the provider, based
+// on PUBLIC_BASE_URL or else the request.
+func (h *AuthHandler) oidcRedirectURL(r *http.Request, p *auth.OIDCProvider) string {
+	base := config.GetPublicBaseURL()
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + "/auth/oidc/" + p.Name + "/callback"
+}
+
+// safeRedirect returns raw if it is a path on this site or a page of the
+// frontend at ALLOWED_ORIGIN, and "/index.html" otherwise, so the sign-in
+// flow cannot be used to send users (and their tokens) to another site.
+// Browsers drop tabs and newlines from URLs and treat "\" like "/", so a
+// value such as "/\t/evil.com" is refused rather than sent on as "//evil.com".
+func safeRedirect(raw string) string {
+	const fallback = "/index.html"
+	if hasUnsafeURLChars(raw) {
+		return fallback
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Opaque != "" || u.User != nil || u.Fragment != "" || hasUnsafeURLChars(u.Path) {
+		return fallback
+	}
+	if u.Scheme == "" && u.Host == "" {
+		if !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") || !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") {
+			return fallback
+		}
+		return raw
+	}
+	ao := config.GetAllowedOrigin()
+	if ao == "" {
+		return fallback
+	}
+	origin, err := url.Parse(ao)
+	if err != nil || origin.Host == "" {
+		return fallback
+	}
+	if (u.Scheme == "https" || u.Scheme == "http") && strings.EqualFold(u.Scheme, origin.Scheme) && strings.EqualFold(u.Host, origin.Host) {
+		return raw
+	}
+	return fallback
+}
+
+// hasUnsafeURLChars reports whether s contains control characters or a
+// backslash.
+func hasUnsafeURLChars(s string) bool {
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f || r == '\\' {
+			return true
+		}
+	}
+	return false
+}
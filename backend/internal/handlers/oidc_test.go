@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+func setupIdentityTable(t *testing.T, db *gorm.DB) {
+	create := `CREATE TABLE IF NOT EXISTS user_identities (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		email TEXT,
+		created_at DATETIME,
+		last_login_at DATETIME,
+		UNIQUE (provider, subject)
+	);`
+	if err := db.Exec(create).Error; err != nil {
+		t.Fatalf("create user_identities table: %v", err)
+	}
+}
+
+// fakeIdP is a minimal OpenID Connect provider: it publishes a discovery
+// document and keys, and redeems codes handed out by the test for the PKCE
+// challenge they were issued for.
+type fakeIdP struct {
+	t   *testing.T
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge, nonce, redirectURI string
+	claims                        jwt.MapClaims
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	idp := &fakeIdP{t: t, key: key, codes: map[string]fakeGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []auth.JWK{{
+			Kty: "RSA",
+			Kid: "city-1",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.serveToken)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+// authorize plays the user signing in at the provider: it returns the code
+// the provider would send back for the authorization URL.
+func (idp *fakeIdP) authorize(authURL string, claims jwt.MapClaims) (code, state string) {
+	u, err := url.Parse(authURL)
+	if err != nil || !strings.HasPrefix(authURL, idp.srv.URL+"/authorize") {
+		idp.t.Fatalf("unexpected authorization URL %q", authURL)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("client_id") != "civic" {
+		idp.t.Fatalf("authorization URL lacks PKCE or client: %q", authURL)
+	}
+	code, _ = auth.NewPKCEVerifier()
+	idp.mu.Lock()
+	idp.codes[code] = fakeGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), redirectURI: q.Get("redirect_uri"), claims: claims}
+	idp.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (idp *fakeIdP) serveToken(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	r.ParseForm()
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.FormValue("code")]
+	delete(idp.codes, r.FormValue("code"))
+	idp.mu.Unlock()
+	if id != "civic" || secret != "s3cret" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if !ok || r.FormValue("grant_type") != "authorization_code" || r.FormValue("redirect_uri") != grant.redirectURI ||
+		auth.PKCEChallenge(r.FormValue("code_verifier")) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	claims := jwt.MapClaims{
+		"iss":   idp.srv.URL,
+		"aud":   "civic",
+		"nonce": grant.nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = "city-1"
+	signed, err := tok.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatalf("sign id token: %v", err)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+func TestOIDCSignInWithRoleMappingAndLinking(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	db := setupReportDB(t, "oidc")
+	setupRoleTables(t, db)
+	setupIdentityTable(t, db)
+	userRepo := repository.NewUserRepository(db)
+	authSvc := services.NewAuthService(userRepo)
+	roleSvc := services.NewRoleService(repository.NewRoleRepository(db), userRepo)
+	if err := roleSvc.SeedDefaults(); err != nil {
+		t.Fatalf("seed roles: %v", err)
+	}
+
+	idp := newFakeIdP(t)
+	city := auth.NewOIDCProvider("city", idp.srv.URL, "civic", "s3cret")
+	city.DisplayName = "City staff"
+	city.RoleClaim = "groups"
+	city.RoleMap = map[string]string{"public-works": models.RoleDepartmentStaff}
+	providers := auth.NewOIDCRegistry()
+	providers.Register(city)
+
+	jwtSvc := auth.NewJWTService()
+	authHandler := NewAuthHandler(authSvc, jwtSvc, nil)
+	authHandler.Roles = roleSvc
+	authHandler.Providers = providers
+	authHandler.Identities = services.NewIdentityService(repository.NewIdentityRepository(db), authSvc, roleSvc)
+	authMw := auth.AuthMiddleware(jwtSvc, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login", authHandler.Login)
+	mux.HandleFunc("GET /auth/providers", authHandler.ServeProviders)
+	mux.HandleFunc("GET /auth/oidc/{provider}/login", authHandler.OIDCLogin)
+	mux.HandleFunc("GET /auth/oidc/{provider}/callback", authHandler.OIDCCallback)
+	mux.Handle("POST /auth/oidc/{provider}/link", authMw(http.HandlerFunc(authHandler.OIDCLink)))
+	mux.Handle("GET /auth/identities", authMw(http.HandlerFunc(authHandler.ListIdentities)))
+
+	do := func(method, path, token string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	stateCookie := func(rr *httptest.ResponseRecorder) *http.Cookie {
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == oidcStateCookie {
+				return c
+			}
+		}
+		t.Fatalf("no %s cookie set", oidcStateCookie)
+		return nil
+	}
+	// signIn runs the redirect flow for a user with the given claims and
+	// returns the claims of the access token it ends with.
+	signIn := func(claims jwt.MapClaims) auth.TokenClaims {
+		rr := do(http.MethodGet, "/auth/oidc/city/login?redirect=/profile.html", "", nil)
+		if rr.Code != http.StatusFound {
+			t.Fatalf("start sign-in: %d %s", rr.Code, rr.Body.String())
+		}
+		code, state := idp.authorize(rr.Header().Get("Location"), claims)
+		rr = do(http.MethodGet, "/auth/oidc/city/callback?code="+code+"&state="+state, "", stateCookie(rr))
+		if rr.Code != http.StatusFound {
+			t.Fatalf("callback: %d %s", rr.Code, rr.Body.String())
+		}
+		loc := rr.Header().Get("Location")
+		path, fragment, _ := strings.Cut(loc, "#")
+		values, _ := url.ParseQuery(fragment)
+		if path != "/profile.html" || values.Get("access_token") == "" {
+			t.Fatalf("unexpected redirect %q", loc)
+		}
+		tc, err := jwtSvc.ParseToken(values.Get("access_token"))
+		if err != nil {
+			t.Fatalf("parse token: %v", err)
+		}
+		return tc
+	}
+
+	var listed []ProviderResp
+	if rr := do(http.MethodGet, "/auth/providers", "", nil); json.NewDecoder(rr.Body).Decode(&listed) != nil || len(listed) != 1 || listed[0].LoginURL != "/auth/oidc/city/login" {
+		t.Fatalf("unexpected providers %+v", listed)
+	}
+
+	// City staff sign in and get the role mapped from their group.
+	staff := jwt.MapClaims{"sub": "staff-1", "email": "kim@city.example.gov", "email_verified": true, "name": "Kim", "groups": []string{"public-works", "everyone"}}
+	kim := signIn(staff)
+	if kim.Role != models.RoleDepartmentStaff || !contains(kim.Permissions, models.PermPostsUpdateStatus) {
+		t.Fatalf("expected department_staff from the groups claim, got %+v", kim)
+	}
+	if u, err := userRepo.GetByID(kim.UserID); err != nil || u.EmailVerifiedAt == nil {
+		t.Fatalf("expected the provider's verified email to count as verified, got %+v", u)
+	}
+	// The next sign-in finds the same user; leaving the group drops the role.
+	staff["groups"] = []string{"everyone"}
+	again := signIn(staff)
+	if again.UserID != kim.UserID || again.Role != models.RoleCitizen {
+		t.Fatalf("expected the same user without the mapped role, got %+v", again)
+	}
+
+	// The callback needs the state cookie of the same browser, and the code
+	// only redeems with the PKCE verifier of the sign-in it was issued for.
+	first := do(http.MethodGet, "/auth/oidc/city/login", "", nil)
+	second := do(http.MethodGet, "/auth/oidc/city/login", "", nil)
+	_, firstState := idp.authorize(first.Header().Get("Location"), staff)
+	code, secondState := idp.authorize(second.Header().Get("Location"), staff)
+	if rr := do(http.MethodGet, "/auth/oidc/city/callback?code="+code+"&state="+secondState, "", nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a callback without the state cookie to fail, got %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/auth/oidc/city/callback?code="+code+"&state="+firstState, "", stateCookie(first)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a code redeemed with another sign-in's verifier to fail, got %d", rr.Code)
+	}
+
+	// A password user links their city account and can then use either,
+	// once their email is verified.
+	patUser, err := authSvc.Register("Pat", "pat@example.com", "pass1234")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	passwordLogin := func(email, password string) string {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`)))
+		var tr map[string]string
+		json.NewDecoder(rr.Body).Decode(&tr)
+		return tr["access_token"]
+	}
+	patToken := passwordLogin("pat@example.com", "pass1234")
+	if rr := do(http.MethodPost, "/auth/oidc/city/link", patToken, nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected linking from an unverified account to be refused, got %d", rr.Code)
+	}
+	if _, err := userRepo.MarkEmailVerified(patUser.ID, patUser.Email, time.Now()); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	link := func(claims jwt.MapClaims) *httptest.ResponseRecorder {
+		rr := do(http.MethodPost, "/auth/oidc/city/link?redirect=/profile.html", patToken, nil)
+		var body map[string]string
+		if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&body) != nil {
+			t.Fatalf("start linking: %d", rr.Code)
+		}
+		code, state := idp.authorize(body["authorization_url"], claims)
+		return do(http.MethodGet, "/auth/oidc/city/callback?code="+code+"&state="+state, "", stateCookie(rr))
+	}
+	if rr := link(jwt.MapClaims{"sub": "staff-2", "email": "pat.m@city.example.gov", "email_verified": true}); rr.Code != http.StatusFound {
+		t.Fatalf("link: %d %s", rr.Code, rr.Body.String())
+	}
+	var identities []models.UserIdentity
+	if rr := do(http.MethodGet, "/auth/identities", patToken, nil); json.NewDecoder(rr.Body).Decode(&identities) != nil || len(identities) != 1 || identities[0].Subject != "staff-2" {
+		t.Fatalf("expected the linked city identity, got %+v", identities)
+	}
+	pat := signIn(jwt.MapClaims{"sub": "staff-2", "email": "pat.m@city.example.gov", "email_verified": true})
+	if pat.UserID != identities[0].UserID {
+		t.Fatalf("expected city sign-in to reach Pat's account")
+	}
+	// Kim's city account cannot be linked to Pat.
+	if rr := link(staff); rr.Code != http.StatusConflict {
+		t.Fatalf("expected linking another user's identity to conflict, got %d", rr.Code)
+	}
+
+	// Someone registered Lee's address before Lee did, and had linked a
+	// provider account of their own to it (say before linking needed a
+	// verified email). The account is unverified, so Lee's city sign-in takes
+	// it over: the squatter's password stops working and their provider
+	// account is unlinked.
+	squatter, err := authSvc.Register("Not Lee", "lee@city.example.gov", "squat1234")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if squatterToken := passwordLogin("lee@city.example.gov", "squat1234"); do(http.MethodPost, "/auth/oidc/city/link", squatterToken, nil).Code != http.StatusForbidden {
+		t.Fatal("expected the squatter not to be able to link a provider")
+	}
+	identityRepo := repository.NewIdentityRepository(db)
+	if err := identityRepo.CreateIdentity(&models.UserIdentity{UserID: squatter.ID, Provider: "city", Subject: "squatter-1", Email: "squatter@example.com", CreatedAt: time.Now(), LastLoginAt: time.Now()}); err != nil {
+		t.Fatalf("link squatter identity: %v", err)
+	}
+	lee := signIn(jwt.MapClaims{"sub": "staff-3", "email": "lee@city.example.gov", "email_verified": true})
+	if lee.UserID != squatter.ID {
+		t.Fatalf("expected Lee's sign-in to reach the account with Lee's email")
+	}
+	if passwordLogin("lee@city.example.gov", "squat1234") != "" {
+		t.Fatal("expected the squatter's password to be replaced")
+	}
+	if ids, _ := identityRepo.ListIdentities(lee.UserID); len(ids) != 1 || ids[0].Subject != "staff-3" {
+		t.Fatalf("expected only Lee's identity to stay linked, got %+v", ids)
+	}
+	if again := signIn(jwt.MapClaims{"sub": "squatter-1", "email": "squatter@example.com", "email_verified": true}); again.UserID == lee.UserID {
+		t.Fatal("expected the squatter's provider account not to reach Lee's account")
+	}
+
+	if got := safeRedirect("https://evil.example.com/"); got != "/index.html" {
+		t.Fatalf("expected an external redirect to be replaced, got %q", got)
+	}
+	if got := safeRedirect("//evil.example.com/"); got != "/index.html" {
+		t.Fatalf("expected a protocol-relative redirect to be replaced, got %q", got)
+	}
+}
+
+func TestSafeRedirect(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGIN", "https://civic.example.com")
+	cases := map[string]string{
+		"/profile.html?tab=me":                 "/profile.html?tab=me",
+		"https://civic.example.com/index.html": "https://civic.example.com/index.html",
+		"":                                     "/index.html",
+		"profile.html":                         "/index.html",
+		"//evil.example.com/":                  "/index.html",
+		"/\\evil.example.com/":                 "/index.html",
+		"/\t/evil.example.com/":                "/index.html",
+		"/\n/evil.example.com/":                "/index.html",
+		"/\r\n/evil.example.com/":              "/index.html",
+		"/%2F/evil.example.com/":               "/index.html",
+		"/page#access_token=x":                 "/index.html",
+		"https://evil.example.com/":            "/index.html",
+		"https://civic.example.com.evil.com/":  "/index.html",
+		"https://civic.example.com@evil.com/":  "/index.html",
+		"http://civic.example.com/index.html":  "/index.html",
+		"javascript:alert(1)":                  "/index.html",
+	}
+	for in, want := range cases {
+		if got := safeRedirect(in); got != want {
+			t.Errorf("safeRedirect(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestOIDCLoginRefusesTabRedirect(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	idp := newFakeIdP(t)
+	providers := auth.NewOIDCRegistry()
+	providers.Register(auth.NewOIDCProvider("city", idp.srv.URL, "civic", "s3cret"))
+	db := setupReportDB(t, "oidc-redirect")
+	setupIdentityTable(t, db)
+	authSvc := services.NewAuthService(repository.NewUserRepository(db))
+	jwtSvc := auth.NewJWTService()
+	h := NewAuthHandler(authSvc, jwtSvc, nil)
+	h.Providers = providers
+	h.Identities = services.NewIdentityService(repository.NewIdentityRepository(db), authSvc, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /auth/oidc/{provider}/login", h.OIDCLogin)
+
+	for _, redirect := range []string{"/%09/evil.com", "/%0A/evil.com", "/%5C/evil.com"} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/auth/oidc/city/login?redirect="+redirect, nil))
+		var cookie *http.Cookie
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == oidcStateCookie {
+				cookie = c
+			}
+		}
+		if rr.Code != http.StatusFound || cookie == nil {
+			t.Fatalf("start sign-in: %d", rr.Code)
+		}
+		st, err := jwtSvc.ParseOIDCState(cookie.Value)
+		if err != nil || st.Redirect != "/index.html" {
+			t.Fatalf("redirect %q: expected the callback to return to /index.html, got %q (%v)", redirect, st.Redirect, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestPersonalFeedAndPlaces(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+
+	db := setupReportDB(t, "personalfeed")
+	userRepo := repository.NewUserRepository(db)
+	feedSvc := services.NewFeedService(repository.NewPostRepository(db), nil)
+	feedSvc.UserRepo = userRepo
+	h := NewFeedHandler(feedSvc)
+	jwtSvc := auth.NewJWTService()
+
+	user := models.User{ID: uuid.New(), Name: "Local", Email: "local@example.com", PasswordHash: "x"}
+	db.Create(&user)
+	issue := models.Issue{ID: uuid.New(), Name: "Personal Pothole", Category: "Road"}
+	db.Create(&issue)
+	// Same description, urgency and age; only the location differs.
+	now := time.Now().Add(-time.Hour)
+	far := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Description: "Pothole", Status: "open", Urgency: 2, Lat: 28.70, Lng: 77.10, CreatedAt: now}
+	near := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Description: "Pothole", Status: "open", Urgency: 2, Lat: 12.97, Lng: 77.59, CreatedAt: now}
+	db.Create(&far)
+	db.Create(&near)
+
+	token, _ := jwtSvc.GenerateToken(user.ID)
+	authed := func(method, target string, body []byte) *http.Request {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/feed", auth.OptionalAuthMiddleware(jwtSvc, nil)(http.HandlerFunc(h.ServeFeed)))
+	authMw := auth.AuthMiddleware(jwtSvc, nil)
+	mux.Handle("GET /api/me/places", authMw(http.HandlerFunc(h.ServePlaces)))
+	mux.Handle("POST /api/me/places", authMw(http.HandlerFunc(h.ServeAddPlace)))
+	mux.Handle("DELETE /api/me/places/{id}", authMw(http.HandlerFunc(h.ServeDeletePlace)))
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	feed := func(req *http.Request) []models.Post {
+		rr := serve(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("feed: %d %s", rr.Code, rr.Body.String())
+		}
+		var posts []models.Post
+		json.NewDecoder(rr.Body).Decode(&posts)
+		if len(posts) != 2 {
+			t.Fatalf("expected 2 posts, got %d", len(posts))
+		}
+		return posts
+	}
+
+	// Anonymous users and users without places get the global ranking.
+	anon := feed(httptest.NewRequest(http.MethodGet, "/feed?for=me", nil))
+	if anon[0].Score != anon[1].Score {
+		t.Fatalf("expected equal global scores, got %v and %v", anon[0].Score, anon[1].Score)
+	}
+
+	rr := serve(authed(http.MethodPost, "/api/me/places", []byte(`{"kind":"mars","lat":0,"lng":0}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("unknown kind: expected 400, got %d", rr.Code)
+	}
+	rr = serve(authed(http.MethodPost, "/api/me/places", []byte(`{"kind":"home","name":"Home","lat":12.971,"lng":77.594}`)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("add place: %d %s", rr.Code, rr.Body.String())
+	}
+	var place models.UserPlace
+	json.NewDecoder(rr.Body).Decode(&place)
+	if place.RadiusM != 2000 || place.UserID != user.ID {
+		t.Fatalf("unexpected place %+v", place)
+	}
+
+	personal := feed(authed(http.MethodGet, "/feed?for=me", nil))
+	if personal[0].ID != near.ID {
+		t.Fatalf("expected the post near home first, got %s", personal[0].ID)
+	}
+	if personal[0].Score <= personal[1].Score || personal[0].DistanceM > 2000 {
+		t.Fatalf("expected a boosted nearby post, got %+v", personal[0])
+	}
+
+	rr = serve(authed(http.MethodGet, "/api/me/places", nil))
+	var places []models.UserPlace
+	json.NewDecoder(rr.Body).Decode(&places)
+	if len(places) != 1 {
+		t.Fatalf("expected 1 place, got %d", len(places))
+	}
+	if rr = serve(authed(http.MethodDelete, "/api/me/places/"+place.ID.String(), nil)); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete place: %d", rr.Code)
+	}
+	if rr = serve(authed(http.MethodDelete, "/api/me/places/"+place.ID.String(), nil)); rr.Code != http.StatusNotFound {
+		t.Fatalf("delete missing place: expected 404, got %d", rr.Code)
+	}
+	if rr = serve(httptest.NewRequest(http.MethodGet, "/api/me/places", nil)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous places: expected 401, got %d", rr.Code)
+	}
+}
+
+func TestPersonalFeedReachesPostsOutsideGlobalTop(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	os.Setenv("FEED_LIMIT", "1")
+	defer os.Unsetenv("FEED_LIMIT")
+
+	db := setupReportDB(t, "personalreach")
+	feedSvc := services.NewFeedService(repository.NewPostRepository(db), nil)
+	feedSvc.UserRepo = repository.NewUserRepository(db)
+	jwtSvc := auth.NewJWTService()
+	serveFeed := auth.OptionalAuthMiddleware(jwtSvc, nil)(http.HandlerFunc(NewFeedHandler(feedSvc).ServeFeed))
+
+	user := models.User{ID: uuid.New(), Name: "Local", Email: "reach@example.com", PasswordHash: "x"}
+	db.Create(&user)
+	issue := models.Issue{ID: uuid.New(), Name: "Reach Pothole", Category: "Road"}
+	db.Create(&issue)
+	// The nearby post is older, so the global feed of one post leaves it out.
+	near := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Description: "Pothole", Status: "open", Urgency: 2, Lat: 12.97, Lng: 77.59, CreatedAt: time.Now().Add(-2 * time.Hour)}
+	far := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Description: "Pothole", Status: "open", Urgency: 2, Lat: 28.70, Lng: 77.10, CreatedAt: time.Now().Add(-time.Hour)}
+	db.Create(&near)
+	db.Create(&far)
+	if _, err := feedSvc.AddPlace(user.ID, models.UserPlace{Kind: models.PlaceHome, Lat: 12.971, Lng: 77.594}); err != nil {
+		t.Fatalf("add place: %v", err)
+	}
+
+	token, _ := jwtSvc.GenerateToken(user.ID)
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		serveFeed.ServeHTTP(rr, req)
+		return rr
+	}
+	var global, personal []models.Post
+	json.NewDecoder(get("/feed").Body).Decode(&global)
+	if len(global) != 1 || global[0].ID != far.ID {
+		t.Fatalf("expected the global feed to hold only the newer far post, got %+v", global)
+	}
+	json.NewDecoder(get("/feed?for=me").Body).Decode(&personal)
+	if len(personal) != 1 || personal[0].ID != near.ID {
+		t.Fatalf("expected the personal feed to find the post near home, got %+v", personal)
+	}
+
+	// The personal ranking has no pages; a cursor must not silently drop it.
+	if rr := get("/feed?for=me&cursor=abc"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected for=me with a cursor to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestPersonalFeedReachesPostsAroundEveryPlace(t *testing.T) {
+	os.Setenv("FEED_LIMIT", "2")
+	defer os.Unsetenv("FEED_LIMIT")
+
+	db := setupReportDB(t, "personalplaces")
+	feedSvc := services.NewFeedService(repository.NewPostRepository(db), nil)
+	feedSvc.UserRepo = repository.NewUserRepository(db)
+
+	user := models.User{ID: uuid.New(), Name: "Commuter", Email: "commuter@example.com", PasswordHash: "x"}
+	db.Create(&user)
+	issue := models.Issue{ID: uuid.New(), Name: "Places Pothole", Category: "Road"}
+	db.Create(&issue)
+	post := func(lat, lng float64, age time.Duration) models.Post {
+		p := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Description: "Pothole", Status: "open", Urgency: 2, Lat: lat, Lng: lng, CreatedAt: time.Now().Add(-age)}
+		db.Create(&p)
+		return p
+	}
+	// The two far posts are the newest, so they fill the global feed.
+	post(28.70, 77.10, time.Hour)
+	post(19.07, 72.87, 2*time.Hour)
+	home := post(12.97, 77.59, 3*time.Hour)
+	work := post(13.08, 80.27, 4*time.Hour)
+	for _, pl := range []models.UserPlace{
+		{Kind: models.PlaceHome, Lat: 12.971, Lng: 77.594},
+		{Kind: models.PlaceWork, Lat: 13.081, Lng: 80.271},
+	} {
+		if _, err := feedSvc.AddPlace(user.ID, pl); err != nil {
+			t.Fatalf("add place: %v", err)
+		}
+	}
+
+	posts, err := feedSvc.GetPersonalFeed(user.ID)
+	if err != nil {
+		t.Fatalf("personal feed: %v", err)
+	}
+	got := map[uuid.UUID]bool{}
+	for _, p := range posts {
+		got[p.ID] = true
+	}
+	if len(posts) != 2 || !got[home.ID] || !got[work.ID] {
+		t.Fatalf("expected the posts near home and work, got %+v", posts)
+	}
+
+	for i := 2; i < services.MaxUserPlaces; i++ {
+		if _, err := feedSvc.AddPlace(user.ID, models.UserPlace{Kind: models.PlaceArea, Lat: 10, Lng: 10}); err != nil {
+			t.Fatalf("add place %d: %v", i+1, err)
+		}
+	}
+	if _, err := feedSvc.AddPlace(user.ID, models.UserPlace{Kind: models.PlaceArea, Lat: 10, Lng: 10}); !errors.Is(err, services.ErrTooManyPlaces) {
+		t.Fatalf("expected too many places, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PlaceRequest is the body of POST /api/me/places. Kind is home, work or
+// area (a followed neighbourhood); RadiusM defaults by kind.
+type PlaceRequest struct {
+	Kind    string  `json:"kind"`
+	Name    string  `json:"name"`
+	Lat     float64 `json:"lat"`
+	Lng     float64 `json:"lng"`
+	RadiusM float64 `json:"radius_m"`
+}
+
+// ServePlaces handles GET /api/me/places.
+func (h *FeedHandler) ServePlaces(w http.ResponseWriter, r *http.Request) {
+	uid, ok := placesUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	places, err := h.FeedService.ListPlaces(uid)
+	if err != nil {
+		http.Error(w, "Failed to fetch places", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, places)
+}
+
+// ServeAddPlace handles POST /api/me/places.
+func (h *FeedHandler) ServeAddPlace(w http.ResponseWriter, r *http.Request) {
+	uid, ok := placesUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req PlaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	place, err := h.FeedService.AddPlace(uid, models.UserPlace{Kind: req.Kind, Name: req.Name, Lat: req.Lat, Lng: req.Lng, RadiusM: req.RadiusM})
+	switch {
+	case errors.Is(err, services.ErrInvalidPlace):
+		http.Error(w, "Invalid place: kind must be home, work or area, radius_m between 100 and 20000", http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrTooManyPlaces):
+		http.Error(w, "Too many places", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to save place", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, place)
+}
+
+// ServeDeletePlace handles DELETE /api/me/places/{id}.
+func (h *FeedHandler) ServeDeletePlace(w http.ResponseWriter, r *http.Request) {
+	uid, ok := placesUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	placeID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid place ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.FeedService.DeletePlace(uid, placeID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Place not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete place", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// placesUserID returns the signed-in user, or the dev user when auth is
+// disabled for local testing.
+func placesUserID(r *http.Request) (uuid.UUID, bool) {
+	if uid, ok := auth.GetUserIDFromContext(r.Context()); ok {
+		return uid, true
+	}
+	return DevTestUserID, DevTestUserID != uuid.Nil
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+)
+
+// flakyPredictor fails a fixed number of times before answering.
+type flakyPredictor struct {
+	failures int
+	calls    int
+}
+
+func (p *flakyPredictor) PredictUrgency(string) (services.Prediction, error) {
+	p.calls++
+	if p.calls <= p.failures {
+		return services.Prediction{}, errors.New("model unavailable")
+	}
+	return services.Prediction{Urgency: 3, Score: 0.9, Source: services.SourceML}, nil
+}
+
+type staticClassifier string
+
+func (c staticClassifier) ClassifyImage(string) (string, error) { return string(c), nil }
+
+func TestAsyncReportIsEnrichedByWorker(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	os.Setenv("DUPLICATE_MODE", "off")
+	defer os.Unsetenv("DUPLICATE_MODE")
+
+	db := setupReportDB(t, "enrichment")
+	postRepo := repository.NewPostRepository(db)
+	authSvc := services.NewAuthService(repository.NewUserRepository(db))
+	predictor := &flakyPredictor{failures: 1}
+	// the request path must not call the models at all
+	reportSvc := services.NewReportService(postRepo, &flakyPredictor{failures: 1000}, nil)
+	reportSvc.AsyncEnrichment = true
+	jwtSvc := auth.NewJWTService()
+	report := auth.AuthMiddleware(jwtSvc, nil)(http.HandlerFunc(NewReportHandler(reportSvc).ServeReport))
+
+	user, err := authSvc.Register("Async", "async@example.com", "password")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	token, _ := jwtSvc.GenerateToken(user.ID)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"issue_name": "Fallen tree",
+		"issue_cat":  "Road",
+		"post_desc":  "Tree fell across the road",
+		"status":     "open",
+		"urgency":    1,
+		"lat":        12.97,
+		"lng":        77.59,
+		"media_url":  "http://example.com/tree.jpg",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/report", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	report.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("report failed: %d %s", rr.Code, rr.Body.String())
+	}
+	var posted models.Post
+	json.NewDecoder(rr.Body).Decode(&posted)
+	if posted.EnrichmentStatus != models.EnrichmentPending || posted.Urgency != 1 {
+		t.Fatalf("expected a pending post with the submitted urgency, got %q urgency %d", posted.EnrichmentStatus, posted.Urgency)
+	}
+
+	worker := services.NewEnrichmentWorker(postRepo, predictor, staticClassifier("Fallen Tree"))
+	worker.BaseBackoff = 0 // retry immediately
+
+	// first attempt fails and is rescheduled, the retry succeeds
+	if n, err := worker.RunPending(); err != nil || n != 2 {
+		t.Fatalf("expected 2 job runs, got %d (%v)", n, err)
+	}
+	post, err := postRepo.GetPost(posted.ID)
+	if err != nil {
+		t.Fatalf("get post: %v", err)
+	}
+	if post.EnrichmentStatus != models.EnrichmentDone || post.Urgency != 3 || post.ClassifiedAs != "Fallen Tree" {
+		t.Fatalf("post not enriched: status %q urgency %d class %q", post.EnrichmentStatus, post.Urgency, post.ClassifiedAs)
+	}
+	if post.ScoreCount != 1 || post.ScoreSum != 0.9 {
+		t.Fatalf("expected initial score 0.9/1, got %.2f/%d", post.ScoreSum, post.ScoreCount)
+	}
+}
+
+func TestEnrichmentGivesUpAfterMaxAttempts(t *testing.T) {
+	db := setupReportDB(t, "enrichment_failed")
+	postRepo := repository.NewPostRepository(db)
+	user, err := services.NewAuthService(repository.NewUserRepository(db)).Register("F", "f@example.com", "password")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	post, err := postRepo.ReportIssueViaPost(user.ID.String(), "Gas smell", "", "Utilities", "gas leak emergency", "open", 1, 1, 1, "http://example.com/g.jpg", "", "en")
+	if err != nil {
+		t.Fatalf("create post: %v", err)
+	}
+	if _, err := postRepo.EnqueueEnrichment(post.ID); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	worker := services.NewEnrichmentWorker(postRepo, &flakyPredictor{failures: 1000}, nil)
+	worker.BaseBackoff = 0
+	worker.MaxAttempts = 3
+	if n, _ := worker.RunPending(); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+	got, _ := postRepo.GetPost(post.ID)
+	if got.EnrichmentStatus != models.EnrichmentFailed || got.ScoreCount != 1 || got.ScoreSum != 0.85 {
+		t.Fatalf("expected failed post with heuristic score, got %q %.2f/%d", got.EnrichmentStatus, got.ScoreSum, got.ScoreCount)
+	}
+}
+
+func TestEnrichmentIgnoresResultAfterLeaseLost(t *testing.T) {
+	db := setupReportDB(t, "enrichment_lease")
+	postRepo := repository.NewPostRepository(db)
+	user, err := services.NewAuthService(repository.NewUserRepository(db)).Register("L", "l@example.com", "password")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	post, err := postRepo.ReportIssueViaPost(user.ID.String(), "Broken light", "", "Electricity", "street light out", "open", 1, 1, 1, "http://example.com/l.jpg", "", "en")
+	if err != nil {
+		t.Fatalf("create post: %v", err)
+	}
+	if _, err := postRepo.EnqueueEnrichment(post.ID); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	// the first worker's lease expires at once, so a second worker reclaims the job
+	stale, err := postRepo.ClaimEnrichmentJobs(1, -time.Second)
+	if err != nil || len(stale) != 1 {
+		t.Fatalf("first claim: %v %d", err, len(stale))
+	}
+	fresh, err := postRepo.ClaimEnrichmentJobs(1, time.Minute)
+	if err != nil || len(fresh) != 1 {
+		t.Fatalf("reclaim: %v %d", err, len(fresh))
+	}
+
+	if err := postRepo.CompleteEnrichment(stale[0], 2, "", 0.4); !errors.Is(err, repository.ErrEnrichmentLeaseLost) {
+		t.Fatalf("expected lease lost for stale worker, got %v", err)
+	}
+	if err := postRepo.FailEnrichmentJob(stale[0], 0.1, "late"); !errors.Is(err, repository.ErrEnrichmentLeaseLost) {
+		t.Fatalf("expected lease lost for stale failure, got %v", err)
+	}
+	if err := postRepo.CompleteEnrichment(fresh[0], 3, "", 0.9); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	got, _ := postRepo.GetPost(post.ID)
+	if got.ScoreCount != 1 || got.ScoreSum != 0.9 || got.Urgency != 3 {
+		t.Fatalf("expected only the reclaiming worker's score, got %.2f/%d urgency %d", got.ScoreSum, got.ScoreCount, got.Urgency)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RoleHandler serves the admin API for user roles under /api/admin/roles and
+// /api/admin/users/{id}/roles. A role can only be assigned or revoked by a
+// user who holds all of its permissions.
+type RoleHandler struct {
+	Service *services.RoleService
+}
+
+func NewRoleHandler(service *services.RoleService) *RoleHandler {
+	return &RoleHandler{Service: service}
+}
+
+// AssignRoleRequest is the body of POST /api/admin/users/{id}/roles.
+type AssignRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// UserRolesResponse lists the roles and permissions of a user. Changes apply
+// to tokens issued after them.
+type UserRolesResponse struct {
+	UserID uuid.UUID `json:"user_id"`
+	services.Grants
+}
+
+// ServeRoles handles GET /api/admin/roles.
+func (h *RoleHandler) ServeRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.Service.ListRoles()
+	if err != nil {
+		http.Error(w, "Failed to fetch roles", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, roles)
+}
+
+// ServeUserRoles handles GET /api/admin/users/{id}/roles.
+func (h *RoleHandler) ServeUserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, ok := roleUserID(w, r)
+	if !ok {
+		return
+	}
+	h.writeUserRoles(w, userID, http.StatusOK)
+}
+
+// ServeAssignRole handles POST /api/admin/users/{id}/roles. It answers 201
+// when the role was added and 200 when the user already held it.
+func (h *RoleHandler) ServeAssignRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := roleUserID(w, r)
+	if !ok {
+		return
+	}
+	var req AssignRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Role == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	actorID, _ := auth.GetUserIDFromContext(r.Context())
+	added, err := h.Service.Assign(actorID, auth.GetUserPermissionsFromContext(r.Context()), userID, req.Role)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	h.writeUserRoles(w, userID, status)
+}
+
+// ServeRevokeRole handles DELETE /api/admin/users/{id}/roles/{role}.
+func (h *RoleHandler) ServeRevokeRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := roleUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Service.Revoke(auth.GetUserPermissionsFromContext(r.Context()), userID, r.PathValue("role")); err != nil {
+		writeRoleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *RoleHandler) writeUserRoles(w http.ResponseWriter, userID uuid.UUID, status int) {
+	grants, err := h.Service.GetUserGrants(userID)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+	writeJSON(w, status, UserRolesResponse{UserID: userID, Grants: grants})
+}
+
+func roleUserID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func writeRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownRole):
+		http.Error(w, "Unknown role", http.StatusBadRequest)
+	case errors.Is(err, services.ErrRoleNotGrantable):
+		http.Error(w, "Cannot grant or revoke a role with permissions you do not hold", http.StatusForbidden)
+	case errors.Is(err, services.ErrLastSuperAdmin):
+		http.Error(w, "Cannot revoke the last super_admin", http.StatusConflict)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "User or role assignment not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to update roles", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"gorm.io/gorm"
+)
+
+func setupRoleTables(t *testing.T, db *gorm.DB) {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS roles (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT,
+			rank INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS permissions (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT
+		);`,
+		`CREATE TABLE IF NOT EXISTS role_permissions (
+			role_id TEXT NOT NULL,
+			permission_id TEXT NOT NULL,
+			PRIMARY KEY (role_id, permission_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS user_roles (
+			user_id TEXT NOT NULL,
+			role_id TEXT NOT NULL,
+			granted_by TEXT,
+			source TEXT,
+			created_at DATETIME,
+			PRIMARY KEY (user_id, role_id)
+		);`,
+	}
+	for _, s := range stmts {
+		if err := db.Exec(s).Error; err != nil {
+			t.Fatalf("create role tables: %v", err)
+		}
+	}
+}
+
+func TestRolesAndPermissions(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	db := setupReportDB(t, "roles")
+	setupRoleTables(t, db)
+	userRepo := repository.NewUserRepository(db)
+	authSvc := services.NewAuthService(userRepo)
+	roleSvc := services.NewRoleService(repository.NewRoleRepository(db), userRepo)
+	if err := roleSvc.SeedDefaults(); err != nil {
+		t.Fatalf("seed roles: %v", err)
+	}
+	// seeding again must not duplicate anything
+	if err := roleSvc.SeedDefaults(); err != nil {
+		t.Fatalf("reseed roles: %v", err)
+	}
+	roleSvc.Bootstrap([]string{" Admin@Example.com "}, models.RoleAdmin)
+	roleSvc.Bootstrap([]string{"root@example.com"}, models.RoleSuperAdmin)
+
+	jwtSvc := auth.NewJWTService()
+	authHandler := NewAuthHandler(authSvc, jwtSvc, nil)
+	authHandler.Roles = roleSvc
+	roleHandler := NewRoleHandler(roleSvc)
+	authMw := auth.AuthMiddleware(jwtSvc, nil)
+	requirePerm := func(perm string, h http.HandlerFunc) http.Handler {
+		return authMw(auth.RequirePermission(perm)(h))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login", authHandler.Login)
+	mux.Handle("GET /api/admin/roles", requirePerm(models.PermUsersManageRoles, roleHandler.ServeRoles))
+	mux.Handle("GET /api/admin/users/{id}/roles", requirePerm(models.PermUsersManageRoles, roleHandler.ServeUserRoles))
+	mux.Handle("POST /api/admin/users/{id}/roles", requirePerm(models.PermUsersManageRoles, roleHandler.ServeAssignRole))
+	mux.Handle("DELETE /api/admin/users/{id}/roles/{role}", requirePerm(models.PermUsersManageRoles, roleHandler.ServeRevokeRole))
+	mux.Handle("GET /api/admin/issues", requirePerm(models.PermIssuesView, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	login := func(email string) (string, auth.TokenClaims) {
+		rr := do(http.MethodPost, "/login", "", map[string]string{"email": email, "password": "pass1234"})
+		var tr map[string]string
+		if err := json.NewDecoder(rr.Body).Decode(&tr); err != nil || tr["access_token"] == "" {
+			t.Fatalf("login %s: %d %v", email, rr.Code, err)
+		}
+		claims, err := jwtSvc.ParseToken(tr["access_token"])
+		if err != nil {
+			t.Fatalf("parse token: %v", err)
+		}
+		return tr["access_token"], claims
+	}
+	users := map[string]*models.User{}
+	for _, email := range []string{"admin@example.com", "root@example.com", "bob@example.com"} {
+		u, err := authSvc.Register(email, email, "pass1234")
+		if err != nil {
+			t.Fatalf("register %s: %v", email, err)
+		}
+		users[email] = u
+	}
+	bob := users["bob@example.com"].ID.String()
+
+	// ADMIN_EMAILS needs proof that the address belongs to whoever registered
+	// it: until the email is verified the admin is a citizen.
+	if _, claims := login("admin@example.com"); claims.Role != models.RoleCitizen || len(claims.Permissions) != 0 {
+		t.Fatalf("expected an unverified bootstrap admin to be a citizen, got %+v", claims)
+	}
+	for _, email := range []string{"admin@example.com", "root@example.com"} {
+		if _, err := userRepo.MarkEmailVerified(users[email].ID, email, time.Now()); err != nil {
+			t.Fatalf("verify %s: %v", email, err)
+		}
+	}
+
+	// Tokens are issued from the stored roles; ADMIN_EMAILS bootstraps the admin.
+	adminToken, adminClaims := login("admin@example.com")
+	if adminClaims.Role != models.RoleAdmin || !contains(adminClaims.Permissions, models.PermUsersManageRoles) {
+		t.Fatalf("unexpected admin claims %+v", adminClaims)
+	}
+	bobToken, bobClaims := login("bob@example.com")
+	if bobClaims.Role != models.RoleCitizen || len(bobClaims.Permissions) != 0 {
+		t.Fatalf("unexpected citizen claims %+v", bobClaims)
+	}
+	if rr := do(http.MethodGet, "/api/admin/issues", bobToken, nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected citizen to be forbidden, got %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/api/admin/users/"+bob+"/roles", bobToken, nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected citizen to be forbidden from the roles API, got %d", rr.Code)
+	}
+
+	var roles []models.Role
+	if rr := do(http.MethodGet, "/api/admin/roles", adminToken, nil); rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&roles) != nil || len(roles) != 5 {
+		t.Fatalf("list roles: %d %d roles", rr.Code, len(roles))
+	}
+	if roles[0].Name != models.RoleSuperAdmin || len(roles[0].Permissions) != 5 {
+		t.Fatalf("expected super_admin first with 5 permissions, got %s with %d", roles[0].Name, len(roles[0].Permissions))
+	}
+
+	// An admin makes bob a moderator; bob's next token can update statuses.
+	if rr := do(http.MethodPost, "/api/admin/users/"+bob+"/roles", adminToken, AssignRoleRequest{Role: models.RoleModerator}); rr.Code != http.StatusCreated {
+		t.Fatalf("assign moderator: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPost, "/api/admin/users/"+bob+"/roles", adminToken, AssignRoleRequest{Role: models.RoleModerator}); rr.Code != http.StatusOK {
+		t.Fatalf("assigning a held role again should be 200, got %d", rr.Code)
+	}
+	bobToken, bobClaims = login("bob@example.com")
+	if bobClaims.Role != models.RoleModerator || !contains(bobClaims.Permissions, models.PermPostsUpdateStatus) || !contains(bobClaims.Roles, models.RoleCitizen) {
+		t.Fatalf("unexpected moderator claims %+v", bobClaims)
+	}
+	if rr := do(http.MethodGet, "/api/admin/issues", bobToken, nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected moderator to view issues, got %d", rr.Code)
+	}
+
+	// Admins cannot hand out super_admin; a super_admin can.
+	if rr := do(http.MethodPost, "/api/admin/users/"+bob+"/roles", adminToken, AssignRoleRequest{Role: models.RoleSuperAdmin}); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected admin granting super_admin to be forbidden, got %d", rr.Code)
+	}
+	rootToken, _ := login("root@example.com")
+	if rr := do(http.MethodPost, "/api/admin/users/"+bob+"/roles", rootToken, AssignRoleRequest{Role: models.RoleCitizen}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected citizen to be rejected, got %d", rr.Code)
+	}
+	if rr := do(http.MethodPost, "/api/admin/users/00000000-0000-0000-0000-000000000001/roles", rootToken, AssignRoleRequest{Role: models.RoleModerator}); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown user to be 404, got %d", rr.Code)
+	}
+
+	// The last super_admin stays; revoking bob's moderator role works.
+	root := users["root@example.com"].ID.String()
+	if rr := do(http.MethodDelete, "/api/admin/users/"+root+"/roles/super_admin", rootToken, nil); rr.Code != http.StatusConflict {
+		t.Fatalf("expected revoking the last super_admin to conflict, got %d", rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/api/admin/users/"+bob+"/roles/moderator", adminToken, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke moderator: %d %s", rr.Code, rr.Body.String())
+	}
+	var after UserRolesResponse
+	if rr := do(http.MethodGet, "/api/admin/users/"+bob+"/roles", adminToken, nil); rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&after) != nil {
+		t.Fatalf("get roles: %d", rr.Code)
+	}
+	if after.Role != models.RoleCitizen || len(after.Permissions) != 0 {
+		t.Fatalf("expected bob to be a citizen again, got %+v", after.Grants)
+	}
+	if rr := do(http.MethodDelete, "/api/admin/users/"+bob+"/roles/moderator", adminToken, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected revoking a role bob no longer holds to be 404, got %d", rr.Code)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// ScoringHandler serves the admin API for the urgency scoring profile under
+// /api/admin/scoring. Every change is stored as a new version; older versions
+// can be activated again to roll back.
+type ScoringHandler struct {
+	Service *services.ScoringProfileService
+}
+
+func NewScoringHandler(service *services.ScoringProfileService) *ScoringHandler {
+	return &ScoringHandler{Service: service}
+}
+
+// CreateScoringProfileRequest is the body of POST /api/admin/scoring. The
+// profile must contain its keywords; other settings left out keep their
+// defaults. Activate defaults to true.
+type CreateScoringProfileRequest struct {
+	Profile  json.RawMessage `json:"profile"`
+	Notes    string          `json:"notes"`
+	Activate *bool           `json:"activate"`
+}
+
+// ServeActive handles GET /api/admin/scoring and returns the profile in use.
+func (h *ScoringHandler) ServeActive(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, services.ActiveScoringProfile())
+}
+
+// ServeCreate handles POST /api/admin/scoring.
+func (h *ScoringHandler) ServeCreate(w http.ResponseWriter, r *http.Request) {
+	var req CreateScoringProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	profile, err := services.UnmarshalScoringProfile(req.Profile)
+	if err != nil {
+		http.Error(w, "Invalid profile", http.StatusBadRequest)
+		return
+	}
+	activate := req.Activate == nil || *req.Activate
+	userID, _ := auth.GetUserIDFromContext(r.Context())
+	v, err := h.Service.Create(profile, req.Notes, userID, activate)
+	if err != nil {
+		writeScoringError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, v)
+}
+
+// ServePatch handles PATCH /api/admin/scoring: the given fields are merged
+// into the active profile and the result is stored and activated. It answers
+// 409 if another version was activated while the patch was applied.
+func (h *ScoringHandler) ServePatch(w http.ResponseWriter, r *http.Request) {
+	var req services.ScoringProfilePatch
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	userID, _ := auth.GetUserIDFromContext(r.Context())
+	v, err := h.Service.Patch(req, userID)
+	if err != nil {
+		writeScoringError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, v)
+}
+
+// ServeVersions handles GET /api/admin/scoring/versions.
+func (h *ScoringHandler) ServeVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.Service.List()
+	if err != nil {
+		writeScoringError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// ServeVersion handles GET /api/admin/scoring/versions/{version}.
+func (h *ScoringHandler) ServeVersion(w http.ResponseWriter, r *http.Request) {
+	version, ok := profileVersion(w, r)
+	if !ok {
+		return
+	}
+	v, err := h.Service.Get(version)
+	if err != nil {
+		writeScoringError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// ServeActivate handles POST /api/admin/scoring/versions/{version}/activate.
+func (h *ScoringHandler) ServeActivate(w http.ResponseWriter, r *http.Request) {
+	version, ok := profileVersion(w, r)
+	if !ok {
+		return
+	}
+	v, err := h.Service.Activate(version)
+	if err != nil {
+		writeScoringError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// ServeDelete handles DELETE /api/admin/scoring/versions/{version}. The
+// active version cannot be deleted.
+func (h *ScoringHandler) ServeDelete(w http.ResponseWriter, r *http.Request) {
+	version, ok := profileVersion(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Service.Delete(version); err != nil {
+		writeScoringError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func profileVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || version <= 0 {
+		http.Error(w, "Invalid profile version", http.StatusBadRequest)
+		return 0, false
+	}
+	return version, true
+}
+
+func writeScoringError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidProfile):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Profile version not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrActiveProfileVersion):
+		http.Error(w, "Cannot delete the active profile version", http.StatusConflict)
+	case errors.Is(err, repository.ErrProfileVersionChanged):
+		http.Error(w, "The active profile changed, please retry", http.StatusConflict)
+	default:
+		http.Error(w, "Failed to update scoring profile", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+
+	"github.com/google/uuid"
+)
+
+func TestScoringProfileAdminAPI(t *testing.T) {
+	db := setupReportDB(t, "scoring_profile")
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS scoring_profile_versions (
+		id TEXT PRIMARY KEY,
+		version INTEGER NOT NULL UNIQUE,
+		profile TEXT NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT false,
+		notes TEXT,
+		created_by TEXT,
+		created_at DATETIME
+	);`).Error; err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	t.Cleanup(func() { services.SetActiveScoringProfile(0, services.DefaultScoringProfile()) })
+
+	h := NewScoringHandler(services.NewScoringProfileService(repository.NewScoringProfileRepository(db)))
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/admin/scoring", auth.AdminMiddleware(http.HandlerFunc(h.ServeActive)))
+	mux.Handle("POST /api/admin/scoring", auth.AdminMiddleware(http.HandlerFunc(h.ServeCreate)))
+	mux.Handle("PATCH /api/admin/scoring", auth.AdminMiddleware(http.HandlerFunc(h.ServePatch)))
+	mux.Handle("GET /api/admin/scoring/versions", auth.AdminMiddleware(http.HandlerFunc(h.ServeVersions)))
+	mux.Handle("POST /api/admin/scoring/versions/{version}/activate", auth.AdminMiddleware(http.HandlerFunc(h.ServeActivate)))
+	mux.Handle("DELETE /api/admin/scoring/versions/{version}", auth.AdminMiddleware(http.HandlerFunc(h.ServeDelete)))
+
+	admin := uuid.New()
+	do := func(method, path string, body interface{}, role string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		ctx := context.WithValue(req.Context(), auth.ContextUserID, admin)
+		ctx = context.WithValue(ctx, auth.ContextUserRole, role)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	if rr := do(http.MethodGet, "/api/admin/scoring", nil, "user"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", rr.Code)
+	}
+
+	// invalid profiles are rejected and nothing is stored
+	bad := services.DefaultScoringProfile()
+	bad.FeedTextWeight = 0.9
+	if rr := do(http.MethodPost, "/api/admin/scoring", map[string]interface{}{"profile": bad}, "admin"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for weights not summing to 1, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// version 1: a new keyword, hot-reloaded into scoring
+	p := services.DefaultScoringProfile()
+	p.Keywords["sinkhole"] = 3.0
+	rr := do(http.MethodPost, "/api/admin/scoring", map[string]interface{}{"profile": p, "notes": "add sinkhole"}, "admin")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", rr.Code, rr.Body.String())
+	}
+	var v1 services.ScoringProfileVersion
+	json.NewDecoder(rr.Body).Decode(&v1)
+	if v1.Version != 1 || !v1.Active || v1.CreatedBy != admin {
+		t.Fatalf("unexpected version: %+v", v1)
+	}
+	if got := services.CalculateCommentUrgency("sinkhole").Score; got != 3.0 {
+		t.Errorf("expected the new keyword to score 3.0, got %v", got)
+	}
+
+	// version 2: patch the blend weights and drop the keyword again
+	patch := map[string]interface{}{
+		"profile":         map[string]float64{"post_weight": 0.3, "comment_weight": 0.7},
+		"remove_keywords": []string{"sinkhole"},
+	}
+	if rr := do(http.MethodPatch, "/api/admin/scoring", patch, "admin"); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", rr.Code, rr.Body.String())
+	}
+	active := services.ActiveScoringProfile()
+	if active.Version != 2 || active.Profile.PostWeight != 0.3 || active.Profile.Keywords["sinkhole"] != 0 {
+		t.Fatalf("patch not applied: version %d, %+v", active.Version, active.Profile.PostWeight)
+	}
+	if agg := services.ExplainAggregateUrgency(1, []float64{3}); agg.PostWeight != 0.3 || agg.CommentWeight != 0.7 {
+		t.Errorf("aggregate urgency ignores the active weights: %+v", agg)
+	}
+
+	// the active version cannot be deleted; rolling back frees it
+	if rr := do(http.MethodDelete, "/api/admin/scoring/versions/2", nil, "admin"); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 deleting the active version, got %d", rr.Code)
+	}
+	if rr := do(http.MethodPost, "/api/admin/scoring/versions/1/activate", nil, "admin"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 on rollback, got %d %s", rr.Code, rr.Body.String())
+	}
+	if services.ActiveScoringProfile().Version != 1 {
+		t.Fatalf("expected version 1 active after rollback")
+	}
+	if rr := do(http.MethodDelete, "/api/admin/scoring/versions/2", nil, "admin"); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if rr := do(http.MethodPost, "/api/admin/scoring/versions/2/activate", nil, "admin"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a deleted version, got %d", rr.Code)
+	}
+
+	rr = do(http.MethodGet, "/api/admin/scoring/versions", nil, "admin")
+	var versions []services.ScoringProfileVersion
+	json.NewDecoder(rr.Body).Decode(&versions)
+	if len(versions) != 1 || versions[0].Version != 1 || !versions[0].Active || versions[0].Profile != nil {
+		t.Errorf("unexpected version list: %+v", versions)
+	}
+
+	// another instance picks the active version up on reload
+	services.SetActiveScoringProfile(0, services.DefaultScoringProfile())
+	if err := h.Service.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := services.ActiveScoringProfile(); got.Version != 1 || got.Profile.Keywords["sinkhole"] != 3.0 {
+		t.Errorf("reload did not load version 1: %d", got.Version)
+	}
+}
+
+func TestConcurrentScoringPatchesKeepEveryChange(t *testing.T) {
+	db := setupReportDB(t, "scoring_patch")
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS scoring_profile_versions (
+		id TEXT PRIMARY KEY,
+		version INTEGER NOT NULL UNIQUE,
+		profile TEXT NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT false,
+		notes TEXT,
+		created_by TEXT,
+		created_at DATETIME
+	);`).Error; err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	t.Cleanup(func() { services.SetActiveScoringProfile(0, services.DefaultScoringProfile()) })
+
+	repo := repository.NewScoringProfileRepository(db)
+	svc := services.NewScoringProfileService(repo)
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			patch := services.ScoringProfilePatch{Profile: json.RawMessage(fmt.Sprintf(`{"keywords":{"patched%d":1.5}}`, i))}
+			if _, err := svc.Patch(patch, uuid.New()); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("patch: %v", err)
+	}
+
+	row, err := repo.GetActive()
+	if err != nil {
+		t.Fatalf("active: %v", err)
+	}
+	if row.Version != n {
+		t.Fatalf("expected version %d to be active, got %d", n, row.Version)
+	}
+	p, _ := services.UnmarshalScoringProfile([]byte(row.Profile))
+	for i := 0; i < n; i++ {
+		if p.Keywords[fmt.Sprintf("patched%d", i)] != 1.5 {
+			t.Fatalf("patch %d was lost: %v", i, p.Keywords)
+		}
+	}
+
+	// a writer that read an older active version must not overwrite the newer one
+	if _, err := repo.CreateVersionOver(n-1, []byte(row.Profile), "", uuid.New()); !errors.Is(err, repository.ErrProfileVersionChanged) {
+		t.Fatalf("expected a stale base to be refused, got %v", err)
+	}
+	if _, err := repo.CreateVersionOver(0, []byte(row.Profile), "", uuid.New()); !errors.Is(err, repository.ErrProfileVersionChanged) {
+		t.Fatalf("expected an empty base to be refused while a version is active, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func setupSessionTables(t *testing.T, db *gorm.DB) {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			user_agent TEXT,
+			ip TEXT,
+			created_at DATETIME,
+			last_used_at DATETIME,
+			expires_at DATETIME,
+			revoked_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			token_hash TEXT PRIMARY KEY,
+			session_id TEXT NOT NULL,
+			created_at DATETIME,
+			used_at DATETIME
+		);`,
+	}
+	for _, s := range stmts {
+		if err := db.Exec(s).Error; err != nil {
+			t.Fatalf("create session tables: %v", err)
+		}
+	}
+}
+
+func TestRefreshTokenRotationAndSessions(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	db := setupReportDB(t, "sessions")
+	setupSessionTables(t, db)
+	userRepo := repository.NewUserRepository(db)
+	authSvc := services.NewAuthService(userRepo)
+	if _, err := authSvc.Register("Sam", "sam@example.com", "pass1234"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	sessionRepo := repository.NewSessionRepository(db)
+
+	jwtSvc := auth.NewJWTService()
+	authHandler := NewAuthHandler(authSvc, jwtSvc, nil)
+	authHandler.Sessions = services.NewSessionService(sessionRepo, 24*time.Hour)
+	authMw := auth.AuthMiddleware(jwtSvc, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login", authHandler.Login)
+	mux.HandleFunc("POST /auth/refresh", authHandler.Refresh)
+	mux.Handle("GET /auth/sessions", authMw(http.HandlerFunc(authHandler.ListSessions)))
+	mux.Handle("DELETE /auth/sessions/{id}", authMw(http.HandlerFunc(authHandler.RevokeSession)))
+
+	do := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	decode := func(rr *httptest.ResponseRecorder) tokenResp {
+		var tr tokenResp
+		if err := json.NewDecoder(rr.Body).Decode(&tr); err != nil || tr.AccessToken == "" || tr.RefreshToken == "" {
+			t.Fatalf("expected access and refresh tokens: %d %v", rr.Code, err)
+		}
+		return tr
+	}
+	refresh := func(token string) *httptest.ResponseRecorder {
+		return do(http.MethodPost, "/auth/refresh", "", refreshReq{RefreshToken: token})
+	}
+	login := func() tokenResp {
+		rr := do(http.MethodPost, "/login", "", map[string]string{"email": "sam@example.com", "password": "pass1234"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("login: %d", rr.Code)
+		}
+		return decode(rr)
+	}
+
+	// Two devices sign in; each gets its own session.
+	phone := login()
+	laptop := login()
+	if phone.ExpiresIn <= 0 {
+		t.Fatalf("expected expires_in, got %d", phone.ExpiresIn)
+	}
+	phoneClaims, err := jwtSvc.ParseToken(phone.AccessToken)
+	if err != nil || phoneClaims.SessionID == uuid.Nil {
+		t.Fatalf("expected a session id in the access token: %+v %v", phoneClaims, err)
+	}
+
+	// Refreshing rotates the token and keeps the session.
+	rr := refresh(phone.RefreshToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("refresh: %d %s", rr.Code, rr.Body.String())
+	}
+	rotated := decode(rr)
+	if rotated.RefreshToken == phone.RefreshToken {
+		t.Fatalf("expected a new refresh token")
+	}
+	if claims, err := jwtSvc.ParseToken(rotated.AccessToken); err != nil || claims.SessionID != phoneClaims.SessionID {
+		t.Fatalf("expected the refreshed token to keep session %s, got %+v %v", phoneClaims.SessionID, claims, err)
+	}
+
+	// Replaying the old token revokes the whole session, so the token that
+	// replaced it stops working too.
+	if rr := refresh(phone.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected reuse to be rejected, got %d", rr.Code)
+	}
+	if rr := refresh(rotated.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the rest of the family to be revoked, got %d", rr.Code)
+	}
+	if rr := refresh("not-a-token"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unknown token to be rejected, got %d", rr.Code)
+	}
+
+	// Only the laptop session is left; it is the current one for its token.
+	var sessions []SessionResp
+	rr = do(http.MethodGet, "/auth/sessions", laptop.AccessToken, nil)
+	if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&sessions) != nil {
+		t.Fatalf("list sessions: %d", rr.Code)
+	}
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("expected one current session, got %+v", sessions)
+	}
+
+	// Another device signs in and kills the laptop session.
+	tablet := login()
+	laptopID := sessions[0].ID.String()
+	if rr := do(http.MethodDelete, "/auth/sessions/"+laptopID, tablet.AccessToken, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke session: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodDelete, "/auth/sessions/"+laptopID, tablet.AccessToken, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected revoking twice to be 404, got %d", rr.Code)
+	}
+	if rr := refresh(laptop.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the revoked session not to refresh, got %d", rr.Code)
+	}
+	if rr := refresh(tablet.RefreshToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected the tablet to still refresh, got %d", rr.Code)
+	}
+
+	// Purging drops revoked sessions and their tokens.
+	if n, err := sessionRepo.PurgeExpired(time.Now()); err != nil || n != 2 {
+		t.Fatalf("expected 2 sessions purged, got %d %v", n, err)
+	}
+}
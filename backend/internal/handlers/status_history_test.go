@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestStatusHistoryShowsOnlyActorName(t *testing.T) {
+	db := setupReportDB(t, "statushistory")
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS post_status_changes (
+		id TEXT PRIMARY KEY,
+		post_id TEXT NOT NULL,
+		actor_id TEXT NOT NULL,
+		from_status TEXT NOT NULL,
+		to_status TEXT NOT NULL,
+		notes TEXT,
+		created_at DATETIME
+	);`).Error; err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	reportSvc := services.NewReportService(repository.NewPostRepository(db), nil, nil)
+	h := NewReportHandler(reportSvc)
+
+	officer := models.User{ID: uuid.New(), Name: "Officer", Email: "officer@example.com", PasswordHash: "secret-hash"}
+	issue := models.Issue{ID: uuid.New(), Name: "History Pothole", Category: "Road"}
+	db.Create(&officer)
+	db.Create(&issue)
+	post := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: officer.ID, Status: models.StatusOpen, Urgency: 2, LastActivityAt: time.Now()}
+	db.Create(&post)
+	if _, err := reportSvc.UpdatePostStatus(post.ID.String(), officer.ID.String(), models.StatusTriaged, "seen"); err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/"+post.ID.String()+"/history", nil)
+	req.SetPathValue("id", post.ID.String())
+	rr := httptest.NewRecorder()
+	h.ServeStatusHistory(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, `"name":"Officer"`) || !strings.Contains(body, `"to_status":"triaged"`) {
+		t.Fatalf("expected the transition and the actor's name, got %s", body)
+	}
+	for _, leaked := range []string{"secret-hash", "officer@example.com", "password", "email"} {
+		if strings.Contains(body, leaked) {
+			t.Fatalf("history leaks %q: %s", leaked, body)
+		}
+	}
+}
+
+func TestReportIgnoresSubmittedStatus(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	db := setupReportDB(t, "reportstatus")
+	reportSvc := services.NewReportService(repository.NewPostRepository(db), nil, nil)
+	jwtSvc := auth.NewJWTService()
+	report := auth.AuthMiddleware(jwtSvc, nil)(http.HandlerFunc(NewReportHandler(reportSvc).ServeReport))
+
+	user := models.User{ID: uuid.New(), Name: "Reporter", Email: "reporter@example.com", PasswordHash: "x"}
+	db.Create(&user)
+	token, _ := jwtSvc.GenerateToken(user.ID)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"issue_name": "Already closed?",
+		"issue_cat":  "Road",
+		"post_desc":  "Broken kerb outside the school gate",
+		"status":     models.StatusClosed,
+		"urgency":    2,
+		"lat":        12.97,
+		"lng":        77.59,
+		"media_url":  "http://example.com/k.jpg",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/report", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	report.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("report failed: %d %s", rr.Code, rr.Body.String())
+	}
+	var post models.Post
+	if err := db.First(&post, "user_id = ?", user.ID).Error; err != nil {
+		t.Fatalf("load post: %v", err)
+	}
+	if post.Status != models.StatusOpen {
+		t.Fatalf("expected a new report to be open, got %q", post.Status)
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestServeUrgencyExplanation(t *testing.T) {
+	os.Setenv("DUPLICATE_MODE", "off")
+	defer os.Unsetenv("DUPLICATE_MODE")
+
+	db := setupReportDB(t, "urgency_explanation")
+	reportSvc := services.NewReportService(repository.NewPostRepository(db), nil, nil)
+	user, err := services.NewAuthService(repository.NewUserRepository(db)).Register("E", "e@example.com", "password")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	post, err := reportSvc.ReportIssueViaPost(user.ID.String(), "Live wire", "", "Utilities", "Dangerous live wire hanging, fire risk", 1, 1, 1, "http://example.com/w.jpg", false)
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if _, err := reportSvc.AddComment(user.ID.String(), post.ID.String(), "still broken and unsafe"); err != nil {
+		t.Fatalf("comment: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/posts/{id}/urgency", NewReportHandler(reportSvc).ServeUrgencyExplanation)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/posts/"+post.ID.String()+"/urgency", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+	}
+	var e services.UrgencyExplanation
+	if err := json.NewDecoder(rr.Body).Decode(&e); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if e.Source != services.SourceHeuristic || e.HeuristicTerm != "danger" || e.MLScore != nil {
+		t.Errorf("unexpected prediction factors: %+v", e)
+	}
+	words := map[string]bool{}
+	for _, k := range e.Keywords {
+		words[k.Word] = true
+	}
+	if !words["dangerous"] || !words["fire"] || !words["risk"] {
+		t.Errorf("expected dangerous, fire and risk among keywords, got %+v", e.Keywords)
+	}
+	if e.Comments == nil || len(e.Comments.CommentScores) != 1 || e.Comments.FinalUrgency != e.Urgency {
+		t.Errorf("expected the comment contribution to be recorded, got %+v", e.Comments)
+	}
+	if e.Upvotes == nil || e.Upvotes.Count != 0 || e.Upvotes.Contribution != 0 {
+		t.Errorf("expected an empty upvote component, got %+v", e.Upvotes)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/posts/"+uuid.NewString()+"/urgency", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown post, got %d", rr.Code)
+	}
+}
+
+func TestUrgencyExplanationRecordsLanguage(t *testing.T) {
+	os.Setenv("DUPLICATE_MODE", "off")
+	defer os.Unsetenv("DUPLICATE_MODE")
+
+	db := setupReportDB(t, "urgency_language")
+	reportSvc := services.NewReportService(repository.NewPostRepository(db), nil, nil)
+	user, err := services.NewAuthService(repository.NewUserRepository(db)).Register("L", "l@example.com", "password")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	post, err := reportSvc.ReportIssueViaPost(user.ID.String(), "Live wire", "", "Utilities", "Dangerous live wire hanging, fire risk", 1, 1, 1, "http://example.com/w.jpg", false)
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if post.Language != services.LangEnglish {
+		t.Errorf("expected post language en, got %q", post.Language)
+	}
+	comment, err := reportSvc.AddComment(user.ID.String(), post.ID.String(), "abhi bhi toota hai, bahut khatra")
+	if err != nil {
+		t.Fatalf("comment: %v", err)
+	}
+	if comment.Language != services.LangHinglish {
+		t.Errorf("expected comment language hi-Latn, got %q", comment.Language)
+	}
+
+	e, err := reportSvc.ExplainPostUrgency(post.ID.String())
+	if err != nil {
+		t.Fatalf("explain: %v", err)
+	}
+	if e.Language != services.LangEnglish {
+		t.Errorf("expected the explanation to record language en, got %q", e.Language)
+	}
+}
+
+func TestRecomputeUrgencyExplanation(t *testing.T) {
+	os.Setenv("FEED_SCORING_MODE", "decay")
+	os.Setenv("FEED_UPVOTE_SATURATION", "9")
+	defer os.Unsetenv("FEED_SCORING_MODE")
+	defer os.Unsetenv("FEED_UPVOTE_SATURATION")
+
+	db := setupReportDB(t, "urgency_recompute")
+	reportSvc := services.NewReportService(repository.NewPostRepository(db), nil, nil)
+	h := NewReportHandler(reportSvc)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/posts/{id}/urgency", h.ServeUrgencyExplanation)
+	mux.HandleFunc("POST /api/posts/{id}/urgency", h.ServeRecomputeUrgency)
+	serve := func(method, id string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, "/api/posts/"+id+"/urgency", nil))
+		return rr
+	}
+
+	// A post from before explanations were recorded.
+	user := models.User{ID: uuid.New(), Name: "Old", Email: "old@example.com", PasswordHash: "x"}
+	issue := models.Issue{ID: uuid.New(), Name: "Old flood", Category: "Water"}
+	db.Create(&user)
+	db.Create(&issue)
+	post := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: user.ID, Description: "Severe flooding near the school", Status: models.StatusOpen, Urgency: 2}
+	db.Create(&post)
+	db.Create(&models.Comment{ID: uuid.New(), PostID: post.ID, UserID: user.ID, Content: "water is entering the classrooms, emergency"})
+	if _, err := reportSvc.ToggleUpvote(user.ID.String(), post.ID.String()); err != nil {
+		t.Fatalf("upvote: %v", err)
+	}
+
+	// GET only reads: nothing is computed or stored for it.
+	if rr := serve(http.MethodGet, post.ID.String()); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a stored explanation, got %d", rr.Code)
+	}
+	var stored int64
+	db.Model(&models.PostUrgencyExplanation{}).Where("post_id = ?", post.ID).Count(&stored)
+	if stored != 0 {
+		t.Fatal("expected GET not to store an explanation")
+	}
+
+	rr := serve(http.MethodPost, post.ID.String())
+	if rr.Code != http.StatusOK {
+		t.Fatalf("recompute: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serve(http.MethodGet, post.ID.String())
+	var e services.UrgencyExplanation
+	if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&e) != nil {
+		t.Fatalf("expected the recomputed explanation, got %d", rr.Code)
+	}
+	if e.Source != services.SourceHeuristic || len(e.Keywords) == 0 {
+		t.Errorf("expected description factors, got %+v", e)
+	}
+	// The comment is scored from the post's current comments, and the post
+	// is ranked by the same urgency and score the explanation describes.
+	if e.Comments == nil || len(e.Comments.CommentScores) != 1 || e.Urgency != e.Comments.FinalUrgency {
+		t.Errorf("expected the current comment in the explanation, got %+v", e.Comments)
+	}
+	var rescored models.Post
+	db.First(&rescored, "id = ?", post.ID)
+	if rescored.Urgency != e.Urgency || rescored.ScoreCount != 2 || rescored.ScoreSum < e.Score {
+		t.Errorf("expected the post to carry the recomputed urgency %d and two scored texts, got urgency %d sum %v count %d", e.Urgency, rescored.Urgency, rescored.ScoreSum, rescored.ScoreCount)
+	}
+	// In decay mode one upvote of a saturation of 9 is log(2)/log(10).
+	want := services.LogUpvoteScore(1, 9)
+	if e.Upvotes == nil || e.Upvotes.Count != 1 || math.Abs(e.Upvotes.Presence-want) > 1e-9 || math.Abs(e.Upvotes.Contribution-e.Upvotes.Weight*want) > 1e-9 {
+		t.Errorf("expected the decayed upvote value %v, got %+v", want, e.Upvotes)
+	}
+
+	if rr := serve(http.MethodPost, uuid.NewString()); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown post, got %d", rr.Code)
+	}
+}
+
+func TestServePredictUrgencyExplains(t *testing.T) {
+	h := NewMLHandler(nil, nil)
+	body, _ := json.Marshal(map[string]string{"text": "Severe flooding near the school"})
+	rr := httptest.NewRecorder()
+	h.ServePredictUrgency(rr, httptest.NewRequest(http.MethodPost, "/predict-urgency", bytes.NewReader(body)))
+
+	var resp PredictUrgencyResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Urgency == 0 || resp.Explanation == nil || len(resp.Explanation.Keywords) == 0 {
+		t.Fatalf("expected urgency with keyword explanation, got %+v", resp)
+	}
+}
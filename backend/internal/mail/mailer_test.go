@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	config "crowdsourcedurbanissuereportingwithai/backend/configs"
+)
+
+func TestFileMailerWritesReadableMessages(t *testing.T) {
+	dir := t.TempDir()
+	m, err := New(config.MailConfig{Driver: "file", Dir: dir, From: "Civic Issue <no-reply@example.com>"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	body := "Hi Zoë,\n\nopen https://civic.example.com/reset-password.html?token=" + strings.Repeat("a", 120) + "\n"
+	if err := m.Send(context.Background(), Message{To: "zoe@example.com", Subject: "Réinitialiser", Body: body}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %v", files)
+	}
+	f, _ := os.Open(files[0])
+	defer f.Close()
+	msg, err := netmail.ReadMessage(f)
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if msg.Header.Get("To") != "zoe@example.com" || subject != "Réinitialiser" || msg.Header.Get("From") == "" {
+		t.Fatalf("unexpected headers %v", msg.Header)
+	}
+	got, _ := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if strings.ReplaceAll(string(got), "\r\n", "\n") != body {
+		t.Fatalf("body did not survive encoding: %q", got)
+	}
+}
+
+func TestFormatRejectsHeaderInjection(t *testing.T) {
+	if _, err := Format("a@example.com", Message{To: "b@example.com\r\nBcc: c@example.com", Subject: "hi"}, time.Time{}); err == nil {
+		t.Fatal("expected a recipient with a line break to be rejected")
+	}
+	if _, err := Format("a@example.com", Message{To: "b@example.com", Subject: "hi\nBcc: c@example.com"}, time.Time{}); err == nil {
+		t.Fatal("expected a subject with a line break to be rejected")
+	}
+}
+
+func TestNewValidatesDriver(t *testing.T) {
+	if _, err := New(config.MailConfig{Driver: "smtp", From: "a@example.com"}); err == nil {
+		t.Fatal("expected smtp without a host to fail")
+	}
+	if _, err := New(config.MailConfig{Driver: "pigeon"}); err == nil {
+		t.Fatal("expected an unknown driver to fail")
+	}
+	if m, err := New(config.MailConfig{Driver: "log"}); err != nil || m.Send(context.Background(), Message{To: "a@example.com"}) != nil {
+		t.Fatalf("log mailer: %v", err)
+	}
+}
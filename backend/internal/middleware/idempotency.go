@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyKeyHeader is the request header clients set to make a POST safe
+// to retry. Retries must reuse the key of the original attempt.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set on responses replayed from the store.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+const maxIdempotencyKeyLen = 255
+
+// Idempotency replays the response of an earlier POST carrying the same
+// Idempotency-Key instead of handling it again. Keys are scoped to the
+// authenticated user and the request path, so it must run inside the auth
+// middleware. Responses with a 5xx status are not stored; the next retry is
+// handled normally.
+type Idempotency struct {
+	Store repository.IdempotencyStore
+	// TTL is how long a response is replayed for.
+	TTL time.Duration
+	// LockTimeout bounds how long a key stays claimed by a request that never
+	// completes, e.g. because the server stopped while handling it.
+	LockTimeout time.Duration
+	// MaxBodyBytes caps the request body read to fingerprint the request.
+	MaxBodyBytes int64
+}
+
+func NewIdempotency(store repository.IdempotencyStore, ttl time.Duration) *Idempotency {
+	return &Idempotency{
+		Store:        store,
+		TTL:          ttl,
+		LockTimeout:  time.Minute,
+		MaxBodyBytes: 1 << 20,
+	}
+}
+
+// IdempotencyStorageKey returns the store key for a client key sent by userID
+// to method and path. It is hashed so it has a fixed length.
+func IdempotencyStorageKey(userID, method, path, key string) string {
+	h := sha256.Sum256([]byte(userID + "\x00" + method + " " + path + "\x00" + key))
+	return "idem:" + hex.EncodeToString(h[:])
+}
+
+// Wrap returns next guarded by idempotency keys. Requests without the header
+// and non-POST requests pass straight through.
+func (m *Idempotency) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			http.Error(w, "Idempotency key too long", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, m.MaxBodyBytes+1))
+		if err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > m.MaxBodyBytes {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		userID := ""
+		if uid, ok := auth.GetUserIDFromContext(r.Context()); ok {
+			userID = uid.String()
+		}
+		storeKey := IdempotencyStorageKey(userID, r.Method, r.URL.Path, key)
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		// The outcome must be stored even if the client goes away mid-request;
+		// that is exactly when it will retry.
+		ctx := context.WithoutCancel(r.Context())
+		existing, reserved, err := m.Store.Reserve(ctx, storeKey, repository.IdempotencyRecord{Fingerprint: fingerprint, CreatedAt: time.Now()}, m.LockTimeout)
+		if err != nil {
+			log.Printf("idempotency: reserve failed, handling request without replay protection: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !reserved {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				http.Error(w, "Idempotency key was already used for a different request", http.StatusUnprocessableEntity)
+			case !existing.Completed():
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "A request with this idempotency key is still in progress", http.StatusConflict)
+			default:
+				replay(w, existing)
+			}
+			return
+		}
+
+		rec := &responseRecorder{header: http.Header{}}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if rec.status >= http.StatusInternalServerError {
+			if err := m.Store.Release(ctx, storeKey); err != nil {
+				log.Printf("idempotency: release failed: %v", err)
+			}
+		} else {
+			done := repository.IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Status:      rec.status,
+				Header:      rec.header.Clone(),
+				Body:        rec.body.Bytes(),
+				CreatedAt:   time.Now(),
+			}
+			if err := m.Store.Complete(ctx, storeKey, done, m.TTL); err != nil {
+				log.Printf("idempotency: storing response failed: %v", err)
+			}
+		}
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
+
+func replay(w http.ResponseWriter, rec repository.IdempotencyRecord) {
+	for k, v := range rec.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+// responseRecorder buffers a handler's response so it can be stored before
+// it is sent.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+// RedisIdempotencyStore keeps idempotency records in Redis as JSON values.
+type RedisIdempotencyStore struct {
+	Client *redis.Client
+}
+
+func NewRedisIdempotencyStore(rdb *redis.Client) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{Client: rdb}
+}
+
+func (s *RedisIdempotencyStore) Reserve(ctx context.Context, key string, rec repository.IdempotencyRecord, ttl time.Duration) (repository.IdempotencyRecord, bool, error) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return repository.IdempotencyRecord{}, false, err
+	}
+	for {
+		ok, err := s.Client.SetNX(ctx, key, b, ttl).Result()
+		if err != nil {
+			return repository.IdempotencyRecord{}, false, err
+		}
+		if ok {
+			return rec, true, nil
+		}
+		raw, err := s.Client.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			// expired between SETNX and GET; try to claim it again
+			continue
+		}
+		if err != nil {
+			return repository.IdempotencyRecord{}, false, err
+		}
+		var existing repository.IdempotencyRecord
+		if err := json.Unmarshal(raw, &existing); err != nil {
+			return repository.IdempotencyRecord{}, false, err
+		}
+		return existing, false, nil
+	}
+}
+
+func (s *RedisIdempotencyStore) Complete(ctx context.Context, key string, rec repository.IdempotencyRecord, ttl time.Duration) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.Client.Set(ctx, key, b, ttl).Err()
+}
+
+func (s *RedisIdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.Client.Del(ctx, key).Err()
+}
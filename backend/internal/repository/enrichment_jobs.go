@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EnqueueEnrichment marks a post as pending enrichment and queues a job for
+// it in the same transaction.
+func (r *PostRepository) EnqueueEnrichment(postID uuid.UUID) (*models.EnrichmentJob, error) {
+	job := models.EnrichmentJob{
+		ID:       uuid.New(),
+		PostID:   postID,
+		Status:   models.JobPending,
+		RunAfter: time.Now(),
+	}
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Post{}).Where("id = ?", postID).
+			UpdateColumn("enrichment_status", models.EnrichmentPending).Error; err != nil {
+			return err
+		}
+		return tx.Create(&job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimEnrichmentJobs leases up to limit due jobs to the caller for the given
+// duration. Jobs whose lease expired (e.g. the worker crashed) are due again.
+// Each job is claimed with a conditional update, so concurrent workers, also
+// in other processes, never receive the same job.
+func (r *PostRepository) ClaimEnrichmentJobs(limit int, lease time.Duration) ([]models.EnrichmentJob, error) {
+	now := time.Now()
+	due := "(status = ? AND run_after <= ?) OR (status = ? AND locked_until < ?)"
+	var candidates []models.EnrichmentJob
+	if err := r.DB.Where(due, models.JobPending, now, models.JobRunning, now).
+		Order("run_after ASC").Limit(limit).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	claimed := candidates[:0]
+	for _, job := range candidates {
+		res := r.DB.Model(&models.EnrichmentJob{}).
+			Where("id = ? AND status = ? AND attempts = ?", job.ID, job.Status, job.Attempts).
+			Updates(map[string]interface{}{
+				"status":       models.JobRunning,
+				"attempts":     job.Attempts + 1,
+				"locked_until": now.Add(lease),
+				"updated_at":   now,
+			})
+		if res.Error != nil {
+			return claimed, res.Error
+		}
+		if res.RowsAffected == 1 {
+			job.Status = models.JobRunning
+			job.Attempts++
+			job.LockedUntil = now.Add(lease)
+			claimed = append(claimed, job)
+		}
+	}
+	return claimed, nil
+}
+
+// ErrEnrichmentLeaseLost is returned when a worker reports on a job whose
+// lease expired and which was claimed again, or finished, in the meantime.
+var ErrEnrichmentLeaseLost = errors.New("enrichment job lease lost")
+
+// leaseHeld restricts q to job as long as the caller's claim still holds it.
+// Every claim increments attempts, so the attempt count acts as lease token.
+func leaseHeld(q *gorm.DB, job models.EnrichmentJob) *gorm.DB {
+	return q.Where("id = ? AND status = ? AND attempts = ?", job.ID, models.JobRunning, job.Attempts)
+}
+
+// finishJob moves a leased job to status and reports ErrEnrichmentLeaseLost
+// if the caller no longer holds it.
+func finishJob(tx *gorm.DB, job models.EnrichmentJob, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+	res := leaseHeld(tx.Model(&models.EnrichmentJob{}), job).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrEnrichmentLeaseLost
+	}
+	return nil
+}
+
+// CompleteEnrichment stores the enrichment results on the post and marks the
+// job done. urgency 0 and an empty classifiedAs leave the stored values as
+// they are; score is added to the incremental score as the first sample.
+// Nothing is written if the caller's lease on job was lost.
+func (r *PostRepository) CompleteEnrichment(job models.EnrichmentJob, urgency int, classifiedAs string, score float64) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := finishJob(tx, job, map[string]interface{}{
+			"status":     models.JobDone,
+			"last_error": "",
+		}); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"score_sum":         gorm.Expr("score_sum + ?", score),
+			"score_count":       gorm.Expr("score_count + 1"),
+			"enrichment_status": models.EnrichmentDone,
+		}
+		if urgency > 0 {
+			updates["urgency"] = urgency
+		}
+		if classifiedAs != "" {
+			updates["classified_as"] = classifiedAs
+		}
+		return tx.Model(&models.Post{}).Where("id = ?", job.PostID).UpdateColumns(updates).Error
+	})
+}
+
+// RetryEnrichmentJob puts a failed job back in the queue to run after runAfter.
+func (r *PostRepository) RetryEnrichmentJob(job models.EnrichmentJob, runAfter time.Time, lastErr string) error {
+	return finishJob(r.DB, job, map[string]interface{}{
+		"status":     models.JobPending,
+		"run_after":  runAfter,
+		"last_error": lastErr,
+	})
+}
+
+// FailEnrichmentJob gives up on a job. The post is marked failed and gets the
+// fallback score so it still ranks in the feed. Nothing is written if the
+// caller's lease on job was lost.
+func (r *PostRepository) FailEnrichmentJob(job models.EnrichmentJob, fallbackScore float64, lastErr string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := finishJob(tx, job, map[string]interface{}{
+			"status":     models.JobFailed,
+			"last_error": lastErr,
+		}); err != nil {
+			return err
+		}
+		return tx.Model(&models.Post{}).Where("id = ?", job.PostID).UpdateColumns(map[string]interface{}{
+			"score_sum":         gorm.Expr("score_sum + ?", fallbackScore),
+			"score_count":       gorm.Expr("score_count + 1"),
+			"enrichment_status": models.EnrichmentFailed,
+		}).Error
+	})
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyRecord is what is stored under an idempotency key. Status is
+// zero while the original request is still being handled.
+type IdempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// Completed reports whether the record holds a response.
+func (r IdempotencyRecord) Completed() bool {
+	return r.Status != 0
+}
+
+// IdempotencyStore keeps idempotency records. Reserve atomically claims key
+// for ttl; if the key is already held it returns the existing record and
+// false. Complete stores the response under a claimed key, and Release gives
+// up a claim so the request can be tried again.
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) (IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) error
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyRepository stores idempotency records in the database when Redis
+// is not configured. It implements IdempotencyStore.
+type IdempotencyRepository struct {
+	DB *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{DB: db}
+}
+
+func (r *IdempotencyRepository) Reserve(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) (IdempotencyRecord, bool, error) {
+	now := time.Now()
+	row := models.IdempotencyKey{
+		Key:         key,
+		Fingerprint: rec.Fingerprint,
+		CreatedAt:   rec.CreatedAt,
+		ExpiresAt:   now.Add(ttl),
+	}
+	var existing models.IdempotencyKey
+	reserved := false
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// an expired row no longer holds the key
+		if err := tx.Where("idempotency_key = ? AND expires_at <= ?", key, now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			reserved = true
+			return nil
+		}
+		return tx.Where("idempotency_key = ?", key).First(&existing).Error
+	})
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	if reserved {
+		return rec, true, nil
+	}
+	out := IdempotencyRecord{
+		Fingerprint: existing.Fingerprint,
+		Status:      existing.Status,
+		Body:        existing.Body,
+		CreatedAt:   existing.CreatedAt,
+	}
+	if existing.Header != "" {
+		if err := json.Unmarshal([]byte(existing.Header), &out.Header); err != nil {
+			return IdempotencyRecord{}, false, err
+		}
+	}
+	return out, false, nil
+}
+
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) error {
+	header, err := json.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+	row := models.IdempotencyKey{
+		Key:         key,
+		Fingerprint: rec.Fingerprint,
+		Status:      rec.Status,
+		Header:      string(header),
+		Body:        rec.Body,
+		CreatedAt:   rec.CreatedAt,
+		ExpiresAt:   rec.CreatedAt.Add(ttl),
+	}
+	return r.DB.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&row).Error
+}
+
+func (r *IdempotencyRepository) Release(ctx context.Context, key string) error {
+	return r.DB.WithContext(ctx).Where("idempotency_key = ?", key).Delete(&models.IdempotencyKey{}).Error
+}
+
+// PurgeExpired deletes expired rows and returns how many were removed.
+func (r *IdempotencyRepository) PurgeExpired() (int64, error) {
+	res := r.DB.Where("expires_at <= ?", time.Now()).Delete(&models.IdempotencyKey{})
+	return res.RowsAffected, res.Error
+}
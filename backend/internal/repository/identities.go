@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// IdentityRepository stores the links between users and their accounts at
+// external identity providers.
+type IdentityRepository struct {
+	DB *gorm.DB
+}
+
+func NewIdentityRepository(db *gorm.DB) *IdentityRepository {
+	return &IdentityRepository{DB: db}
+}
+
+// FindIdentity returns the identity with the given provider and subject, or
+// gorm.ErrRecordNotFound.
+func (r *IdentityRepository) FindIdentity(provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := r.DB.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// CreateIdentity links an identity to a user.
+func (r *IdentityRepository) CreateIdentity(identity *models.UserIdentity) error {
+	if identity.ID == uuid.Nil {
+		identity.ID = uuid.New()
+	}
+	return r.DB.Create(identity).Error
+}
+
+// TouchIdentity records a sign-in through an identity and the email the
+// provider reported for it.
+func (r *IdentityRepository) TouchIdentity(id uuid.UUID, email string, now time.Time) error {
+	return r.DB.Model(&models.UserIdentity{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"email": email, "last_login_at": now}).Error
+}
+
+// ListIdentities returns a user's linked identities, oldest first.
+func (r *IdentityRepository) ListIdentities(userID uuid.UUID) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	err := r.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error
+	return identities, err
+}
+
+// DeleteIdentities unlinks every identity of a user.
+func (r *IdentityRepository) DeleteIdentities(userID uuid.UUID) error {
+	return r.DB.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/internal/geo"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"math"
+)
+
+// clusterCellsPerTile is how many grid cells span one 256px map tile, i.e.
+// clusters are roughly 64px apart on screen at any zoom level.
+const clusterCellsPerTile = 4
+
+// PostCluster summarises the posts falling into one grid cell.
+type PostCluster struct {
+	Count            int     `json:"count"`
+	Lat              float64 `json:"lat"` // centroid
+	Lng              float64 `json:"lng"`
+	DominantCategory string  `json:"dominant_category"`
+	MaxUrgency       int     `json:"max_urgency"`
+}
+
+type clusterKey struct{ X, Y int64 }
+
+// ClusterCellSize returns the grid cell size in degrees used at a map zoom level.
+func ClusterCellSize(zoom int) float64 {
+	return 360 / math.Pow(2, float64(zoom)) / clusterCellsPerTile
+}
+
+// GetPostClusters groups the posts inside box into square grid cells sized
+// for the given zoom level and returns count, centroid, most common issue
+// category and highest urgency per cell. Aggregation happens in the database
+// so only one row per cell (and per cell/category pair) is transferred.
+func (r *PostRepository) GetPostClusters(box geo.BBox, zoom int) ([]PostCluster, error) {
+	cell := ClusterCellSize(zoom)
+	cellX := "FLOOR((posts.lng - ?) / ?)"
+	cellY := "FLOOR((posts.lat - ?) / ?)"
+
+	type cellRow struct {
+		X, Y       int64
+		Count      int
+		Lat, Lng   float64
+		MaxUrgency int
+	}
+	var cells []cellRow
+	if err := r.whereInBBox(r.DB.Model(&models.Post{}), box).
+		Select("CAST("+cellX+" AS BIGINT) AS x, CAST("+cellY+" AS BIGINT) AS y, COUNT(*) AS count, AVG(posts.lat) AS lat, AVG(posts.lng) AS lng, MAX(posts.urgency) AS max_urgency",
+			box.MinLng, cell, box.MinLat, cell).
+		Group("x, y").
+		Scan(&cells).Error; err != nil {
+		return nil, err
+	}
+
+	type categoryRow struct {
+		X, Y     int64
+		Category string
+		Count    int
+	}
+	var categories []categoryRow
+	if err := r.whereInBBox(r.DB.Model(&models.Post{}).Joins("JOIN issues ON issues.id = posts.issue_id"), box).
+		Select("CAST("+cellX+" AS BIGINT) AS x, CAST("+cellY+" AS BIGINT) AS y, issues.category AS category, COUNT(*) AS count",
+			box.MinLng, cell, box.MinLat, cell).
+		Group("x, y, issues.category").
+		Scan(&categories).Error; err != nil {
+		return nil, err
+	}
+	dominant := map[clusterKey]categoryRow{}
+	for _, c := range categories {
+		k := clusterKey{c.X, c.Y}
+		if best, ok := dominant[k]; !ok || c.Count > best.Count || (c.Count == best.Count && c.Category < best.Category) {
+			dominant[k] = c
+		}
+	}
+
+	clusters := make([]PostCluster, 0, len(cells))
+	for _, c := range cells {
+		clusters = append(clusters, PostCluster{
+			Count:            c.Count,
+			Lat:              c.Lat,
+			Lng:              c.Lng,
+			DominantCategory: dominant[clusterKey{c.X, c.Y}].Category,
+			MaxUrgency:       c.MaxUrgency,
+		})
+	}
+	return clusters, nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// bumpPostCounter adds delta to a counter column of the post and, unless
+// activity is zero, moves last_activity_at forward to it.
+func bumpPostCounter(tx *gorm.DB, postID uuid.UUID, column string, delta int, activity time.Time) error {
+	updates := map[string]interface{}{column: gorm.Expr(column+" + ?", delta)}
+	if !activity.IsZero() {
+		updates["last_activity_at"] = activity
+	}
+	return tx.Model(&models.Post{}).Where("id = ?", postID).UpdateColumns(updates).Error
+}
+
+// BackfillPostCounters recomputes upvote_count, comment_count and
+// last_activity_at of every post from the upvotes and comments tables.
+// Returns the number of posts updated.
+func (r *PostRepository) BackfillPostCounters() (int64, error) {
+	var n int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec(`UPDATE posts SET
+			upvote_count = (SELECT COUNT(*) FROM upvotes WHERE upvotes.post_id = posts.id),
+			comment_count = (SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id),
+			last_activity_at = created_at`)
+		if res.Error != nil {
+			return res.Error
+		}
+		n = res.RowsAffected
+		// move last_activity_at forward to the newest comment or upvote
+		for _, table := range []string{"comments", "upvotes"} {
+			latest := "(SELECT MAX(" + table + ".created_at) FROM " + table + " WHERE " + table + ".post_id = posts.id)"
+			if err := tx.Exec("UPDATE posts SET last_activity_at = " + latest + " WHERE " + latest + " > last_activity_at").Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// UpvotedPostIDs reports which of the given posts userID has upvoted.
+func (r *PostRepository) UpvotedPostIDs(userID uuid.UUID, postIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	upvoted := map[uuid.UUID]bool{}
+	if len(postIDs) == 0 {
+		return upvoted, nil
+	}
+	var ids []uuid.UUID
+	err := r.DB.Model(&models.Upvote{}).
+		Where("user_id = ? AND post_id IN ?", userID, postIDs).
+		Pluck("post_id", &ids).Error
+	for _, id := range ids {
+		upvoted[id] = true
+	}
+	return upvoted, err
+}
+
+// DedupeUpvotes deletes all but the earliest upvote of each (post, user)
+// pair so the unique upvote index can be created on databases that collected
+// duplicates. Returns the number of upvotes deleted; callers should recompute
+// the post counters when it is non-zero.
+func (r *PostRepository) DedupeUpvotes() (int64, error) {
+	if !r.DB.Migrator().HasTable(&models.Upvote{}) {
+		return 0, nil
+	}
+	res := r.DB.Exec(`DELETE FROM upvotes WHERE EXISTS (
+		SELECT 1 FROM upvotes AS first
+		WHERE first.post_id = upvotes.post_id AND first.user_id = upvotes.user_id
+		AND (first.created_at < upvotes.created_at OR (first.created_at = upvotes.created_at AND first.id < upvotes.id)))`)
+	return res.RowsAffected, res.Error
+}
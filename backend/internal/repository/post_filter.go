@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/internal/geo"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PostFilter narrows feed queries. Zero values disable the corresponding filter.
+type PostFilter struct {
+	Category     string
+	Status       string
+	MinUrgency   int
+	MaxUrgency   int
+	UserID       uuid.UUID
+	CreatedFrom  time.Time
+	CreatedTo    time.Time
+	ClassifiedAs string
+	// Within restricts posts to a bounding box.
+	Within geo.BBox
+	// WithinAny restricts posts to the union of bounding boxes.
+	WithinAny []geo.BBox
+}
+
+// isZero reports whether f filters nothing.
+func (f PostFilter) isZero() bool {
+	return reflect.ValueOf(f).IsZero()
+}
+
+// PostKeyset identifies a position in a (created_at DESC, id DESC) ordering.
+type PostKeyset struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (f PostFilter) apply(r *PostRepository, q *gorm.DB) *gorm.DB {
+	if f.Category != "" {
+		q = q.Where("posts.issue_id IN (?)", r.DB.Model(&models.Issue{}).Select("id").Where("category = ?", f.Category))
+	}
+	if f.Status != "" {
+		q = q.Where("posts.status = ?", f.Status)
+	}
+	if f.MinUrgency > 0 {
+		q = q.Where("posts.urgency >= ?", f.MinUrgency)
+	}
+	if f.MaxUrgency > 0 {
+		q = q.Where("posts.urgency <= ?", f.MaxUrgency)
+	}
+	if f.UserID != uuid.Nil {
+		q = q.Where("posts.user_id = ?", f.UserID)
+	}
+	if !f.CreatedFrom.IsZero() {
+		q = q.Where("posts.created_at >= ?", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		q = q.Where("posts.created_at < ?", f.CreatedTo)
+	}
+	if f.ClassifiedAs != "" {
+		q = q.Where("LOWER(posts.classified_as) = LOWER(?)", f.ClassifiedAs)
+	}
+	if f.Within != (geo.BBox{}) {
+		q = r.whereInBBox(q, f.Within)
+	}
+	if len(f.WithinAny) > 0 {
+		q = r.whereInAnyBBox(q, f.WithinAny)
+	}
+	return q
+}
+
+// GetFilteredPosts returns posts matching the filter, newest first, with the
+// same preloads as GetFeedPosts. When after is set only posts strictly after
+// that position in the (created_at DESC, id DESC) order are returned, which
+// lets callers page through the feed with a keyset cursor.
+func (r *PostRepository) GetFilteredPosts(f PostFilter, after *PostKeyset, limit int) ([]models.Post, error) {
+	return r.filteredPosts(f, after, limit, true)
+}
+
+// GetFilteredPostsWithoutComments is GetFilteredPosts without loading the
+// comments, for callers that rank many posts by their stored scores.
+func (r *PostRepository) GetFilteredPostsWithoutComments(f PostFilter, after *PostKeyset, limit int) ([]models.Post, error) {
+	return r.filteredPosts(f, after, limit, false)
+}
+
+func (r *PostRepository) filteredPosts(f PostFilter, after *PostKeyset, limit int, withComments bool) ([]models.Post, error) {
+	var posts []models.Post
+	q := f.apply(r, r.DB.Model(&models.Post{}))
+	if after != nil {
+		q = q.Where("posts.created_at < ? OR (posts.created_at = ? AND posts.id < ?)", after.CreatedAt, after.CreatedAt, after.ID)
+	}
+	q = q.Preload("User").Preload("Issue")
+	if withComments {
+		q = q.Preload("Comments", func(db *gorm.DB) *gorm.DB {
+			return db.Preload("User").Order("created_at DESC")
+		})
+	}
+	err := q.
+		Order("posts.created_at DESC").
+		Order("posts.id DESC").
+		Limit(limit).
+		Find(&posts).Error
+	return posts, err
+}
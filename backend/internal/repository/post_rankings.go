@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RankingKeyset identifies a position in the (score DESC, created_at DESC,
+// id DESC) order of post_rankings.
+type RankingKeyset struct {
+	Score     float64
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// UpsertPostRankings stores the given rankings, replacing existing ones.
+func (r *PostRepository) UpsertPostRankings(rankings []models.PostRanking) error {
+	if len(rankings) == 0 {
+		return nil
+	}
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "post_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"score", "post_created_at", "computed_urgency", "computed_at"}),
+	}).Create(&rankings).Error
+}
+
+// PruneRankings deletes rankings last computed before the given time, i.e.
+// those of posts a full sweep no longer covers.
+func (r *PostRepository) PruneRankings(before time.Time) (int64, error) {
+	res := r.DB.Where("computed_at < ?", before).Delete(&models.PostRanking{})
+	return res.RowsAffected, res.Error
+}
+
+// GetPostsByIDs returns the posts with the same preloads as GetFeedPosts, in
+// no particular order.
+func (r *PostRepository) GetPostsByIDs(ids []uuid.UUID) ([]models.Post, error) {
+	var posts []models.Post
+	if len(ids) == 0 {
+		return posts, nil
+	}
+	err := r.DB.
+		Preload("User").
+		Preload("Issue").
+		Preload("Comments", func(db *gorm.DB) *gorm.DB {
+			return db.Preload("User").Order("created_at DESC")
+		}).
+		Where("id IN ?", ids).
+		Find(&posts).Error
+	return posts, err
+}
+
+// GetRankedPosts returns up to limit posts matching the filter in ranking
+// order, with Score and ComputedUrgency taken from post_rankings. When after
+// is set only posts strictly after that position are returned. Posts without
+// a ranking are not returned.
+func (r *PostRepository) GetRankedPosts(f PostFilter, after *RankingKeyset, limit int) ([]models.Post, error) {
+	var rankings []models.PostRanking
+	q := r.DB.Model(&models.PostRanking{})
+	if !f.isZero() {
+		q = f.apply(r, q.Joins("JOIN posts ON posts.id = post_rankings.post_id"))
+	}
+	if after != nil {
+		q = q.Where("post_rankings.score < ? OR (post_rankings.score = ? AND (post_rankings.post_created_at < ? OR (post_rankings.post_created_at = ? AND post_rankings.post_id < ?)))",
+			after.Score, after.Score, after.CreatedAt, after.CreatedAt, after.ID)
+	}
+	err := q.Select("post_rankings.*").
+		Order("post_rankings.score DESC").
+		Order("post_rankings.post_created_at DESC").
+		Order("post_rankings.post_id DESC").
+		Limit(limit).
+		Find(&rankings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(rankings))
+	for i, rk := range rankings {
+		ids[i] = rk.PostID
+	}
+	// the feed shows counters, not the comments themselves
+	var found []models.Post
+	if err := r.DB.Preload("User").Preload("Issue").Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]models.Post, len(found))
+	for _, p := range found {
+		byID[p.ID] = p
+	}
+	posts := make([]models.Post, 0, len(rankings))
+	for _, rk := range rankings {
+		p, ok := byID[rk.PostID]
+		if !ok {
+			continue // deleted since it was ranked; the next sweep prunes it
+		}
+		p.Score = rk.Score
+		p.ComputedUrgency = rk.ComputedUrgency
+		posts = append(posts, p)
+	}
+	return posts, nil
+}
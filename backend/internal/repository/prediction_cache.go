@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/cache"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PredictionCacheRepository stores ML predictions in the database so they
+// survive restarts. It implements cache.PredictionStore.
+type PredictionCacheRepository struct {
+	DB *gorm.DB
+}
+
+func NewPredictionCacheRepository(db *gorm.DB) *PredictionCacheRepository {
+	return &PredictionCacheRepository{DB: db}
+}
+
+func (r *PredictionCacheRepository) Get(ctx context.Context, key string) (cache.PredictionEntry, bool, error) {
+	var row models.PredictionCacheEntry
+	err := r.DB.WithContext(ctx).Where("cache_key = ? AND expires_at > ?", key, time.Now()).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return cache.PredictionEntry{}, false, nil
+	}
+	if err != nil {
+		return cache.PredictionEntry{}, false, err
+	}
+	return cache.PredictionEntry{
+		ModelID:   row.ModelID,
+		Urgency:   row.Urgency,
+		Score:     row.Score,
+		Class:     row.Class,
+		Source:    row.Source,
+		CreatedAt: row.CreatedAt,
+		ExpiresAt: row.ExpiresAt,
+	}, true, nil
+}
+
+func (r *PredictionCacheRepository) Set(ctx context.Context, key string, e cache.PredictionEntry, ttl time.Duration) error {
+	expiresAt := e.CreatedAt.Add(ttl)
+	if ttl <= 0 {
+		expiresAt = e.CreatedAt.AddDate(100, 0, 0)
+	}
+	row := models.PredictionCacheEntry{
+		Key:       key,
+		ModelID:   e.ModelID,
+		Urgency:   e.Urgency,
+		Score:     e.Score,
+		Class:     e.Class,
+		Source:    e.Source,
+		CreatedAt: e.CreatedAt,
+		ExpiresAt: expiresAt,
+	}
+	return r.DB.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&row).Error
+}
+
+func (r *PredictionCacheRepository) Invalidate(ctx context.Context, modelID string) error {
+	return r.DB.WithContext(ctx).Where("model_id = ?", modelID).Delete(&models.PredictionCacheEntry{}).Error
+}
+
+// PurgeExpired deletes expired rows and returns how many were removed.
+func (r *PredictionCacheRepository) PurgeExpired() (int64, error) {
+	res := r.DB.Where("expires_at <= ?", time.Now()).Delete(&models.PredictionCacheEntry{})
+	return res.RowsAffected, res.Error
+}
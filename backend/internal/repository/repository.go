@@ -3,21 +3,34 @@ package repository
 import (
 	"errors"
 	config "crowdsourcedurbanissuereportingwithai/backend/configs"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/geo"
 	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"math"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PostRepository struct {
 	DB *gorm.DB
+	// UsePostGIS switches map queries to PostGIS operators so they can use the
+	// GIST index created by EnsureSpatialIndexes (Postgres only).
+	UsePostGIS bool
 }
 
+// maxNearbyPosts caps the rows a radius query reads when the caller sets no
+// smaller limit.
+const maxNearbyPosts = 200
+
 func NewPostRepository(db *gorm.DB) *PostRepository {
 	return &PostRepository{DB: db}
 }
 
-// Feed: Get posts ordered by timeline (newest first), including comments and upvotes
+// Feed: Get posts ordered by timeline (newest first), including comments; upvotes are counted in UpvoteCount
 func (r *PostRepository) GetFeedPosts() ([]models.Post, error) {
 	var posts []models.Post
 	// Limit feed size for performance if configured
@@ -29,15 +42,15 @@ func (r *PostRepository) GetFeedPosts() ([]models.Post, error) {
 		Preload("Comments", func(db *gorm.DB) *gorm.DB {
 			return db.Preload("User").Order("created_at DESC")
 		}).
-		Preload("Upvotes").
 		Order("created_at DESC").
 		Limit(limit).
 		Find(&posts).Error
 	return posts, err
 }
 
-// ReportIssueViaPost: Create an issue if not exists, then create a post for it
-func (r *PostRepository) ReportIssueViaPost(userID, issueName, issueDesc, issueCat, postDesc, status string, urgency int, lat, lng float64, mediaURL string, classifiedAs string) (*models.Post, error) {
+// ReportIssueViaPost: Create an issue if not exists, then create a post for it.
+// language is the detected language of postDesc.
+func (r *PostRepository) ReportIssueViaPost(userID, issueName, issueDesc, issueCat, postDesc, status string, urgency int, lat, lng float64, mediaURL string, classifiedAs string, language string) (*models.Post, error) {
 	var issue models.Issue
 	err := r.DB.Where("name = ?", issueName).First(&issue).Error
 	if err == gorm.ErrRecordNotFound {
@@ -62,6 +75,7 @@ func (r *PostRepository) ReportIssueViaPost(userID, issueName, issueDesc, issueC
 		return nil, err
 	}
 	post := models.Post{
+		ID:           uuid.New(),
 		IssueID:      issue.ID,
 		UserID:       userUUID,
 		Description:  postDesc,
@@ -71,6 +85,8 @@ func (r *PostRepository) ReportIssueViaPost(userID, issueName, issueDesc, issueC
 		Lat:          lat,
 		Lng:          lng,
 		MediaURL:     mediaURL,
+		Language:     language,
+		LastActivityAt: time.Now(),
 	}
 	if err := r.DB.Create(&post).Error; err != nil {
 		return nil, err
@@ -78,36 +94,143 @@ func (r *PostRepository) ReportIssueViaPost(userID, issueName, issueDesc, issueC
 	return &post, nil
 }
 
+// NearbyPost is a post returned by a radius query together with its distance
+// from the query point.
+type NearbyPost struct {
+	Post      models.Post
+	DistanceM float64
+}
+
+// FindPostsNear returns posts within radiusM meters of (lat, lng), nearest
+// first, at most limit of them (maxNearbyPosts when limit is 0 or larger).
+// The query pre-filters on a lat/lng bounding box, which both Postgres and
+// sqlite can answer with plain comparisons, orders by an equirectangular
+// distance estimate and reads only that many rows; the exact haversine
+// distance is applied in Go. An empty category or statuses slice disables
+// that filter.
+func (r *PostRepository) FindPostsNear(lat, lng, radiusM float64, category string, statuses []string, limit int) ([]NearbyPost, error) {
+	if limit <= 0 || limit > maxNearbyPosts {
+		limit = maxNearbyPosts
+	}
+	box := geo.BoundingBox(lat, lng, radiusM)
+	q := r.whereInBBox(r.DB.
+		Preload("Issue").
+		Joins("JOIN issues ON issues.id = posts.issue_id"), box)
+	if category != "" {
+		q = q.Where("issues.category = ?", category)
+	}
+	if len(statuses) > 0 {
+		q = q.Where("posts.status IN ?", statuses)
+	}
+	// nearest first by squared degrees, longitude scaled by cos(lat)
+	k := math.Cos(lat * math.Pi / 180)
+	q = q.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:                "(posts.lat - ?) * (posts.lat - ?) + (posts.lng - ?) * (posts.lng - ?) * ?",
+		Vars:               []interface{}{lat, lat, lng, lng, k * k},
+		WithoutParentheses: true,
+	}})
+	var posts []models.Post
+	if err := q.Limit(limit).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+
+	nearby := make([]NearbyPost, 0, len(posts))
+	for _, p := range posts {
+		d := geo.HaversineMeters(lat, lng, p.Lat, p.Lng)
+		if d <= radiusM {
+			nearby = append(nearby, NearbyPost{Post: p, DistanceM: d})
+		}
+	}
+	sort.Slice(nearby, func(i, j int) bool { return nearby[i].DistanceM < nearby[j].DistanceM })
+	return nearby, nil
+}
+
+// GetPostsInBBox returns the newest posts (with user and issue) whose
+// location lies inside the box, at most limit of them.
+func (r *PostRepository) GetPostsInBBox(box geo.BBox, limit int) ([]models.Post, error) {
+	var posts []models.Post
+	err := r.whereInBBox(r.DB.Preload("User").Preload("Issue"), box).
+		Order("posts.created_at DESC").
+		Limit(limit).
+		Find(&posts).Error
+	return posts, err
+}
+
+// whereInBBox restricts q to posts inside box. Without PostGIS the plain
+// range comparisons are served by the composite (lat, lng) index; a box that
+// crosses the antimeridian (MinLng > MaxLng) is split in two longitude ranges.
+func (r *PostRepository) whereInBBox(q *gorm.DB, box geo.BBox) *gorm.DB {
+	cond, args := r.bboxCondition(box)
+	return q.Where(cond, args...)
+}
+
+// whereInAnyBBox restricts q to posts inside at least one of boxes.
+func (r *PostRepository) whereInAnyBBox(q *gorm.DB, boxes []geo.BBox) *gorm.DB {
+	conds := make([]string, len(boxes))
+	var args []interface{}
+	for i, box := range boxes {
+		cond, boxArgs := r.bboxCondition(box)
+		conds[i] = "(" + cond + ")"
+		args = append(args, boxArgs...)
+	}
+	return q.Where(strings.Join(conds, " OR "), args...)
+}
+
+func (r *PostRepository) bboxCondition(box geo.BBox) (string, []interface{}) {
+	if box.MinLng > box.MaxLng {
+		return "posts.lat BETWEEN ? AND ? AND (posts.lng >= ? OR posts.lng <= ?)", []interface{}{box.MinLat, box.MaxLat, box.MinLng, box.MaxLng}
+	}
+	if r.UsePostGIS {
+		return "ST_SetSRID(ST_MakePoint(posts.lng, posts.lat), 4326) && ST_MakeEnvelope(?, ?, ?, ?, 4326)", []interface{}{box.MinLng, box.MinLat, box.MaxLng, box.MaxLat}
+	}
+	return "posts.lat BETWEEN ? AND ? AND posts.lng BETWEEN ? AND ?", []interface{}{box.MinLat, box.MaxLat, box.MinLng, box.MaxLng}
+}
+
+// EnsureSpatialIndexes enables PostGIS and creates a GIST index on the post
+// location expression used by whereInBBox. Postgres only.
+func (r *PostRepository) EnsureSpatialIndexes() error {
+	if err := r.DB.Exec("CREATE EXTENSION IF NOT EXISTS postgis").Error; err != nil {
+		return err
+	}
+	return r.DB.Exec("CREATE INDEX IF NOT EXISTS idx_post_location_gist ON posts USING GIST (ST_SetSRID(ST_MakePoint(lng, lat), 4326))").Error
+}
+
 // UpdatePostScoreAdd increments (or decrements) score_sum and score_count atomically for a post.
 // deltaCount can be negative (e.g., when removing an upvote) but will not reduce below 1 if description initialized.
+// The update is a single statement relative to the stored values, so concurrent calls never lose an update.
 func (r *PostRepository) UpdatePostScoreAdd(postID uuid.UUID, deltaScore float64, deltaCount int) error {
-	var p models.Post
-	if err := r.DB.First(&p, "id = ?", postID).Error; err != nil {
-		return err
+	res := r.DB.Model(&models.Post{}).Where("id = ?", postID).UpdateColumns(map[string]interface{}{
+		"score_sum":   gorm.Expr("CASE WHEN score_sum + ? < 0 THEN 0 ELSE score_sum + ? END", deltaScore, deltaScore),
+		"score_count": gorm.Expr("CASE WHEN score_count + ? < 1 THEN 1 ELSE score_count + ? END", deltaCount, deltaCount),
+	})
+	if res.Error != nil {
+		return res.Error
 	}
-	// Initialize baseline if not set
-	sum := p.ScoreSum + deltaScore
-	cnt := p.ScoreCount + deltaCount
-	if cnt < 1 {
-		cnt = 1
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
 	}
-	if sum < 0 {
-		sum = 0
-	}
-	return r.DB.Model(&models.Post{}).Where("id = ?", postID).Updates(map[string]interface{}{
-		"score_sum":   sum,
-		"score_count": cnt,
-	}).Error
+	return nil
 }
 
-// AddComment creates a comment on a post by a user
-func (r *PostRepository) AddComment(userID, postID uuid.UUID, content string) (*models.Comment, error) {
+// AddComment creates a comment on a post by a user; language is the detected
+// language of content. The post's comment_count and last_activity_at are
+// updated in the same transaction.
+func (r *PostRepository) AddComment(userID, postID uuid.UUID, content, language string) (*models.Comment, error) {
 	comment := models.Comment{
-		PostID:  postID,
-		UserID:  userID,
-		Content: content,
+		ID:        uuid.New(),
+		PostID:    postID,
+		UserID:    userID,
+		Content:   content,
+		Language:  language,
+		CreatedAt: time.Now(),
 	}
-	if err := r.DB.Create(&comment).Error; err != nil {
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		return bumpPostCounter(tx, postID, "comment_count", 1, comment.CreatedAt)
+	})
+	if err != nil {
 		return nil, err
 	}
 	// preload user info
@@ -118,32 +241,58 @@ func (r *PostRepository) AddComment(userID, postID uuid.UUID, content string) (*
 	return &comment, nil
 }
 
-// ToggleUpvote creates an upvote if missing, or removes an existing upvote.
+// ToggleUpvote creates an upvote if missing, or removes an existing upvote,
+// and adjusts the post's upvote_count in the same transaction.
 // Returns true if upvote was created, false if removed.
+//
+// There is no read before the write: the delete reports whether an upvote
+// existed, and the insert relies on the unique (post_id, user_id) index, so
+// concurrent toggles can neither duplicate an upvote nor miscount it. When a
+// concurrent request inserts the same upvote first, this one reports it as
+// created without counting it twice.
 func (r *PostRepository) ToggleUpvote(userID, postID uuid.UUID) (bool, error) {
-	var existing models.Upvote
-	err := r.DB.Where("post_id = ? AND user_id = ?", postID, userID).First(&existing).Error
-	switch {
-	case err == nil:
-		// found existing - remove it
-		if err := r.DB.Delete(&existing).Error; err != nil {
-			return false, err
+	upvoted := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		upvoted = false
+		res := tx.Where("post_id = ? AND user_id = ?", postID, userID).Delete(&models.Upvote{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			return bumpPostCounter(tx, postID, "upvote_count", -int(res.RowsAffected), time.Time{})
 		}
-		return false, nil
-	case errors.Is(err, gorm.ErrRecordNotFound):
-		// continue to create new upvote
-	default:
+		upvoted = true
+		return addUpvote(tx, userID, postID)
+	})
+	if err != nil {
 		return false, err
 	}
-	// create new upvote
+	return upvoted, nil
+}
+
+// AddUpvote upvotes a post for a user unless they already did. Unlike
+// ToggleUpvote it never removes an upvote, so it is safe to repeat.
+func (r *PostRepository) AddUpvote(userID, postID uuid.UUID) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		return addUpvote(tx, userID, postID)
+	})
+}
+
+func addUpvote(tx *gorm.DB, userID, postID uuid.UUID) error {
 	up := models.Upvote{
-		PostID: postID,
-		UserID: userID,
+		ID:        uuid.New(),
+		PostID:    postID,
+		UserID:    userID,
+		CreatedAt: time.Now(),
 	}
-	if err := r.DB.Create(&up).Error; err != nil {
-		return false, err
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&up)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil // already upvoted, possibly by a concurrent request
 	}
-	return true, nil
+	return bumpPostCounter(tx, postID, "upvote_count", 1, up.CreatedAt)
 }
 
 // GetPostComments fetches all comments for a post
@@ -158,19 +307,54 @@ func (r *PostRepository) UpdatePostUrgency(postID uuid.UUID, newUrgency int) err
 	return r.DB.Model(&models.Post{}).Where("id = ?", postID).Update("urgency", newUrgency).Error
 }
 
-// UpdatePostStatus updates the status of a post (e.g., "open" -> "closed")
-func (r *PostRepository) UpdatePostStatus(postID uuid.UUID, status string) (*models.Post, error) {
-	post := &models.Post{}
-	if err := r.DB.Model(post).Where("id = ?", postID).Update("status", status).Error; err != nil {
+// ErrStatusChanged is returned by UpdatePostStatus when the post's status no
+// longer matches the expected from-status (another update won the race).
+var ErrStatusChanged = errors.New("post status was changed concurrently")
+
+// UpdatePostStatus moves a post from fromStatus to toStatus and records the
+// transition in post_status_changes within a single transaction.
+func (r *PostRepository) UpdatePostStatus(postID, actorID uuid.UUID, fromStatus, toStatus, notes string) (*models.Post, error) {
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Post{}).
+			Where("id = ? AND status = ?", postID, fromStatus).
+			Update("status", toStatus)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrStatusChanged
+		}
+		change := models.PostStatusChange{
+			ID:         uuid.New(),
+			PostID:     postID,
+			ActorID:    actorID,
+			FromStatus: fromStatus,
+			ToStatus:   toStatus,
+			Notes:      notes,
+		}
+		return tx.Create(&change).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	// Reload the post with preloads
+	post := &models.Post{}
 	if err := r.DB.Preload("User").Preload("Issue").Preload("Comments").Preload("Upvotes").First(post, "id = ?", postID).Error; err != nil {
 		return nil, err
 	}
 	return post, nil
 }
 
+// GetPostStatusHistory returns all status changes of a post, oldest first.
+// Only the id and name of each actor are loaded.
+func (r *PostRepository) GetPostStatusHistory(postID uuid.UUID) ([]models.PostStatusChange, error) {
+	var changes []models.PostStatusChange
+	err := r.DB.Where("post_id = ?", postID).
+		Preload("Actor", func(db *gorm.DB) *gorm.DB { return db.Select("id", "name") }).
+		Order("created_at ASC").Find(&changes).Error
+	return changes, err
+}
+
 // GetPost fetches a single post by ID
 func (r *PostRepository) GetPost(postID uuid.UUID) (*models.Post, error) {
 	var post models.Post
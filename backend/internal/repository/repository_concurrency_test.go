@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// concurrencyDBs returns the databases the concurrency tests run against: a
+// sqlite file in WAL mode and, when TEST_DATABASE_DSN is set, Postgres. On
+// sqlite a transaction that reads before it writes cannot wait out a
+// concurrent writer and fails with SQLITE_BUSY, so read-then-write code shows
+// up here even where it would merely race on Postgres.
+func concurrencyDBs(t *testing.T) map[string]*gorm.DB {
+	cfg := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+	dsn := "file:" + filepath.Join(t.TempDir(), "concurrency.db") +
+		"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)"
+	lite, err := gorm.Open(sqlite.Open(dsn), cfg)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	stmts := []string{
+		`CREATE TABLE users (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			email TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			email_verified_at DATETIME,
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+		`CREATE TABLE issues (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT,
+			category TEXT NOT NULL,
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+		`CREATE TABLE posts (
+			id TEXT PRIMARY KEY,
+			issue_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			description TEXT,
+			language TEXT,
+			status TEXT NOT NULL,
+			urgency INTEGER NOT NULL,
+			classified_as TEXT,
+			lat REAL NOT NULL,
+			lng REAL NOT NULL,
+			media_url TEXT NOT NULL,
+			score_sum REAL DEFAULT 0,
+			score_count INTEGER DEFAULT 0,
+			upvote_count INTEGER NOT NULL DEFAULT 0,
+			comment_count INTEGER NOT NULL DEFAULT 0,
+			last_activity_at DATETIME,
+			enrichment_status TEXT DEFAULT 'done',
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+		`CREATE TABLE upvotes (
+			id TEXT PRIMARY KEY,
+			post_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			created_at DATETIME,
+			UNIQUE (post_id, user_id)
+		);`,
+	}
+	for _, stmt := range stmts {
+		if err := lite.Exec(stmt).Error; err != nil {
+			t.Fatalf("create table: %v", err)
+		}
+	}
+	dbs := map[string]*gorm.DB{"sqlite": lite}
+
+	if pgDSN := os.Getenv("TEST_DATABASE_DSN"); pgDSN != "" {
+		pg, err := gorm.Open(postgres.Open(pgDSN), cfg)
+		if err != nil {
+			t.Fatalf("open postgres: %v", err)
+		}
+		pg.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`)
+		if err := pg.AutoMigrate(&models.User{}, &models.Issue{}, &models.Post{}, &models.Upvote{}); err != nil {
+			t.Fatalf("migrate postgres: %v", err)
+		}
+		dbs["postgres"] = pg
+	} else {
+		t.Log("TEST_DATABASE_DSN not set; running against sqlite only")
+	}
+	return dbs
+}
+
+// seedPost creates a post and n users to act on it.
+func seedPost(t *testing.T, db *gorm.DB, n int) (uuid.UUID, []uuid.UUID) {
+	users := make([]uuid.UUID, n+1)
+	for i := range users {
+		u := models.User{ID: uuid.New(), Name: "Racer", Email: uuid.NewString() + "@example.com", PasswordHash: "x"}
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		users[i] = u.ID
+	}
+	issue := models.Issue{ID: uuid.New(), Name: "Race " + uuid.NewString(), Category: "Road"}
+	if err := db.Create(&issue).Error; err != nil {
+		t.Fatalf("create issue: %v", err)
+	}
+	post := models.Post{ID: uuid.New(), IssueID: issue.ID, UserID: users[0], Status: "open", Urgency: 1, MediaURL: "m"}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatalf("create post: %v", err)
+	}
+	return post.ID, users[1:]
+}
+
+// hammer runs fn on n goroutines at once and fails on the first error.
+func hammer(t *testing.T, n int, fn func(i int) error) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			if err := fn(i); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+// checkUpvotes verifies there is at most one upvote per user and that the
+// post counter matches the rows, and returns the number of upvotes.
+func checkUpvotes(t *testing.T, db *gorm.DB, postID uuid.UUID) int {
+	var rows, pairs int64
+	db.Model(&models.Upvote{}).Where("post_id = ?", postID).Count(&rows)
+	db.Model(&models.Upvote{}).Where("post_id = ?", postID).Distinct("user_id").Count(&pairs)
+	if rows != pairs {
+		t.Fatalf("duplicate upvotes: %d rows for %d users", rows, pairs)
+	}
+	var post models.Post
+	db.First(&post, "id = ?", postID)
+	if int64(post.UpvoteCount) != rows {
+		t.Fatalf("upvote_count %d does not match %d upvotes", post.UpvoteCount, rows)
+	}
+	return int(rows)
+}
+
+func TestConcurrentUpvotesAndScores(t *testing.T) {
+	for name, db := range concurrencyDBs(t) {
+		t.Run(name, func(t *testing.T) {
+			repo := NewPostRepository(db)
+
+			t.Run("distinct users", func(t *testing.T) {
+				postID, users := seedPost(t, db, 40)
+				hammer(t, len(users), func(i int) error {
+					_, err := repo.ToggleUpvote(users[i], postID)
+					return err
+				})
+				if n := checkUpvotes(t, db, postID); n != len(users) {
+					t.Fatalf("expected %d upvotes, got %d", len(users), n)
+				}
+			})
+
+			t.Run("same user", func(t *testing.T) {
+				postID, users := seedPost(t, db, 1)
+				hammer(t, 40, func(int) error {
+					_, err := repo.ToggleUpvote(users[0], postID)
+					return err
+				})
+				if n := checkUpvotes(t, db, postID); n > 1 {
+					t.Fatalf("expected at most one upvote, got %d", n)
+				}
+			})
+
+			t.Run("score updates", func(t *testing.T) {
+				postID, _ := seedPost(t, db, 0)
+				const n = 100
+				hammer(t, n, func(int) error {
+					return repo.UpdatePostScoreAdd(postID, 0.01, 1)
+				})
+				var post models.Post
+				db.First(&post, "id = ?", postID)
+				if post.ScoreCount != n || math.Abs(post.ScoreSum-1.0) > 1e-9 {
+					t.Fatalf("lost score updates: sum %v count %d, want 1 and %d", post.ScoreSum, post.ScoreCount, n)
+				}
+			})
+		})
+	}
+}
+
+func TestUpdatePostScoreAddClampsAndReportsMissingPost(t *testing.T) {
+	db := concurrencyDBs(t)["sqlite"]
+	repo := NewPostRepository(db)
+	postID, _ := seedPost(t, db, 0)
+	if err := repo.UpdatePostScoreAdd(postID, -5, -5); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	var post models.Post
+	db.First(&post, "id = ?", postID)
+	if post.ScoreSum != 0 || post.ScoreCount != 1 {
+		t.Fatalf("expected clamped sum 0 and count 1, got %v and %d", post.ScoreSum, post.ScoreCount)
+	}
+	if err := repo.UpdatePostScoreAdd(uuid.New(), 1, 1); err != gorm.ErrRecordNotFound {
+		t.Fatalf("expected ErrRecordNotFound for a missing post, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RoleRepository stores roles, their permissions and which users hold them.
+type RoleRepository struct {
+	DB *gorm.DB
+}
+
+func NewRoleRepository(db *gorm.DB) *RoleRepository {
+	return &RoleRepository{DB: db}
+}
+
+// EnsureRoles creates the given roles and permissions if they do not exist
+// and sets each role's description, rank and permissions to the given ones.
+// Roles and permissions not mentioned are left alone.
+func (r *RoleRepository) EnsureRoles(roles []models.Role) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		perms := map[string]models.Permission{}
+		for _, role := range roles {
+			for _, p := range role.Permissions {
+				if _, ok := perms[p.Name]; ok {
+					continue
+				}
+				var stored models.Permission
+				if err := tx.Where(models.Permission{Name: p.Name}).Attrs(models.Permission{ID: uuid.New()}).FirstOrCreate(&stored).Error; err != nil {
+					return err
+				}
+				if stored.Description != p.Description {
+					if err := tx.Model(&stored).Update("description", p.Description).Error; err != nil {
+						return err
+					}
+				}
+				perms[p.Name] = stored
+			}
+		}
+		for _, role := range roles {
+			var stored models.Role
+			if err := tx.Where(models.Role{Name: role.Name}).Attrs(models.Role{ID: uuid.New(), CreatedAt: time.Now()}).FirstOrCreate(&stored).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&stored).Updates(map[string]interface{}{"description": role.Description, "rank": role.Rank}).Error; err != nil {
+				return err
+			}
+			want := make([]models.Permission, 0, len(role.Permissions))
+			for _, p := range role.Permissions {
+				want = append(want, perms[p.Name])
+			}
+			if err := tx.Model(&stored).Association("Permissions").Replace(want); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListRoles returns all roles with their permissions, most privileged first.
+func (r *RoleRepository) ListRoles() ([]models.Role, error) {
+	var roles []models.Role
+	err := r.DB.Preload("Permissions").Order("rank DESC, name ASC").Find(&roles).Error
+	return roles, err
+}
+
+// GetRoleByName returns a role with its permissions.
+func (r *RoleRepository) GetRoleByName(name string) (*models.Role, error) {
+	var role models.Role
+	if err := r.DB.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// UserRoles returns the roles assigned to a user with their permissions, most
+// privileged first.
+func (r *RoleRepository) UserRoles(userID uuid.UUID) ([]models.Role, error) {
+	var roles []models.Role
+	err := r.DB.Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.rank DESC, roles.name ASC").
+		Find(&roles).Error
+	return roles, err
+}
+
+// AssignRole gives a user a role and reports whether they did not hold it
+// already.
+func (r *RoleRepository) AssignRole(userID, roleID uuid.UUID, grantedBy *uuid.UUID) (bool, error) {
+	res := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UserRole{
+		UserID:    userID,
+		RoleID:    roleID,
+		GrantedBy: grantedBy,
+		CreatedAt: time.Now(),
+	})
+	return res.RowsAffected > 0, res.Error
+}
+
+// RevokeRole takes a role from a user, returning gorm.ErrRecordNotFound if the
+// user does not hold it.
+func (r *RoleRepository) RevokeRole(userID, roleID uuid.UUID) error {
+	res := r.DB.Where("user_id = ? AND role_id = ?", userID, roleID).Delete(&models.UserRole{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SyncRoles makes the roles a user holds from source exactly roleIDs: roles
+// from source not in roleIDs are removed, missing ones are added. Roles the
+// user holds from elsewhere are left alone.
+func (r *RoleRepository) SyncRoles(userID uuid.UUID, source string, roleIDs []uuid.UUID) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		stale := tx.Where("user_id = ? AND source = ?", userID, source)
+		if len(roleIDs) > 0 {
+			stale = stale.Where("role_id NOT IN ?", roleIDs)
+		}
+		if err := stale.Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		for _, id := range roleIDs {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UserRole{
+				UserID:    userID,
+				RoleID:    id,
+				Source:    source,
+				CreatedAt: time.Now(),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CountRoleHolders returns how many users hold a role.
+func (r *RoleRepository) CountRoleHolders(roleID uuid.UUID) (int64, error) {
+	var n int64
+	err := r.DB.Model(&models.UserRole{}).Where("role_id = ?", roleID).Count(&n).Error
+	return n, err
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrActiveProfileVersion is returned when deleting the active scoring
+// profile version.
+var ErrActiveProfileVersion = errors.New("scoring profile version is active")
+
+// ErrProfileVersionChanged is returned by CreateVersionOver when another
+// version was activated since the caller read the active one.
+var ErrProfileVersionChanged = errors.New("active scoring profile version changed")
+
+// ScoringProfileRepository stores versions of the urgency scoring profile.
+type ScoringProfileRepository struct {
+	DB *gorm.DB
+}
+
+func NewScoringProfileRepository(db *gorm.DB) *ScoringProfileRepository {
+	return &ScoringProfileRepository{DB: db}
+}
+
+// CreateVersion stores profile as the next version number. When activate is
+// set the new version replaces the active one in the same transaction.
+func (r *ScoringProfileRepository) CreateVersion(profile []byte, notes string, createdBy uuid.UUID, activate bool) (*models.ScoringProfileVersion, error) {
+	var row models.ScoringProfileVersion
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&models.ScoringProfileVersion{}).Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		if activate {
+			if err := tx.Model(&models.ScoringProfileVersion{}).Where("active = ?", true).Update("active", false).Error; err != nil {
+				return err
+			}
+		}
+		row = newProfileVersion(latest+1, profile, notes, createdBy, activate)
+		return tx.Create(&row).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// CreateVersionOver stores profile as the next version and activates it, but
+// only while base is still the active version (0 meaning none is active).
+// The active row is deactivated with a conditional update, so of two writers
+// that read the same base only the first one wins; the other gets
+// ErrProfileVersionChanged and nothing is stored.
+func (r *ScoringProfileRepository) CreateVersionOver(base int, profile []byte, notes string, createdBy uuid.UUID) (*models.ScoringProfileVersion, error) {
+	var row models.ScoringProfileVersion
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if base == 0 {
+			var active int64
+			if err := tx.Model(&models.ScoringProfileVersion{}).Where("active = ?", true).Count(&active).Error; err != nil {
+				return err
+			}
+			if active > 0 {
+				return ErrProfileVersionChanged
+			}
+		} else {
+			res := tx.Model(&models.ScoringProfileVersion{}).Where("version = ? AND active = ?", base, true).Update("active", false)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return ErrProfileVersionChanged
+			}
+		}
+		var latest int
+		if err := tx.Model(&models.ScoringProfileVersion{}).Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		row = newProfileVersion(latest+1, profile, notes, createdBy, true)
+		return tx.Create(&row).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func newProfileVersion(version int, profile []byte, notes string, createdBy uuid.UUID, active bool) models.ScoringProfileVersion {
+	return models.ScoringProfileVersion{
+		ID:        uuid.New(),
+		Version:   version,
+		Profile:   string(profile),
+		Active:    active,
+		Notes:     notes,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+}
+
+// GetActive returns the active version, or gorm.ErrRecordNotFound if none is.
+func (r *ScoringProfileRepository) GetActive() (*models.ScoringProfileVersion, error) {
+	var row models.ScoringProfileVersion
+	if err := r.DB.Where("active = ?", true).Order("version DESC").First(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// GetVersion returns one version, or gorm.ErrRecordNotFound.
+func (r *ScoringProfileRepository) GetVersion(version int) (*models.ScoringProfileVersion, error) {
+	var row models.ScoringProfileVersion
+	if err := r.DB.Where("version = ?", version).First(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// ListVersions returns all versions, newest first.
+func (r *ScoringProfileRepository) ListVersions() ([]models.ScoringProfileVersion, error) {
+	var rows []models.ScoringProfileVersion
+	err := r.DB.Order("version DESC").Find(&rows).Error
+	return rows, err
+}
+
+// ActivateVersion makes version the only active one.
+func (r *ScoringProfileRepository) ActivateVersion(version int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ScoringProfileVersion{}).Where("active = ?", true).Update("active", false).Error; err != nil {
+			return err
+		}
+		res := tx.Model(&models.ScoringProfileVersion{}).Where("version = ?", version).Update("active", true)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteVersion removes an inactive version.
+func (r *ScoringProfileRepository) DeleteVersion(version int) error {
+	row, err := r.GetVersion(version)
+	if err != nil {
+		return err
+	}
+	if row.Active {
+		return ErrActiveProfileVersion
+	}
+	return r.DB.Delete(&models.ScoringProfileVersion{}, "version = ?", version).Error
+}
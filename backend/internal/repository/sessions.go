@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SessionRepository stores sessions and their hashed refresh tokens.
+type SessionRepository struct {
+	DB *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{DB: db}
+}
+
+// CreateSession stores a new session together with its first refresh token.
+func (r *SessionRepository) CreateSession(session *models.Session, tokenHash string) error {
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.RefreshToken{TokenHash: tokenHash, SessionID: session.ID, CreatedAt: session.CreatedAt}).Error
+	})
+}
+
+// RotateResult is the outcome of RotateRefreshToken.
+type RotateResult int
+
+const (
+	// Rotated means the token was valid and has been replaced.
+	Rotated RotateResult = iota
+	// UnknownToken means no session ever issued the token.
+	UnknownToken
+	// ReusedToken means the token had already been rotated; its session has
+	// been revoked.
+	ReusedToken
+	// InactiveSession means the token's session is revoked or expired.
+	InactiveSession
+)
+
+// RotateRefreshToken exchanges the refresh token with hash oldHash for one
+// with hash newHash. Marking the old token used is a conditional update, so of
+// two concurrent rotations of the same token only one succeeds and the other
+// is treated as reuse. It returns the session the token belongs to, if any.
+func (r *SessionRepository) RotateRefreshToken(oldHash, newHash string, now time.Time) (*models.Session, RotateResult, error) {
+	var session models.Session
+	result := Rotated
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var token models.RefreshToken
+		if err := tx.Where("token_hash = ?", oldHash).First(&token).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				result = UnknownToken
+				return nil
+			}
+			return err
+		}
+		if err := tx.Where("id = ?", token.SessionID).First(&session).Error; err != nil {
+			return err
+		}
+		if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+			result = InactiveSession
+			return nil
+		}
+		res := tx.Model(&models.RefreshToken{}).Where("token_hash = ? AND used_at IS NULL", oldHash).Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			result = ReusedToken
+			session.RevokedAt = &now
+			return tx.Model(&models.Session{}).Where("id = ?", session.ID).Update("revoked_at", now).Error
+		}
+		session.LastUsedAt = now
+		if err := tx.Model(&models.Session{}).Where("id = ?", session.ID).Update("last_used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.RefreshToken{TokenHash: newHash, SessionID: session.ID, CreatedAt: now}).Error
+	})
+	if err != nil {
+		return nil, Rotated, err
+	}
+	if result == UnknownToken {
+		return nil, result, nil
+	}
+	return &session, result, nil
+}
+
+// ListActiveSessions returns a user's sessions that are neither revoked nor
+// expired, most recently used first.
+func (r *SessionRepository) ListActiveSessions(userID uuid.UUID, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSession revokes one of a user's active sessions, returning
+// gorm.ErrRecordNotFound if the user has no such session.
+func (r *SessionRepository) RevokeSession(userID, sessionID uuid.UUID, now time.Time) error {
+	res := r.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", now)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes all active sessions of a user and returns how
+// many there were.
+func (r *SessionRepository) RevokeUserSessions(userID uuid.UUID, now time.Time) (int64, error) {
+	res := r.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now)
+	return res.RowsAffected, res.Error
+}
+
+// PurgeExpired deletes sessions that expired or were revoked before cutoff,
+// with their refresh tokens, and returns how many sessions were removed.
+func (r *SessionRepository) PurgeExpired(cutoff time.Time) (int64, error) {
+	var n int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		stale := tx.Model(&models.Session{}).Select("id").Where("expires_at <= ? OR revoked_at <= ?", cutoff, cutoff)
+		if err := tx.Where("session_id IN (?)", stale).Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("expires_at <= ? OR revoked_at <= ?", cutoff, cutoff).Delete(&models.Session{})
+		n = res.RowsAffected
+		return res.Error
+	})
+	return n, err
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SaveUrgencyExplanation stores the JSON explanation for a post, replacing
+// any previous one.
+func (r *PostRepository) SaveUrgencyExplanation(postID uuid.UUID, explanation []byte) error {
+	row := models.PostUrgencyExplanation{
+		PostID:      postID,
+		Explanation: string(explanation),
+		UpdatedAt:   time.Now(),
+	}
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "post_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"explanation", "updated_at"}),
+	}).Create(&row).Error
+}
+
+// GetUrgencyExplanation returns the stored explanation of a post, or
+// gorm.ErrRecordNotFound if none has been saved yet.
+func (r *PostRepository) GetUrgencyExplanation(postID uuid.UUID) (*models.PostUrgencyExplanation, error) {
+	var row models.PostUrgencyExplanation
+	if err := r.DB.First(&row, "post_id = ?", postID).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// CountPostUpvotes returns the number of upvotes on a post.
+func (r *PostRepository) CountPostUpvotes(postID uuid.UUID) (int64, error) {
+	var n int64
+	err := r.DB.Model(&models.Upvote{}).Where("post_id = ?", postID).Count(&n).Error
+	return n, err
+}
+
+// RescorePost replaces a post's urgency, its score_sum and score_count, and
+// its urgency explanation in one transaction, so the explanation always
+// describes the score the post has.
+func (r *PostRepository) RescorePost(postID uuid.UUID, urgency int, scoreSum float64, scoreCount int, explanation []byte) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Post{}).Where("id = ?", postID).UpdateColumns(map[string]interface{}{
+			"urgency":     urgency,
+			"score_sum":   scoreSum,
+			"score_count": scoreCount,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return (&PostRepository{DB: tx}).SaveUrgencyExplanation(postID, explanation)
+	})
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListPlaces returns the places a user saved, oldest first.
+func (r *UserRepository) ListPlaces(userID uuid.UUID) ([]models.UserPlace, error) {
+	var places []models.UserPlace
+	err := r.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&places).Error
+	return places, err
+}
+
+// ErrPlaceLimit is returned by AddPlace when the user already saved the
+// maximum number of places.
+var ErrPlaceLimit = errors.New("place limit reached")
+
+// AddPlace saves a place for its user unless the user already saved max
+// places. The user's row stays locked from the count to the insert, so
+// concurrent requests cannot exceed max.
+func (r *UserRepository) AddPlace(place *models.UserPlace, max int) error {
+	if place.ID == uuid.Nil {
+		place.ID = uuid.New()
+	}
+	if place.CreatedAt.IsZero() {
+		place.CreatedAt = time.Now()
+	}
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ?", place.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		var n int64
+		if err := tx.Model(&models.UserPlace{}).Where("user_id = ?", place.UserID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n >= int64(max) {
+			return ErrPlaceLimit
+		}
+		return tx.Create(place).Error
+	})
+}
+
+// DeletePlace removes one of a user's places, returning gorm.ErrRecordNotFound
+// if the user has no such place.
+func (r *UserRepository) DeletePlace(userID, placeID uuid.UUID) error {
+	res := r.DB.Where("id = ? AND user_id = ?", placeID, userID).Delete(&models.UserPlace{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UserCategoryInteractions counts, per issue category, the posts a user
+// upvoted or commented on.
+func (r *PostRepository) UserCategoryInteractions(userID uuid.UUID) (map[string]int, error) {
+	type row struct {
+		Category string
+		N        int
+	}
+	counts := map[string]int{}
+	for _, table := range []string{"upvotes", "comments"} {
+		var rows []row
+		err := r.DB.Table(table).
+			Select("issues.category AS category, COUNT(*) AS n").
+			Joins("JOIN posts ON posts.id = "+table+".post_id").
+			Joins("JOIN issues ON issues.id = posts.issue_id").
+			Where(table+".user_id = ?", userID).
+			Group("issues.category").
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, rw := range rows {
+			counts[rw.Category] += rw.N
+		}
+	}
+	return counts, nil
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -36,3 +38,21 @@ func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
 	}
 	return &u, nil
 }
+
+// MarkEmailVerified records that the user confirmed email. It returns false
+// when the user's email is no longer email or was already verified.
+func (r *UserRepository) MarkEmailVerified(id uuid.UUID, email string, at time.Time) (bool, error) {
+	res := r.DB.Model(&models.User{}).
+		Where("id = ? AND email = ? AND email_verified_at IS NULL", id, email).
+		Update("email_verified_at", at)
+	return res.RowsAffected > 0, res.Error
+}
+
+// ReplacePasswordHash sets a new password hash if the current one is still
+// oldHash, so of two resets racing with the same token only one succeeds.
+func (r *UserRepository) ReplacePasswordHash(id uuid.UUID, oldHash, newHash string) (bool, error) {
+	res := r.DB.Model(&models.User{}).
+		Where("id = ? AND password_hash = ?", id, oldHash).
+		Update("password_hash", newHash)
+	return res.RowsAffected > 0, res.Error
+}
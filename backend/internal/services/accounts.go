@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/mail"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// MinPasswordLength is the shortest password accepted by ResetPassword.
+const MinPasswordLength = 8
+
+var (
+	// ErrActionTokenUsed is returned for a valid link whose action was
+	// already done: the email is verified or the password was changed since.
+	ErrActionTokenUsed = errors.New("this link has already been used")
+	// ErrWeakPassword is returned for new passwords shorter than
+	// MinPasswordLength.
+	ErrWeakPassword = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+)
+
+// AccountService runs the email verification and password reset flows. Both
+// mail the user a link with a signed token. Tokens expire, and each is bound
+// to the state it changes (the address being verified, the password hash
+// being replaced), so it works only once and a reset link stops working as
+// soon as the password changes some other way.
+type AccountService struct {
+	Users  *repository.UserRepository
+	Tokens *auth.JWTService
+	Mailer mail.Mailer
+	// Sessions, if set, are all revoked when a password is reset.
+	Sessions *SessionService
+	// BaseURL is the frontend URL the links point to.
+	BaseURL   string
+	VerifyTTL time.Duration
+	ResetTTL  time.Duration
+
+	now func() time.Time
+}
+
+func NewAccountService(users *repository.UserRepository, tokens *auth.JWTService, mailer mail.Mailer, baseURL string) *AccountService {
+	return &AccountService{
+		Users:     users,
+		Tokens:    tokens,
+		Mailer:    mailer,
+		BaseURL:   baseURL,
+		VerifyTTL: 48 * time.Hour,
+		ResetTTL:  time.Hour,
+		now:       time.Now,
+	}
+}
+
+// SendVerification mails the user a link to confirm their email. It does
+// nothing if the email is already verified.
+func (s *AccountService) SendVerification(ctx context.Context, user *models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	token, err := s.Tokens.SignActionToken(auth.ActionToken{
+		Purpose: auth.PurposeVerifyEmail,
+		UserID:  user.ID,
+		Binding: user.Email,
+	}, s.VerifyTTL)
+	if err != nil {
+		return err
+	}
+	return s.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nplease confirm your email address by opening this link:\n\n%s\n\n"+
+			"The link is valid for %s. If you did not create an account, you can ignore this email.\n",
+			user.Name, s.link("/verify-email.html", token), humanizeTTL(s.VerifyTTL)),
+	})
+}
+
+// VerifyEmail confirms the email a verification token was sent to.
+func (s *AccountService) VerifyEmail(token string) (*models.User, error) {
+	t, err := s.Tokens.ParseActionToken(token, auth.PurposeVerifyEmail)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.Users.GetByID(t.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, auth.ErrInvalidActionToken
+		}
+		return nil, err
+	}
+	// the user changed their email since the link was sent
+	if user.Email != t.Binding {
+		return nil, auth.ErrInvalidActionToken
+	}
+	ok, err := s.Users.MarkEmailVerified(user.ID, user.Email, s.now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrActionTokenUsed
+	}
+	return s.Users.GetByID(user.ID)
+}
+
+// RequestPasswordReset mails a password reset link to the user with the
+// given email. Unknown emails are ignored, so callers cannot tell whether an
+// account exists.
+func (s *AccountService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.Users.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	token, err := s.Tokens.SignActionToken(auth.ActionToken{
+		Purpose: auth.PurposeResetPassword,
+		UserID:  user.ID,
+		Binding: passwordBinding(user.PasswordHash),
+	}, s.ResetTTL)
+	if err != nil {
+		return err
+	}
+	return s.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nsomeone asked to reset the password of your account. To choose a new password, open this link:\n\n%s\n\n"+
+			"The link is valid for %s and works once. If you did not ask for this, you can ignore this email.\n",
+			user.Name, s.link("/reset-password.html", token), humanizeTTL(s.ResetTTL)),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out everywhere. Since the link reached the user's inbox, their email
+// counts as verified too.
+func (s *AccountService) ResetPassword(token, password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+	t, err := s.Tokens.ParseActionToken(token, auth.PurposeResetPassword)
+	if err != nil {
+		return err
+	}
+	user, err := s.Users.GetByID(t.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return auth.ErrInvalidActionToken
+		}
+		return err
+	}
+	if passwordBinding(user.PasswordHash) != t.Binding {
+		return ErrActionTokenUsed
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	ok, err := s.Users.ReplacePasswordHash(user.ID, user.PasswordHash, string(hashed))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrActionTokenUsed
+	}
+	log.Printf("accounts: password of user %s was reset", user.ID)
+	if _, err := s.Users.MarkEmailVerified(user.ID, user.Email, s.now()); err != nil {
+		return err
+	}
+	if s.Sessions != nil {
+		return s.Sessions.RevokeAll(user.ID)
+	}
+	return nil
+}
+
+func (s *AccountService) link(page, token string) string {
+	return s.BaseURL + page + "?token=" + url.QueryEscape(token)
+}
+
+// humanizeTTL writes a link lifetime for an email, e.g. "48 hours".
+func humanizeTTL(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		if d == time.Hour {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d minutes", int(d.Minutes()))
+}
+
+// passwordBinding identifies a password hash in reset tokens without putting
+// the hash itself into them.
+func passwordBinding(hash string) string {
+	h := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(h[:16])
+}
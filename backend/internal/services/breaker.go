@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states reported by CircuitBreaker.State.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// ErrCircuitOpen is returned without calling the backend while a breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker stops calls to a failing backend. After FailureThreshold
+// consecutive failures it opens and rejects calls with ErrCircuitOpen for
+// OpenTimeout; then it lets a single probe through (half-open). A successful
+// probe closes the breaker, a failed one opens it again.
+type CircuitBreaker struct {
+	Name             string
+	FailureThreshold int
+	OpenTimeout      time.Duration
+
+	mu          sync.Mutex
+	state       string
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	lastFailure string
+	now         func() time.Time
+}
+
+// BreakerStatus is a point-in-time view of a breaker, exposed on /health.
+type BreakerStatus struct {
+	Name        string     `json:"name"`
+	State       string     `json:"state"`
+	Failures    int        `json:"consecutive_failures"`
+	OpenedAt    *time.Time `json:"opened_at,omitempty"`
+	LastFailure string     `json:"last_failure,omitempty"`
+}
+
+// NewCircuitBreaker creates a closed breaker.
+func NewCircuitBreaker(name string, failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = 1
+	}
+	return &CircuitBreaker{
+		Name:             name,
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+		state:            BreakerClosed,
+		now:              time.Now,
+	}
+}
+
+// Do runs fn if the breaker allows it and records the outcome.
+func (b *CircuitBreaker) Do(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		// only one probe at a time; everyone else keeps failing fast
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.state = BreakerClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+	b.failures++
+	b.lastFailure = err.Error()
+	if b.state == BreakerHalfOpen || b.failures >= b.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+	b.probing = false
+}
+
+// State returns the current state. An open breaker whose timeout has elapsed
+// is reported as half-open since the next call will probe the backend.
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stateLocked()
+}
+
+func (b *CircuitBreaker) stateLocked() string {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Status returns a snapshot of the breaker for health reporting.
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := BreakerStatus{
+		Name:        b.Name,
+		State:       b.stateLocked(),
+		Failures:    b.failures,
+		LastFailure: b.lastFailure,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		st.OpenedAt = &openedAt
+	}
+	return st
+}
+
+// RetryPolicy retries idempotent calls with exponential backoff and full
+// jitter. MaxAttempts includes the first call.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// retryableError marks failures worth retrying (transport errors, 5xx, 429).
+type retryableError struct{ err error }
+
+func (e retryableError) Error() string { return e.err.Error() }
+func (e retryableError) Unwrap() error { return e.err }
+
+func isRetryable(err error) bool {
+	var re retryableError
+	return errors.As(err, &re)
+}
+
+// callWithResilience runs fn through the breaker (when set) and retries
+// retryable failures according to policy. It stops as soon as the breaker
+// opens so a dead backend is not hammered with retries.
+func callWithResilience(ctx context.Context, breaker *CircuitBreaker, policy RetryPolicy, fn func() error) error {
+	attempts := policy.MaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(policy.backoff(attempt)):
+			}
+		}
+		if breaker != nil {
+			err = breaker.Do(fn)
+		} else {
+			err = fn()
+		}
+		if err == nil || errors.Is(err, ErrCircuitOpen) || !isRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// backoff returns a random delay in [0, min(MaxDelay, BaseDelay*2^(attempt-1))].
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if p.MaxDelay > 0 && (d > p.MaxDelay || d <= 0) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
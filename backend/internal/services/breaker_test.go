@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAndProbes(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := NewCircuitBreaker("test", 3, 30*time.Second)
+	b.now = func() time.Time { return now }
+
+	fail := func() error { return errors.New("boom") }
+	calls := 0
+	counted := func() error { calls++; return nil }
+
+	for i := 0; i < 3; i++ {
+		b.Do(fail)
+	}
+	if got := b.State(); got != BreakerOpen {
+		t.Fatalf("expected open after 3 failures, got %s", got)
+	}
+	if err := b.Do(counted); !errors.Is(err, ErrCircuitOpen) || calls != 0 {
+		t.Fatalf("open breaker should reject without calling, err=%v calls=%d", err, calls)
+	}
+
+	// after the timeout a failed probe opens the breaker again
+	now = now.Add(31 * time.Second)
+	if got := b.State(); got != BreakerHalfOpen {
+		t.Fatalf("expected half-open after timeout, got %s", got)
+	}
+	b.Do(fail)
+	if got := b.State(); got != BreakerOpen {
+		t.Fatalf("failed probe should reopen, got %s", got)
+	}
+
+	// a successful probe closes it
+	now = now.Add(31 * time.Second)
+	if err := b.Do(counted); err != nil || calls != 1 {
+		t.Fatalf("probe should run, err=%v calls=%d", err, calls)
+	}
+	if st := b.Status(); st.State != BreakerClosed || st.Failures != 0 {
+		t.Fatalf("expected closed breaker after successful probe, got %+v", st)
+	}
+}
+
+func TestHTTPUrgencyPredictorRetriesTransientErrors(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"score": 0.9}`))
+	}))
+	defer srv.Close()
+
+	p := NewHTTPUrgencyPredictor(srv.URL, time.Second)
+	p.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	pred, err := p.PredictUrgency("gas leak")
+	if err != nil {
+		t.Fatalf("expected success after retry, got %v", err)
+	}
+	if pred.Urgency != 3 || hits != 2 {
+		t.Fatalf("got %+v after %d calls, want urgency 3 after 2 calls", pred, hits)
+	}
+}
+
+func TestOpenBreakerDegradesChainToHeuristic(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	api := NewHTTPUrgencyPredictor(srv.URL, time.Second)
+	api.Breaker = NewCircuitBreaker("urgency", 2, time.Minute)
+	api.Retry = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}
+	chain := NewChainPredictor(api, HeuristicPredictor{})
+
+	for i := 0; i < 10; i++ {
+		pred, err := chain.PredictUrgency("fire near the school")
+		if err != nil || pred.Source != SourceHeuristic {
+			t.Fatalf("expected heuristic fallback, got %+v, %v", pred, err)
+		}
+	}
+	// retries stop once the breaker opens, and later calls never reach the API
+	if hits != 2 {
+		t.Fatalf("expected 2 calls to the failing API, got %d", hits)
+	}
+	if got := api.Breaker.State(); got != BreakerOpen {
+		t.Fatalf("expected open breaker, got %s", got)
+	}
+}
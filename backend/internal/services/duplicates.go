@@ -0,0 +1,152 @@
+package services
+
+import (
+	config "crowdsourcedurbanissuereportingwithai/backend/configs"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// openStatuses are the statuses in which a post still represents an active
+// problem and can therefore absorb duplicate reports.
+var openStatuses = []string{
+	models.StatusOpen,
+	models.StatusTriaged,
+	models.StatusAssigned,
+	models.StatusInProgress,
+	models.StatusReopened,
+}
+
+// maxDuplicateCandidates caps how many candidates are returned to the client.
+const maxDuplicateCandidates = 5
+
+// DuplicateCandidate describes an existing open post that a new report most
+// likely duplicates.
+type DuplicateCandidate struct {
+	PostID       uuid.UUID `json:"post_id"`
+	IssueID      uuid.UUID `json:"issue_id"`
+	IssueName    string    `json:"issue_name"`
+	Description  string    `json:"description,omitempty"`
+	ClassifiedAs string    `json:"classified_as,omitempty"`
+	Status       string    `json:"status"`
+	DistanceM    float64   `json:"distance_m"`
+	Similarity   float64   `json:"similarity"`
+}
+
+// DuplicateReportError is returned by ReportIssueViaPost in "suggest" mode when
+// the report looks like an existing one. The client can offer the user to add
+// their voice to a candidate instead, or resubmit with forceNew set.
+type DuplicateReportError struct {
+	Candidates []DuplicateCandidate
+}
+
+func (e *DuplicateReportError) Error() string {
+	return "report looks like an existing open report"
+}
+
+// FindDuplicateCandidates returns open posts of the same category near the
+// given point whose description and image classification are similar enough
+// to be considered the same problem, best match first.
+func (s *ReportService) FindDuplicateCandidates(category, description, classifiedAs string, lat, lng float64) ([]DuplicateCandidate, error) {
+	radius := config.GetDuplicateRadiusMeters()
+	nearby, err := s.PostRepo.FindPostsNear(lat, lng, radius, category, openStatuses, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	minSimilarity := config.GetDuplicateMinSimilarity()
+	var candidates []DuplicateCandidate
+	for _, n := range nearby {
+		sim := reportSimilarity(description, classifiedAs, n.Post.Description, n.Post.ClassifiedAs, n.DistanceM, radius)
+		if sim < minSimilarity {
+			continue
+		}
+		candidates = append(candidates, DuplicateCandidate{
+			PostID:       n.Post.ID,
+			IssueID:      n.Post.IssueID,
+			IssueName:    n.Post.Issue.Name,
+			Description:  n.Post.Description,
+			ClassifiedAs: n.Post.ClassifiedAs,
+			Status:       n.Post.Status,
+			DistanceM:    n.DistanceM,
+			Similarity:   sim,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Similarity > candidates[j].Similarity })
+	if len(candidates) > maxDuplicateCandidates {
+		candidates = candidates[:maxDuplicateCandidates]
+	}
+	return candidates, nil
+}
+
+// minDuplicateTextOverlap is the description overlap (Jaccard) two reports
+// need before their proximity counts towards similarity, unless their images
+// were classified the same.
+const minDuplicateTextOverlap = 0.1
+
+// reportSimilarity blends description overlap (50%), image classification
+// agreement (25%) and proximity within the search radius (25%) into 0..1.
+// A missing classification on either side counts as neutral. Proximity only
+// counts once the descriptions overlap by minDuplicateTextOverlap or the
+// classifications match, so unrelated reports at the same spot stay apart.
+func reportSimilarity(descA, classA, descB, classB string, distanceM, radiusM float64) float64 {
+	text := jaccard(descriptionTokens(descA), descriptionTokens(descB))
+
+	class := 0.5
+	a, b := strings.ToLower(strings.TrimSpace(classA)), strings.ToLower(strings.TrimSpace(classB))
+	if a != "" && b != "" {
+		if a == b {
+			class = 1
+		} else {
+			class = 0
+		}
+	}
+
+	if text < minDuplicateTextOverlap && class < 1 {
+		return 0.5*text + 0.25*class
+	}
+	proximity := 1.0
+	if radiusM > 0 {
+		proximity = 1 - distanceM/radiusM
+		if proximity < 0 {
+			proximity = 0
+		}
+	}
+	return 0.5*text + 0.25*class + 0.25*proximity
+}
+
+// stopWords are ignored when comparing descriptions.
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "was": true, "this": true,
+	"that": true, "with": true, "near": true, "there": true, "here": true, "has": true,
+	"have": true, "been": true, "from": true, "our": true, "its": true, "very": true,
+}
+
+func descriptionTokens(text string) map[string]bool {
+	tokens := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(w) < 3 || stopWords[w] {
+			continue
+		}
+		tokens[w] = true
+	}
+	return tokens
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	inter := 0
+	for w := range a {
+		if b[w] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// EnrichmentWorker runs queued ML enrichment jobs: it predicts the urgency of
+// the post description, classifies the post image and stores both on the post.
+// Failed jobs are retried with exponential backoff up to MaxAttempts, after
+// which the post is marked failed and scored with the local heuristic.
+type EnrichmentWorker struct {
+	PostRepo   *repository.PostRepository
+	Predictor  UrgencyPredictor
+	Classifier ImageClassifier
+	// Ranker, if set, rescores enriched posts for the feed
+	Ranker *FeedRanker
+
+	Workers      int
+	MaxAttempts  int
+	PollInterval time.Duration
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	Lease        time.Duration
+}
+
+// NewEnrichmentWorker creates a worker with default tuning; callers may adjust
+// the exported fields before Start.
+func NewEnrichmentWorker(postRepo *repository.PostRepository, predictor UrgencyPredictor, classifier ImageClassifier) *EnrichmentWorker {
+	if predictor == nil {
+		predictor = HeuristicPredictor{}
+	}
+	if classifier == nil {
+		classifier = NoopImageClassifier{}
+	}
+	return &EnrichmentWorker{
+		PostRepo:     postRepo,
+		Predictor:    predictor,
+		Classifier:   classifier,
+		Workers:      4,
+		MaxAttempts:  5,
+		PollInterval: 2 * time.Second,
+		BaseBackoff:  5 * time.Second,
+		MaxBackoff:   10 * time.Minute,
+		Lease:        2 * time.Minute,
+	}
+}
+
+// Start polls for due jobs and processes them on Workers goroutines until ctx
+// is cancelled. It returns immediately; the returned WaitGroup is done once
+// all goroutines have exited.
+func (w *EnrichmentWorker) Start(ctx context.Context) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	jobs := make(chan models.EnrichmentJob)
+
+	for i := 0; i < w.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				w.ProcessJob(job)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		ticker := time.NewTicker(w.PollInterval)
+		defer ticker.Stop()
+		for {
+			claimed, err := w.PostRepo.ClaimEnrichmentJobs(w.Workers, w.Lease)
+			if err != nil {
+				log.Printf("enrichment: claim failed: %v", err)
+			}
+			for _, job := range claimed {
+				select {
+				case jobs <- job:
+				case <-ctx.Done():
+					// unsent jobs are picked up again once their lease expires
+					return
+				}
+			}
+			if len(claimed) == w.Workers {
+				continue // there may be more due jobs
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return &wg
+}
+
+// RunPending processes all currently due jobs synchronously and returns how
+// many were handled. It is used by tests and one-off maintenance runs.
+func (w *EnrichmentWorker) RunPending() (int, error) {
+	n := 0
+	for {
+		claimed, err := w.PostRepo.ClaimEnrichmentJobs(w.Workers, w.Lease)
+		if err != nil {
+			return n, err
+		}
+		if len(claimed) == 0 {
+			return n, nil
+		}
+		for _, job := range claimed {
+			w.ProcessJob(job)
+			n++
+		}
+	}
+}
+
+// ProcessJob enriches the job's post and records the outcome. Errors are
+// handled by rescheduling or failing the job, never returned.
+func (w *EnrichmentWorker) ProcessJob(job models.EnrichmentJob) {
+	post, err := w.PostRepo.GetPost(job.PostID)
+	if err != nil {
+		w.handleFailure(job, nil, err)
+		return
+	}
+
+	pred, err := w.Predictor.PredictUrgency(post.Description)
+	if err != nil {
+		w.handleFailure(job, post, err)
+		return
+	}
+	classifiedAs, err := w.Classifier.ClassifyImage(post.MediaURL)
+	if err != nil {
+		w.handleFailure(job, post, err)
+		return
+	}
+
+	if err := w.PostRepo.CompleteEnrichment(job, pred.Urgency, classifiedAs, pred.Score); err != nil {
+		if errors.Is(err, repository.ErrEnrichmentLeaseLost) {
+			// another worker reclaimed the job and records its own result
+			log.Printf("enrichment: dropping result of job %s attempt %d: %v", job.ID, job.Attempts, err)
+			return
+		}
+		w.handleFailure(job, post, err)
+		return
+	}
+	saveUrgencyExplanation(w.PostRepo, post.ID, ExplainText(post.Description, pred, nil))
+	w.Ranker.Notify(post.ID)
+}
+
+func (w *EnrichmentWorker) handleFailure(job models.EnrichmentJob, post *models.Post, cause error) {
+	if job.Attempts < w.MaxAttempts {
+		delay := w.backoff(job.Attempts)
+		log.Printf("enrichment: job %s attempt %d failed, retrying in %s: %v", job.ID, job.Attempts, delay, cause)
+		if err := w.PostRepo.RetryEnrichmentJob(job, time.Now().Add(delay), cause.Error()); err != nil {
+			log.Printf("enrichment: could not reschedule job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("enrichment: job %s failed after %d attempts: %v", job.ID, job.Attempts, cause)
+	fallback := 0.0
+	if post != nil {
+		fallback = heuristicScore(post.Description)
+	}
+	if err := w.PostRepo.FailEnrichmentJob(job, fallback, cause.Error()); err != nil {
+		log.Printf("enrichment: could not mark job %s failed: %v", job.ID, err)
+		return
+	}
+	w.Ranker.Notify(job.PostID)
+	if post != nil {
+		e := ExplainText(post.Description, Prediction{}, cause)
+		e.Urgency = post.Urgency // the submitted urgency is kept
+		saveUrgencyExplanation(w.PostRepo, post.ID, e)
+	}
+}
+
+// backoff returns BaseBackoff*2^(attempts-1) capped at MaxBackoff.
+func (w *EnrichmentWorker) backoff(attempts int) time.Duration {
+	d := w.BaseBackoff
+	for i := 1; i < attempts && d < w.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > w.MaxBackoff {
+		d = w.MaxBackoff
+	}
+	return d
+}
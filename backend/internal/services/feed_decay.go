@@ -0,0 +1,90 @@
+package services
+
+import (
+	config "crowdsourcedurbanissuereportingwithai/backend/configs"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"math"
+	"time"
+)
+
+// DecayRanking holds the settings of the "decay" feed scoring mode. The score
+// of a post is
+//
+//	base = FeedTextWeight*text score + FeedUpvoteWeight*log upvote score
+//	score = base * (0.5^(age/HalfLife) + SLABoost*overdue)
+//
+// where overdue grows from 0 to 1 over the SLA period after an unresolved
+// report passes its SLA. Fresh reports thus outrank stale ones of the same
+// urgency, while reports that were never fixed do not sink out of sight.
+type DecayRanking struct {
+	HalfLife         time.Duration
+	SLA              time.Duration
+	SLABoost         float64
+	UpvoteSaturation int
+	Now              func() time.Time
+}
+
+// DecayRankingFromConfig reads the decay settings from the environment.
+func DecayRankingFromConfig() DecayRanking {
+	return DecayRanking{
+		HalfLife:         config.GetFeedDecayHalfLife(),
+		SLA:              config.GetFeedSLA(),
+		SLABoost:         config.GetFeedSLABoost(),
+		UpvoteSaturation: config.GetFeedUpvoteSaturation(),
+		Now:              time.Now,
+	}
+}
+
+// LogUpvoteScore maps an upvote count to 0..1 logarithmically, reaching 1 at
+// saturation, so the first few upvotes matter most.
+func LogUpvoteScore(upvotes, saturation int) float64 {
+	if upvotes <= 0 || saturation <= 0 {
+		return 0
+	}
+	return math.Min(1, math.Log1p(float64(upvotes))/math.Log1p(float64(saturation)))
+}
+
+// Decay returns the time decay factor (1 for a new post, 0.5 at HalfLife).
+func (d DecayRanking) Decay(age time.Duration) float64 {
+	if age <= 0 || d.HalfLife <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, float64(age)/float64(d.HalfLife))
+}
+
+// Overdue returns how far past its SLA an unresolved post is, from 0 at the
+// SLA to 1 one SLA period later.
+func (d DecayRanking) Overdue(status string, age time.Duration) float64 {
+	if !IsOpenStatus(status) || d.SLA <= 0 || age <= d.SLA {
+		return 0
+	}
+	return math.Min(1, float64(age-d.SLA)/float64(d.SLA))
+}
+
+// Score ranks a post given its text score (0..1).
+func (d DecayRanking) Score(profile *ScoringProfile, textScore float64, upvotes int, status string, createdAt time.Time) float64 {
+	base := profile.FeedTextWeight*textScore + profile.FeedUpvoteWeight*LogUpvoteScore(upvotes, d.UpvoteSaturation)
+	age := d.Now().Sub(createdAt)
+	return base * (d.Decay(age) + d.SLABoost*d.Overdue(status, age))
+}
+
+// scoreDecay scores posts in the "decay" mode. The text score is the
+// persisted incremental average, or the stored urgency for posts without one,
+// so no ML calls are made.
+func scoreDecay(posts []models.Post, d DecayRanking, profile *ScoringProfile) {
+	for i := range posts {
+		p := &posts[i]
+		text := storedTextScore(*p)
+		p.Score = d.Score(profile, text, p.UpvoteCount, p.Status, p.CreatedAt)
+		p.ComputedUrgency = mapScoreToUrgency(text)
+	}
+}
+
+// storedTextScore is a post's persisted incremental text score (0..1), or its
+// stored urgency for posts without one.
+func storedTextScore(p models.Post) float64 {
+	if p.ScoreCount > 0 {
+		return math.Max(0, math.Min(1, p.ScoreSum/float64(p.ScoreCount)))
+	}
+	return mapNumericUrgencyToScore(p.Urgency)
+}
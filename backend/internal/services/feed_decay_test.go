@@ -0,0 +1,94 @@
+package services
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func testDecayRanking(now time.Time) DecayRanking {
+	return DecayRanking{
+		HalfLife:         72 * time.Hour,
+		SLA:              7 * 24 * time.Hour,
+		SLABoost:         0.3,
+		UpvoteSaturation: 50,
+		Now:              func() time.Time { return now },
+	}
+}
+
+func TestLogUpvoteScore(t *testing.T) {
+	if LogUpvoteScore(0, 50) != 0 {
+		t.Errorf("no upvotes should score 0")
+	}
+	one, ten := LogUpvoteScore(1, 50), LogUpvoteScore(10, 50)
+	if !(one > 0 && ten > one && ten < 1) {
+		t.Errorf("expected 0 < score(1)=%v < score(10)=%v < 1", one, ten)
+	}
+	if ten-one < LogUpvoteScore(20, 50)-ten {
+		t.Errorf("upvote score should grow sublinearly")
+	}
+	if LogUpvoteScore(50, 50) != 1 || LogUpvoteScore(500, 50) != 1 {
+		t.Errorf("upvote score should saturate at 1")
+	}
+}
+
+func TestDecayRankingFactors(t *testing.T) {
+	d := testDecayRanking(time.Now())
+	if got := d.Decay(72 * time.Hour); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("decay at half-life = %v, want 0.5", got)
+	}
+	if d.Decay(0) != 1 {
+		t.Errorf("a new post should not decay")
+	}
+	if d.Overdue(models.StatusOpen, 6*24*time.Hour) != 0 {
+		t.Errorf("not overdue before the SLA")
+	}
+	if got := d.Overdue(models.StatusOpen, 10*24*time.Hour+12*time.Hour); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("overdue half an SLA past = %v, want 0.5", got)
+	}
+	if d.Overdue(models.StatusOpen, 365*24*time.Hour) != 1 {
+		t.Errorf("overdue should be capped at 1")
+	}
+	if d.Overdue(models.StatusResolved, 365*24*time.Hour) != 0 {
+		t.Errorf("resolved posts are never overdue")
+	}
+}
+
+func TestScoreDecayRanking(t *testing.T) {
+	now := time.Now()
+	profile := DefaultScoringProfile()
+	post := func(urgency int, status string, age time.Duration, upvotes int) models.Post {
+		return models.Post{ID: uuid.New(), Urgency: urgency, Status: status, UpvoteCount: upvotes, CreatedAt: now.Add(-age)}
+	}
+	posts := []models.Post{
+		post(3, models.StatusOpen, 365*24*time.Hour, 0),   // 0: last year's critical, never closed
+		post(3, models.StatusOpen, 24*time.Hour, 0),       // 1: yesterday's critical
+		post(3, models.StatusClosed, 365*24*time.Hour, 0), // 2: last year's critical, closed
+		post(1, models.StatusOpen, 24*time.Hour, 0),       // 3: yesterday's low urgency
+		post(1, models.StatusOpen, 24*time.Hour, 30),      // 4: yesterday's low urgency, many upvotes
+		post(3, models.StatusOpen, 24*time.Hour, 1),       // 5: yesterday's critical, one upvote
+	}
+	// a stored incremental score takes precedence over the urgency
+	posts[3].ScoreSum, posts[3].ScoreCount = 0.2, 1
+
+	scoreDecay(posts, testDecayRanking(now), &profile)
+
+	if !(posts[1].Score > posts[0].Score) {
+		t.Errorf("yesterday's report (%v) should outrank last year's (%v)", posts[1].Score, posts[0].Score)
+	}
+	if !(posts[0].Score > posts[2].Score) {
+		t.Errorf("an overdue open report (%v) should outrank a closed one (%v)", posts[0].Score, posts[2].Score)
+	}
+	if !(posts[4].Score > posts[3].Score) {
+		t.Errorf("upvotes should raise the score: %v vs %v", posts[4].Score, posts[3].Score)
+	}
+	if !(posts[5].Score > posts[1].Score) {
+		t.Errorf("a single upvote should count: %v vs %v", posts[5].Score, posts[1].Score)
+	}
+	if posts[3].ComputedUrgency != mapScoreToUrgency(0.2) {
+		t.Errorf("computed urgency should follow the stored score, got %d", posts[3].ComputedUrgency)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FeedUser is the part of a user shown next to posts and comments. It
+// carries no email, as the feed is public.
+type FeedUser struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// FeedItem is a post as returned by /feed: counters instead of the comment
+// and upvote arrays, and whether the requesting user upvoted it.
+type FeedItem struct {
+	ID               uuid.UUID    `json:"id"`
+	IssueID          uuid.UUID    `json:"issue_id"`
+	Issue            models.Issue `json:"issue"`
+	UserID           uuid.UUID    `json:"user_id"`
+	User             FeedUser     `json:"user"`
+	Description      string       `json:"description,omitempty"`
+	Language         string       `json:"language,omitempty"`
+	Status           string       `json:"status"`
+	Urgency          int          `json:"urgency"`
+	ClassifiedAs     string       `json:"classified_as,omitempty"`
+	Lat              float64      `json:"lat"`
+	Lng              float64      `json:"lng"`
+	MediaURL         string       `json:"media_url"`
+	EnrichmentStatus string       `json:"enrichment_status"`
+	UpvoteCount      int          `json:"upvote_count"`
+	CommentCount     int          `json:"comment_count"`
+	LastActivityAt   time.Time    `json:"last_activity_at"`
+	ViewerHasUpvoted bool         `json:"viewer_has_upvoted"`
+	Score            float64      `json:"score,omitempty"`
+	ComputedUrgency  int          `json:"computed_urgency,omitempty"`
+	DistanceM        float64      `json:"distance_m,omitempty"`
+	CreatedAt        time.Time    `json:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at"`
+}
+
+// FeedItemPage is one page of FeedItems, the response form of FeedPage.
+type FeedItemPage struct {
+	Items      []FeedItem `json:"items"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// FeedComment is a comment as returned by GET /api/posts/{id}/comments.
+type FeedComment struct {
+	ID        uuid.UUID `json:"id"`
+	PostID    uuid.UUID `json:"post_id"`
+	User      FeedUser  `json:"user"`
+	Content   string    `json:"content"`
+	Language  string    `json:"language,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FeedItems converts posts to FeedItems for viewerID, which may be uuid.Nil
+// for anonymous requests.
+func (s *FeedService) FeedItems(posts []models.Post, viewerID uuid.UUID) ([]FeedItem, error) {
+	upvoted := map[uuid.UUID]bool{}
+	if viewerID != uuid.Nil && len(posts) > 0 {
+		ids := make([]uuid.UUID, len(posts))
+		for i, p := range posts {
+			ids[i] = p.ID
+		}
+		var err error
+		if upvoted, err = s.PostRepo.UpvotedPostIDs(viewerID, ids); err != nil {
+			return nil, err
+		}
+	}
+	items := make([]FeedItem, len(posts))
+	for i, p := range posts {
+		items[i] = FeedItem{
+			ID:               p.ID,
+			IssueID:          p.IssueID,
+			Issue:            p.Issue,
+			UserID:           p.UserID,
+			User:             FeedUser{ID: p.User.ID, Name: p.User.Name},
+			Description:      p.Description,
+			Language:         p.Language,
+			Status:           p.Status,
+			Urgency:          p.Urgency,
+			ClassifiedAs:     p.ClassifiedAs,
+			Lat:              p.Lat,
+			Lng:              p.Lng,
+			MediaURL:         p.MediaURL,
+			EnrichmentStatus: p.EnrichmentStatus,
+			UpvoteCount:      p.UpvoteCount,
+			CommentCount:     p.CommentCount,
+			LastActivityAt:   p.LastActivityAt,
+			ViewerHasUpvoted: upvoted[p.ID],
+			Score:            p.Score,
+			ComputedUrgency:  p.ComputedUrgency,
+			DistanceM:        p.DistanceM,
+			CreatedAt:        p.CreatedAt,
+			UpdatedAt:        p.UpdatedAt,
+		}
+	}
+	return items, nil
+}
+
+// GetPostComments returns the comments of a post, oldest first, or
+// gorm.ErrRecordNotFound if the post does not exist.
+func (s *FeedService) GetPostComments(postID uuid.UUID) ([]FeedComment, error) {
+	if _, err := s.PostRepo.GetPost(postID); err != nil {
+		return nil, err
+	}
+	comments, err := s.PostRepo.GetPostComments(postID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]FeedComment, len(comments))
+	for i, c := range comments {
+		out[i] = FeedComment{
+			ID:        c.ID,
+			PostID:    c.PostID,
+			User:      FeedUser{ID: c.User.ID, Name: c.User.Name},
+			Content:   c.Content,
+			Language:  c.Language,
+			CreatedAt: c.CreatedAt,
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	config "crowdsourcedurbanissuereportingwithai/backend/configs"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Feed sort orders accepted by GetFeedPage.
+const (
+	FeedSortScore  = "score"  // ranked by computed score (default)
+	FeedSortRecent = "recent" // newest first
+)
+
+// maxFeedPageSize bounds the page size a client may request.
+const maxFeedPageSize = 100
+
+// ErrInvalidCursor is returned when a feed cursor cannot be decoded or was
+// issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FeedQuery describes one page of the feed.
+type FeedQuery struct {
+	Sort   string
+	Limit  int
+	Cursor string
+	Filter repository.PostFilter
+}
+
+// FeedPage is the response envelope for a paginated feed request.
+type FeedPage struct {
+	Items      []models.Post `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// feedCursor is the decoded form of the opaque cursor handed to clients. It
+// records the position of the last item of a page in the sort order.
+type feedCursor struct {
+	Sort      string    `json:"k"`
+	Score     float64   `json:"s,omitempty"`
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+func encodeFeedCursor(c feedCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeFeedCursor(s, sortOrder string) (*feedCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c feedCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == uuid.Nil || c.Sort != sortOrder {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// GetFeedPage returns one page of the feed matching q. In score order the
+// newest FEED_RANK_WINDOW matching posts are scored and ordered by
+// (score, created_at, id) descending; the cursor carries that tuple so later
+// pages continue exactly after the last item even when scores tie. In recent
+// order the cursor is a (created_at, id) keyset applied in the database.
+func (s *FeedService) GetFeedPage(q FeedQuery) (*FeedPage, error) {
+	if q.Sort == "" {
+		q.Sort = FeedSortScore
+	}
+	if q.Sort != FeedSortScore && q.Sort != FeedSortRecent {
+		return nil, errors.New("invalid sort: " + q.Sort)
+	}
+	if q.Limit <= 0 {
+		q.Limit = config.GetFeedLimit()
+	}
+	if q.Limit > maxFeedPageSize {
+		q.Limit = maxFeedPageSize
+	}
+	var cursor *feedCursor
+	if strings.TrimSpace(q.Cursor) != "" {
+		c, err := decodeFeedCursor(q.Cursor, q.Sort)
+		if err != nil {
+			return nil, err
+		}
+		cursor = c
+	}
+
+	if q.Sort == FeedSortRecent {
+		return s.getRecentFeedPage(q, cursor)
+	}
+	return s.getRankedFeedPage(q, cursor)
+}
+
+func (s *FeedService) getRecentFeedPage(q FeedQuery, cursor *feedCursor) (*FeedPage, error) {
+	var after *repository.PostKeyset
+	if cursor != nil {
+		after = &repository.PostKeyset{CreatedAt: cursor.CreatedAt, ID: cursor.ID}
+	}
+	// fetch one extra row to learn whether another page exists
+	posts, err := s.PostRepo.GetFilteredPosts(q.Filter, after, q.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &FeedPage{Items: posts}
+	if len(posts) > q.Limit {
+		page.Items = posts[:q.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = encodeFeedCursor(feedCursor{Sort: FeedSortRecent, CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	s.scorePosts(page.Items)
+	return page, nil
+}
+
+func (s *FeedService) getRankedFeedPage(q FeedQuery, cursor *feedCursor) (*FeedPage, error) {
+	if s.Rankings {
+		page, err := s.getMaterializedFeedPage(q, cursor)
+		if err != nil || len(page.Items) > 0 || cursor != nil {
+			return page, err
+		}
+	}
+	posts, err := s.PostRepo.GetFilteredPostsWithoutComments(q.Filter, nil, config.GetFeedRankWindow())
+	if err != nil {
+		return nil, err
+	}
+	scoreStored(posts, &ActiveScoringProfile().Profile)
+	sort.SliceStable(posts, func(i, j int) bool { return rankedBefore(posts[i], posts[j]) })
+
+	start := 0
+	if cursor != nil {
+		pos := models.Post{ID: cursor.ID, Score: cursor.Score, CreatedAt: cursor.CreatedAt}
+		start = sort.Search(len(posts), func(i int) bool { return rankedBefore(pos, posts[i]) })
+	}
+	end := start + q.Limit
+	if end > len(posts) {
+		end = len(posts)
+	}
+	page := &FeedPage{Items: posts[start:end]}
+	if end < len(posts) {
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = encodeFeedCursor(feedCursor{Sort: FeedSortScore, Score: last.Score, CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	return page, nil
+}
+
+// scoreStored scores posts from their stored text score (see storedTextScore)
+// blended with upvote presence, or with the decayed ranking in the "decay"
+// mode. It makes no ML calls, so every post of a large ranking window gets a
+// comparable score.
+func scoreStored(posts []models.Post, profile *ScoringProfile) {
+	if config.GetFeedScoringMode() == "decay" {
+		scoreDecay(posts, DecayRankingFromConfig(), profile)
+		return
+	}
+	for i := range posts {
+		p := &posts[i]
+		text := storedTextScore(*p)
+		upvotePresence := 0.0
+		if p.UpvoteCount > 0 {
+			upvotePresence = 1.0
+		}
+		p.Score = profile.FeedTextWeight*text + profile.FeedUpvoteWeight*upvotePresence
+		p.ComputedUrgency = mapScoreToUrgency(text)
+	}
+}
+
+// getMaterializedFeedPage reads a score-ranked page from post_rankings with
+// the cursor applied as a keyset in the database.
+func (s *FeedService) getMaterializedFeedPage(q FeedQuery, cursor *feedCursor) (*FeedPage, error) {
+	var after *repository.RankingKeyset
+	if cursor != nil {
+		after = &repository.RankingKeyset{Score: cursor.Score, CreatedAt: cursor.CreatedAt, ID: cursor.ID}
+	}
+	posts, err := s.PostRepo.GetRankedPosts(q.Filter, after, q.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &FeedPage{Items: posts}
+	if len(posts) > q.Limit {
+		page.Items = posts[:q.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = encodeFeedCursor(feedCursor{Sort: FeedSortScore, Score: last.Score, CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	return page, nil
+}
+
+// rankedBefore reports whether a sorts before b in the ranked feed:
+// score descending, then newest first, then by id descending.
+func rankedBefore(a, b models.Post) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID.String() > b.ID.String()
+}
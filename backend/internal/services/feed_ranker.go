@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FeedRanker keeps post_rankings up to date. Posts are rescored shortly after
+// they are reported, commented on, upvoted or change status (see Notify), and
+// a periodic sweep rescores the newest Window posts so time-dependent scores,
+// config and scoring profile changes are picked up and rankings of posts that
+// fell out of the window are dropped.
+type FeedRanker struct {
+	Feed *FeedService
+
+	SweepInterval time.Duration
+	Window        int
+	BatchSize     int
+
+	mu      sync.Mutex
+	pending map[uuid.UUID]bool
+	wake    chan struct{}
+}
+
+// NewFeedRanker creates a ranker with default tuning; callers may adjust the
+// exported fields before Start.
+func NewFeedRanker(feed *FeedService) *FeedRanker {
+	return &FeedRanker{
+		Feed:          feed,
+		SweepInterval: time.Minute,
+		Window:        500,
+		BatchSize:     100,
+		pending:       map[uuid.UUID]bool{},
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// Notify marks a post for rescoring. It never blocks; repeated notifications
+// for the same post before the ranker gets to it are coalesced. Notify on a
+// nil ranker does nothing, so services can call it unconditionally.
+func (k *FeedRanker) Notify(postID uuid.UUID) {
+	if k == nil {
+		return
+	}
+	k.mu.Lock()
+	k.pending[postID] = true
+	k.mu.Unlock()
+	select {
+	case k.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs an initial sweep and then rescores notified posts and sweeps
+// every SweepInterval until ctx is cancelled. It returns immediately; the
+// returned WaitGroup is done once the goroutine has exited.
+func (k *FeedRanker) Start(ctx context.Context) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := k.Sweep(); err != nil {
+			log.Printf("feed ranker: sweep failed: %v", err)
+		}
+		ticker := time.NewTicker(k.SweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-k.wake:
+				if _, err := k.RecomputePending(); err != nil {
+					log.Printf("feed ranker: rescoring failed: %v", err)
+				}
+			case <-ticker.C:
+				if _, err := k.Sweep(); err != nil {
+					log.Printf("feed ranker: sweep failed: %v", err)
+				}
+			}
+		}
+	}()
+	return &wg
+}
+
+// RecomputePending rescores all notified posts and returns how many there
+// were. Posts that could not be stored are notified again for the next round.
+func (k *FeedRanker) RecomputePending() (int, error) {
+	k.mu.Lock()
+	ids := make([]uuid.UUID, 0, len(k.pending))
+	for id := range k.pending {
+		ids = append(ids, id)
+	}
+	k.pending = map[uuid.UUID]bool{}
+	k.mu.Unlock()
+
+	if err := k.Recompute(ids...); err != nil {
+		k.mu.Lock()
+		for _, id := range ids {
+			k.pending[id] = true
+		}
+		k.mu.Unlock()
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// Recompute rescores the given posts now.
+func (k *FeedRanker) Recompute(ids ...uuid.UUID) error {
+	for start := 0; start < len(ids); start += k.BatchSize {
+		end := start + k.BatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		posts, err := k.Feed.PostRepo.GetPostsByIDs(ids[start:end])
+		if err != nil {
+			return err
+		}
+		if err := k.store(posts, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sweep rescores the newest Window posts and deletes all other rankings. It
+// returns the number of posts ranked.
+func (k *FeedRanker) Sweep() (int, error) {
+	started := time.Now()
+	n := 0
+	var after *repository.PostKeyset
+	for n < k.Window {
+		limit := k.BatchSize
+		if k.Window-n < limit {
+			limit = k.Window - n
+		}
+		posts, err := k.Feed.PostRepo.GetFilteredPosts(repository.PostFilter{}, after, limit)
+		if err != nil {
+			return n, err
+		}
+		if len(posts) == 0 {
+			break
+		}
+		if err := k.store(posts, started); err != nil {
+			return n, err
+		}
+		n += len(posts)
+		last := posts[len(posts)-1]
+		after = &repository.PostKeyset{CreatedAt: last.CreatedAt, ID: last.ID}
+		if len(posts) < limit {
+			break
+		}
+	}
+	if _, err := k.Feed.PostRepo.PruneRankings(started); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// store scores posts the same way the live feed does and saves the result.
+func (k *FeedRanker) store(posts []models.Post, computedAt time.Time) error {
+	k.Feed.scorePosts(posts)
+	rankings := make([]models.PostRanking, len(posts))
+	for i, p := range posts {
+		rankings[i] = models.PostRanking{
+			PostID:          p.ID,
+			Score:           p.Score,
+			PostCreatedAt:   p.CreatedAt,
+			ComputedUrgency: p.ComputedUrgency,
+			ComputedAt:      computedAt,
+		}
+	}
+	return k.Feed.PostRepo.UpsertPostRankings(rankings)
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrIdentityLinked is returned when linking an external identity that
+// already belongs to another user.
+var ErrIdentityLinked = errors.New("identity is linked to another user")
+
+// ErrLinkUnverified is returned when linking an identity to a user whose
+// email is not verified.
+var ErrLinkUnverified = errors.New("email must be verified before linking an identity")
+
+// ExternalIdentity is a user as vouched for by an identity provider. Email
+// must be verified by the provider.
+type ExternalIdentity struct {
+	Provider string
+	Subject  string
+	Email    string
+	Name     string
+	// Roles are the roles mapped from the provider's claims, or nil if the
+	// provider has no role mapping.
+	Roles []string
+}
+
+// IdentityService signs users in through external identity providers. One
+// user can have a password and any number of linked identities.
+type IdentityService struct {
+	Repo  *repository.IdentityRepository
+	Auth  *AuthService
+	Roles *RoleService
+	// Sessions, if set, ends the sessions of an unverified account when a
+	// provider proves someone else owns its email.
+	Sessions *SessionService
+}
+
+func NewIdentityService(repo *repository.IdentityRepository, authSvc *AuthService, roles *RoleService) *IdentityService {
+	return &IdentityService{Repo: repo, Auth: authSvc, Roles: roles}
+}
+
+// SignIn returns the user an external identity belongs to. An identity seen
+// for the first time is linked to linkTo if set (a signed-in user adding a
+// login method), otherwise to the user with the same email, who is created if
+// needed. Linking by email to an account whose email was never verified takes
+// the account over: whoever registered it may not own the address, so its
+// password is replaced, its sessions are ended and the identities it linked
+// are removed. Only users with a verified email can be linkTo. Roles mapped by
+// the provider are synced on every sign-in.
+func (s *IdentityService) SignIn(id ExternalIdentity, linkTo uuid.UUID) (*models.User, error) {
+	now := time.Now()
+	identity, err := s.Repo.FindIdentity(id.Provider, id.Subject)
+	var user *models.User
+	switch {
+	case err == nil:
+		if linkTo != uuid.Nil && linkTo != identity.UserID {
+			return nil, ErrIdentityLinked
+		}
+		if user, err = s.Auth.UserRepo.GetByID(identity.UserID); err != nil {
+			return nil, err
+		}
+		if err := s.Repo.TouchIdentity(identity.ID, id.Email, now); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if user, err = s.owner(id, linkTo); err != nil {
+			return nil, err
+		}
+		err = s.Repo.CreateIdentity(&models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    id.Provider,
+			Subject:     id.Subject,
+			Email:       id.Email,
+			CreatedAt:   now,
+			LastLoginAt: now,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("identities: linked %s identity %s to user %s", id.Provider, id.Subject, user.ID)
+	default:
+		return nil, err
+	}
+	// the provider vouches for the email, so it needs no verification link
+	if user.EmailVerifiedAt == nil && strings.EqualFold(user.Email, id.Email) {
+		if _, err := s.Auth.UserRepo.MarkEmailVerified(user.ID, user.Email, now); err != nil {
+			return nil, err
+		}
+		user.EmailVerifiedAt = &now
+	}
+	if id.Roles != nil && s.Roles != nil {
+		if err := s.Roles.SyncExternalRoles(user.ID, "oidc:"+id.Provider, id.Roles); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// owner returns the user a new identity is linked to.
+func (s *IdentityService) owner(id ExternalIdentity, linkTo uuid.UUID) (*models.User, error) {
+	if linkTo != uuid.Nil {
+		user, err := s.Auth.UserRepo.GetByID(linkTo)
+		if err == nil && user.EmailVerifiedAt == nil {
+			return nil, ErrLinkUnverified
+		}
+		return user, err
+	}
+	if user, err := s.Auth.UserRepo.GetByEmail(id.Email); err == nil {
+		if user.EmailVerifiedAt == nil {
+			if err := s.takeOver(user); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	name := id.Name
+	if name == "" {
+		name = id.Email
+	}
+	// a random password nobody knows; the account signs in through the provider
+	password, err := RandomPassword()
+	if err != nil {
+		return nil, err
+	}
+	return s.Auth.Register(name, id.Email, password)
+}
+
+// takeOver locks out whoever set the password of an unverified account before
+// its email's owner signs in through a provider, including through any
+// provider account they linked to it.
+func (s *IdentityService) takeOver(user *models.User) error {
+	password, err := RandomPassword()
+	if err != nil {
+		return err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	ok, err := s.Auth.UserRepo.ReplacePasswordHash(user.ID, user.PasswordHash, string(hashed))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("password changed while linking identity")
+	}
+	user.PasswordHash = string(hashed)
+	if err := s.Repo.DeleteIdentities(user.ID); err != nil {
+		return err
+	}
+	log.Printf("identities: replaced the password and unlinked the identities of unverified user %s", user.ID)
+	if s.Sessions != nil {
+		return s.Sessions.RevokeAll(user.ID)
+	}
+	return nil
+}
+
+// List returns a user's linked identities.
+func (s *IdentityService) List(userID uuid.UUID) ([]models.UserIdentity, error) {
+	return s.Repo.ListIdentities(userID)
+}
+
+// RandomPassword returns an unguessable password for accounts created
+// through an identity provider.
+func RandomPassword() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
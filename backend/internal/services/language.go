@@ -0,0 +1,129 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Languages recognised by DetectLanguage, as BCP 47 tags.
+const (
+	LangEnglish  = "en"
+	LangHindi    = "hi"      // Devanagari script
+	LangHinglish = "hi-Latn" // Hindi transliterated into Latin script, often mixed with English
+	LangUnknown  = "und"
+)
+
+// hinglishMarkers are common transliterated Hindi function words. They rarely
+// occur in English text, so a handful of them is a strong Hinglish signal.
+var hinglishMarkers = map[string]bool{
+	"hai": true, "hain": true, "nahi": true, "nahin": true, "nhi": true, "bahut": true,
+	"bohot": true, "kya": true, "ka": true, "ki": true, "ke": true, "ko": true,
+	"mein": true, "mai": true, "se": true, "aur": true, "yeh": true,
+	"ye": true, "woh": true, "wo": true, "yahan": true, "wahan": true, "raha": true,
+	"rahi": true, "rahe": true, "tha": true, "thi": true, "karo": true, "kijiye": true,
+	"gaya": true, "gayi": true, "hua": true, "hui": true, "abhi": true, "sab": true,
+	"koi": true, "kuch": true, "bhi": true, "bhai": true, "ji": true, "kab": true,
+	"kyun": true, "kaise": true, "pura": true, "poora": true, "wala": true, "wali": true,
+}
+
+// NormalizeUnicode returns text in NFC, lower case and without zero-width
+// joiners, so differently typed Devanagari (e.g. precomposed vs combining
+// nukta) compares equal.
+func NormalizeUnicode(text string) string {
+	text = strings.Map(func(r rune) rune {
+		switch r {
+		case '\u200c', '\u200d', '\ufeff':
+			return -1
+		}
+		return r
+	}, text)
+	return strings.ToLower(norm.NFC.String(text))
+}
+
+// Tokenize splits normalized text into words. Letters, combining marks (the
+// Devanagari vowel signs) and digits form words; apostrophes inside a word are
+// kept so "it's" stays one token. Everything else, including the danda, separates.
+func Tokenize(text string) []string {
+	var tokens []string
+	for _, clause := range TokenizeClauses(text) {
+		tokens = append(tokens, clause...)
+	}
+	return tokens
+}
+
+// TokenizeClauses tokenizes like Tokenize but groups the words into clauses
+// separated by sentence and clause punctuation (. , ; : ! ? and the danda),
+// which bound the scope of negations.
+func TokenizeClauses(text string) [][]string {
+	runes := []rune(NormalizeUnicode(text))
+	var clauses [][]string
+	var tokens []string
+	start := -1
+	for i, r := range runes {
+		inWord := unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r)
+		if !inWord && (r == '\'' || r == '’') && start >= 0 && i+1 < len(runes) && unicode.IsLetter(runes[i+1]) {
+			inWord = true
+		}
+		if inWord {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, string(runes[start:i]))
+			start = -1
+		}
+		if strings.ContainsRune(".,;:!?।॥\n", r) && len(tokens) > 0 {
+			clauses = append(clauses, tokens)
+			tokens = nil
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, string(runes[start:]))
+	}
+	if len(tokens) > 0 {
+		clauses = append(clauses, tokens)
+	}
+	return clauses
+}
+
+// DetectLanguage guesses the language of a short report or comment: Hindi
+// when most letters are Devanagari, Hinglish when at least a fifth of the
+// Latin words are transliterated Hindi, English otherwise. Text without
+// letters is LangUnknown.
+func DetectLanguage(text string) string {
+	var devanagari, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Devanagari, r):
+			devanagari++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	if devanagari == 0 && latin == 0 {
+		return LangUnknown
+	}
+	if devanagari >= latin {
+		return LangHindi
+	}
+
+	hinglish := ActiveScoringProfile().lexicon(LangHinglish)
+	words, hits := 0, 0
+	for _, tok := range Tokenize(text) {
+		if !unicode.Is(unicode.Latin, []rune(tok)[0]) {
+			continue
+		}
+		words++
+		if _, ok := hinglish[tok]; ok || hinglishMarkers[tok] {
+			hits++
+		}
+	}
+	if hits > 0 && hits*5 >= words {
+		return LangHinglish
+	}
+	return LangEnglish
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Huge pothole near the school gate", LangEnglish},
+		{"सड़क पर बहुत बड़ा गड्ढा है", LangHindi},
+		{"Yahan pe bahut bada gaddha hai, jaldi repair karo", LangHinglish},
+		{"Road pe aag lagi hai", LangHinglish},
+		{"Streetlight broken near MG Road metro", LangEnglish},
+		{"   ", LangUnknown},
+		{"123 !!", LangUnknown},
+	}
+	for _, tt := range tests {
+		if got := DetectLanguage(tt.text); got != tt.want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"It's DANGEROUS!! (really)", []string{"it's", "dangerous", "really"}},
+		{"पानी भर गया। बहुत खतरा", []string{"पानी", "भर", "गया", "बहुत", "खतरा"}},
+		{"water-logged, 3 days", []string{"water", "logged", "3", "days"}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeUnicodeNukta(t *testing.T) {
+	precomposed := "\u095c"     // ड़ as one code point
+	combining := "\u0921\u093c" // ड + nukta
+	if NormalizeUnicode(precomposed) != NormalizeUnicode(combining) {
+		t.Fatalf("nukta forms normalize differently")
+	}
+	if NormalizeUnicode("ख\u200dतरा") != "खतरा" {
+		t.Errorf("zero-width joiner not removed")
+	}
+}
+
+func TestCalculateCommentUrgencyMultilingual(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		language string
+		level    UrgencyLevel
+		keyword  string
+	}{
+		{"hindi critical", "यहाँ बहुत खतरा है, तुरंत मदद चाहिए", LangHindi, Critical, "खतरा"},
+		{"hindi inflected stem", "बिजली का तार खतरनाक हालत में", LangHindi, Critical, "खतरनाक"},
+		{"hinglish critical", "Bhai yahan aag lagi hai, turant aao", LangHinglish, Critical, "aag"},
+		{"hinglish mixed with english", "Road pe gaddha hai aur pipe broken hai", LangHinglish, Critical, "gaddha"},
+		{"hinglish minor", "thoda sa kachra pada hai", LangHinglish, Low, "thoda"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := CalculateCommentUrgency(tt.text)
+			if score.Language != tt.language {
+				t.Errorf("language = %q, want %q", score.Language, tt.language)
+			}
+			if score.Level != tt.level {
+				t.Errorf("level = %s (score %.2f, matches %+v), want %s", score.Level, score.Score, score.Matches, tt.level)
+			}
+			found := false
+			for _, m := range score.Matches {
+				found = found || m.Keyword == tt.keyword
+			}
+			if !found {
+				t.Errorf("expected keyword %q among %+v", tt.keyword, score.Matches)
+			}
+		})
+	}
+}
+
+func TestHeuristicScoreHindi(t *testing.T) {
+	if score, term := explainHeuristic("गली में आग लगी है"); score != 0.85 || term != "आग" {
+		t.Errorf("expected critical via आग, got %v %q", score, term)
+	}
+	if score, _ := explainHeuristic("Naali mein kachra bhara hai"); score != 0.6 {
+		t.Errorf("expected moderate for kachra, got %v", score)
+	}
+}
@@ -5,83 +5,241 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	config "crowdsourcedurbanissuereportingwithai/backend/configs"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/cache"
 )
 
-// PredictUrgency calls the configured ML API with the provided text and
-// attempts to extract an integer urgency score. Returns (0, nil) if no
-// ML API is configured. If the call fails, returns an error.
-// PredictUrgency retains backward-compatibility (integer only) by delegating
-// to PredictUrgencyDetailed and discarding the score.
-func PredictUrgency(text string) (int, error) {
-	urg, _, err := PredictUrgencyDetailed(text)
-	return urg, err
+// Prediction is the urgency estimate for a piece of text: a discrete bucket
+// (1-3), a continuous score in [0,1] and the name of the predictor that
+// produced it.
+type Prediction struct {
+	Urgency int     `json:"urgency"`
+	Score   float64 `json:"score"`
+	Source  string  `json:"source"`
 }
 
-// PredictUrgencyDetailed returns both a discrete urgency bucket (1-3) and a
-// continuous score in [0,1]. Threshold mapping (>=0.8->3, >=0.5->2, else 1).
-// If ML API disabled it attempts heuristic scoring from text content.
-func PredictUrgencyDetailed(text string) (int, float64, error) {
+// Prediction sources reported in Prediction.Source.
+const (
+	SourceML        = "ml"
+	SourceHeuristic = "heuristic"
+	SourceKeyword   = "keyword"
+)
+
+// UrgencyPredictor scores free text (report descriptions, comments) for urgency.
+type UrgencyPredictor interface {
+	PredictUrgency(text string) (Prediction, error)
+}
+
+// ImageClassifier predicts the issue class shown in an image. An empty class
+// with a nil error means no classification is available.
+type ImageClassifier interface {
+	ClassifyImage(imageURL string) (string, error)
+}
+
+// NewUrgencyPredictorFromConfig builds the predictor used in production: the
+// ML API from ML_API_URL with the local heuristic as fallback, or just the
+// heuristic when no API is configured. A non-nil breaker guards the API calls
+// so an unavailable model degrades to the heuristic immediately; a non-nil
+// store caches the API's predictions.
+func NewUrgencyPredictorFromConfig(breaker *CircuitBreaker, store cache.PredictionStore) UrgencyPredictor {
+	ml := NewMLUrgencyPredictorFromConfig(breaker, store)
+	if ml == nil {
+		return HeuristicPredictor{}
+	}
+	return NewChainPredictor(ml, HeuristicPredictor{})
+}
+
+// NewMLUrgencyPredictorFromConfig returns the ML API predictor alone, without
+// the heuristic fallback, or nil when ML_API_URL is unset. Callers that retry
+// on their own (the enrichment worker) use it to tell model failures apart
+// from heuristic results.
+func NewMLUrgencyPredictorFromConfig(breaker *CircuitBreaker, store cache.PredictionStore) UrgencyPredictor {
 	mlURL := config.GetMLAPIURL()
 	if mlURL == "" {
-		// Heuristic fallback when ML disabled
-		score := heuristicScore(text)
-		return mapScoreToUrgency(score), score, nil
+		return nil
 	}
+	api := NewHTTPUrgencyPredictor(mlURL, config.GetMLTextTimeout())
+	api.Breaker = breaker
+	api.Retry = RetryPolicyFromConfig()
+	if store != nil {
+		return NewCachingPredictor(api, store, UrgencyModelID(), config.GetPredictionCacheTTL())
+	}
+	return api
+}
+
+// NewImageClassifierFromConfig returns the HTTP classifier for
+// IMAGE_CLASSIFICATION_API_URL, or a no-op classifier when it is unset.
+func NewImageClassifierFromConfig(breaker *CircuitBreaker, store cache.PredictionStore) ImageClassifier {
+	apiURL := config.GetImageClassificationAPIURL()
+	if apiURL == "" {
+		return NoopImageClassifier{}
+	}
+	c := NewHTTPImageClassifier(apiURL, config.GetMLImageTimeout())
+	c.Breaker = breaker
+	c.Retry = RetryPolicyFromConfig()
+	if store != nil {
+		return NewCachingImageClassifier(c, store, ImageModelID(), config.GetPredictionCacheTTL())
+	}
+	return c
+}
+
+// UrgencyModelID identifies the configured urgency model for caching: its
+// URL plus ML_MODEL_VERSION.
+func UrgencyModelID() string {
+	return "urgency:" + config.GetMLAPIURL() + "@" + config.GetMLModelVersion()
+}
+
+// ImageModelID identifies the configured image classification model.
+func ImageModelID() string {
+	return "image:" + config.GetImageClassificationAPIURL() + "@" + config.GetImageModelVersion()
+}
+
+// NewCircuitBreakerFromConfig creates a breaker using the ML_BREAKER_* settings.
+func NewCircuitBreakerFromConfig(name string) *CircuitBreaker {
+	return NewCircuitBreaker(name, config.GetMLBreakerFailures(), config.GetMLBreakerOpenTimeout())
+}
 
-	reqBody := map[string]string{"text": text}
-	b, err := json.Marshal(reqBody)
+// RetryPolicyFromConfig returns the retry policy for ML API calls.
+func RetryPolicyFromConfig() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: config.GetMLRetryAttempts(),
+		BaseDelay:   config.GetMLRetryBaseDelay(),
+		MaxDelay:    2 * time.Second,
+	}
+}
+
+// HTTPUrgencyPredictor calls an external urgency model over HTTP with a
+// {"text": ...} JSON body. Unlike the composite predictors it never falls
+// back on its own: any transport, status or decoding problem is an error.
+// When Breaker is set, calls fail fast with ErrCircuitOpen while the model is
+// known to be down; Retry bounds retries of transient failures.
+type HTTPUrgencyPredictor struct {
+	URL     string
+	Timeout time.Duration
+	Client  *http.Client
+	Breaker *CircuitBreaker
+	Retry   RetryPolicy
+	// BatchConcurrency bounds concurrent single calls when the API turns out
+	// not to support batch requests (0 means ML_BATCH_CONCURRENCY).
+	BatchConcurrency int
+
+	batchUnsupported atomic.Bool
+}
+
+// NewHTTPUrgencyPredictor creates a predictor for the model served at url.
+func NewHTTPUrgencyPredictor(url string, timeout time.Duration) *HTTPUrgencyPredictor {
+	return &HTTPUrgencyPredictor{
+		URL:     url,
+		Timeout: timeout,
+		Client:  &http.Client{Timeout: timeout + (2 * time.Second)},
+	}
+}
+
+func (p *HTTPUrgencyPredictor) PredictUrgency(text string) (Prediction, error) {
+	b, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return Prediction{}, err
+	}
+
+	var pred Prediction
+	err = callWithResilience(context.Background(), p.Breaker, p.Retry, func() error {
+		parsed, err := p.post(b)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if pred, ok = parseUrgencyResponse(parsed); !ok {
+			log.Println("ml: could not extract urgency from response", parsed)
+			return errors.New("ml api response has no urgency")
+		}
+		return nil
+	})
 	if err != nil {
-		return 0, 0, err
+		return Prediction{}, err
 	}
+	return pred, nil
+}
 
-	// Use configured timeout for text ML
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetMLTextTimeout())
+// post sends one request to the model and decodes the JSON object it returns.
+func (p *HTTPUrgencyPredictor) post(body []byte) (map[string]interface{}, error) {
+	raw, _, err := p.postRaw(body)
+	if err != nil {
+		return nil, err
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// postRaw sends one request to the model and returns the raw response body
+// and status code. Non-2xx responses are errors, but the status is still
+// returned so callers can tell unsupported requests from outages.
+func (p *HTTPUrgencyPredictor) postRaw(body []byte) (json.RawMessage, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", mlURL, bytes.NewReader(b))
+	req, err := http.NewRequestWithContext(ctx, "POST", p.URL, bytes.NewReader(body))
 	if err != nil {
-		// Fallback to heuristic if request cannot be created
-		score := heuristicScore(text)
-		return mapScoreToUrgency(score), score, nil
+		return nil, 0, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: config.GetMLTextTimeout() + (2 * time.Second)}
-	resp, err := client.Do(req)
+	resp, err := p.Client.Do(req)
 	if err != nil {
-		// Network error -> fallback to heuristic
-		score := heuristicScore(text)
-		return mapScoreToUrgency(score), score, nil
+		return nil, 0, classifyTransportError(err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		// Non-2xx -> fallback to heuristic
-		score := heuristicScore(text)
-		return mapScoreToUrgency(score), score, nil
+		return nil, resp.StatusCode, classifyStatus(fmt.Errorf("ml api returned status %d", resp.StatusCode), resp.StatusCode)
 	}
 
-	var parsed map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		// Malformed response -> fallback to heuristic
-		score := heuristicScore(text)
-		return mapScoreToUrgency(score), score, nil
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, resp.StatusCode, err
 	}
+	return raw, resp.StatusCode, nil
+}
+
+// classifyTransportError marks connection failures as retryable. Timeouts are
+// not retried: a model that did not answer within the timeout is most likely
+// cold, and retrying would only multiply the wait.
+func classifyTransportError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err) {
+		return err
+	}
+	return retryableError{err}
+}
+
+// classifyStatus marks 5xx and 429 responses as retryable.
+func classifyStatus(err error, status int) error {
+	if status >= 500 || status == http.StatusTooManyRequests {
+		return retryableError{err}
+	}
+	return err
+}
 
+// parseUrgencyResponse extracts a prediction from the response shapes the
+// urgency models are known to return.
+func parseUrgencyResponse(parsed map[string]interface{}) (Prediction, bool) {
 	// 1. Direct score field
 	if scoreV, ok := parsed["score"]; ok {
 		if sc, ok := scoreV.(float64); ok {
 			urg := mapScoreToUrgency(sc)
 			log.Printf("ml: urgency prediction - score: %.2f -> urgency: %d\n", sc, urg)
-			return urg, sc, nil
+			return Prediction{Urgency: urg, Score: sc, Source: SourceML}, true
 		}
 	}
 
@@ -91,40 +249,71 @@ func PredictUrgencyDetailed(text string) (int, float64, error) {
 			label := strings.ToLower(strings.TrimSpace(s))
 			switch label {
 			case "critical", "urgent":
-				return 3, 0.9, nil
+				return Prediction{Urgency: 3, Score: 0.9, Source: SourceML}, true
 			case "moderate", "medium":
-				return 2, 0.65, nil
+				return Prediction{Urgency: 2, Score: 0.65, Source: SourceML}, true
 			case "low", "minor":
-				return 1, 0.3, nil
+				return Prediction{Urgency: 1, Score: 0.3, Source: SourceML}, true
 			}
 		}
 	}
 
 	// 3. Numeric urgency -> mapped score
 	if v, ok := parsed["urgency"]; ok {
-		switch t := v.(type) {
-		case float64:
+		if t, ok := v.(float64); ok {
 			urg := int(t)
-			sc := mapNumericUrgencyToScore(urg)
-			return urg, sc, nil
-		case int:
-			sc := mapNumericUrgencyToScore(t)
-			return t, sc, nil
+			return Prediction{Urgency: urg, Score: mapNumericUrgencyToScore(urg), Source: SourceML}, true
 		}
 	}
 
 	// 4. Classification / confidence alternative fields
 	if confV, ok := parsed["confidence"]; ok {
 		if cf, ok := confV.(float64); ok {
-			urg := mapScoreToUrgency(cf)
-			return urg, cf, nil
+			return Prediction{Urgency: mapScoreToUrgency(cf), Score: cf, Source: SourceML}, true
 		}
 	}
+	return Prediction{}, false
+}
+
+// HeuristicPredictor scores text locally with heuristicScore. It never fails.
+type HeuristicPredictor struct{}
 
-	log.Println("ml: could not extract urgency from response", parsed)
-	// If ML can't provide, fallback to heuristic instead of returning zero
+func (HeuristicPredictor) PredictUrgency(text string) (Prediction, error) {
 	score := heuristicScore(text)
-	return mapScoreToUrgency(score), score, nil
+	return Prediction{Urgency: mapScoreToUrgency(score), Score: score, Source: SourceHeuristic}, nil
+}
+
+// KeywordPredictor scores text with the weighted keyword calculator
+// (CalculateCommentUrgency), scaling its 0..3 score to 0..1. It never fails.
+type KeywordPredictor struct{}
+
+func (KeywordPredictor) PredictUrgency(text string) (Prediction, error) {
+	u := CalculateCommentUrgency(text)
+	score := u.Score / 3.0
+	return Prediction{Urgency: mapScoreToUrgency(score), Score: score, Source: SourceKeyword}, nil
+}
+
+// ChainPredictor asks each predictor in turn and returns the first successful
+// prediction, e.g. the ML API first and a local heuristic as fallback.
+type ChainPredictor struct {
+	Predictors []UrgencyPredictor
+}
+
+// NewChainPredictor creates a fallback chain tried in the given order.
+func NewChainPredictor(predictors ...UrgencyPredictor) *ChainPredictor {
+	return &ChainPredictor{Predictors: predictors}
+}
+
+func (c *ChainPredictor) PredictUrgency(text string) (Prediction, error) {
+	err := errors.New("no urgency predictor configured")
+	for _, p := range c.Predictors {
+		var pred Prediction
+		if pred, err = p.PredictUrgency(text); err == nil {
+			return pred, nil
+		}
+		log.Printf("ml: urgency predictor %T failed, trying next: %v", p, err)
+	}
+	return Prediction{}, err
 }
 
 // helper: map score to urgency bucket
@@ -154,38 +343,75 @@ func mapNumericUrgencyToScore(urg int) float64 {
 // heuristicScore provides a lightweight local estimation when ML API disabled.
 // Very naive keyword scoring; can be improved later.
 func heuristicScore(text string) float64 {
-	lower := strings.ToLower(text)
-	criticalTerms := []string{"emergency", "danger", "fire", "explosion", "injury", "critical", "urgent"}
-	moderateTerms := []string{"broken", "delay", "blocked", "leak", "issue", "problem", "trash"}
-	for _, w := range criticalTerms {
+	score, _ := explainHeuristic(text)
+	return score
+}
+
+// explainHeuristic returns heuristicScore together with the term that decided it.
+func explainHeuristic(text string) (float64, string) {
+	active := ActiveScoringProfile()
+	profile := &active.Profile
+	lower := NormalizeUnicode(text)
+	for _, w := range active.criticalTerms {
 		if strings.Contains(lower, w) {
-			return 0.85
+			return profile.CriticalScore, w
 		}
 	}
-	for _, w := range moderateTerms {
+	for _, w := range active.moderateTerms {
 		if strings.Contains(lower, w) {
-			return 0.6
+			return profile.ModerateScore, w
 		}
 	}
 	if strings.TrimSpace(lower) == "" {
-		return 0.0
+		return 0.0, ""
 	}
-	return 0.3
+	return profile.DefaultScore, ""
 }
 
-// ClassifyImage calls the configured image classification API with the provided image URL
-// and attempts to extract the predicted class. Returns empty string if no API is configured.
-// If the call fails, returns an error but allows graceful fallback.
-func ClassifyImage(imageURL string) (string, error) {
-	apiURL := config.GetImageClassificationAPIURL()
-	if apiURL == "" {
-		return "", nil // feature disabled
+// NoopImageClassifier is used when no image classification API is configured.
+type NoopImageClassifier struct{}
+
+func (NoopImageClassifier) ClassifyImage(string) (string, error) {
+	return "", nil
+}
+
+// HTTPImageClassifier posts the image URL as multipart form field "image_url"
+// to an external classification API. Breaker and Retry behave as for
+// HTTPUrgencyPredictor.
+type HTTPImageClassifier struct {
+	URL     string
+	Timeout time.Duration
+	Client  *http.Client
+	Breaker *CircuitBreaker
+	Retry   RetryPolicy
+}
+
+// NewHTTPImageClassifier creates a classifier for the API served at url.
+func NewHTTPImageClassifier(url string, timeout time.Duration) *HTTPImageClassifier {
+	return &HTTPImageClassifier{
+		URL:     url,
+		Timeout: timeout,
+		Client:  &http.Client{Timeout: timeout + (2 * time.Second)},
 	}
+}
 
+// ClassifyImage returns the predicted class for the image, or an empty string
+// if the image URL is empty or the response carries no recognised class field.
+func (c *HTTPImageClassifier) ClassifyImage(imageURL string) (string, error) {
 	if imageURL == "" {
 		return "", nil // no image to classify
 	}
 
+	var classified string
+	err := callWithResilience(context.Background(), c.Breaker, c.Retry, func() error {
+		var err error
+		classified, err = c.classify(imageURL)
+		return err
+	})
+	return classified, err
+}
+
+func (c *HTTPImageClassifier) classify(imageURL string) (string, error) {
 	// Create multipart form with image_url field
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
@@ -199,26 +425,24 @@ func ClassifyImage(imageURL string) (string, error) {
 		return "", err
 	}
 
-	// Use configured timeout for image classification (larger default)
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetMLImageTimeout())
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, body)
 	if err != nil {
 		return "", err
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	client := &http.Client{Timeout: config.GetMLImageTimeout() + (2 * time.Second)}
-	resp, err := client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
-		return "", err
+		return "", classifyTransportError(err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", errors.New("image classification api returned non-2xx status: " + string(bodyBytes))
+		return "", classifyStatus(errors.New("image classification api returned non-2xx status: "+string(bodyBytes)), resp.StatusCode)
 	}
 
 	var parsed map[string]interface{}
@@ -226,30 +450,15 @@ func ClassifyImage(imageURL string) (string, error) {
 		return "", err
 	}
 
-	// Handle "predicted_class" field (primary response format from the model)
-	if v, ok := parsed["predicted_class"]; ok {
-		if s, ok := v.(string); ok {
-			classified := strings.TrimSpace(s)
-			log.Printf("image_classification: predicted_class: %s\n", classified)
-			return classified, nil
-		}
-	}
-
-	// Fallback: try "classification" field
-	if v, ok := parsed["classification"]; ok {
-		if s, ok := v.(string); ok {
-			classified := strings.TrimSpace(s)
-			log.Printf("image_classification: classification: %s\n", classified)
-			return classified, nil
-		}
-	}
-
-	// Fallback: try "class" field
-	if v, ok := parsed["class"]; ok {
-		if s, ok := v.(string); ok {
-			classified := strings.TrimSpace(s)
-			log.Printf("image_classification: class: %s\n", classified)
-			return classified, nil
+	// "predicted_class" is the primary response format from the model;
+	// "classification" and "class" are accepted as fallbacks.
+	for _, field := range []string{"predicted_class", "classification", "class"} {
+		if v, ok := parsed[field]; ok {
+			if s, ok := v.(string); ok {
+				classified := strings.TrimSpace(s)
+				log.Printf("image_classification: %s: %s\n", field, classified)
+				return classified, nil
+			}
 		}
 	}
 
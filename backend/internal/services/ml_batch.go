@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/cache"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	config "crowdsourcedurbanissuereportingwithai/backend/configs"
+)
+
+// maxBatchSize caps the number of texts sent to the ML API in one request.
+const maxBatchSize = 64
+
+// errBatchUnsupported is returned when the ML API does not understand
+// {"texts": [...]} requests; callers then fall back to single calls.
+var errBatchUnsupported = errors.New("ml api does not support batch prediction")
+
+// BatchUrgencyPredictor is implemented by predictors that can score many texts
+// at once. Results and errors are aligned with texts; errs[i] is nil when
+// preds[i] is valid.
+type BatchUrgencyPredictor interface {
+	UrgencyPredictor
+	PredictUrgencyBatch(texts []string) (preds []Prediction, errs []error)
+}
+
+// PredictBatch scores texts with p: in one call when p supports batching,
+// otherwise with at most concurrency single calls in flight (ML_BATCH_CONCURRENCY
+// when concurrency is 0).
+func PredictBatch(p UrgencyPredictor, texts []string, concurrency int) ([]Prediction, []error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if bp, ok := p.(BatchUrgencyPredictor); ok {
+		return bp.PredictUrgencyBatch(texts)
+	}
+	return predictConcurrently(p, texts, concurrency)
+}
+
+func predictConcurrently(p UrgencyPredictor, texts []string, concurrency int) ([]Prediction, []error) {
+	if concurrency <= 0 {
+		concurrency = config.GetMLBatchConcurrency()
+	}
+	preds := make([]Prediction, len(texts))
+	errs := make([]error, len(texts))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, text := range texts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, text string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			preds[i], errs[i] = p.PredictUrgency(text)
+		}(i, text)
+	}
+	wg.Wait()
+	return preds, errs
+}
+
+// PredictUrgencyBatch sends the texts as {"texts": [...]} in chunks of
+// maxBatchSize. The first time the API rejects the batch format the predictor
+// remembers it and from then on uses BatchConcurrency concurrent single calls.
+func (p *HTTPUrgencyPredictor) PredictUrgencyBatch(texts []string) ([]Prediction, []error) {
+	if p.batchUnsupported.Load() {
+		return predictConcurrently(p, texts, p.BatchConcurrency)
+	}
+	preds := make([]Prediction, len(texts))
+	errs := make([]error, len(texts))
+	for start := 0; start < len(texts); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		chunk, err := p.predictChunk(texts[start:end])
+		if errors.Is(err, errBatchUnsupported) {
+			log.Printf("ml: %v, falling back to single calls", err)
+			p.batchUnsupported.Store(true)
+			rest, restErrs := predictConcurrently(p, texts[start:], p.BatchConcurrency)
+			copy(preds[start:], rest)
+			copy(errs[start:], restErrs)
+			return preds, errs
+		}
+		for i := start; i < end; i++ {
+			if err != nil {
+				errs[i] = err
+			} else {
+				preds[i] = chunk[i-start]
+			}
+		}
+	}
+	return preds, errs
+}
+
+func (p *HTTPUrgencyPredictor) predictChunk(texts []string) ([]Prediction, error) {
+	b, err := json.Marshal(map[string][]string{"texts": texts})
+	if err != nil {
+		return nil, err
+	}
+	var preds []Prediction
+	err = callWithResilience(context.Background(), p.Breaker, p.Retry, func() error {
+		raw, status, err := p.postRaw(b)
+		if status == 400 || status == 404 || status == 405 || status == 422 {
+			// the API does not know the batch format; not a model failure
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if preds, ok = parseBatchResponse(raw, len(texts)); !ok {
+			preds = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if preds == nil {
+		return nil, errBatchUnsupported
+	}
+	return preds, nil
+}
+
+// parseBatchResponse accepts a JSON array (of scores or of single-prediction
+// objects), optionally wrapped in an object under "scores", "predictions" or
+// "results". It fails unless there is exactly one result per text.
+func parseBatchResponse(raw json.RawMessage, n int) ([]Prediction, bool) {
+	var items []interface{}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		var wrapped map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return nil, false
+		}
+		for _, key := range []string{"scores", "predictions", "results"} {
+			if v, ok := wrapped[key]; ok && json.Unmarshal(v, &items) == nil {
+				break
+			}
+		}
+	}
+	if len(items) != n {
+		return nil, false
+	}
+	preds := make([]Prediction, n)
+	for i, item := range items {
+		switch v := item.(type) {
+		case float64:
+			preds[i] = Prediction{Urgency: mapScoreToUrgency(v), Score: v, Source: SourceML}
+		case map[string]interface{}:
+			pred, ok := parseUrgencyResponse(v)
+			if !ok {
+				return nil, false
+			}
+			preds[i] = pred
+		default:
+			return nil, false
+		}
+	}
+	return preds, true
+}
+
+// PredictUrgencyBatch asks each predictor in turn for the texts the previous
+// ones could not score.
+func (c *ChainPredictor) PredictUrgencyBatch(texts []string) ([]Prediction, []error) {
+	preds := make([]Prediction, len(texts))
+	errs := make([]error, len(texts))
+	pending := make([]int, len(texts))
+	for i := range texts {
+		pending[i] = i
+		errs[i] = errors.New("no urgency predictor configured")
+	}
+	for _, p := range c.Predictors {
+		if len(pending) == 0 {
+			break
+		}
+		batch := make([]string, len(pending))
+		for j, idx := range pending {
+			batch[j] = texts[idx]
+		}
+		got, gotErrs := PredictBatch(p, batch, 0)
+		var still []int
+		for j, idx := range pending {
+			if gotErrs[j] != nil {
+				errs[idx] = gotErrs[j]
+				still = append(still, idx)
+				continue
+			}
+			preds[idx], errs[idx] = got[j], nil
+		}
+		if len(still) > 0 {
+			log.Printf("ml: urgency predictor %T failed for %d of %d texts, trying next", p, len(still), len(pending))
+		}
+		pending = still
+	}
+	return preds, errs
+}
+
+// PredictUrgencyBatch serves cached texts from the store and sends only the
+// misses to Next, batched when Next supports it.
+func (c *CachingPredictor) PredictUrgencyBatch(texts []string) ([]Prediction, []error) {
+	ctx := context.Background()
+	modelID := c.ModelID()
+	preds := make([]Prediction, len(texts))
+	errs := make([]error, len(texts))
+	keys := make([]string, len(texts))
+	var missIdx []int
+	var missTexts []string
+	for i, text := range texts {
+		keys[i] = cache.PredictionKey(modelID, cache.NormalizeText(text))
+		e, ok, err := c.Store.Get(ctx, keys[i])
+		if err != nil {
+			log.Printf("prediction cache: get failed: %v", err)
+		}
+		if ok {
+			preds[i] = Prediction{Urgency: e.Urgency, Score: e.Score, Source: e.Source}
+			continue
+		}
+		missIdx = append(missIdx, i)
+		missTexts = append(missTexts, text)
+	}
+	if len(missTexts) == 0 {
+		return preds, errs
+	}
+
+	got, gotErrs := PredictBatch(c.Next, missTexts, 0)
+	now := time.Now()
+	for j, i := range missIdx {
+		preds[i], errs[i] = got[j], gotErrs[j]
+		if errs[i] != nil {
+			continue
+		}
+		entry := cache.PredictionEntry{ModelID: modelID, Urgency: got[j].Urgency, Score: got[j].Score, Source: got[j].Source, CreatedAt: now}
+		if err := c.Store.Set(ctx, keys[i], entry, c.TTL); err != nil {
+			log.Printf("prediction cache: set failed: %v", err)
+		}
+	}
+	return preds, errs
+}
+
+// PredictUrgencyBatch scores each text locally; it never fails.
+func (h HeuristicPredictor) PredictUrgencyBatch(texts []string) ([]Prediction, []error) {
+	preds := make([]Prediction, len(texts))
+	for i, text := range texts {
+		preds[i], _ = h.PredictUrgency(text)
+	}
+	return preds, make([]error, len(texts))
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"crowdsourcedurbanissuereportingwithai/backend/internal/cache"
+)
+
+func TestHTTPUrgencyPredictorBatchRequest(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var body struct {
+			Texts []string `json:"texts"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		scores := []float64{0.1, 0.2, 0.3}[:len(body.Texts)]
+		json.NewEncoder(w).Encode(map[string]interface{}{"scores": scores})
+	}))
+	defer srv.Close()
+
+	p := NewHTTPUrgencyPredictor(srv.URL, time.Second)
+	preds, errs := PredictBatch(p, []string{"a", "b", "c"}, 0)
+	if requests != 1 {
+		t.Fatalf("expected one batch request, got %d", requests)
+	}
+	for i, want := range []float64{0.1, 0.2, 0.3} {
+		if errs[i] != nil || preds[i].Score != want {
+			t.Errorf("text %d: got %+v (%v), want score %.1f", i, preds[i], errs[i], want)
+		}
+	}
+}
+
+func TestHTTPUrgencyPredictorFallsBackToSingleCalls(t *testing.T) {
+	var batchRequests, singleRequests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["texts"]; ok {
+			atomic.AddInt32(&batchRequests, 1)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		atomic.AddInt32(&singleRequests, 1)
+		w.Write([]byte(`{"label": "critical"}`))
+	}))
+	defer srv.Close()
+
+	p := NewHTTPUrgencyPredictor(srv.URL, time.Second)
+	p.BatchConcurrency = 2
+	texts := []string{"a", "b", "c", "d"}
+	for round := 0; round < 2; round++ {
+		preds, errs := PredictBatch(p, texts, 0)
+		for i := range texts {
+			if errs[i] != nil || preds[i].Urgency != 3 {
+				t.Fatalf("round %d text %d: got %+v (%v)", round, i, preds[i], errs[i])
+			}
+		}
+	}
+	// the unsupported batch format is only tried once
+	if batchRequests != 1 || singleRequests != 8 {
+		t.Fatalf("expected 1 batch and 8 single requests, got %d and %d", batchRequests, singleRequests)
+	}
+}
+
+func TestChainBatchFallsBackPerText(t *testing.T) {
+	store := cache.NewLRUPredictionStore(10)
+	store.Set(context.Background(), cache.PredictionKey("m", "cached text"), cache.PredictionEntry{ModelID: "m", Urgency: 3, Score: 0.95, Source: SourceML}, time.Hour)
+	failing := &fakePredictor{err: errBatchUnsupported}
+	chain := NewChainPredictor(NewCachingPredictor(failing, store, "m", time.Hour), HeuristicPredictor{})
+
+	preds, errs := PredictBatch(chain, []string{"Cached   TEXT", "fire on the bridge"}, 1)
+	if errs[0] != nil || preds[0].Source != SourceML || preds[0].Score != 0.95 {
+		t.Errorf("expected cached ML prediction, got %+v (%v)", preds[0], errs[0])
+	}
+	if errs[1] != nil || preds[1].Source != SourceHeuristic || preds[1].Urgency != 3 {
+		t.Errorf("expected heuristic fallback, got %+v (%v)", preds[1], errs[1])
+	}
+	if failing.calls != 1 {
+		t.Errorf("expected only the cache miss to reach the model, got %d calls", failing.calls)
+	}
+}
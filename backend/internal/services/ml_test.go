@@ -0,0 +1,82 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPUrgencyPredictorResponseShapes(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantUrgency int
+		wantScore   float64
+	}{
+		{name: "score", body: `{"score": 0.92}`, wantUrgency: 3, wantScore: 0.92},
+		{name: "label", body: `{"label": "Moderate"}`, wantUrgency: 2, wantScore: 0.65},
+		{name: "numeric urgency", body: `{"urgency": 1}`, wantUrgency: 1, wantScore: 0.3},
+		{name: "confidence", body: `{"confidence": 0.55}`, wantUrgency: 2, wantScore: 0.55},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			pred, err := NewHTTPUrgencyPredictor(srv.URL, time.Second).PredictUrgency("water main burst")
+			if err != nil {
+				t.Fatalf("PredictUrgency error: %v", err)
+			}
+			if pred.Urgency != tt.wantUrgency || pred.Score != tt.wantScore || pred.Source != SourceML {
+				t.Errorf("got %+v, want urgency %d score %.2f from ml", pred, tt.wantUrgency, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestHTTPUrgencyPredictorReportsFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if _, err := NewHTTPUrgencyPredictor(srv.URL, time.Second).PredictUrgency("x"); err == nil {
+		t.Fatal("expected an error for a 503 response")
+	}
+}
+
+type fakePredictor struct {
+	pred  Prediction
+	err   error
+	calls int
+}
+
+func (f *fakePredictor) PredictUrgency(string) (Prediction, error) {
+	f.calls++
+	return f.pred, f.err
+}
+
+func TestChainPredictorFallsBack(t *testing.T) {
+	failing := &fakePredictor{err: errors.New("model is cold")}
+	fallback := &fakePredictor{pred: Prediction{Urgency: 2, Score: 0.6, Source: SourceHeuristic}}
+	unused := &fakePredictor{pred: Prediction{Urgency: 3, Score: 0.9}}
+
+	pred, err := NewChainPredictor(failing, fallback, unused).PredictUrgency("broken streetlight")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pred.Source != SourceHeuristic || pred.Urgency != 2 {
+		t.Errorf("expected the fallback prediction, got %+v", pred)
+	}
+	if failing.calls != 1 || fallback.calls != 1 || unused.calls != 0 {
+		t.Errorf("unexpected call counts: failing=%d fallback=%d unused=%d", failing.calls, fallback.calls, unused.calls)
+	}
+
+	if _, err := NewChainPredictor(failing).PredictUrgency("x"); err == nil {
+		t.Error("expected an error when every predictor fails")
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	config "crowdsourcedurbanissuereportingwithai/backend/configs"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/geo"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidPlace is returned for a place with an unknown kind or
+	// out-of-range coordinates or radius.
+	ErrInvalidPlace = errors.New("invalid place")
+	// ErrTooManyPlaces is returned when a user already saved MaxUserPlaces.
+	ErrTooManyPlaces = errors.New("too many places")
+)
+
+// MaxUserPlaces bounds how many places one user can save.
+const MaxUserPlaces = 10
+
+// defaultPlaceRadiusM is the radius used when a place is saved without one.
+var defaultPlaceRadiusM = map[string]float64{
+	models.PlaceHome: 2000,
+	models.PlaceWork: 2000,
+	models.PlaceArea: 1000,
+}
+
+// ListPlaces returns the places a user saved.
+func (s *FeedService) ListPlaces(userID uuid.UUID) ([]models.UserPlace, error) {
+	return s.UserRepo.ListPlaces(userID)
+}
+
+// AddPlace validates and saves a place for userID.
+func (s *FeedService) AddPlace(userID uuid.UUID, place models.UserPlace) (*models.UserPlace, error) {
+	place.Kind = strings.ToLower(strings.TrimSpace(place.Kind))
+	defaultRadius, ok := defaultPlaceRadiusM[place.Kind]
+	if !ok {
+		return nil, ErrInvalidPlace
+	}
+	if place.RadiusM == 0 {
+		place.RadiusM = defaultRadius
+	}
+	if place.Lat < -90 || place.Lat > 90 || place.Lng < -180 || place.Lng > 180 || place.RadiusM < 100 || place.RadiusM > 20000 {
+		return nil, ErrInvalidPlace
+	}
+	place.ID = uuid.Nil
+	place.UserID = userID
+	if err := s.UserRepo.AddPlace(&place, MaxUserPlaces); err != nil {
+		if errors.Is(err, repository.ErrPlaceLimit) {
+			return nil, ErrTooManyPlaces
+		}
+		return nil, err
+	}
+	return &place, nil
+}
+
+// DeletePlace removes one of the user's places.
+func (s *FeedService) DeletePlace(userID, placeID uuid.UUID) error {
+	return s.UserRepo.DeletePlace(userID, placeID)
+}
+
+// placeReachRadii is how many radii around a saved place the personal feed
+// looks for candidates; beyond it the proximity boost is a quarter or less.
+const placeReachRadii = 3
+
+// GetPersonalFeed returns the feed ranked for userID: the global score is
+// boosted for posts near the user's saved places and in categories the user
+// upvoted or commented on. Besides the global top posts, the candidates
+// include the top posts around the places, so a local report that is not
+// among the city's top FEED_LIMIT still reaches its neighbours. Users without
+// places or interactions get the global ranking.
+func (s *FeedService) GetPersonalFeed(userID uuid.UUID) ([]models.Post, error) {
+	if s.UserRepo == nil {
+		return s.GetFeed()
+	}
+	places, err := s.UserRepo.ListPlaces(userID)
+	if err != nil {
+		return nil, err
+	}
+	interactions, err := s.PostRepo.UserCategoryInteractions(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(places) == 0 && len(interactions) == 0 {
+		return s.GetFeed()
+	}
+	limit := config.GetFeedLimit()
+	if limit <= 0 {
+		limit = 50
+	}
+	boxes := make([]geo.BBox, len(places))
+	for i, pl := range places {
+		boxes[i] = geo.BoundingBox(pl.Lat, pl.Lng, pl.RadiusM*placeReachRadii)
+	}
+	posts, err := s.personalCandidates(boxes, limit)
+	if err != nil {
+		return nil, err
+	}
+	personalize(posts, places, interactions, config.GetFeedPersonalDistanceBoost(), config.GetFeedPersonalCategoryBoost())
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Score > posts[j].Score })
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
+
+// personalCandidates picks the global feed candidates plus the top posts
+// inside any of boxes, fetched in one query. With rankings both come scored
+// from post_rankings; otherwise they are scored live together, in one pass,
+// exactly as GetFeed scores its posts.
+func (s *FeedService) personalCandidates(boxes []geo.BBox, limit int) ([]models.Post, error) {
+	if s.Rankings {
+		posts, err := s.PostRepo.GetRankedPosts(repository.PostFilter{}, nil, limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(posts) > 0 {
+			if len(boxes) == 0 {
+				return posts, nil
+			}
+			nearby, err := s.PostRepo.GetRankedPosts(repository.PostFilter{WithinAny: boxes}, nil, limit)
+			if err != nil {
+				return nil, err
+			}
+			return appendNewPosts(posts, nearby), nil
+		}
+		// nothing ranked yet (first start before the initial sweep): score live
+	}
+	posts, err := s.PostRepo.GetFeedPosts()
+	if err != nil {
+		return nil, err
+	}
+	if len(boxes) > 0 {
+		nearby, err := s.PostRepo.GetFilteredPosts(repository.PostFilter{WithinAny: boxes}, nil, limit)
+		if err != nil {
+			return nil, err
+		}
+		posts = appendNewPosts(posts, nearby)
+	}
+	s.scorePosts(posts)
+	return posts, nil
+}
+
+// appendNewPosts appends the posts of more that are not in posts yet.
+func appendNewPosts(posts, more []models.Post) []models.Post {
+	seen := make(map[uuid.UUID]bool, len(posts))
+	for _, p := range posts {
+		seen[p.ID] = true
+	}
+	for _, p := range more {
+		if !seen[p.ID] {
+			seen[p.ID] = true
+			posts = append(posts, p)
+		}
+	}
+	return posts
+}
+
+// personalize multiplies each post's score by
+// 1 + distanceBoost*proximity + categoryBoost*affinity and sets DistanceM to
+// the distance from the nearest place.
+func personalize(posts []models.Post, places []models.UserPlace, interactions map[string]int, distanceBoost, categoryBoost float64) {
+	maxInteractions := 0
+	for _, n := range interactions {
+		if n > maxInteractions {
+			maxInteractions = n
+		}
+	}
+	for i := range posts {
+		p := &posts[i]
+		proximity, nearest := placeProximity(p.Lat, p.Lng, places)
+		if len(places) > 0 {
+			p.DistanceM = nearest
+		}
+		affinity := 0.0
+		if maxInteractions > 0 {
+			affinity = float64(interactions[p.Issue.Category]) / float64(maxInteractions)
+		}
+		p.Score *= 1 + distanceBoost*proximity + categoryBoost*affinity
+	}
+}
+
+// placeProximity returns how close (lat, lng) is to the nearest place, from 1
+// inside its radius halving with every further radius, and the distance in
+// meters to that place.
+func placeProximity(lat, lng float64, places []models.UserPlace) (float64, float64) {
+	best, nearest := 0.0, math.Inf(1)
+	for _, pl := range places {
+		d := geo.HaversineMeters(lat, lng, pl.Lat, pl.Lng)
+		nearest = math.Min(nearest, d)
+		prox := 1.0
+		if d > pl.RadiusM {
+			prox = math.Pow(0.5, (d-pl.RadiusM)/pl.RadiusM)
+		}
+		best = math.Max(best, prox)
+	}
+	return best, nearest
+}
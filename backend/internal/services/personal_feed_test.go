@@ -0,0 +1,46 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+)
+
+func TestPlaceProximity(t *testing.T) {
+	places := []models.UserPlace{{Lat: 12.97, Lng: 77.59, RadiusM: 1000}}
+	if prox, d := placeProximity(12.97, 77.59, places); prox != 1 || d > 1 {
+		t.Fatalf("at the place: got %v, %v", prox, d)
+	}
+	// About 2 km north: one radius outside, so half the boost.
+	prox, d := placeProximity(12.988, 77.59, places)
+	if math.Abs(prox-0.5) > 0.05 || math.Abs(d-2000) > 50 {
+		t.Fatalf("2 km away: got %v, %v", prox, d)
+	}
+	if prox, _ := placeProximity(28.7, 77.1, places); prox > 1e-6 {
+		t.Fatalf("another city should get no boost, got %v", prox)
+	}
+	if prox, d := placeProximity(0, 0, nil); prox != 0 || !math.IsInf(d, 1) {
+		t.Fatalf("no places: got %v, %v", prox, d)
+	}
+}
+
+func TestPersonalize(t *testing.T) {
+	places := []models.UserPlace{{Lat: 12.97, Lng: 77.59, RadiusM: 1000}}
+	posts := []models.Post{
+		{Score: 1, Lat: 28.7, Lng: 77.1, Issue: models.Issue{Category: "Road"}},
+		{Score: 1, Lat: 12.97, Lng: 77.59, Issue: models.Issue{Category: "Water"}},
+		{Score: 1, Lat: 28.7, Lng: 77.1, Issue: models.Issue{Category: "Water"}},
+	}
+	personalize(posts, places, map[string]int{"Water": 4, "Road": 2}, 1.0, 0.5)
+
+	if math.Abs(posts[0].Score-1.25) > 1e-6 {
+		t.Fatalf("far road post: expected 1.25, got %v", posts[0].Score)
+	}
+	if math.Abs(posts[1].Score-2.5) > 1e-6 || posts[1].DistanceM > 1 {
+		t.Fatalf("near water post: expected 2.5 at the place, got %v at %v m", posts[1].Score, posts[1].DistanceM)
+	}
+	if math.Abs(posts[2].Score-1.5) > 1e-6 {
+		t.Fatalf("far water post: expected 1.5, got %v", posts[2].Score)
+	}
+}
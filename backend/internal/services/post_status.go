@@ -0,0 +1,105 @@
+package services
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidStatus is returned when a status is not part of the post lifecycle.
+	ErrInvalidStatus = errors.New("invalid status")
+	// ErrInvalidTransition is returned when the lifecycle does not allow moving
+	// from the post's current status to the requested one.
+	ErrInvalidTransition = errors.New("status transition not allowed")
+)
+
+// statusTransitions lists, for every status, the statuses a post may move to.
+// The main path is open -> triaged -> assigned -> inprogress -> resolved ->
+// verified -> closed; earlier steps may be skipped. Rejected, duplicate and
+// finished reports can be reopened, which re-enters the triage part of the flow.
+var statusTransitions = map[string][]string{
+	models.StatusOpen:       {models.StatusTriaged, models.StatusAssigned, models.StatusInProgress, models.StatusRejected, models.StatusDuplicate},
+	models.StatusTriaged:    {models.StatusAssigned, models.StatusInProgress, models.StatusRejected, models.StatusDuplicate},
+	models.StatusAssigned:   {models.StatusInProgress, models.StatusTriaged, models.StatusRejected},
+	models.StatusInProgress: {models.StatusResolved, models.StatusAssigned},
+	models.StatusResolved:   {models.StatusVerified, models.StatusClosed, models.StatusReopened},
+	models.StatusVerified:   {models.StatusClosed, models.StatusReopened},
+	models.StatusClosed:     {models.StatusReopened},
+	models.StatusRejected:   {models.StatusReopened},
+	models.StatusDuplicate:  {models.StatusReopened},
+	models.StatusReopened:   {models.StatusTriaged, models.StatusAssigned, models.StatusInProgress, models.StatusRejected, models.StatusDuplicate},
+}
+
+// IsValidStatus reports whether status is part of the post lifecycle.
+func IsValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransitionStatus returns nil if a post may move from one status to the
+// other, ErrInvalidStatus if either status is unknown and ErrInvalidTransition
+// otherwise.
+func CanTransitionStatus(from, to string) error {
+	if !IsValidStatus(from) || !IsValidStatus(to) {
+		return ErrInvalidStatus
+	}
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return ErrInvalidTransition
+}
+
+// AllowedStatusTransitions returns the statuses a post in the given status may move to.
+func AllowedStatusTransitions(from string) []string {
+	return append([]string(nil), statusTransitions[from]...)
+}
+
+// IsOpenStatus reports whether a post in status still awaits a fix, i.e. it
+// has not been resolved, closed, rejected or marked duplicate.
+func IsOpenStatus(status string) bool {
+	switch status {
+	case models.StatusResolved, models.StatusVerified, models.StatusClosed, models.StatusRejected, models.StatusDuplicate:
+		return false
+	}
+	return true
+}
+
+// StatusActor is the part of a user shown next to a status change.
+type StatusActor struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// StatusChange is a status transition as returned by the history endpoint.
+type StatusChange struct {
+	ID         uuid.UUID   `json:"id"`
+	PostID     uuid.UUID   `json:"post_id"`
+	ActorID    uuid.UUID   `json:"actor_id"`
+	Actor      StatusActor `json:"actor"`
+	FromStatus string      `json:"from_status"`
+	ToStatus   string      `json:"to_status"`
+	Notes      string      `json:"notes,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+func toStatusChanges(changes []models.PostStatusChange) []StatusChange {
+	out := make([]StatusChange, 0, len(changes))
+	for _, c := range changes {
+		out = append(out, StatusChange{
+			ID:         c.ID,
+			PostID:     c.PostID,
+			ActorID:    c.ActorID,
+			Actor:      StatusActor{ID: c.Actor.ID, Name: c.Actor.Name},
+			FromStatus: c.FromStatus,
+			ToStatus:   c.ToStatus,
+			Notes:      c.Notes,
+			CreatedAt:  c.CreatedAt,
+		})
+	}
+	return out
+}
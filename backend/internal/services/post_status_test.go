@@ -0,0 +1,38 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanTransitionStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		wantErr error
+	}{
+		{name: "open to triaged", from: "open", to: "triaged"},
+		{name: "open straight to inprogress", from: "open", to: "inprogress"},
+		{name: "inprogress to resolved", from: "inprogress", to: "resolved"},
+		{name: "resolved to verified", from: "resolved", to: "verified"},
+		{name: "verified to closed", from: "verified", to: "closed"},
+		{name: "closed can be reopened", from: "closed", to: "reopened"},
+		{name: "duplicate can be reopened", from: "duplicate", to: "reopened"},
+		{name: "reopened back to triage", from: "reopened", to: "triaged"},
+		{name: "open cannot be closed directly", from: "open", to: "closed", wantErr: ErrInvalidTransition},
+		{name: "closed cannot go back to inprogress", from: "closed", to: "inprogress", wantErr: ErrInvalidTransition},
+		{name: "same status is not a transition", from: "triaged", to: "triaged", wantErr: ErrInvalidTransition},
+		{name: "unknown target status", from: "open", to: "done", wantErr: ErrInvalidStatus},
+		{name: "unknown current status", from: "pending", to: "open", wantErr: ErrInvalidStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CanTransitionStatus(tt.from, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CanTransitionStatus(%q, %q) = %v, want %v", tt.from, tt.to, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/cache"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachingPredictor memoizes successful predictions of Next, keyed by model id
+// and normalized text. It should wrap the ML API predictor rather than a
+// fallback chain so heuristic results served during an outage are not cached
+// as model output. Cache failures are logged and treated as misses.
+type CachingPredictor struct {
+	Next  UrgencyPredictor
+	Store cache.PredictionStore
+	TTL   time.Duration
+
+	mu      sync.RWMutex
+	modelID string
+}
+
+func NewCachingPredictor(next UrgencyPredictor, store cache.PredictionStore, modelID string, ttl time.Duration) *CachingPredictor {
+	return &CachingPredictor{Next: next, Store: store, TTL: ttl, modelID: modelID}
+}
+
+// ModelID returns the model id currently used to key cache entries.
+func (c *CachingPredictor) ModelID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.modelID
+}
+
+// SetModelID switches to a new model version and drops the cached
+// predictions of the previous one.
+func (c *CachingPredictor) SetModelID(ctx context.Context, modelID string) error {
+	c.mu.Lock()
+	old := c.modelID
+	c.modelID = modelID
+	c.mu.Unlock()
+	if old == modelID {
+		return nil
+	}
+	return c.Store.Invalidate(ctx, old)
+}
+
+func (c *CachingPredictor) PredictUrgency(text string) (Prediction, error) {
+	ctx := context.Background()
+	modelID := c.ModelID()
+	key := cache.PredictionKey(modelID, cache.NormalizeText(text))
+
+	e, ok, err := c.Store.Get(ctx, key)
+	if err != nil {
+		log.Printf("prediction cache: get failed: %v", err)
+	}
+	if ok {
+		return Prediction{Urgency: e.Urgency, Score: e.Score, Source: e.Source}, nil
+	}
+
+	pred, err := c.Next.PredictUrgency(text)
+	if err != nil {
+		return pred, err
+	}
+	entry := cache.PredictionEntry{
+		ModelID:   modelID,
+		Urgency:   pred.Urgency,
+		Score:     pred.Score,
+		Source:    pred.Source,
+		CreatedAt: time.Now(),
+	}
+	if err := c.Store.Set(ctx, key, entry, c.TTL); err != nil {
+		log.Printf("prediction cache: set failed: %v", err)
+	}
+	return pred, nil
+}
+
+// CachingImageClassifier memoizes image classifications by media URL.
+// Empty results are not cached so a later retry can still classify the image.
+type CachingImageClassifier struct {
+	Next  ImageClassifier
+	Store cache.PredictionStore
+	TTL   time.Duration
+
+	mu      sync.RWMutex
+	modelID string
+}
+
+func NewCachingImageClassifier(next ImageClassifier, store cache.PredictionStore, modelID string, ttl time.Duration) *CachingImageClassifier {
+	return &CachingImageClassifier{Next: next, Store: store, TTL: ttl, modelID: modelID}
+}
+
+// ModelID returns the model id currently used to key cache entries.
+func (c *CachingImageClassifier) ModelID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.modelID
+}
+
+// SetModelID switches to a new model version and drops the cached
+// classifications of the previous one.
+func (c *CachingImageClassifier) SetModelID(ctx context.Context, modelID string) error {
+	c.mu.Lock()
+	old := c.modelID
+	c.modelID = modelID
+	c.mu.Unlock()
+	if old == modelID {
+		return nil
+	}
+	return c.Store.Invalidate(ctx, old)
+}
+
+func (c *CachingImageClassifier) ClassifyImage(imageURL string) (string, error) {
+	imageURL = strings.TrimSpace(imageURL)
+	if imageURL == "" {
+		return "", nil
+	}
+	ctx := context.Background()
+	modelID := c.ModelID()
+	key := cache.PredictionKey(modelID, imageURL)
+
+	e, ok, err := c.Store.Get(ctx, key)
+	if err != nil {
+		log.Printf("prediction cache: get failed: %v", err)
+	}
+	if ok {
+		return e.Class, nil
+	}
+
+	class, err := c.Next.ClassifyImage(imageURL)
+	if err != nil || class == "" {
+		return class, err
+	}
+	entry := cache.PredictionEntry{ModelID: modelID, Class: class, CreatedAt: time.Now()}
+	if err := c.Store.Set(ctx, key, entry, c.TTL); err != nil {
+		log.Printf("prediction cache: set failed: %v", err)
+	}
+	return class, nil
+}
+
+// SyncModelVersion records modelID as the current model for kind in store and,
+// if a different model was recorded before (e.g. by the previous deployment),
+// invalidates that model's cached predictions.
+func SyncModelVersion(ctx context.Context, store cache.PredictionStore, kind, modelID string) error {
+	key := cache.PredictionKey("model-version", kind)
+	prev, ok, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if ok && prev.ModelID == modelID {
+		return nil
+	}
+	if ok {
+		log.Printf("prediction cache: %s model changed from %q to %q, invalidating", kind, prev.ModelID, modelID)
+		if err := store.Invalidate(ctx, prev.ModelID); err != nil {
+			return err
+		}
+	}
+	return store.Set(ctx, key, cache.PredictionEntry{ModelID: modelID, CreatedAt: time.Now()}, 0)
+}
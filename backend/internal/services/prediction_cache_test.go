@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/cache"
+	"testing"
+	"time"
+)
+
+func TestCachingPredictorHitsAndInvalidation(t *testing.T) {
+	ctx := context.Background()
+	next := &fakePredictor{pred: Prediction{Urgency: 3, Score: 0.9, Source: SourceML}}
+	store := cache.NewLRUPredictionStore(100)
+	c := NewCachingPredictor(next, store, "urgency:v1", time.Hour)
+
+	for _, text := range []string{"Sewage overflow", "sewage   OVERFLOW"} {
+		pred, err := c.PredictUrgency(text)
+		if err != nil || pred.Urgency != 3 || pred.Source != SourceML {
+			t.Fatalf("unexpected prediction %+v, %v", pred, err)
+		}
+	}
+	if next.calls != 1 {
+		t.Fatalf("expected the second lookup to hit the cache, model called %d times", next.calls)
+	}
+
+	if err := c.SetModelID(ctx, "urgency:v2"); err != nil {
+		t.Fatalf("SetModelID: %v", err)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("expected v1 entries to be invalidated, %d left", store.Len())
+	}
+	c.PredictUrgency("sewage overflow")
+	if next.calls != 2 {
+		t.Fatalf("expected a new model version to miss the cache, model called %d times", next.calls)
+	}
+}
+
+type fakeClassifier struct {
+	class string
+	calls int
+}
+
+func (f *fakeClassifier) ClassifyImage(string) (string, error) {
+	f.calls++
+	return f.class, nil
+}
+
+func TestCachingImageClassifierSkipsEmptyResults(t *testing.T) {
+	next := &fakeClassifier{}
+	c := NewCachingImageClassifier(next, cache.NewLRUPredictionStore(10), "image:v1", time.Hour)
+
+	c.ClassifyImage("http://example.com/a.jpg")
+	next.class = "pothole"
+	for i := 0; i < 2; i++ {
+		if class, _ := c.ClassifyImage("http://example.com/a.jpg"); class != "pothole" {
+			t.Fatalf("expected pothole, got %q", class)
+		}
+	}
+	if next.calls != 2 {
+		t.Fatalf("expected empty result to be retried and the class cached, got %d calls", next.calls)
+	}
+}
+
+func TestSyncModelVersionInvalidatesPreviousModel(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewLRUPredictionStore(10)
+	if err := SyncModelVersion(ctx, store, "urgency", "urgency:v1"); err != nil {
+		t.Fatal(err)
+	}
+	store.Set(ctx, cache.PredictionKey("urgency:v1", "x"), cache.PredictionEntry{ModelID: "urgency:v1"}, time.Hour)
+
+	// same version: nothing is dropped
+	SyncModelVersion(ctx, store, "urgency", "urgency:v1")
+	if _, ok, _ := store.Get(ctx, cache.PredictionKey("urgency:v1", "x")); !ok {
+		t.Fatal("entry should survive when the version is unchanged")
+	}
+
+	SyncModelVersion(ctx, store, "urgency", "urgency:v2")
+	if _, ok, _ := store.Get(ctx, cache.PredictionKey("urgency:v1", "x")); ok {
+		t.Fatal("entry of the previous version should be invalidated")
+	}
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUnknownRole is returned for role names that do not exist or cannot
+	// be assigned explicitly (citizen is implicit).
+	ErrUnknownRole = errors.New("unknown role")
+	// ErrRoleNotGrantable is returned when the acting user lacks some of the
+	// permissions of the role they try to assign or revoke.
+	ErrRoleNotGrantable = errors.New("role has permissions the acting user does not hold")
+	// ErrLastSuperAdmin is returned when revoking the only super_admin.
+	ErrLastSuperAdmin = errors.New("cannot revoke the last super_admin")
+)
+
+func perms(names ...string) []models.Permission {
+	out := make([]models.Permission, len(names))
+	for i, n := range names {
+		out[i] = models.Permission{Name: n}
+	}
+	return out
+}
+
+// DefaultRoles are the built-in roles, stored by RoleService.SeedDefaults on
+// startup. Citizens hold no extra permissions; reporting, commenting and
+// upvoting only require being signed in.
+var DefaultRoles = []models.Role{
+	{Name: models.RoleCitizen, Rank: 0, Description: "Signed-in resident"},
+	{Name: models.RoleModerator, Rank: 10, Description: "Reviews and triages reports",
+		Permissions: perms(models.PermIssuesView, models.PermPostsUpdateStatus)},
+	{Name: models.RoleDepartmentStaff, Rank: 20, Description: "City department working on reports",
+		Permissions: perms(models.PermIssuesView, models.PermPostsUpdateStatus)},
+	{Name: models.RoleAdmin, Rank: 30, Description: "Manages scoring and staff roles",
+		Permissions: perms(models.PermIssuesView, models.PermPostsUpdateStatus, models.PermScoringManage, models.PermUsersManageRoles)},
+	{Name: models.RoleSuperAdmin, Rank: 40, Description: "Manages admins",
+		Permissions: perms(models.PermIssuesView, models.PermPostsUpdateStatus, models.PermScoringManage, models.PermUsersManageRoles, models.PermUsersManageAdmins)},
+}
+
+// Grants are the roles and permissions a user's tokens carry. Role is the
+// most privileged of Roles.
+type Grants struct {
+	Role        string   `json:"role"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleService resolves and assigns user roles. BootstrapRoles maps lower-cased
+// emails to a role that user is given when their grants are next resolved,
+// which is how the first admins are created (ADMIN_EMAILS, SUPER_ADMIN_EMAILS).
+type RoleService struct {
+	Repo           *repository.RoleRepository
+	UserRepo       *repository.UserRepository
+	BootstrapRoles map[string]string
+}
+
+func NewRoleService(repo *repository.RoleRepository, userRepo *repository.UserRepository) *RoleService {
+	return &RoleService{Repo: repo, UserRepo: userRepo, BootstrapRoles: map[string]string{}}
+}
+
+// SeedDefaults stores DefaultRoles.
+func (s *RoleService) SeedDefaults() error {
+	return s.Repo.EnsureRoles(DefaultRoles)
+}
+
+// Bootstrap gives every email in emails the named role on its next sign-in.
+func (s *RoleService) Bootstrap(emails []string, role string) {
+	for _, e := range emails {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+			s.BootstrapRoles[e] = role
+		}
+	}
+}
+
+// GrantsFor returns the roles and permissions of user, first assigning a
+// bootstrap role configured for their email. Bootstrap roles need a verified
+// email: anyone can register with an admin's address before the admin does.
+func (s *RoleService) GrantsFor(user *models.User) (Grants, error) {
+	if name, ok := s.BootstrapRoles[strings.ToLower(user.Email)]; ok && user.EmailVerifiedAt != nil {
+		role, err := s.Repo.GetRoleByName(name)
+		if err != nil {
+			return Grants{}, err
+		}
+		added, err := s.Repo.AssignRole(user.ID, role.ID, nil)
+		if err != nil {
+			return Grants{}, err
+		}
+		if added {
+			log.Printf("roles: granted %s to %s from configuration", name, user.Email)
+		}
+	}
+	return s.UserGrants(user.ID)
+}
+
+// UserGrants returns the roles and permissions assigned to a user.
+func (s *RoleService) UserGrants(userID uuid.UUID) (Grants, error) {
+	roles, err := s.Repo.UserRoles(userID)
+	if err != nil {
+		return Grants{}, err
+	}
+	return grantsOf(roles), nil
+}
+
+// GetUserGrants is UserGrants for an API caller: it returns
+// gorm.ErrRecordNotFound if the user does not exist.
+func (s *RoleService) GetUserGrants(userID uuid.UUID) (Grants, error) {
+	if _, err := s.UserRepo.GetByID(userID); err != nil {
+		return Grants{}, err
+	}
+	return s.UserGrants(userID)
+}
+
+func grantsOf(roles []models.Role) Grants {
+	g := Grants{Role: models.RoleCitizen, Roles: []string{}, Permissions: []string{}}
+	best := -1
+	held := map[string]bool{}
+	seen := map[string]bool{}
+	for _, r := range roles {
+		if r.Rank > best {
+			best, g.Role = r.Rank, r.Name
+		}
+		g.Roles = append(g.Roles, r.Name)
+		held[r.Name] = true
+		for _, p := range r.Permissions {
+			if !seen[p.Name] {
+				seen[p.Name] = true
+				g.Permissions = append(g.Permissions, p.Name)
+			}
+		}
+	}
+	if !held[models.RoleCitizen] {
+		g.Roles = append(g.Roles, models.RoleCitizen)
+	}
+	sort.Strings(g.Permissions)
+	return g
+}
+
+// SyncExternalRoles makes the roles a user holds from an identity provider
+// (source) exactly the named ones, so removing someone from a group at the
+// provider takes the role away on their next sign-in. Unknown names and
+// citizen are skipped.
+func (s *RoleService) SyncExternalRoles(userID uuid.UUID, source string, names []string) error {
+	ids := make([]uuid.UUID, 0, len(names))
+	for _, name := range names {
+		if name == models.RoleCitizen {
+			continue
+		}
+		role, err := s.Repo.GetRoleByName(name)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("roles: %s maps to unknown role %q", source, name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		ids = append(ids, role.ID)
+	}
+	return s.Repo.SyncRoles(userID, source, ids)
+}
+
+// ListRoles returns all roles with their permissions.
+func (s *RoleService) ListRoles() ([]models.Role, error) {
+	return s.Repo.ListRoles()
+}
+
+// Assign gives userID the named role on behalf of an actor holding
+// actorPerms, who must hold every permission of the role. It reports whether
+// the user did not hold the role already.
+func (s *RoleService) Assign(actorID uuid.UUID, actorPerms []string, userID uuid.UUID, roleName string) (bool, error) {
+	role, err := s.grantableRole(actorPerms, roleName)
+	if err != nil {
+		return false, err
+	}
+	if _, err := s.UserRepo.GetByID(userID); err != nil {
+		return false, err
+	}
+	var grantedBy *uuid.UUID
+	if actorID != uuid.Nil {
+		grantedBy = &actorID
+	}
+	return s.Repo.AssignRole(userID, role.ID, grantedBy)
+}
+
+// Revoke takes the named role from userID, with the same permission rule as
+// Assign. The last super_admin cannot be revoked.
+func (s *RoleService) Revoke(actorPerms []string, userID uuid.UUID, roleName string) error {
+	role, err := s.grantableRole(actorPerms, roleName)
+	if err != nil {
+		return err
+	}
+	if role.Name == models.RoleSuperAdmin {
+		held, err := s.Repo.UserRoles(userID)
+		if err != nil {
+			return err
+		}
+		if !hasRole(held, role.Name) {
+			return gorm.ErrRecordNotFound
+		}
+		n, err := s.Repo.CountRoleHolders(role.ID)
+		if err != nil {
+			return err
+		}
+		if n <= 1 {
+			return ErrLastSuperAdmin
+		}
+	}
+	return s.Repo.RevokeRole(userID, role.ID)
+}
+
+func (s *RoleService) grantableRole(actorPerms []string, roleName string) (*models.Role, error) {
+	if roleName == models.RoleCitizen {
+		return nil, ErrUnknownRole
+	}
+	role, err := s.Repo.GetRoleByName(roleName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownRole
+	}
+	if err != nil {
+		return nil, err
+	}
+	held := map[string]bool{}
+	for _, p := range actorPerms {
+		held[p] = true
+	}
+	for _, p := range role.Permissions {
+		if !held[p.Name] {
+			return nil, ErrRoleNotGrantable
+		}
+	}
+	return role, nil
+}
+
+func hasRole(roles []models.Role, name string) bool {
+	for _, r := range roles {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
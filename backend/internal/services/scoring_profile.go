@@ -0,0 +1,630 @@
+package services
+
+import (
+	"context"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ScoringProfile holds the tunable parts of urgency scoring: keyword weights
+// used by CalculateCommentUrgency, the heuristicScore term lists and scores,
+// and the weights of the feed and post/comment blends.
+type ScoringProfile struct {
+	// Keywords maps an English keyword to its urgency weight (0..3 scale)
+	Keywords map[string]float64 `json:"keywords"`
+	// Lexicons holds keyword weights for other languages, keyed by the tags
+	// DetectLanguage returns (LangHindi, LangHinglish). They are used in
+	// addition to Keywords for text in that language. A nil map means the
+	// built-in lexicons.
+	Lexicons map[string]map[string]float64 `json:"lexicons"`
+	// PartialMatchFactor scales the weight of prefix matches
+	PartialMatchFactor float64 `json:"partial_match_factor"`
+
+	// Context rules of CalculateCommentUrgency. Phrases are multi-word
+	// keywords; Intensifiers multiply the next keyword's weight; keywords
+	// within NegationWindow words of a negation count as NegatedWeight; and a
+	// resolution term ("fixed", "cleared") scales the score by
+	// ResolutionFactor. Nil lists and maps mean the built-in defaults.
+	Phrases          map[string]float64 `json:"phrases"`
+	Intensifiers     map[string]float64 `json:"intensifiers"`
+	Negations        []string           `json:"negations"`
+	NegationWindow   int                `json:"negation_window"`
+	NegatedWeight    float64            `json:"negated_weight"`
+	ResolutionTerms  []string           `json:"resolution_terms"`
+	ResolutionFactor float64            `json:"resolution_factor"`
+
+	// heuristicScore: texts containing a critical term score CriticalScore,
+	// otherwise a moderate term ModerateScore, otherwise DefaultScore
+	CriticalTerms []string `json:"critical_terms"`
+	ModerateTerms []string `json:"moderate_terms"`
+	CriticalScore float64  `json:"critical_score"`
+	ModerateScore float64  `json:"moderate_score"`
+	DefaultScore  float64  `json:"default_score"`
+
+	// Feed score = FeedTextWeight*text score + FeedUpvoteWeight*upvote presence
+	FeedTextWeight   float64 `json:"feed_text_weight"`
+	FeedUpvoteWeight float64 `json:"feed_upvote_weight"`
+
+	// Aggregate urgency = PostWeight*post urgency + CommentWeight*comment average
+	PostWeight    float64 `json:"post_weight"`
+	CommentWeight float64 `json:"comment_weight"`
+}
+
+// DefaultScoringProfile returns the built-in profile, used until an admin
+// activates one.
+func DefaultScoringProfile() ScoringProfile {
+	return ScoringProfile{
+		Keywords: map[string]float64{
+			// Critical indicators (3.0x)
+			"dangerous": 3.0,
+			"critical":  3.0,
+			"emergency": 3.0,
+			"severe":    3.0,
+			"urgent":    3.0,
+			"fatal":     3.0,
+			"death":     3.0,
+			"dying":     3.0,
+			"collapsed": 3.0,
+			"collapse":  3.0,
+			"broken":    2.5,
+			"destroyed": 2.5,
+			"accident":  2.5,
+			"injury":    2.5,
+			"injured":   2.5,
+			"bleeding":  3.0,
+			"fire":      3.0,
+			"explod":    3.0,
+			"hazard":    2.5,
+			"gas":       2.5,
+
+			// Moderate indicators (1.5x - 2.4x)
+			"concern":  1.8,
+			"serious":  2.0,
+			"problem":  1.5,
+			"issue":    1.2,
+			"needs":    1.5,
+			"needed":   1.5,
+			"repair":   1.8,
+			"damage":   2.0,
+			"damaged":  2.0,
+			"flood":    2.2,
+			"flooding": 2.2,
+			"waterlog": 2.2,
+			"crack":    1.6,
+			"hole":     1.5,
+			"pothole":  1.8,
+			"danger":   2.3,
+			"risk":     2.0,
+			"unsafe":   2.2,
+			"sick":     2.0,
+			"illness":  2.0,
+			"disease":  2.0,
+			"spread":   2.0,
+
+			// Low indicators (0.5x - 1.4x)
+			"minor":    0.8,
+			"small":    0.7,
+			"slight":   0.7,
+			"bit":      0.6,
+			"little":   0.6,
+			"could":    0.9,
+			"might":    0.9,
+			"possible": 0.9,
+			"maybe":    0.8,
+			"suggests": 1.0,
+			"seems":    0.9,
+		},
+		Lexicons:           defaultLexicons(),
+		PartialMatchFactor: 0.8,
+		Phrases:            defaultPhrases(),
+		Intensifiers:       defaultIntensifiers(),
+		Negations:          defaultNegations(),
+		NegationWindow:     3,
+		NegatedWeight:      0.5,
+		ResolutionTerms:    defaultResolutionTerms(),
+		ResolutionFactor:   0.4,
+		CriticalTerms: []string{
+			"emergency", "danger", "fire", "explosion", "injury", "critical", "urgent",
+			"आग", "खतर", "आपात", "दुर्घटना", "घायल", "khatra", "khatarnak", "durghatna", "ghayal",
+		},
+		ModerateTerms: []string{
+			"broken", "delay", "blocked", "leak", "issue", "problem", "trash",
+			"टूट", "गड्ढ", "कचरा", "रिसाव", "समस्या", "toota", "gaddha", "kachra", "samasya",
+		},
+		CriticalScore:    0.85,
+		ModerateScore:    0.6,
+		DefaultScore:     0.3,
+		FeedTextWeight:   0.8,
+		FeedUpvoteWeight: 0.2,
+		PostWeight:       0.5,
+		CommentWeight:    0.5,
+	}
+}
+
+// defaultLexicons returns the built-in Hindi and Hinglish keyword weights, on
+// the same scale as the English keywords. Hindi inflects by suffix, so stems
+// such as "खतर" also match "खतरनाक" as partial matches.
+func defaultLexicons() map[string]map[string]float64 {
+	return map[string]map[string]float64{
+		LangHindi: {
+			// Critical
+			"खतरा":     3.0,
+			"खतरनाक":   3.0,
+			"आपातकाल":  3.0,
+			"तुरंत":    3.0,
+			"आग":       3.0,
+			"मौत":      3.0,
+			"खून":      3.0,
+			"दुर्घटना": 2.5,
+			"घायल":     2.5,
+			"गिर":      2.5,
+			"टूटा":     2.5,
+			"टूटी":     2.5,
+			// Moderate
+			"गंभीर":   2.0,
+			"जल्दी":   2.0,
+			"बाढ़":    2.2,
+			"जलभराव":  2.2,
+			"नुकसान":  2.0,
+			"बीमारी":  2.0,
+			"गड्ढा":   1.8,
+			"गड्ढे":   1.8,
+			"मरम्मत":  1.8,
+			"समस्या":  1.5,
+			"परेशानी": 1.5,
+			// Low
+			"थोड़ा": 0.6,
+			"छोटा":  0.7,
+			"शायद":  0.8,
+		},
+		LangHinglish: {
+			// Critical
+			"khatra":     3.0,
+			"khatarnak":  3.0,
+			"khatarnaak": 3.0,
+			"turant":     3.0,
+			"aag":        3.0,
+			"maut":       3.0,
+			"khoon":      3.0,
+			"durghatna":  2.5,
+			"ghayal":     2.5,
+			"toota":      2.5,
+			"tuta":       2.5,
+			"tooti":      2.5,
+			"tuti":       2.5,
+			// Moderate
+			"gambhir":   2.0,
+			"jaldi":     2.0,
+			"baadh":     2.2,
+			"nuksan":    2.0,
+			"nuksaan":   2.0,
+			"bimari":    2.0,
+			"gaddha":    1.8,
+			"gadda":     1.8,
+			"gaddhe":    1.8,
+			"samasya":   1.5,
+			"dikkat":    1.5,
+			"pareshani": 1.5,
+			// Low
+			"thoda":  0.6,
+			"chhota": 0.7,
+			"shayad": 0.8,
+		},
+	}
+}
+
+// ErrInvalidProfile wraps every validation failure of a scoring profile.
+var ErrInvalidProfile = errors.New("invalid scoring profile")
+
+// Validate checks that the profile can be used for scoring.
+func (p ScoringProfile) Validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidProfile, fmt.Sprintf(format, args...))
+	}
+	if len(p.Keywords) == 0 {
+		return invalid("at least one keyword is required")
+	}
+	lexicons := map[string]map[string]float64{LangEnglish: p.Keywords}
+	for lang, lex := range p.Lexicons {
+		if lang != LangHindi && lang != LangHinglish {
+			return invalid("unsupported lexicon language %q", lang)
+		}
+		lexicons[lang] = lex
+	}
+	for _, lex := range lexicons {
+		for k, w := range lex {
+			if k == "" || k != strings.ToLower(strings.TrimSpace(k)) {
+				return invalid("keyword %q must be lower case without surrounding spaces", k)
+			}
+			if w <= 0 || w > 3 || math.IsNaN(w) {
+				return invalid("weight of %q must be in (0, 3]", k)
+			}
+		}
+	}
+	if p.PartialMatchFactor < 0 || p.PartialMatchFactor > 1 {
+		return invalid("partial_match_factor must be in [0, 1]")
+	}
+	for k, w := range p.Phrases {
+		if len(Tokenize(k)) < 2 || k != strings.ToLower(strings.TrimSpace(k)) {
+			return invalid("phrase %q must be lower case and have at least two words", k)
+		}
+		if w <= 0 || w > 3 || math.IsNaN(w) {
+			return invalid("weight of %q must be in (0, 3]", k)
+		}
+	}
+	for k, f := range p.Intensifiers {
+		if len(Tokenize(k)) != 1 || k != strings.ToLower(k) {
+			return invalid("intensifier %q must be a single lower case word", k)
+		}
+		if f < 1 || f > 2 || math.IsNaN(f) {
+			return invalid("factor of intensifier %q must be in [1, 2]", k)
+		}
+	}
+	if p.NegationWindow < 0 || p.NegationWindow > 10 {
+		return invalid("negation_window must be in [0, 10]")
+	}
+	if p.NegatedWeight <= 0 || p.NegatedWeight > 3 {
+		return invalid("negated_weight must be in (0, 3]")
+	}
+	if p.ResolutionFactor <= 0 || p.ResolutionFactor > 1 {
+		return invalid("resolution_factor must be in (0, 1]")
+	}
+	for _, list := range [][]string{p.CriticalTerms, p.ModerateTerms, p.Negations, p.ResolutionTerms} {
+		for _, t := range list {
+			if strings.TrimSpace(t) == "" || t != strings.ToLower(t) {
+				return invalid("term %q must be non-empty and lower case", t)
+			}
+		}
+	}
+	for name, v := range map[string]float64{"critical_score": p.CriticalScore, "moderate_score": p.ModerateScore, "default_score": p.DefaultScore} {
+		if v < 0 || v > 1 {
+			return invalid("%s must be in [0, 1]", name)
+		}
+	}
+	if !(p.CriticalScore >= p.ModerateScore && p.ModerateScore >= p.DefaultScore) {
+		return invalid("critical_score >= moderate_score >= default_score is required")
+	}
+	if p.FeedTextWeight < 0 || p.FeedUpvoteWeight < 0 || math.Abs(p.FeedTextWeight+p.FeedUpvoteWeight-1) > 1e-9 {
+		return invalid("feed_text_weight and feed_upvote_weight must be non-negative and sum to 1")
+	}
+	if p.PostWeight < 0 || p.CommentWeight < 0 || math.Abs(p.PostWeight+p.CommentWeight-1) > 1e-9 {
+		return invalid("post_weight and comment_weight must be non-negative and sum to 1")
+	}
+	return nil
+}
+
+// activeProfile is the profile used by all scoring functions. It is replaced
+// as a whole, so readers always see a consistent profile.
+var activeProfile atomic.Pointer[ActiveProfile]
+
+// ActiveProfile is the scoring profile in use and the stored version it came
+// from (0 for the built-in default).
+type ActiveProfile struct {
+	Version int            `json:"version"`
+	Profile ScoringProfile `json:"profile"`
+
+	// lexicons and terms are Profile's keywords and heuristic terms passed
+	// through NormalizeUnicode, so they match tokens however they were typed
+	lexicons      map[string]map[string]float64
+	criticalTerms []string
+	moderateTerms []string
+
+	// compiled context rules of CalculateCommentUrgency
+	phrases      []phrasePattern
+	resolutions  []phrasePattern
+	intensifiers map[string]float64
+	negations    map[string]bool
+}
+
+func init() {
+	SetActiveScoringProfile(0, DefaultScoringProfile())
+}
+
+// lexicon returns the normalized keyword weights for lang, or nil.
+func (a *ActiveProfile) lexicon(lang string) map[string]float64 {
+	return a.lexicons[lang]
+}
+
+func normalizeTerms(terms []string) []string {
+	out := make([]string, len(terms))
+	for i, t := range terms {
+		out[i] = NormalizeUnicode(t)
+	}
+	return out
+}
+
+// ActiveScoringProfile returns the profile currently used for scoring. The
+// returned value must not be modified.
+func ActiveScoringProfile() *ActiveProfile {
+	return activeProfile.Load()
+}
+
+// SetActiveScoringProfile switches scoring to p.
+func SetActiveScoringProfile(version int, p ScoringProfile) {
+	a := &ActiveProfile{
+		Version:       version,
+		Profile:       p,
+		lexicons:      map[string]map[string]float64{LangEnglish: p.Keywords},
+		criticalTerms: normalizeTerms(p.CriticalTerms),
+		moderateTerms: normalizeTerms(p.ModerateTerms),
+	}
+	phrases, intensifiers := p.Phrases, p.Intensifiers
+	if phrases == nil {
+		phrases = defaultPhrases()
+	}
+	if intensifiers == nil {
+		intensifiers = defaultIntensifiers()
+	}
+	negations, resolutions := p.Negations, p.ResolutionTerms
+	if negations == nil {
+		negations = defaultNegations()
+	}
+	if resolutions == nil {
+		resolutions = defaultResolutionTerms()
+	}
+	a.phrases = compilePhrases(phrases)
+	a.intensifiers = normalizeWeights(intensifiers)
+	a.negations = normalizeSet(negations)
+	a.resolutions = compileTerms(resolutions)
+
+	lexicons := p.Lexicons
+	if lexicons == nil {
+		lexicons = defaultLexicons()
+	}
+	for lang, lex := range lexicons {
+		a.lexicons[lang] = normalizeWeights(lex)
+	}
+	activeProfile.Store(a)
+}
+
+// ScoringProfileService stores versioned scoring profiles and keeps the
+// active one loaded.
+type ScoringProfileService struct {
+	Repo *repository.ScoringProfileRepository
+
+	// patchMu serializes Patch so two patches in this process never merge
+	// onto the same base; CreateVersionOver catches other instances.
+	patchMu sync.Mutex
+}
+
+func NewScoringProfileService(repo *repository.ScoringProfileRepository) *ScoringProfileService {
+	return &ScoringProfileService{Repo: repo}
+}
+
+// ScoringProfileVersion is a stored profile with its metadata.
+type ScoringProfileVersion struct {
+	Version   int             `json:"version"`
+	Active    bool            `json:"active"`
+	Notes     string          `json:"notes,omitempty"`
+	CreatedBy uuid.UUID       `json:"created_by"`
+	CreatedAt time.Time       `json:"created_at"`
+	Profile   *ScoringProfile `json:"profile,omitempty"`
+}
+
+// UnmarshalScoringProfile decodes a profile. Settings missing from data, e.g.
+// in versions stored before the setting existed, keep their default values.
+// Maps start out nil rather than default, since decoding merges into a map.
+func UnmarshalScoringProfile(data []byte) (ScoringProfile, error) {
+	p := DefaultScoringProfile()
+	p.Keywords, p.Lexicons, p.Phrases, p.Intensifiers = nil, nil, nil, nil
+	err := json.Unmarshal(data, &p)
+	return p, err
+}
+
+func toProfileVersion(row models.ScoringProfileVersion, withProfile bool) (*ScoringProfileVersion, error) {
+	v := &ScoringProfileVersion{
+		Version:   row.Version,
+		Active:    row.Active,
+		Notes:     row.Notes,
+		CreatedBy: row.CreatedBy,
+		CreatedAt: row.CreatedAt,
+	}
+	if withProfile {
+		p, err := UnmarshalScoringProfile([]byte(row.Profile))
+		if err != nil {
+			return nil, err
+		}
+		v.Profile = &p
+	}
+	return v, nil
+}
+
+// Reload loads the active stored profile into the scoring functions, falling
+// back to the built-in default when none is stored.
+func (s *ScoringProfileService) Reload() error {
+	row, err := s.Repo.GetActive()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if ActiveScoringProfile().Version != 0 {
+			SetActiveScoringProfile(0, DefaultScoringProfile())
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if row.Version == ActiveScoringProfile().Version {
+		return nil
+	}
+	v, err := toProfileVersion(*row, true)
+	if err != nil {
+		return err
+	}
+	if err := v.Profile.Validate(); err != nil {
+		return err
+	}
+	SetActiveScoringProfile(v.Version, *v.Profile)
+	log.Printf("scoring: loaded profile version %d", v.Version)
+	return nil
+}
+
+// Watch reloads the active profile every interval until ctx is cancelled, so
+// changes made through another instance are picked up.
+func (s *ScoringProfileService) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				log.Printf("scoring: reload failed: %v", err)
+			}
+		}
+	}
+}
+
+// Create validates and stores p as a new version, activating it if requested.
+func (s *ScoringProfileService) Create(p ScoringProfile, notes string, createdBy uuid.UUID, activate bool) (*ScoringProfileVersion, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	row, err := s.Repo.CreateVersion(b, notes, createdBy, activate)
+	if err != nil {
+		return nil, err
+	}
+	if activate {
+		SetActiveScoringProfile(row.Version, p)
+	}
+	return toProfileVersion(*row, true)
+}
+
+// ScoringProfilePatch changes part of the active profile. Profile holds the
+// fields to overwrite as raw JSON; keywords in it are added or re-weighted, a
+// lexicon given in it replaces that language's lexicon, and RemoveKeywords are
+// dropped from the keywords, phrases and every lexicon.
+type ScoringProfilePatch struct {
+	Profile        json.RawMessage `json:"profile"`
+	RemoveKeywords []string        `json:"remove_keywords"`
+	Notes          string          `json:"notes"`
+}
+
+// Patch applies patch to the active profile and stores and activates the
+// result as a new version. The stored active profile is reloaded first, and
+// if another version is activated before the result is saved Patch fails with
+// repository.ErrProfileVersionChanged instead of overwriting that change.
+func (s *ScoringProfileService) Patch(patch ScoringProfilePatch, createdBy uuid.UUID) (*ScoringProfileVersion, error) {
+	s.patchMu.Lock()
+	defer s.patchMu.Unlock()
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	active := ActiveScoringProfile()
+	current := active.Profile
+	next := current
+	// decoding merges into maps, so the active profile's maps are copied first
+	next.Keywords = copyWeights(current.Keywords, nil)
+	next.Phrases = copyWeights(current.Phrases, defaultPhrases)
+	next.Intensifiers = copyWeights(current.Intensifiers, defaultIntensifiers)
+	lexicons := current.Lexicons
+	if lexicons == nil {
+		lexicons = defaultLexicons()
+	}
+	next.Lexicons = make(map[string]map[string]float64, len(lexicons))
+	for lang, lex := range lexicons {
+		next.Lexicons[lang] = lex
+	}
+	if len(patch.Profile) > 0 {
+		if err := json.Unmarshal(patch.Profile, &next); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+	}
+	for _, k := range patch.RemoveKeywords {
+		delete(next.Keywords, k)
+		delete(next.Phrases, k)
+		for lang, lex := range next.Lexicons {
+			if _, ok := lex[k]; !ok {
+				continue
+			}
+			pruned := copyWeights(lex, nil)
+			delete(pruned, k)
+			next.Lexicons[lang] = pruned
+		}
+	}
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(next)
+	if err != nil {
+		return nil, err
+	}
+	row, err := s.Repo.CreateVersionOver(active.Version, b, patch.Notes, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	SetActiveScoringProfile(row.Version, next)
+	return toProfileVersion(*row, true)
+}
+
+// copyWeights copies m, or the defaults when m is nil and defaults is set.
+func copyWeights(m map[string]float64, defaults func() map[string]float64) map[string]float64 {
+	if m == nil && defaults != nil {
+		return defaults()
+	}
+	out := make(map[string]float64, len(m))
+	for k, w := range m {
+		out[k] = w
+	}
+	return out
+}
+
+// List returns all stored versions, newest first, without their profiles.
+func (s *ScoringProfileService) List() ([]ScoringProfileVersion, error) {
+	rows, err := s.Repo.ListVersions()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ScoringProfileVersion, 0, len(rows))
+	for _, row := range rows {
+		v, _ := toProfileVersion(row, false)
+		out = append(out, *v)
+	}
+	return out, nil
+}
+
+// Get returns one stored version with its profile.
+func (s *ScoringProfileService) Get(version int) (*ScoringProfileVersion, error) {
+	row, err := s.Repo.GetVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	return toProfileVersion(*row, true)
+}
+
+// Activate makes a stored version the active profile, e.g. to roll back.
+func (s *ScoringProfileService) Activate(version int) (*ScoringProfileVersion, error) {
+	v, err := s.Get(version)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Profile.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.Repo.ActivateVersion(version); err != nil {
+		return nil, err
+	}
+	SetActiveScoringProfile(version, *v.Profile)
+	v.Active = true
+	return v, nil
+}
+
+// Delete removes an inactive version.
+func (s *ScoringProfileService) Delete(version int) error {
+	return s.Repo.DeleteVersion(version)
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDefaultScoringProfileIsValid(t *testing.T) {
+	if err := DefaultScoringProfile().Validate(); err != nil {
+		t.Fatalf("default profile invalid: %v", err)
+	}
+}
+
+func TestScoringProfileValidate(t *testing.T) {
+	cases := map[string]func(p *ScoringProfile){
+		"no keywords":          func(p *ScoringProfile) { p.Keywords = nil },
+		"weight too high":      func(p *ScoringProfile) { p.Keywords["fire"] = 4 },
+		"zero weight":          func(p *ScoringProfile) { p.Keywords["fire"] = 0 },
+		"upper case keyword":   func(p *ScoringProfile) { p.Keywords["Fire"] = 2 },
+		"partial factor":       func(p *ScoringProfile) { p.PartialMatchFactor = 1.5 },
+		"empty term":           func(p *ScoringProfile) { p.CriticalTerms = append(p.CriticalTerms, " ") },
+		"scores out of order":  func(p *ScoringProfile) { p.ModerateScore = 0.9 },
+		"feed weights sum":     func(p *ScoringProfile) { p.FeedUpvoteWeight = 0.3 },
+		"negative post weight": func(p *ScoringProfile) { p.PostWeight, p.CommentWeight = -0.5, 1.5 },
+		"single word phrase":   func(p *ScoringProfile) { p.Phrases = map[string]float64{"leak": 2} },
+		"weak intensifier":     func(p *ScoringProfile) { p.Intensifiers = map[string]float64{"very": 0.5} },
+		"zero resolution":      func(p *ScoringProfile) { p.ResolutionFactor = 0 },
+		"negation window":      func(p *ScoringProfile) { p.NegationWindow = 20 },
+	}
+	for name, mutate := range cases {
+		p := DefaultScoringProfile()
+		mutate(&p)
+		if err := p.Validate(); !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("%s: expected ErrInvalidProfile, got %v", name, err)
+		}
+	}
+}
+
+func TestActiveScoringProfileDrivesHeuristic(t *testing.T) {
+	defer SetActiveScoringProfile(0, DefaultScoringProfile())
+
+	p := DefaultScoringProfile()
+	p.ModerateTerms = append(p.ModerateTerms, "graffiti")
+	p.ModerateScore = 0.7
+	SetActiveScoringProfile(3, p)
+
+	if score, term := explainHeuristic("Graffiti on the wall"); score != 0.7 || term != "graffiti" {
+		t.Errorf("expected 0.7 via graffiti, got %v %q", score, term)
+	}
+	if got := heuristicScore("nice park"); got != p.DefaultScore {
+		t.Errorf("expected default score %v, got %v", p.DefaultScore, got)
+	}
+}
+
+func TestUnmarshalScoringProfileKeepsNewDefaults(t *testing.T) {
+	// a version stored before the context rules existed
+	old, _ := json.Marshal(map[string]interface{}{
+		"keywords":           map[string]float64{"fire": 3},
+		"critical_terms":     []string{"fire"},
+		"critical_score":     0.9,
+		"moderate_score":     0.6,
+		"default_score":      0.3,
+		"feed_text_weight":   0.8,
+		"feed_upvote_weight": 0.2,
+		"post_weight":        0.5,
+		"comment_weight":     0.5,
+	})
+	p, err := UnmarshalScoringProfile(old)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("old profile no longer valid: %v", err)
+	}
+	if len(p.Keywords) != 1 || p.NegationWindow != 3 || p.ResolutionFactor != 0.4 || p.Phrases != nil {
+		t.Errorf("unexpected decoded profile: keywords %v, window %d, factor %v", p.Keywords, p.NegationWindow, p.ResolutionFactor)
+	}
+}
@@ -2,57 +2,99 @@ package services
 
 import (
 	config "crowdsourcedurbanissuereportingwithai/backend/configs"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/geo"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
 	"crowdsourcedurbanissuereportingwithai/backend/models"
 	"sort"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type FeedService struct {
-	PostRepo *repository.PostRepository
+	PostRepo  *repository.PostRepository
+	Predictor UrgencyPredictor
+	// UserRepo holds saved places for the personalized feed; without it
+	// GetPersonalFeed falls back to the global ranking
+	UserRepo *repository.UserRepository
+	// Rankings serves score-ranked feeds from post_rankings, kept up to date
+	// by a FeedRanker, instead of scoring posts per request
+	Rankings bool
 }
 
-func NewFeedService(postRepo *repository.PostRepository) *FeedService {
-	return &FeedService{PostRepo: postRepo}
+// NewFeedService creates a FeedService. predictor is used by the "ml" feed
+// scoring mode; nil means the local heuristic.
+func NewFeedService(postRepo *repository.PostRepository, predictor UrgencyPredictor) *FeedService {
+	if predictor == nil {
+		predictor = HeuristicPredictor{}
+	}
+	return &FeedService{PostRepo: postRepo, Predictor: predictor}
 }
 
 type ReportService struct {
-	PostRepo *repository.PostRepository
+	PostRepo   *repository.PostRepository
+	Predictor  UrgencyPredictor
+	Classifier ImageClassifier
+	// AsyncEnrichment saves reports right away and queues urgency prediction
+	// and image classification for the EnrichmentWorker instead of calling
+	// the models during the request.
+	AsyncEnrichment bool
+	// Ranker, if set, is notified of every change that affects a post's
+	// feed ranking
+	Ranker *FeedRanker
 }
 
-func NewReportService(postRepo *repository.PostRepository) *ReportService {
-	return &ReportService{PostRepo: postRepo}
+// NewReportService creates a ReportService. A nil predictor means the local
+// heuristic and a nil classifier disables image classification.
+func NewReportService(postRepo *repository.PostRepository, predictor UrgencyPredictor, classifier ImageClassifier) *ReportService {
+	if predictor == nil {
+		predictor = HeuristicPredictor{}
+	}
+	if classifier == nil {
+		classifier = NoopImageClassifier{}
+	}
+	return &ReportService{PostRepo: postRepo, Predictor: predictor, Classifier: classifier}
 }
 
-func (s *ReportService) ReportIssueViaPost(userID, issueName, issueDesc, issueCat, postDesc, status string, urgency int, lat, lng float64, mediaURL string) (*models.Post, error) {
+// ReportIssueViaPost creates a post for the named issue. Unless forceNew is set
+// it first looks for open reports of the same problem nearby: depending on
+// DUPLICATE_MODE it either returns a *DuplicateReportError listing them or
+// attaches the new post to the best matching existing issue. New posts always
+// start as open; moving them along the lifecycle goes through UpdatePostStatus.
+func (s *ReportService) ReportIssueViaPost(userID, issueName, issueDesc, issueCat, postDesc string, urgency int, lat, lng float64, mediaURL string, forceNew bool) (*models.Post, error) {
 	uid, err := uuid.Parse(userID)
 	if err != nil {
 		return nil, err
 	}
+	if s.AsyncEnrichment {
+		return s.reportAndEnqueue(uid, issueName, issueDesc, issueCat, postDesc, urgency, lat, lng, mediaURL, forceNew)
+	}
 	// Predict urgency and score from the description; use this score to initialize incremental scoring
 	var initScore float64 = 0.0
-	if u, sc, err := PredictUrgencyDetailed(postDesc); err == nil {
-		if u != 0 { urgency = u }
-		initScore = sc
+	pred, predErr := s.Predictor.PredictUrgency(postDesc)
+	if predErr == nil {
+		if pred.Urgency != 0 { urgency = pred.Urgency }
+		initScore = pred.Score
 	} else {
-		// heuristics fallback is embedded in PredictUrgencyDetailed; call again to get a score
-		_, sc, _ := PredictUrgencyDetailed(postDesc)
-		initScore = sc
+		log.Printf("warning: urgency prediction failed, using heuristic score: %v", predErr)
+		initScore = heuristicScore(postDesc)
 	}
 
-	// If an image classification API is configured, attempt to classify the image.
-	classifiedAs := ""
-	if classified, err := ClassifyImage(mediaURL); err == nil && classified != "" {
-		classifiedAs = classified
-	} else if err != nil {
-		// non-fatal: log and continue without classification
-		// ClassifyImage logs details; we don't block reporting if classification fails.
+	// Attempt to classify the image; a failure must not block reporting.
+	classifiedAs, err := s.Classifier.ClassifyImage(mediaURL)
+	if err != nil {
+		log.Printf("warning: image classification failed: %v", err)
+		classifiedAs = ""
+	}
+
+	issueName, err = s.checkDuplicates(issueName, issueCat, postDesc, classifiedAs, lat, lng, forceNew)
+	if err != nil {
+		return nil, err
 	}
 
-	post, err := s.PostRepo.ReportIssueViaPost(uid.String(), issueName, issueDesc, issueCat, postDesc, status, urgency, lat, lng, mediaURL, classifiedAs)
+	post, err := s.PostRepo.ReportIssueViaPost(uid.String(), issueName, issueDesc, issueCat, postDesc, models.StatusOpen, urgency, lat, lng, mediaURL, classifiedAs, DetectLanguage(postDesc))
 	if err != nil {
 		return nil, err
 	}
@@ -60,16 +102,92 @@ func (s *ReportService) ReportIssueViaPost(userID, issueName, issueDesc, issueCa
 	if err := s.PostRepo.UpdatePostScoreAdd(post.ID, initScore, 1); err != nil {
 		log.Printf("warning: failed to initialize post score: %v", err)
 	}
+	saveUrgencyExplanation(s.PostRepo, post.ID, ExplainText(postDesc, pred, predErr))
+	s.Ranker.Notify(post.ID)
 	return post, nil
 }
+
+// reportAndEnqueue saves the post with the submitted urgency and queues its
+// ML enrichment. Duplicate detection runs without an image class since the
+// image has not been classified yet.
+func (s *ReportService) reportAndEnqueue(uid uuid.UUID, issueName, issueDesc, issueCat, postDesc string, urgency int, lat, lng float64, mediaURL string, forceNew bool) (*models.Post, error) {
+	issueName, err := s.checkDuplicates(issueName, issueCat, postDesc, "", lat, lng, forceNew)
+	if err != nil {
+		return nil, err
+	}
+	post, err := s.PostRepo.ReportIssueViaPost(uid.String(), issueName, issueDesc, issueCat, postDesc, models.StatusOpen, urgency, lat, lng, mediaURL, "", DetectLanguage(postDesc))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.PostRepo.EnqueueEnrichment(post.ID); err != nil {
+		// the post is saved; score it locally rather than failing the report
+		log.Printf("warning: failed to queue enrichment for post %s: %v", post.ID, err)
+		if err := s.PostRepo.UpdatePostScoreAdd(post.ID, heuristicScore(postDesc), 1); err != nil {
+			log.Printf("warning: failed to initialize post score: %v", err)
+		}
+		s.Ranker.Notify(post.ID)
+		return post, nil
+	}
+	post.EnrichmentStatus = models.EnrichmentPending
+	s.Ranker.Notify(post.ID)
+	return post, nil
+}
+
+// checkDuplicates applies DUPLICATE_MODE unless forceNew is set. It returns
+// the issue name to report under, which in link mode is the best matching
+// existing issue, or a *DuplicateReportError in suggest mode.
+func (s *ReportService) checkDuplicates(issueName, issueCat, postDesc, classifiedAs string, lat, lng float64, forceNew bool) (string, error) {
+	mode := config.GetDuplicateMode()
+	if mode == "off" || forceNew {
+		return issueName, nil
+	}
+	candidates, err := s.FindDuplicateCandidates(issueCat, postDesc, classifiedAs, lat, lng)
+	if err != nil {
+		// non-fatal: duplicate detection must never block reporting
+		log.Printf("warning: duplicate detection failed: %v", err)
+		return issueName, nil
+	}
+	if len(candidates) == 0 {
+		return issueName, nil
+	}
+	if mode == "suggest" {
+		return "", &DuplicateReportError{Candidates: candidates}
+	}
+	// link: reuse the existing issue so both posts are grouped together
+	return candidates[0].IssueName, nil
+}
 func (s *FeedService) GetFeed() ([]models.Post, error) {
+	if s.Rankings {
+		limit := config.GetFeedLimit()
+		if limit <= 0 { limit = 50 }
+		posts, err := s.PostRepo.GetRankedPosts(repository.PostFilter{}, nil, limit)
+		if err != nil || len(posts) > 0 {
+			return posts, err
+		}
+		// nothing ranked yet (first start before the initial sweep): score live
+	}
 	posts, err := s.PostRepo.GetFeedPosts()
 	if err != nil {
 		return nil, err
 	}
+	s.scorePosts(posts)
+
+	// Sort by computed score descending (higher urgency first)
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Score > posts[j].Score })
+	return posts, nil
+}
 
+// scorePosts sets the transient Score and ComputedUrgency of each post
+// according to FEED_SCORING_MODE. It does not reorder the slice.
+func (s *FeedService) scorePosts(posts []models.Post) {
 	// Determine scoring mode
-	mode := config.GetFeedScoringMode() // ml | heuristic | none | incremental
+	mode := config.GetFeedScoringMode() // ml | heuristic | none | incremental | decay
+	profile := &ActiveScoringProfile().Profile
+
+	if mode == "decay" {
+		scoreDecay(posts, DecayRankingFromConfig(), profile)
+		return
+	}
 
 	if mode == "incremental" {
 		// Use persisted incremental average per post and blend with upvote presence
@@ -81,78 +199,85 @@ func (s *FeedService) GetFeed() ([]models.Post, error) {
 			if mlAvg < 0 { mlAvg = 0 }
 			if mlAvg > 1 { mlAvg = 1 }
 			upvotePresence := 0.0
-			if len(p.Upvotes) > 0 { upvotePresence = 1.0 }
-			p.Score = 0.8*mlAvg + 0.2*upvotePresence
+			if p.UpvoteCount > 0 { upvotePresence = 1.0 }
+			p.Score = profile.FeedTextWeight*mlAvg + profile.FeedUpvoteWeight*upvotePresence
 			p.ComputedUrgency = mapScoreToUrgency(mlAvg)
 		}
-		sort.SliceStable(posts, func(i, j int) bool { return posts[i].Score > posts[j].Score })
-		return posts, nil
+		return
 	}
 	// Pre-compute max upvotes for normalization across the feed
 	maxUpvotes := 0
 	for i := range posts {
-		if n := len(posts[i].Upvotes); n > maxUpvotes { maxUpvotes = n }
+		if n := posts[i].UpvoteCount; n > maxUpvotes { maxUpvotes = n }
 	}
 
 	// Enrich each post with computed ml_score based on description and comments, then
-	// blend with normalized upvotes: score = 0.8*ml_score + 0.2*votes_norm
+	// blend with normalized upvotes: score = text_weight*ml_score + upvote_weight*votes_norm
+	// (0.8/0.2 unless the active scoring profile says otherwise)
 	// Put a guardrail on total ML calls to keep the endpoint responsive.
 	const maxMLCalls = 50
-	calls := 0
+	// Sample only the first few comments per post for scoring to avoid long latency
+	const maxComments = 5
+	type feedText struct {
+		post int
+		desc bool
+		text string
+	}
+	var texts []feedText
 	for i := range posts {
 		p := &posts[i]
-		// accumulate ML/heuristic scores for post description and each comment (range: 0..1)
-		var scores []float64
-
-		if p.Description != "" {
-			if calls < maxMLCalls {
-				var urg int
-				var sc float64
-				var err error
-				switch mode {
-				case "ml":
-					urg, sc, err = PredictUrgencyDetailed(p.Description)
-				case "heuristic":
-					sc = heuristicScore(p.Description)
-					urg = mapScoreToUrgency(sc)
-				default: // none
-					sc = mapNumericUrgencyToScore(p.Urgency)
-					urg = p.Urgency
-				}
-				if err == nil {
-					// use computed urgency only for the transient field; don't overwrite DB urgency
-					p.ComputedUrgency = urg
-					scores = append(scores, sc)
-				}
-				calls++
-			}
+		if p.Description != "" && len(texts) < maxMLCalls {
+			texts = append(texts, feedText{post: i, desc: true, text: p.Description})
 		}
-		// Sample only the first few comments per post for scoring to avoid long latency
-		maxComments := 5
 		for idx, c := range p.Comments {
-			if idx >= maxComments || calls >= maxMLCalls {
+			if idx >= maxComments || len(texts) >= maxMLCalls {
 				break
 			}
 			if c.Content == "" {
 				continue
 			}
-			var sc float64
-			var err error
-			switch mode {
-			case "ml":
-				_, sc, err = PredictUrgencyDetailed(c.Content)
-			case "heuristic":
-				sc = heuristicScore(c.Content)
-			default: // none
-				// we don't have comment urgency persisted; skip scoring
-				err = nil
-				sc = -1 // sentinel to skip
+			texts = append(texts, feedText{post: i, text: c.Content})
+		}
+	}
+
+	// score all sampled texts at once so the ML API can be called in a single batch
+	scored := make([]float64, len(texts))
+	ok := make([]bool, len(texts))
+	switch mode {
+	case "ml":
+		batch := make([]string, len(texts))
+		for j, t := range texts {
+			batch[j] = t.text
+		}
+		preds, errs := PredictBatch(s.Predictor, batch, 0)
+		for j := range texts {
+			if errs[j] == nil {
+				scored[j], ok[j] = preds[j].Score, true
 			}
-			if err == nil && sc >= 0 {
-				scores = append(scores, sc)
+		}
+	case "heuristic":
+		for j, t := range texts {
+			scored[j], ok[j] = heuristicScore(t.text), true
+		}
+	default: // none
+		// we don't have comment urgency persisted; only descriptions are scored
+		for j, t := range texts {
+			if t.desc {
+				scored[j], ok[j] = mapNumericUrgencyToScore(posts[t.post].Urgency), true
 			}
-			calls++
 		}
+	}
+	postScores := make([][]float64, len(posts))
+	for j, t := range texts {
+		if ok[j] {
+			postScores[t.post] = append(postScores[t.post], scored[j])
+		}
+	}
+
+	for i := range posts {
+		p := &posts[i]
+		// accumulate ML/heuristic scores for post description and each comment (range: 0..1)
+		scores := postScores[i]
 
 		// average ml score (0..1)
 		var mlAvg float64
@@ -165,22 +290,52 @@ func (s *FeedService) GetFeed() ([]models.Post, error) {
 		}
 		// upvote presence (0 or 1)
 		var upvotePresence float64
-		if len(p.Upvotes) > 0 { upvotePresence = 1.0 } else { upvotePresence = 0.0 }
+		if p.UpvoteCount > 0 { upvotePresence = 1.0 } else { upvotePresence = 0.0 }
 
 		// final blended score per spec (independent of upvote count)
-		blended := 0.8*mlAvg + 0.2*upvotePresence
+		blended := profile.FeedTextWeight*mlAvg + profile.FeedUpvoteWeight*upvotePresence
 		p.Score = blended
 		// computed urgency from mlAvg only (not from votes)
 		p.ComputedUrgency = mapScoreToUrgency(mlAvg)
 	}
+}
 
-	// Sort by computed score descending (higher urgency first)
-	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Score > posts[j].Score })
+// GetPostsInBBox returns the newest posts inside the box for the map view.
+func (s *FeedService) GetPostsInBBox(box geo.BBox, limit int) ([]models.Post, error) {
+	return s.PostRepo.GetPostsInBBox(box, clampMapLimit(limit))
+}
+
+// GetPostsNear returns posts within radiusM meters of the point, nearest first,
+// with DistanceM populated.
+func (s *FeedService) GetPostsNear(lat, lng, radiusM float64, limit int) ([]models.Post, error) {
+	nearby, err := s.PostRepo.FindPostsNear(lat, lng, radiusM, "", nil, clampMapLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	posts := make([]models.Post, 0, len(nearby))
+	for _, n := range nearby {
+		p := n.Post
+		p.DistanceM = n.DistanceM
+		posts = append(posts, p)
+	}
 	return posts, nil
 }
 
+// GetPostClusters groups posts inside the box into map clusters for the zoom level.
+func (s *FeedService) GetPostClusters(box geo.BBox, zoom int) ([]repository.PostCluster, error) {
+	return s.PostRepo.GetPostClusters(box, zoom)
+}
+
+func clampMapLimit(limit int) int {
+	max := config.GetMapQueryLimit()
+	if limit <= 0 || limit > max {
+		return max
+	}
+	return limit
+}
+
 // GetAllPostsForAdmin fetches all posts (unfiltered by score) for admin dashboard
-// Supports optional status filter ("open", "inprogress", "closed")
+// Supports an optional status filter (any of the models.Status* values)
 func (f *FeedService) GetAllPostsForAdmin(statusFilter string, limit int) ([]models.Post, error) {
 	posts, err := f.PostRepo.GetFeedPosts()
 	if err != nil {
@@ -213,14 +368,17 @@ func (s *ReportService) AddComment(userID, postID, content string) (*models.Comm
 	if err != nil {
 		return nil, err
 	}
-	comment, err := s.PostRepo.AddComment(uid, pid, content)
+	comment, err := s.PostRepo.AddComment(uid, pid, content, DetectLanguage(content))
 	if err != nil {
 		return nil, err
 	}
 
 	// Incremental scoring: add this comment's score to the post average
 	if strings.TrimSpace(content) != "" {
-		_, sc, _ := PredictUrgencyDetailed(content)
+		sc := heuristicScore(content)
+		if pred, err := s.Predictor.PredictUrgency(content); err == nil {
+			sc = pred.Score
+		}
 		if err := s.PostRepo.UpdatePostScoreAdd(pid, sc, 1); err != nil {
 			log.Printf("warning: failed to update post score after comment: %v", err)
 		}
@@ -231,6 +389,7 @@ func (s *ReportService) AddComment(userID, postID, content string) (*models.Comm
 		// Non-fatal: log but don't fail the comment creation
 		log.Printf("warning: failed to update post urgency after comment: %v", err)
 	}
+	s.Ranker.Notify(pid)
 
 	return comment, nil
 }
@@ -245,37 +404,121 @@ func (s *ReportService) ToggleUpvote(userID, postID string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	return s.PostRepo.ToggleUpvote(uid, pid)
+	added, err := s.PostRepo.ToggleUpvote(uid, pid)
+	if err != nil {
+		return false, err
+	}
+	s.Ranker.Notify(pid)
+	return added, nil
 }
 
-// UpdatePostStatus updates the status of a post (e.g., open -> closed)
-func (s *ReportService) UpdatePostStatus(postID, status, notes string) (*models.Post, error) {
+// AddUpvote upvotes a post for userID, keeping an existing upvote. It returns
+// gorm.ErrRecordNotFound if the post does not exist.
+func (s *ReportService) AddUpvote(userID, postID string) error {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return err
+	}
+	pid, err := uuid.Parse(postID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.PostRepo.GetPost(pid); err != nil {
+		return err
+	}
+	if err := s.PostRepo.AddUpvote(uid, pid); err != nil {
+		return err
+	}
+	s.Ranker.Notify(pid)
+	return nil
+}
+
+// UpdatePostStatus moves a post to a new status on behalf of actorID, enforcing
+// the lifecycle rules and recording the change (with notes) in the post history.
+func (s *ReportService) UpdatePostStatus(postID, actorID, status, notes string) (*models.Post, error) {
 	pid, err := uuid.Parse(postID)
 	if err != nil {
 		return nil, err
 	}
-	
-	// Validate status
-	validStatuses := map[string]bool{"open": true, "inprogress": true, "closed": true}
-	if !validStatuses[status] {
-		return nil, err // invalid status
+	aid, err := uuid.Parse(actorID)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Update the post status in the database
-	post, err := s.PostRepo.UpdatePostStatus(pid, status)
+	if !IsValidStatus(status) {
+		return nil, ErrInvalidStatus
+	}
+
+	current, err := s.PostRepo.GetPost(pid)
 	if err != nil {
 		return nil, err
 	}
-	
-	// If notes provided, append as a system comment (optional enhancement)
-	if notes != "" {
-		systemUserID := uuid.Nil // or a special admin user ID
-		_, _ = s.PostRepo.AddComment(pid, systemUserID, "[Admin] "+notes)
+	if err := CanTransitionStatus(current.Status, status); err != nil {
+		return nil, err
 	}
-	
+
+	// The repository re-checks the current status inside its transaction so a
+	// concurrent update cannot slip an unchecked transition in between.
+	post, err := s.PostRepo.UpdatePostStatus(pid, aid, current.Status, status, strings.TrimSpace(notes))
+	if err != nil {
+		return nil, err
+	}
+	s.Ranker.Notify(pid)
 	return post, nil
 }
 
+// GetPostStatusHistory returns the recorded status transitions of a post.
+func (s *ReportService) GetPostStatusHistory(postID string) ([]StatusChange, error) {
+	pid, err := uuid.Parse(postID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.PostRepo.GetPost(pid); err != nil {
+		return nil, err
+	}
+	changes, err := s.PostRepo.GetPostStatusHistory(pid)
+	if err != nil {
+		return nil, err
+	}
+	return toStatusChanges(changes), nil
+}
+
+// commentTexts returns the non-blank comment contents.
+func commentTexts(comments []models.Comment) []string {
+	var texts []string
+	for _, comment := range comments {
+		if strings.TrimSpace(comment.Content) != "" {
+			texts = append(texts, comment.Content)
+		}
+	}
+	return texts
+}
+
+// commentUrgencyScores returns the 0..3 scores CalculateAggregateUrgency
+// combines for the comment texts under the current FEED_SCORING_MODE. In
+// "ml" mode preds and errs are the predictions for texts.
+func commentUrgencyScores(texts []string, preds []Prediction, errs []error) []float64 {
+	mode := config.GetFeedScoringMode()
+	scores := make([]float64, 0, len(texts))
+	for j, text := range texts {
+		switch mode {
+		case "ml":
+			// Use ML scores (0..1) scaled to 0..3 to match existing aggregator
+			sc := preds[j].Score
+			if errs[j] != nil {
+				sc = heuristicScore(text)
+			}
+			scores = append(scores, sc*3.0)
+		case "heuristic":
+			// Use local heuristic (0..1) scaled to 0..3
+			scores = append(scores, heuristicScore(text)*3.0)
+		default:
+			// none: fallback to simple keyword-based calculator (already ~0..3)
+			scores = append(scores, CalculateCommentUrgency(text).Score)
+		}
+	}
+	return scores
+}
+
 // UpdatePostUrgencyFromComments recalculates the post's urgency based on all its comments
 // This is called after a new comment is added to dynamically update the post's priority
 func (s *ReportService) UpdatePostUrgencyFromComments(postID uuid.UUID) error {
@@ -292,34 +535,36 @@ func (s *ReportService) UpdatePostUrgencyFromComments(postID uuid.UUID) error {
 	}
 
 	// Calculate urgency scores for each comment
-	var commentScores []float64
-	mode := config.GetFeedScoringMode()
-	for _, comment := range comments {
-		if strings.TrimSpace(comment.Content) == "" { continue }
-		switch mode {
-		case "ml":
-			// Use ML score (0..1) scaled to 0..3 to match existing aggregator
-			_, sc, _ := PredictUrgencyDetailed(comment.Content)
-			commentScores = append(commentScores, sc*3.0)
-		case "heuristic":
-			// Use local heuristic (0..1) scaled to 0..3
-			sc := heuristicScore(comment.Content)
-			commentScores = append(commentScores, sc*3.0)
-		default:
-			// none: fallback to simple keyword-based calculator (already ~0..3)
-			s := CalculateCommentUrgency(comment.Content)
-			commentScores = append(commentScores, s.Score)
-		}
+	texts := commentTexts(comments)
+	var preds []Prediction
+	var errs []error
+	if config.GetFeedScoringMode() == "ml" {
+		// predicted in one batch
+		preds, errs = PredictBatch(s.Predictor, texts, 0)
 	}
+	commentScores := commentUrgencyScores(texts, preds, errs)
 
 	// Calculate the new urgency level
-	newUrgency, newLevel := CalculateAggregateUrgency(post.Urgency, commentScores)
+	agg := ExplainAggregateUrgency(post.Urgency, commentScores)
+	newUrgency, newLevel := agg.FinalUrgency, agg.Level
 
 	// Update the post's urgency in the database
 	if err := s.PostRepo.UpdatePostUrgency(postID, newUrgency); err != nil {
 		return err
 	}
 
+	// Record how the comments moved the urgency next to the description factors
+	explanation, err := loadUrgencyExplanation(s.PostRepo, postID)
+	if err != nil || explanation == nil {
+		pred, _ := HeuristicPredictor{}.PredictUrgency(post.Description)
+		e := ExplainText(post.Description, pred, nil)
+		explanation = &e
+	}
+	explanation.Comments = &agg
+	explanation.Urgency = newUrgency
+	explanation.UpdatedAt = time.Now()
+	saveUrgencyExplanation(s.PostRepo, postID, *explanation)
+
 	// Log the urgency update for debugging
 	LogUrgencyCalculation(postID, post.Urgency, commentScores, newUrgency, newLevel)
 
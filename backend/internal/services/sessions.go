@@ -0,0 +1,118 @@
+package services
+
+import (
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown refresh tokens and tokens
+	// of revoked or expired sessions.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token is presented
+	// after it was rotated. The session it belongs to has been revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// SessionService manages sessions (signed-in devices) and their refresh
+// tokens. Refresh tokens are opaque random strings, stored only as hashes,
+// and are replaced on every refresh; a token that is used twice means it
+// leaked, so the whole session is revoked.
+type SessionService struct {
+	Repo *repository.SessionRepository
+	// TTL is how long a session lasts after sign-in. Refreshing does not
+	// extend it.
+	TTL time.Duration
+
+	now func() time.Time
+}
+
+func NewSessionService(repo *repository.SessionRepository, ttl time.Duration) *SessionService {
+	return &SessionService{Repo: repo, TTL: ttl, now: time.Now}
+}
+
+// Start creates a session for a user signing in and returns it with its
+// first refresh token.
+func (s *SessionService) Start(userID uuid.UUID, userAgent, ip string) (*models.Session, string, error) {
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := s.now()
+	session := &models.Session{
+		ID:         uuid.New(),
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(s.TTL),
+	}
+	if err := s.Repo.CreateSession(session, hash); err != nil {
+		return nil, "", err
+	}
+	return session, token, nil
+}
+
+// Refresh exchanges a refresh token for the next one of its session.
+func (s *SessionService) Refresh(token string) (*models.Session, string, error) {
+	next, nextHash, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+	session, result, err := s.Repo.RotateRefreshToken(HashRefreshToken(token), nextHash, s.now())
+	if err != nil {
+		return nil, "", err
+	}
+	switch result {
+	case repository.Rotated:
+		return session, next, nil
+	case repository.ReusedToken:
+		log.Printf("sessions: refresh token reused, revoked session %s of user %s", session.ID, session.UserID)
+		return nil, "", ErrRefreshTokenReused
+	default:
+		return nil, "", ErrInvalidRefreshToken
+	}
+}
+
+// List returns a user's active sessions.
+func (s *SessionService) List(userID uuid.UUID) ([]models.Session, error) {
+	return s.Repo.ListActiveSessions(userID, s.now())
+}
+
+// Revoke ends one of a user's sessions; its refresh tokens stop working.
+// Access tokens already issued stay valid until they expire.
+func (s *SessionService) Revoke(userID, sessionID uuid.UUID) error {
+	return s.Repo.RevokeSession(userID, sessionID, s.now())
+}
+
+// RevokeAll ends all of a user's sessions, e.g. after their password was
+// reset.
+func (s *SessionService) RevokeAll(userID uuid.UUID) error {
+	_, err := s.Repo.RevokeUserSessions(userID, s.now())
+	return err
+}
+
+// HashRefreshToken returns the stored form of a refresh token.
+func HashRefreshToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func newRefreshToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
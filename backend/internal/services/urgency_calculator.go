@@ -21,107 +21,48 @@ type UrgencyScore struct {
 	Score      float64
 	Level      UrgencyLevel
 	Confidence float64 // 0.0 - 1.0
+	// Language is the detected language of the text (see DetectLanguage)
+	Language string
+	// Matches lists the keywords that contributed to Score
+	Matches []KeywordMatch
+	// Resolution is the term that said the problem was fixed, if any; it
+	// scaled Score down by the profile's ResolutionFactor
+	Resolution string
 }
 
-// urgencyKeywords maps keywords to their urgency multiplier
-var urgencyKeywords = map[string]float64{
-	// Critical indicators (3.0x)
-	"dangerous": 3.0,
-	"critical":  3.0,
-	"emergency": 3.0,
-	"severe":    3.0,
-	"urgent":    3.0,
-	"fatal":     3.0,
-	"death":     3.0,
-	"dying":     3.0,
-	"collapsed": 3.0,
-	"collapse":  3.0,
-	"broken":    2.5,
-	"destroyed": 2.5,
-	"accident":  2.5,
-	"injury":    2.5,
-	"injured":   2.5,
-	"bleeding":  3.0,
-	"fire":      3.0,
-	"explod":    3.0,
-	"hazard":    2.5,
-	"gas":       2.5,
-
-	// Moderate indicators (1.5x - 2.4x)
-	"concern":  1.8,
-	"serious":  2.0,
-	"problem":  1.5,
-	"issue":    1.2,
-	"needs":    1.5,
-	"needed":   1.5,
-	"repair":   1.8,
-	"damage":   2.0,
-	"damaged":  2.0,
-	"flood":    2.2,
-	"flooding": 2.2,
-	"waterlog": 2.2,
-	"crack":    1.6,
-	"hole":     1.5,
-	"pothole":  1.8,
-	"danger":   2.3,
-	"risk":     2.0,
-	"unsafe":   2.2,
-	"sick":     2.0,
-	"illness":  2.0,
-	"disease":  2.0,
-	"spread":   2.0,
-
-	// Low indicators (0.5x - 1.4x)
-	"minor":    0.8,
-	"small":    0.7,
-	"slight":   0.7,
-	"bit":      0.6,
-	"little":   0.6,
-	"could":    0.9,
-	"might":    0.9,
-	"possible": 0.9,
-	"maybe":    0.8,
-	"suggests": 1.0,
-	"seems":    0.9,
+// KeywordMatch is one word of a text that matched an urgency keyword.
+type KeywordMatch struct {
+	Word    string  `json:"word"`
+	Keyword string  `json:"keyword"`
+	Weight  float64 `json:"weight"`
+	Partial bool    `json:"partial,omitempty"` // prefix match, weighted by PartialMatchFactor
+	Phrase  bool    `json:"phrase,omitempty"`  // multi-word match from the profile's phrases
+	// Intensifier is the word ("very") that multiplied Weight
+	Intensifier string `json:"intensifier,omitempty"`
+	// Negated matches were in a negation's scope and weigh NegatedWeight
+	Negated bool `json:"negated,omitempty"`
 }
 
 // CalculateCommentUrgency analyzes a comment string and returns an urgency score
 func CalculateCommentUrgency(commentText string) UrgencyScore {
 	if commentText == "" {
-		return UrgencyScore{Score: 1.0, Level: Moderate, Confidence: 0.5}
+		return UrgencyScore{Score: 1.0, Level: Moderate, Confidence: 0.5, Language: LangUnknown}
 	}
 
-	text := strings.ToLower(commentText)
-	words := strings.Fields(text)
+	active := ActiveScoringProfile()
+	language := DetectLanguage(commentText)
+	// English keywords always apply: Hindi and Hinglish reports mix in English words
+	lexicons := []map[string]float64{active.lexicon(LangEnglish)}
+	if lex := active.lexicon(language); lex != nil && language != LangEnglish {
+		lexicons = append(lexicons, lex)
+	}
 
+	matches, resolution := matchClauses(active, lexicons, language, TokenizeClauses(commentText))
 	totalScore := 0.0
-	matchCount := 0
-	maxScore := 0.0
-
-	// Calculate score from keywords
-	for _, word := range words {
-		// Remove punctuation for matching
-		cleanWord := strings.Trim(word, ".,!?;:\"'()[]{}")
-
-		// Check for direct matches
-		if multiplier, found := urgencyKeywords[cleanWord]; found {
-			totalScore += multiplier
-			matchCount++
-			if multiplier > maxScore {
-				maxScore = multiplier
-			}
-			continue
-		}
-
-		// Check for partial matches (prefix matching)
-		for keyword, multiplier := range urgencyKeywords {
-			if strings.HasPrefix(cleanWord, keyword) {
-				totalScore += multiplier * 0.8 // slightly lower confidence for partial matches
-				matchCount++
-				break
-			}
-		}
+	for _, m := range matches {
+		totalScore += m.Weight
 	}
+	matchCount := len(matches)
 
 	// Calculate average score
 	var avgScore float64
@@ -144,6 +85,10 @@ func CalculateCommentUrgency(commentText string) UrgencyScore {
 	if avgScore < 0.5 {
 		avgScore = 1.0
 	}
+	// A report that the problem was fixed outweighs how bad it was
+	if resolution != "" {
+		avgScore *= active.Profile.ResolutionFactor
+	}
 
 	level := categorizeUrgency(avgScore)
 
@@ -151,9 +96,136 @@ func CalculateCommentUrgency(commentText string) UrgencyScore {
 		Score:      avgScore,
 		Level:      level,
 		Confidence: confidence,
+		Language:   language,
+		Matches:    matches,
+		Resolution: resolution,
 	}
 }
 
+// clauseMatch is a keyword or resolution term found at a token position.
+type clauseMatch struct {
+	pos        int
+	match      KeywordMatch
+	resolution string
+}
+
+// matchClauses finds the keyword matches of each clause and applies the
+// context rules: phrases before single words, intensifiers to the keywords
+// that follow them, and negations to the keywords in their scope. It also
+// returns the first resolution term that is not negated.
+func matchClauses(active *ActiveProfile, lexicons []map[string]float64, language string, clauses [][]string) ([]KeywordMatch, string) {
+	profile := &active.Profile
+	postNegation := negationFollowsKeyword(language)
+	var matches []KeywordMatch
+	resolution := ""
+
+	for _, tokens := range clauses {
+		var found []clauseMatch
+		negatedUntil, negationFrom := -1, 0
+		intensity, intensifier, intensifiedUntil := 1.0, "", -1
+
+		add := func(f clauseMatch) {
+			if !postNegation && f.pos <= negatedUntil {
+				f.match.Negated = true
+			}
+			found = append(found, f)
+		}
+
+		for i := 0; i < len(tokens); {
+			if p, ok := matchPattern(active.phrases, tokens, i); ok {
+				m := KeywordMatch{Word: strings.Join(tokens[i:i+len(p.tokens)], " "), Keyword: p.text, Weight: p.weight, Phrase: true}
+				add(clauseMatch{pos: i, match: m})
+				i += len(p.tokens)
+				continue
+			}
+			if p, ok := matchPattern(active.resolutions, tokens, i); ok {
+				add(clauseMatch{pos: i, resolution: p.text})
+				i += len(p.tokens)
+				continue
+			}
+
+			word := tokens[i]
+			switch {
+			case negationScopeBreakers[word]:
+				negatedUntil, negationFrom = -1, i+1
+			case active.negations[word]:
+				if postNegation {
+					// negate what came before, back to the last scope break
+					for j := range found {
+						if found[j].pos >= negationFrom && found[j].pos >= i-profile.NegationWindow {
+							found[j].match.Negated = true
+						}
+					}
+				} else {
+					negatedUntil = i + profile.NegationWindow
+				}
+			case active.intensifiers[word] > 0:
+				intensity, intensifier, intensifiedUntil = active.intensifiers[word], word, i+intensifierWindow
+			default:
+				m, ok := matchKeyword(lexicons, word, profile.PartialMatchFactor)
+				if !ok {
+					break
+				}
+				if i <= intensifiedUntil {
+					m.Weight = minFloat(3.0, m.Weight*intensity)
+					m.Intensifier = intensifier
+					intensifiedUntil = -1
+				}
+				add(clauseMatch{pos: i, match: m})
+			}
+			i++
+		}
+
+		for _, f := range found {
+			if f.resolution != "" {
+				if !f.match.Negated && resolution == "" {
+					resolution = f.resolution
+				}
+				continue
+			}
+			m := f.match
+			if m.Negated {
+				m.Weight = profile.NegatedWeight
+			}
+			matches = append(matches, m)
+		}
+	}
+	return matches, resolution
+}
+
+// matchKeyword looks word up in lexicons, preferring a direct match in any
+// lexicon over a prefix match.
+func matchKeyword(lexicons []map[string]float64, word string, partialFactor float64) (KeywordMatch, bool) {
+	if w, ok := lookupKeyword(lexicons, word); ok {
+		return KeywordMatch{Word: word, Keyword: word, Weight: w}, true
+	}
+	if keyword, w, ok := lookupKeywordPrefix(lexicons, word); ok {
+		// slightly lower confidence for partial matches
+		return KeywordMatch{Word: word, Keyword: keyword, Weight: w * partialFactor, Partial: true}, true
+	}
+	return KeywordMatch{}, false
+}
+
+func lookupKeyword(lexicons []map[string]float64, word string) (float64, bool) {
+	for _, lex := range lexicons {
+		if w, ok := lex[word]; ok {
+			return w, true
+		}
+	}
+	return 0, false
+}
+
+func lookupKeywordPrefix(lexicons []map[string]float64, word string) (string, float64, bool) {
+	for _, lex := range lexicons {
+		for keyword, w := range lex {
+			if strings.HasPrefix(word, keyword) {
+				return keyword, w, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
 // categorizeUrgency converts a numeric score to an urgency level
 // Based on: low<=0.75, moderate<=1.5, critical>1.5
 func categorizeUrgency(score float64) UrgencyLevel {
@@ -166,9 +238,30 @@ func categorizeUrgency(score float64) UrgencyLevel {
 	return Critical
 }
 
+// AggregateUrgency explains how CalculateAggregateUrgency combined the post's
+// urgency with its comments.
+type AggregateUrgency struct {
+	PostUrgency   int          `json:"post_urgency"`
+	CommentScores []float64    `json:"comment_scores"`
+	CommentAvg    float64      `json:"comment_avg"`
+	PostWeight    float64      `json:"post_weight"`
+	CommentWeight float64      `json:"comment_weight"`
+	FinalScore    float64      `json:"final_score"`
+	FinalUrgency  int          `json:"final_urgency"`
+	Level         UrgencyLevel `json:"level"`
+}
+
 // CalculateAggregateUrgency combines post urgency with comment urgencies to get final score
-// Algorithm: (PostUrgency * 0.5) + (Average(CommentScores) * 0.5)
+// Algorithm: (PostUrgency * PostWeight) + (Average(CommentScores) * CommentWeight),
+// with the weights taken from the active scoring profile (0.5/0.5 by default)
 func CalculateAggregateUrgency(postUrgency int, commentScores []float64) (int, UrgencyLevel) {
+	agg := ExplainAggregateUrgency(postUrgency, commentScores)
+	return agg.FinalUrgency, agg.Level
+}
+
+// ExplainAggregateUrgency performs the CalculateAggregateUrgency computation
+// and returns every intermediate value.
+func ExplainAggregateUrgency(postUrgency int, commentScores []float64) AggregateUrgency {
 	// Start with post's initial urgency as baseline
 	postScore := float64(postUrgency)
 
@@ -184,9 +277,10 @@ func CalculateAggregateUrgency(postUrgency int, commentScores []float64) (int, U
 		commentAvg = float64(postUrgency)
 	}
 
-	// Weighted average: 50% post, 50% comments
+	// Weighted average, 50% post and 50% comments by default
 	// This allows comments to significantly influence the urgency
-	finalScore := (postScore * 0.5) + (commentAvg * 0.5)
+	profile := &ActiveScoringProfile().Profile
+	finalScore := (postScore * profile.PostWeight) + (commentAvg * profile.CommentWeight)
 
 	// Convert to int (1-3 scale)
 	finalInt := 1
@@ -196,9 +290,16 @@ func CalculateAggregateUrgency(postUrgency int, commentScores []float64) (int, U
 		finalInt = 2
 	}
 
-	level := categorizeUrgency(finalScore)
-
-	return finalInt, level
+	return AggregateUrgency{
+		PostUrgency:   postUrgency,
+		CommentScores: commentScores,
+		CommentAvg:    commentAvg,
+		PostWeight:    profile.PostWeight,
+		CommentWeight: profile.CommentWeight,
+		FinalScore:    finalScore,
+		FinalUrgency:  finalInt,
+		Level:         categorizeUrgency(finalScore),
+	}
 }
 
 // Helper function
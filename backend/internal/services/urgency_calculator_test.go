@@ -36,9 +36,9 @@ func TestCalculateCommentUrgency(t *testing.T) {
 		{
 			name:          "Low-moderate urgency - minor issue",
 			comment:       "This is a minor issue, not urgent",
-			expectedLevel: Critical, // "minor" = 0.8, "issue" = 1.2, "not" no match, "urgent" = 3.0, avg = (0.8+1.2+3.0)/3 = 1.67 > 1.5
-			minScore:      1.5,
-			maxScore:      2.0,
+			expectedLevel: Moderate, // "minor" = 0.8, "issue" = 1.2, "not urgent" is negated = 0.5, avg = (0.8+1.2+0.5)/3 = 0.83
+			minScore:      0.8,
+			maxScore:      0.9,
 		},
 		{
 			name:          "Moderate urgency - pothole",
@@ -75,6 +75,199 @@ func TestCalculateCommentUrgency(t *testing.T) {
 	}
 }
 
+// TestCalculateCommentUrgencyContext is a corpus of comments whose urgency
+// depends on negation, intensifiers, resolution phrases or multi-word phrases.
+func TestCalculateCommentUrgencyContext(t *testing.T) {
+	tests := []struct {
+		name       string
+		comment    string
+		level      UrgencyLevel
+		minScore   float64
+		maxScore   float64
+		resolution string
+		negated    []string // keywords expected to be negated
+		phrase     string   // phrase expected among the matches
+		intensify  string   // keyword expected to be intensified
+	}{
+		{
+			name:       "negated and resolved",
+			comment:    "Not dangerous anymore, it was fixed",
+			level:      Low,
+			minScore:   0.1,
+			maxScore:   0.3, // negated "dangerous" = 0.5, resolved: 0.5*0.4
+			resolution: "fixed",
+			negated:    []string{"dangerous"},
+		},
+		{
+			name:     "negation window",
+			comment:  "There is no real danger here",
+			level:    Low,
+			minScore: 0.5,
+			maxScore: 0.5,
+			negated:  []string{"danger"},
+		},
+		{
+			name:     "negation ends at clause boundary",
+			comment:  "No, this is dangerous",
+			level:    Critical,
+			minScore: 3.0,
+			maxScore: 3.0,
+		},
+		{
+			name:     "negation ends at but",
+			comment:  "No fire but a severe crack in the wall",
+			level:    Critical,
+			minScore: 1.5,
+			maxScore: 3.0,
+			negated:  []string{"fire"},
+		},
+		{
+			name:     "negation out of window",
+			comment:  "Not sure who to call about this dangerous wire",
+			level:    Critical,
+			minScore: 3.0,
+			maxScore: 3.0,
+		},
+		{
+			name:       "negated resolution keeps urgency",
+			comment:    "Still not fixed and the hole is dangerous",
+			level:      Critical,
+			minScore:   2.0,
+			maxScore:   3.0,
+			resolution: "",
+		},
+		{
+			name:      "intensifier raises weight",
+			comment:   "The pothole is very deep and very damaged",
+			level:     Critical,
+			minScore:  2.1,
+			maxScore:  2.5, // pothole 1.8, damaged 2.0*1.3
+			intensify: "damaged",
+		},
+		{
+			name:      "intensifier capped at 3",
+			comment:   "extremely dangerous",
+			level:     Critical,
+			minScore:  3.0,
+			maxScore:  3.0,
+			intensify: "dangerous",
+		},
+		{
+			name:     "gas leak phrase",
+			comment:  "Smell of gas leak near the market",
+			level:    Critical,
+			minScore: 3.0,
+			maxScore: 3.0,
+			phrase:   "gas leak",
+		},
+		{
+			name:     "live wire phrase",
+			comment:  "Live wire hanging over the footpath",
+			level:    Critical,
+			minScore: 3.0,
+			maxScore: 3.0,
+			phrase:   "live wire",
+		},
+		{
+			name:     "negated phrase",
+			comment:  "It was not a gas leak, just garbage",
+			level:    Low,
+			minScore: 0.5,
+			maxScore: 0.5,
+			negated:  []string{"gas leak"},
+		},
+		{
+			name:       "resolution without keywords",
+			comment:    "The garbage was cleared this morning",
+			level:      Low,
+			minScore:   0.4,
+			maxScore:   0.4,
+			resolution: "cleared",
+		},
+		{
+			name:       "multi-word resolution",
+			comment:    "Flooding is no longer a problem",
+			level:      Low,
+			minScore:   0.6,
+			maxScore:   0.8,
+			resolution: "no longer",
+		},
+		{
+			name:     "hindi negation follows keyword",
+			comment:  "यहाँ कोई खतरा नहीं है",
+			level:    Low,
+			minScore: 0.5,
+			maxScore: 0.5,
+			negated:  []string{"खतरा"},
+		},
+		{
+			name:     "hinglish negation follows keyword",
+			comment:  "Ab koi khatra nahi hai",
+			level:    Low,
+			minScore: 0.5,
+			maxScore: 0.5,
+			negated:  []string{"khatra"},
+		},
+		{
+			name:      "hinglish intensifier",
+			comment:   "Yahan bahut bada gaddha hai",
+			level:     Critical,
+			minScore:  2.3,
+			maxScore:  2.4, // gaddha 1.8*1.3
+			intensify: "gaddha",
+		},
+		{
+			name:       "hinglish resolution",
+			comment:    "Naali ab theek ho gaya hai",
+			level:      Low,
+			minScore:   0.4,
+			maxScore:   0.4,
+			resolution: "theek ho gaya",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := CalculateCommentUrgency(tt.comment)
+			if score.Level != tt.level {
+				t.Errorf("expected level %s, got %s (score %.2f, matches %+v)", tt.level, score.Level, score.Score, score.Matches)
+			}
+			if score.Score < tt.minScore-1e-9 || score.Score > tt.maxScore+1e-9 {
+				t.Errorf("expected score between %.2f and %.2f, got %.2f (matches %+v)", tt.minScore, tt.maxScore, score.Score, score.Matches)
+			}
+			if score.Resolution != tt.resolution {
+				t.Errorf("expected resolution %q, got %q", tt.resolution, score.Resolution)
+			}
+			byKeyword := map[string]KeywordMatch{}
+			for _, m := range score.Matches {
+				byKeyword[m.Keyword] = m
+			}
+			for _, k := range tt.negated {
+				if m, ok := byKeyword[k]; !ok || !m.Negated {
+					t.Errorf("expected %q to be negated, matches %+v", k, score.Matches)
+				}
+			}
+			if tt.negated == nil {
+				for _, m := range score.Matches {
+					if m.Negated {
+						t.Errorf("unexpected negated match %+v", m)
+					}
+				}
+			}
+			if tt.phrase != "" {
+				if m, ok := byKeyword[tt.phrase]; !ok || !m.Phrase {
+					t.Errorf("expected phrase %q, matches %+v", tt.phrase, score.Matches)
+				}
+			}
+			if tt.intensify != "" {
+				if m, ok := byKeyword[tt.intensify]; !ok || m.Intensifier == "" {
+					t.Errorf("expected %q to be intensified, matches %+v", tt.intensify, score.Matches)
+				}
+			}
+		})
+	}
+}
+
 func TestCategorizeUrgency(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -0,0 +1,211 @@
+package services
+
+import (
+	config "crowdsourcedurbanissuereportingwithai/backend/configs"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UrgencyExplanation lists the factors behind an urgency score so admins can
+// see why a report was ranked the way it was.
+type UrgencyExplanation struct {
+	// Urgency, Score and Source are the prediction that was used
+	Urgency int     `json:"urgency"`
+	Score   float64 `json:"score"`
+	Source  string  `json:"source"`
+	// MLScore is set when the ML model answered; MLError when it did not
+	MLScore *float64 `json:"ml_score,omitempty"`
+	MLError string   `json:"ml_error,omitempty"`
+	// HeuristicScore is the local fallback score and the term that decided it
+	HeuristicScore float64 `json:"heuristic_score"`
+	HeuristicTerm  string  `json:"heuristic_term,omitempty"`
+	// KeywordScore (0..3) and Keywords come from CalculateCommentUrgency,
+	// using the lexicons of the detected Language
+	Language     string         `json:"language"`
+	KeywordScore float64        `json:"keyword_score"`
+	Keywords     []KeywordMatch `json:"keywords"`
+	// Resolution is the phrase ("fixed", "cleared") that lowered KeywordScore
+	Resolution string `json:"resolution,omitempty"`
+	// Comments is how comments moved the post urgency, when they have
+	Comments *AggregateUrgency `json:"comments,omitempty"`
+	// Upvotes is the upvote part of the feed score, filled in on read
+	Upvotes   *UpvoteComponent `json:"upvotes,omitempty"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// ErrNoUrgencyExplanation is returned for a post whose urgency was never
+// explained, e.g. one reported before explanations were recorded.
+var ErrNoUrgencyExplanation = errors.New("no urgency explanation recorded")
+
+// UpvoteComponent is the upvote term of the blended feed score
+// (FeedTextWeight*text score + FeedUpvoteWeight*upvote value). The value is
+// the upvote presence (0 or 1), or in the "decay" scoring mode the
+// logarithmic LogUpvoteScore.
+type UpvoteComponent struct {
+	Count        int64   `json:"count"`
+	Presence     float64 `json:"presence"`
+	Weight       float64 `json:"weight"`
+	Contribution float64 `json:"contribution"`
+}
+
+// ExplainText explains the urgency of text given the prediction (or error)
+// the configured predictor returned for it.
+func ExplainText(text string, pred Prediction, predErr error) UrgencyExplanation {
+	hScore, hTerm := explainHeuristic(text)
+	kw := CalculateCommentUrgency(text)
+	e := UrgencyExplanation{
+		HeuristicScore: hScore,
+		HeuristicTerm:  hTerm,
+		Language:       kw.Language,
+		KeywordScore:   kw.Score,
+		Keywords:       kw.Matches,
+		Resolution:     kw.Resolution,
+		UpdatedAt:      time.Now(),
+	}
+	if e.Keywords == nil {
+		e.Keywords = []KeywordMatch{}
+	}
+	if predErr != nil {
+		e.MLError = predErr.Error()
+		e.Urgency, e.Score, e.Source = mapScoreToUrgency(hScore), hScore, SourceHeuristic
+		return e
+	}
+	e.Urgency, e.Score, e.Source = pred.Urgency, pred.Score, pred.Source
+	if pred.Source == SourceML {
+		score := pred.Score
+		e.MLScore = &score
+	}
+	return e
+}
+
+// ExplainUrgency predicts the urgency of text with p and explains the result.
+func ExplainUrgency(p UrgencyPredictor, text string) UrgencyExplanation {
+	pred, err := p.PredictUrgency(text)
+	return ExplainText(text, pred, err)
+}
+
+func saveUrgencyExplanation(repo *repository.PostRepository, postID uuid.UUID, e UrgencyExplanation) {
+	b, err := json.Marshal(e)
+	if err == nil {
+		err = repo.SaveUrgencyExplanation(postID, b)
+	}
+	if err != nil {
+		log.Printf("warning: failed to save urgency explanation for post %s: %v", postID, err)
+	}
+}
+
+// loadUrgencyExplanation returns the stored explanation of a post, or nil if
+// there is none.
+func loadUrgencyExplanation(repo *repository.PostRepository, postID uuid.UUID) (*UrgencyExplanation, error) {
+	row, err := repo.GetUrgencyExplanation(postID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e UrgencyExplanation
+	if err := json.Unmarshal([]byte(row.Explanation), &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ExplainPostUrgency returns the stored urgency explanation of a post with
+// the current upvote component. It makes no ML calls and writes nothing; a
+// post without an explanation gets ErrNoUrgencyExplanation.
+func (s *ReportService) ExplainPostUrgency(postID string) (*UrgencyExplanation, error) {
+	pid, err := uuid.Parse(postID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.PostRepo.GetPost(pid); err != nil {
+		return nil, err
+	}
+	e, err := loadUrgencyExplanation(s.PostRepo, pid)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, ErrNoUrgencyExplanation
+	}
+	if e.Upvotes, err = s.upvoteComponent(pid); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// RecomputePostUrgency scores the post again from its description and
+// current comments with the configured predictor, in one batch. The post's
+// urgency, score_sum/score_count and stored explanation are all replaced, so
+// the explanation matches the score the post is ranked by. It also records an
+// explanation for posts reported before explanations were kept.
+func (s *ReportService) RecomputePostUrgency(postID string) (*UrgencyExplanation, error) {
+	pid, err := uuid.Parse(postID)
+	if err != nil {
+		return nil, err
+	}
+	post, err := s.PostRepo.GetPost(pid)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := s.PostRepo.GetPostComments(pid)
+	if err != nil {
+		return nil, err
+	}
+	texts := append([]string{post.Description}, commentTexts(comments)...)
+	preds, errs := PredictBatch(s.Predictor, texts, 0)
+	e := ExplainText(post.Description, preds[0], errs[0])
+	if e.Urgency == 0 {
+		e.Urgency = mapScoreToUrgency(e.Score)
+	}
+	// the same terms ReportIssueViaPost and AddComment add up incrementally
+	scoreSum := e.Score
+	for j := 1; j < len(texts); j++ {
+		sc := heuristicScore(texts[j])
+		if errs[j] == nil {
+			sc = preds[j].Score
+		}
+		scoreSum += sc
+	}
+	if len(texts) > 1 {
+		agg := ExplainAggregateUrgency(e.Urgency, commentUrgencyScores(texts[1:], preds[1:], errs[1:]))
+		e.Comments = &agg
+		e.Urgency = agg.FinalUrgency
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.PostRepo.RescorePost(pid, e.Urgency, scoreSum, len(texts), b); err != nil {
+		return nil, err
+	}
+	s.Ranker.Notify(pid)
+	if e.Upvotes, err = s.upvoteComponent(pid); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// upvoteComponent returns the upvote term of the post's feed score under the
+// current FEED_SCORING_MODE.
+func (s *ReportService) upvoteComponent(postID uuid.UUID) (*UpvoteComponent, error) {
+	upvotes, err := s.PostRepo.CountPostUpvotes(postID)
+	if err != nil {
+		return nil, err
+	}
+	value := 0.0
+	if config.GetFeedScoringMode() == "decay" {
+		value = LogUpvoteScore(int(upvotes), config.GetFeedUpvoteSaturation())
+	} else if upvotes > 0 {
+		value = 1.0
+	}
+	weight := ActiveScoringProfile().Profile.FeedUpvoteWeight
+	return &UpvoteComponent{Count: upvotes, Presence: value, Weight: weight, Contribution: weight * value}, nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"sort"
+	"strings"
+)
+
+// Context rules applied by CalculateCommentUrgency on top of plain keyword
+// weights. Their word lists live in the scoring profile so admins can extend
+// them; nil lists and maps mean the built-in defaults below.
+
+// defaultPhrases are multi-word matches that mean more than their words do
+// alone ("live wire" is critical although neither word is a keyword).
+func defaultPhrases() map[string]float64 {
+	return map[string]float64{
+		"gas leak":          3.0,
+		"gas leakage":       3.0,
+		"live wire":         3.0,
+		"exposed wire":      3.0,
+		"short circuit":     3.0,
+		"open manhole":      3.0,
+		"building collapse": 3.0,
+		"sparking wire":     3.0,
+		"fallen tree":       2.5,
+		"sewage overflow":   2.5,
+		"power outage":      2.2,
+		"water logging":     2.2,
+		"no water":          2.0,
+		"street light":      1.2,
+		"traffic jam":       1.2,
+		"गैस लीक":           3.0,
+		"करंट लग":           3.0,
+		"current aa raha":   3.0,
+		"bijli ka taar":     2.5,
+	}
+}
+
+// defaultIntensifiers multiply the weight of the next keyword.
+func defaultIntensifiers() map[string]float64 {
+	return map[string]float64{
+		"very":       1.3,
+		"really":     1.2,
+		"extremely":  1.5,
+		"highly":     1.3,
+		"super":      1.2,
+		"seriously":  1.3,
+		"terribly":   1.4,
+		"absolutely": 1.3,
+		"bahut":      1.3,
+		"bohot":      1.3,
+		"bahot":      1.3,
+		"ekdum":      1.3,
+		"behad":      1.5,
+		"बहुत":       1.3,
+		"बेहद":       1.5,
+		"अत्यधिक":    1.5,
+	}
+}
+
+// defaultNegations turn the keywords in their scope into a low-urgency cue.
+func defaultNegations() []string {
+	return []string{
+		"not", "no", "never", "without", "hardly", "neither", "nor",
+		"isn't", "isnt", "wasn't", "wasnt", "aren't", "arent", "weren't",
+		"don't", "dont", "doesn't", "doesnt", "didn't", "didnt", "nothing",
+		"nahi", "nahin", "nhi", "mat",
+		"नहीं", "नही", "मत", "न",
+	}
+}
+
+// defaultResolutionTerms say the problem is gone and scale the score down.
+func defaultResolutionTerms() []string {
+	return []string{
+		"fixed", "resolved", "cleared", "repaired", "restored", "removed",
+		"cleaned", "solved", "no longer",
+		"theek ho gaya", "thik ho gaya", "fix ho gaya", "saaf ho gaya", "hat gaya",
+		"ठीक हो गया", "ठीक हो गई", "साफ हो गया", "हटा दिया",
+	}
+}
+
+// negationScopeBreakers end a negation scope within a clause:
+// in "no fire but a huge pothole" the pothole is not negated.
+var negationScopeBreakers = map[string]bool{
+	"but": true, "however": true, "although": true, "though": true, "yet": true,
+	"lekin": true, "magar": true, "लेकिन": true, "मगर": true,
+}
+
+// intensifierWindow is how many tokens an intensifier reaches ahead
+// ("very very dangerous", "extremely badly damaged").
+const intensifierWindow = 2
+
+// phrasePattern is a phrase or resolution term split into tokens.
+type phrasePattern struct {
+	text   string
+	tokens []string
+	weight float64
+}
+
+// compilePhrases tokenizes phrases and orders them longest first so the
+// longest match wins.
+func compilePhrases(phrases map[string]float64) []phrasePattern {
+	out := make([]phrasePattern, 0, len(phrases))
+	for text, w := range phrases {
+		out = append(out, phrasePattern{text: text, tokens: Tokenize(text), weight: w})
+	}
+	sortPatterns(out)
+	return out
+}
+
+func compileTerms(terms []string) []phrasePattern {
+	out := make([]phrasePattern, 0, len(terms))
+	for _, text := range terms {
+		out = append(out, phrasePattern{text: text, tokens: Tokenize(text)})
+	}
+	sortPatterns(out)
+	return out
+}
+
+func sortPatterns(p []phrasePattern) {
+	sort.SliceStable(p, func(i, j int) bool {
+		if len(p[i].tokens) != len(p[j].tokens) {
+			return len(p[i].tokens) > len(p[j].tokens)
+		}
+		return p[i].text < p[j].text
+	})
+}
+
+// matchPattern returns the first pattern whose tokens start at tokens[i].
+func matchPattern(patterns []phrasePattern, tokens []string, i int) (phrasePattern, bool) {
+	for _, p := range patterns {
+		if len(p.tokens) == 0 || i+len(p.tokens) > len(tokens) {
+			continue
+		}
+		ok := true
+		for j, t := range p.tokens {
+			if tokens[i+j] != t {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return p, true
+		}
+	}
+	return phrasePattern{}, false
+}
+
+func normalizeSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[NormalizeUnicode(strings.TrimSpace(w))] = true
+	}
+	return set
+}
+
+func normalizeWeights(m map[string]float64) map[string]float64 {
+	out := make(map[string]float64, len(m))
+	for k, w := range m {
+		out[NormalizeUnicode(k)] = w
+	}
+	return out
+}
+
+// negationFollowsKeyword reports whether negations in lang come after what
+// they negate, as in Hindi "खतरा नहीं है" or Hinglish "khatra nahi hai".
+func negationFollowsKeyword(lang string) bool {
+	return lang == LangHindi || lang == LangHinglish
+}
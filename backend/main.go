@@ -6,6 +6,8 @@ import (
 	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/cache"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/handlers"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/mail"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/middleware"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/repository"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/services"
 	"crowdsourcedurbanissuereportingwithai/backend/models"
@@ -17,6 +19,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -47,6 +50,14 @@ func main() {
 		log.Fatal("Failed to enable uuid-ossp extension:", err)
 	}
 
+	// Upvotes are unique per user and post; drop duplicates collected before
+	// the unique index existed so AutoMigrate can create it
+	postRepo := repository.NewPostRepository(db)
+	dupUpvotes, err := postRepo.DedupeUpvotes()
+	if err != nil {
+		log.Fatal("Failed to remove duplicate upvotes:", err)
+	}
+
 	// AutoMigrate all models
 	err = db.AutoMigrate(
 		&models.User{},
@@ -54,36 +65,211 @@ func main() {
 		&models.Post{},
 		&models.Comment{},
 		&models.Upvote{},
+		&models.PostStatusChange{},
+		&models.EnrichmentJob{},
+		&models.PostUrgencyExplanation{},
+		&models.ScoringProfileVersion{},
+		&models.UserPlace{},
+		&models.PostRanking{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserRole{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.UserIdentity{},
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	postRepo := repository.NewPostRepository(db)
-	feedService := services.NewFeedService(postRepo)
-	reportService := services.NewReportService(postRepo)
+	if dupUpvotes > 0 {
+		log.Printf("removed %d duplicate upvotes", dupUpvotes)
+		if _, err := postRepo.BackfillPostCounters(); err != nil {
+			log.Printf("warning: counter backfill failed: %v", err)
+		}
+	}
+	if config.GetPostGISEnabled() {
+		if err := postRepo.EnsureSpatialIndexes(); err != nil {
+			log.Printf("PostGIS unavailable, using lat/lng index for map queries: %v", err)
+		} else {
+			postRepo.UsePostGIS = true
+		}
+	}
+	// posts.geohash was written but never queried; drop it from older databases
+	if db.Migrator().HasColumn(&models.Post{}, "geohash") {
+		if err := db.Migrator().DropColumn(&models.Post{}, "geohash"); err != nil {
+			log.Printf("warning: failed to drop posts.geohash: %v", err)
+		}
+	}
+
+	redisAddr := config.GetRedisAddr()
+	var redisClient *redis.Client
+	if redisAddr != "" {
+		redisClient = cache.NewRedisClient(redisAddr, config.GetRedisPassword())
+	}
+
+	// ML predictions are cached in Redis when available, otherwise in process,
+	// optionally backed by the database
+	var predictionStore cache.PredictionStore
+	if ttl := config.GetPredictionCacheTTL(); ttl > 0 {
+		var tiers []cache.PredictionStore
+		if redisClient != nil {
+			tiers = append(tiers, cache.NewRedisPredictionStore(redisClient))
+		} else {
+			tiers = append(tiers, cache.NewLRUPredictionStore(config.GetPredictionCacheSize()))
+		}
+		if config.GetPredictionCacheDBEnabled() {
+			if err := db.AutoMigrate(&models.PredictionCacheEntry{}); err != nil {
+				log.Fatal(err)
+			}
+			predictionRepo := repository.NewPredictionCacheRepository(db)
+			if n, err := predictionRepo.PurgeExpired(); err == nil && n > 0 {
+				log.Printf("purged %d expired cached predictions", n)
+			}
+			tiers = append(tiers, predictionRepo)
+		}
+		predictionStore = cache.NewTieredPredictionStore(ttl, tiers...)
+		ctx := context.Background()
+		if err := services.SyncModelVersion(ctx, predictionStore, "urgency", services.UrgencyModelID()); err != nil {
+			log.Printf("warning: prediction cache version check failed: %v", err)
+		}
+		if err := services.SyncModelVersion(ctx, predictionStore, "image", services.ImageModelID()); err != nil {
+			log.Printf("warning: prediction cache version check failed: %v", err)
+		}
+	}
+
+	// Retries of POST /report, /comment and /upvote that carry the same
+	// Idempotency-Key replay the first response instead of creating new records
+	idempotent := func(h http.Handler) http.Handler { return h }
+	if ttl := config.GetIdempotencyTTL(); ttl > 0 {
+		var store repository.IdempotencyStore
+		if redisClient != nil {
+			store = middleware.NewRedisIdempotencyStore(redisClient)
+		} else {
+			if err := db.AutoMigrate(&models.IdempotencyKey{}); err != nil {
+				log.Fatal(err)
+			}
+			idempotencyRepo := repository.NewIdempotencyRepository(db)
+			if n, err := idempotencyRepo.PurgeExpired(); err == nil && n > 0 {
+				log.Printf("purged %d expired idempotency keys", n)
+			}
+			store = idempotencyRepo
+		}
+		idempotent = middleware.NewIdempotency(store, ttl).Wrap
+	}
+
+	// ML backends are chosen once at startup and shared by all services
+	urgencyBreaker := services.NewCircuitBreakerFromConfig("urgency")
+	imageBreaker := services.NewCircuitBreakerFromConfig("image_classification")
+	urgencyPredictor := services.NewUrgencyPredictorFromConfig(urgencyBreaker, predictionStore)
+	imageClassifier := services.NewImageClassifierFromConfig(imageBreaker, predictionStore)
+
+	// Scoring weights come from the active profile version; other instances'
+	// changes are picked up by polling
+	scoringService := services.NewScoringProfileService(repository.NewScoringProfileRepository(db))
+	if err := scoringService.Reload(); err != nil {
+		log.Printf("warning: using default scoring profile: %v", err)
+	}
+	scoringCtx, stopScoringWatch := context.WithCancel(context.Background())
+	defer stopScoringWatch()
+	go scoringService.Watch(scoringCtx, config.GetScoringReloadInterval())
+
+	userRepo := repository.NewUserRepository(db)
+	feedService := services.NewFeedService(postRepo, urgencyPredictor)
+	feedService.UserRepo = userRepo
+	reportService := services.NewReportService(postRepo, urgencyPredictor, imageClassifier)
+
+	// /feed reads precomputed rankings; the ranker rescores posts as they change
+	// and sweeps all of them periodically
+	var rankerWG *sync.WaitGroup
+	rankerCtx, stopRanker := context.WithCancel(context.Background())
+	if config.GetFeedRanking() == "materialized" {
+		ranker := services.NewFeedRanker(feedService)
+		ranker.SweepInterval = config.GetFeedRankingSweepInterval()
+		ranker.Window = config.GetFeedRankWindow()
+		feedService.Rankings = true
+		reportService.Ranker = ranker
+		rankerWG = ranker.Start(rankerCtx)
+	}
+
+	// New reports are enriched in the background; the worker talks to the ML
+	// API directly so model failures are retried instead of masked by the heuristic
+	var enrichmentWG *sync.WaitGroup
+	enrichmentCtx, stopEnrichment := context.WithCancel(context.Background())
+	if config.GetEnrichmentMode() == "async" {
+		reportService.AsyncEnrichment = true
+		worker := services.NewEnrichmentWorker(postRepo, services.NewMLUrgencyPredictorFromConfig(urgencyBreaker, predictionStore), imageClassifier)
+		worker.Workers = config.GetEnrichmentWorkers()
+		worker.MaxAttempts = config.GetEnrichmentMaxAttempts()
+		worker.Ranker = reportService.Ranker
+		enrichmentWG = worker.Start(enrichmentCtx)
+	}
 	feedHandler := handlers.NewFeedHandler(feedService)
 	reportHandler := handlers.NewReportHandler(reportService)
-	mlHandler := handlers.NewMLHandler()
+	mlHandler := handlers.NewMLHandler(urgencyPredictor, imageClassifier)
+	healthHandler := handlers.NewHealthHandler(urgencyBreaker, imageBreaker)
+	scoringHandler := handlers.NewScoringHandler(scoringService)
 
 	jwtSvc := auth.NewJWTService()
 
-	userRepo := repository.NewUserRepository(db)
 	authService := services.NewAuthService(userRepo)
 
-	
-	redisAddr := config.GetRedisAddr()
-	var redisClient *redis.Client
-	if redisAddr != "" {
-		redisClient = cache.NewRedisClient(redisAddr, config.GetRedisPassword())
+	// Roles and permissions live in the database; ADMIN_EMAILS and
+	// SUPER_ADMIN_EMAILS bootstrap the first admins
+	roleService := services.NewRoleService(repository.NewRoleRepository(db), userRepo)
+	if err := roleService.SeedDefaults(); err != nil {
+		log.Fatal(err)
 	}
+	roleService.Bootstrap(config.GetAdminEmails(), models.RoleAdmin)
+	roleService.Bootstrap(config.GetSuperAdminEmails(), models.RoleSuperAdmin)
+	roleHandler := handlers.NewRoleHandler(roleService)
+
 
 	authHandler := handlers.NewAuthHandler(authService, jwtSvc, redisClient)
+	authHandler.Roles = roleService
 
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
-	})
+	// Identity providers: Google and any OIDC issuers such as the city's SSO.
+	// Their accounts are linked to users in user_identities
+	providers := auth.NewOIDCRegistry()
+	if clientIDs := config.GetGoogleClientIDs(); len(clientIDs) > 0 {
+		providers.Register(auth.NewGoogleProvider(clientIDs, config.GetGoogleClientSecret()))
+	} else {
+		log.Println("GOOGLE_CLIENT_IDS not set; Google sign-in disabled")
+	}
+	for _, c := range config.GetOIDCProviders() {
+		p := auth.NewOIDCProvider(c.Name, c.Issuer, c.ClientID, c.ClientSecret)
+		p.DisplayName = c.DisplayName
+		p.Scopes = c.Scopes
+		p.RoleClaim = c.RoleClaim
+		p.RoleMap = c.RoleMap
+		p.Verifier.TrustEmail = c.TrustEmail
+		providers.Register(p)
+		log.Printf("OIDC sign-in enabled for %s (%s)", c.Name, c.Issuer)
+	}
+	authHandler.Providers = providers
+	authHandler.Identities = services.NewIdentityService(repository.NewIdentityRepository(db), authService, roleService)
+
+	// Sign-ins start a session whose refresh token is rotated by /auth/refresh
+	if ttl := config.GetRefreshTokenTTL(); ttl > 0 {
+		sessionRepo := repository.NewSessionRepository(db)
+		if n, err := sessionRepo.PurgeExpired(time.Now()); err == nil && n > 0 {
+			log.Printf("purged %d expired sessions", n)
+		}
+		authHandler.Sessions = services.NewSessionService(sessionRepo, ttl)
+		authHandler.Identities.Sessions = authHandler.Sessions
+	}
+
+	// Email verification and password reset links are mailed through MAIL_DRIVER
+	mailer, err := mail.New(config.GetMailConfig())
+	if err != nil {
+		log.Fatalf("mail: %v", err)
+	}
+	accounts := services.NewAccountService(authService.UserRepo, jwtSvc, mailer, config.GetFrontendURL())
+	accounts.Sessions = authHandler.Sessions
+	authHandler.Accounts = accounts
+	authHandler.ResetCooldowns = cache.NewCooldowns(redisClient, "reset", config.GetPasswordResetCooldown())
+
+	http.HandleFunc("/health", healthHandler.ServeHealth)
 
 	http.HandleFunc("/api/endpoint", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -144,14 +330,28 @@ func main() {
 		
 		fileServer.ServeHTTP(w, r)
 	})
-	http.HandleFunc("/feed", feedHandler.ServeFeed)
+	// /feed serves everyone; a signed-in user can ask for a personal ranking with ?for=me
+	optionalAuthMw := auth.OptionalAuthMiddleware(jwtSvc, redisClient)
+	http.Handle("/feed", optionalAuthMw(http.HandlerFunc(feedHandler.ServeFeed)))
 	http.HandleFunc("/login", authHandler.Login)
 	http.HandleFunc("/register", authHandler.Register)
 	
 	http.HandleFunc("/google-login", authHandler.GoogleLogin)
+	http.HandleFunc("POST /auth/refresh", authHandler.Refresh)
+	http.HandleFunc("GET /auth/providers", authHandler.ServeProviders)
+	http.HandleFunc("GET /auth/oidc/{provider}/login", authHandler.OIDCLogin)
+	http.HandleFunc("GET /auth/oidc/{provider}/callback", authHandler.OIDCCallback)
+	http.HandleFunc("POST /auth/verify-email", authHandler.VerifyEmail)
+	http.HandleFunc("POST /auth/forgot-password", authHandler.ForgotPassword)
+	http.HandleFunc("POST /auth/reset-password", authHandler.ResetPassword)
 	
 	http.HandleFunc("/classify-image", mlHandler.ServeClassifyImage)
 	http.HandleFunc("/predict-urgency", mlHandler.ServePredictUrgency)
+	http.HandleFunc("GET /api/posts", feedHandler.ServePosts)
+	http.HandleFunc("GET /api/posts/clusters", feedHandler.ServePostClusters)
+	http.HandleFunc("GET /api/posts/{id}/history", reportHandler.ServeStatusHistory)
+	http.HandleFunc("GET /api/posts/{id}/urgency", reportHandler.ServeUrgencyExplanation)
+	http.HandleFunc("GET /api/posts/{id}/comments", feedHandler.ServePostComments)
 	authMw := auth.AuthMiddleware(jwtSvc, redisClient)
 
 	
@@ -179,18 +379,60 @@ func main() {
 		handlers.DevTestUserID = devUser.ID
 
 		// register routes without auth middleware for convenience
-		http.Handle("/report", http.HandlerFunc(reportHandler.ServeReport))
+		http.Handle("/report", idempotent(http.HandlerFunc(reportHandler.ServeReport)))
 		http.Handle("/logout", http.HandlerFunc(authHandler.Logout))
-		http.Handle("/comment", http.HandlerFunc(reportHandler.ServeComment))
-		http.Handle("/upvote", http.HandlerFunc(reportHandler.ServeUpvote))
+		http.Handle("/comment", idempotent(http.HandlerFunc(reportHandler.ServeComment)))
+		http.Handle("/upvote", idempotent(http.HandlerFunc(reportHandler.ServeUpvote)))
+		http.Handle("PUT /api/posts/{id}/upvote", http.HandlerFunc(reportHandler.ServeAddUpvote))
+		http.Handle("GET /api/me/places", http.HandlerFunc(feedHandler.ServePlaces))
+		http.Handle("POST /api/me/places", http.HandlerFunc(feedHandler.ServeAddPlace))
+		http.Handle("DELETE /api/me/places/{id}", http.HandlerFunc(feedHandler.ServeDeletePlace))
 		log.Println("DISABLE_AUTH=true: auth disabled for local testing; using dev user:", devEmail)
 	} else {
-		http.Handle("/report", authMw(http.HandlerFunc(reportHandler.ServeReport)))
+		// REQUIRE_VERIFIED_EMAIL lets only users who confirmed their email report
+		report := idempotent(http.HandlerFunc(reportHandler.ServeReport))
+		if config.GetRequireVerifiedEmail() {
+			report = authHandler.RequireVerifiedEmail(report)
+		}
+		http.Handle("/report", authMw(report))
 		http.Handle("/logout", authMw(http.HandlerFunc(authHandler.Logout)))
 		// Comments and upvotes are protected endpoints — user must be authenticated
-		http.Handle("/comment", authMw(http.HandlerFunc(reportHandler.ServeComment)))
-		http.Handle("/upvote", authMw(http.HandlerFunc(reportHandler.ServeUpvote)))
+		http.Handle("/comment", authMw(idempotent(http.HandlerFunc(reportHandler.ServeComment))))
+		http.Handle("/upvote", authMw(idempotent(http.HandlerFunc(reportHandler.ServeUpvote))))
+		http.Handle("PUT /api/posts/{id}/upvote", authMw(http.HandlerFunc(reportHandler.ServeAddUpvote)))
+		// Saved home/work locations and followed neighbourhoods for /feed?for=me
+		http.Handle("GET /api/me/places", authMw(http.HandlerFunc(feedHandler.ServePlaces)))
+		http.Handle("POST /api/me/places", authMw(http.HandlerFunc(feedHandler.ServeAddPlace)))
+		http.Handle("DELETE /api/me/places/{id}", authMw(http.HandlerFunc(feedHandler.ServeDeletePlace)))
+	}
+
+	// Admin routes always require an authenticated user holding the route's
+	// permission, even with DISABLE_AUTH
+	requirePerm := func(perm string, h http.HandlerFunc) http.Handler {
+		return authMw(auth.RequirePermission(perm)(h))
 	}
+	http.Handle("/api/admin/post-status", requirePerm(models.PermPostsUpdateStatus, reportHandler.ServeUpdateStatus))
+	http.Handle("/api/admin/issues", requirePerm(models.PermIssuesView, feedHandler.ServeAdminFeed))
+	http.Handle("POST /api/posts/{id}/urgency", requirePerm(models.PermPostsUpdateStatus, reportHandler.ServeRecomputeUrgency))
+	http.Handle("GET /api/admin/scoring", requirePerm(models.PermScoringManage, scoringHandler.ServeActive))
+	http.Handle("POST /api/admin/scoring", requirePerm(models.PermScoringManage, scoringHandler.ServeCreate))
+	http.Handle("PATCH /api/admin/scoring", requirePerm(models.PermScoringManage, scoringHandler.ServePatch))
+	http.Handle("GET /api/admin/scoring/versions", requirePerm(models.PermScoringManage, scoringHandler.ServeVersions))
+	http.Handle("GET /api/admin/scoring/versions/{version}", requirePerm(models.PermScoringManage, scoringHandler.ServeVersion))
+	http.Handle("POST /api/admin/scoring/versions/{version}/activate", requirePerm(models.PermScoringManage, scoringHandler.ServeActivate))
+	http.Handle("DELETE /api/admin/scoring/versions/{version}", requirePerm(models.PermScoringManage, scoringHandler.ServeDelete))
+	http.Handle("GET /api/admin/roles", requirePerm(models.PermUsersManageRoles, roleHandler.ServeRoles))
+	http.Handle("GET /api/admin/users/{id}/roles", requirePerm(models.PermUsersManageRoles, roleHandler.ServeUserRoles))
+	http.Handle("POST /api/admin/users/{id}/roles", requirePerm(models.PermUsersManageRoles, roleHandler.ServeAssignRole))
+	http.Handle("DELETE /api/admin/users/{id}/roles/{role}", requirePerm(models.PermUsersManageRoles, roleHandler.ServeRevokeRole))
+
+	// A user's signed-in devices and linked identities; these only exist for
+	// real sign-ins, so they require a token even with DISABLE_AUTH
+	http.Handle("GET /auth/sessions", authMw(http.HandlerFunc(authHandler.ListSessions)))
+	http.Handle("DELETE /auth/sessions/{id}", authMw(http.HandlerFunc(authHandler.RevokeSession)))
+	http.Handle("GET /auth/identities", authMw(http.HandlerFunc(authHandler.ListIdentities)))
+	http.Handle("POST /auth/oidc/{provider}/link", authMw(http.HandlerFunc(authHandler.OIDCLink)))
+	http.Handle("POST /auth/verify-email/resend", authMw(http.HandlerFunc(authHandler.ResendVerification)))
 
 	// Log redis status
 	if redisClient == nil {
@@ -220,8 +462,8 @@ func main() {
 	corsHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if allowedOrigin != "" {
 			w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 			if allowCredentials {
 				w.Header().Set("Access-Control-Allow-Credentials", "true")
 			}
@@ -256,5 +498,31 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	stopRanker()
+	stopEnrichment()
+	if enrichmentWG != nil {
+		// jobs still running after the deadline are retried once their lease expires
+		done := make(chan struct{})
+		go func() {
+			enrichmentWG.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+	if rankerWG != nil {
+		// an unfinished sweep is simply redone on the next start
+		done := make(chan struct{})
+		go func() {
+			rankerWG.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
 	log.Println("Server exited properly")
 }
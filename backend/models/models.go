@@ -15,13 +15,66 @@ const (
 	CategoryVandalism  = "Vandalism"
 )
 
+// Post status constants. The allowed transitions between them are enforced by
+// the services layer; see services.CanTransitionStatus.
+const (
+	StatusOpen       = "open"
+	StatusTriaged    = "triaged"
+	StatusAssigned   = "assigned"
+	StatusInProgress = "inprogress"
+	StatusResolved   = "resolved"
+	StatusVerified   = "verified"
+	StatusClosed     = "closed"
+	StatusRejected   = "rejected"
+	StatusDuplicate  = "duplicate"
+	StatusReopened   = "reopened"
+)
+
+// Post enrichment states. A post is saved as pending when ML enrichment
+// (urgency prediction, image classification) runs in the background.
+const (
+	EnrichmentPending = "pending"
+	EnrichmentDone    = "done"
+	EnrichmentFailed  = "failed"
+)
+
+// Enrichment job states.
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Role names. Every user implicitly holds RoleCitizen; the other roles are
+// assigned through /api/admin/users/{id}/roles.
+const (
+	RoleCitizen         = "citizen"
+	RoleModerator       = "moderator"
+	RoleDepartmentStaff = "department_staff"
+	RoleAdmin           = "admin"
+	RoleSuperAdmin      = "super_admin"
+)
+
+// Permission names, checked by auth.RequirePermission.
+const (
+	PermIssuesView        = "issues:view_all"
+	PermPostsUpdateStatus = "posts:update_status"
+	PermScoringManage     = "scoring:manage"
+	PermUsersManageRoles  = "users:manage_roles"
+	PermUsersManageAdmins = "users:manage_admins"
+)
+
 type User struct {
 	ID           uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
 	Name         string    `gorm:"not null" json:"name"`
 	Email        string    `gorm:"unique;not null" json:"email"`
 	PasswordHash string    `gorm:"not null" json:"password_hash"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	// EmailVerifiedAt is when the user confirmed they own Email, through the
+	// emailed link or an identity provider; nil while unconfirmed.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 type Issue struct {
@@ -40,20 +93,33 @@ type Post struct {
 	UserID       uuid.UUID `gorm:"type:uuid;not null;index:idx_post_user" json:"user_id"`
 	User         User      `gorm:"foreignKey:UserID" json:"user"`
 	Description  string    `json:"description,omitempty"`
+	// Detected language of Description: en, hi, hi-Latn (Hinglish) or und
+	Language     string    `gorm:"size:16;index:idx_post_language" json:"language,omitempty"`
 	Status       string    `gorm:"default:'open';not null;index:idx_post_status" json:"status"`
 	Urgency      int       `gorm:"not null;index:idx_post_urgency" json:"urgency"`
 	ClassifiedAs string    `json:"classified_as,omitempty"`
-	Lat          float64   `gorm:"not null" json:"lat"`
-	Lng          float64   `gorm:"not null" json:"lng"`
+	Lat          float64   `gorm:"not null;index:idx_post_lat_lng,priority:1" json:"lat"`
+	Lng          float64   `gorm:"not null;index:idx_post_lat_lng,priority:2" json:"lng"`
 	MediaURL     string    `gorm:"not null" json:"media_url"`
 	Comments     []Comment `gorm:"foreignKey:PostID" json:"comments"`
 	Upvotes      []Upvote  `gorm:"foreignKey:PostID" json:"upvotes"`
+	// Denormalized counters, kept in step with the upvotes and comments
+	// tables by the repository; LastActivityAt is the latest of the post,
+	// comment and upvote creation times
+	UpvoteCount    int       `gorm:"not null;default:0" json:"upvote_count"`
+	CommentCount   int       `gorm:"not null;default:0" json:"comment_count"`
+	LastActivityAt time.Time `gorm:"index:idx_post_last_activity" json:"last_activity_at"`
 	// Persistent incremental scoring fields
 	ScoreSum     float64   `gorm:"default:0" json:"-"`
 	ScoreCount   int       `gorm:"default:0" json:"-"`
+	// ML enrichment progress: pending until the background worker has set
+	// Urgency, ClassifiedAs and the initial score
+	EnrichmentStatus string `gorm:"size:16;default:'done';not null" json:"enrichment_status"`
 	// Transient, computed at request time for ranking the feed
 	Score            float64 `gorm:"-" json:"score,omitempty"`
 	ComputedUrgency  int     `gorm:"-" json:"computed_urgency,omitempty"`
+	// Transient, set by radius queries
+	DistanceM        float64 `gorm:"-" json:"distance_m,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -65,14 +131,189 @@ type Comment struct {
 	UserID    uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
 	User      User      `gorm:"foreignKey:UserID" json:"user"`
 	Content   string    `gorm:"not null" json:"content"`
+	// Detected language of Content, as on Post
+	Language  string    `gorm:"size:16" json:"language,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Upvote is one user's upvote of a post; a user can upvote a post once.
 type Upvote struct {
 	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
-	PostID    uuid.UUID `gorm:"type:uuid;not null" json:"post_id"`
+	PostID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_upvote_post_user,priority:1" json:"post_id"`
 	Post      Post      `gorm:"foreignKey:PostID" json:"post"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_upvote_post_user,priority:2" json:"user_id"`
 	User      User      `gorm:"foreignKey:UserID" json:"user"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// PostStatusChange records a single status transition of a post together with
+// the user who made it and any notes they left.
+type PostStatusChange struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	PostID     uuid.UUID `gorm:"type:uuid;not null;index:idx_status_change_post" json:"post_id"`
+	ActorID    uuid.UUID `gorm:"type:uuid;not null" json:"actor_id"`
+	Actor      User      `gorm:"foreignKey:ActorID" json:"actor"`
+	FromStatus string    `gorm:"not null" json:"from_status"`
+	ToStatus   string    `gorm:"not null" json:"to_status"`
+	Notes      string    `json:"notes,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PredictionCacheEntry is the durable tier of the ML prediction cache. Key is
+// the hash of model id and normalized input (see cache.PredictionKey).
+type PredictionCacheEntry struct {
+	Key       string    `gorm:"column:cache_key;primaryKey;size:96" json:"key"`
+	ModelID   string    `gorm:"not null;index:idx_prediction_cache_model" json:"model_id"`
+	Urgency   int       `json:"urgency"`
+	Score     float64   `json:"score"`
+	Class     string    `json:"class"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+}
+
+// IdempotencyKey stores the response to a POST made with an Idempotency-Key
+// header so retries replay it (see middleware.Idempotency). Key is the hashed
+// user, path and client key; rows without a status are in progress.
+type IdempotencyKey struct {
+	Key         string    `gorm:"column:idempotency_key;primaryKey;size:96" json:"key"`
+	Fingerprint string    `gorm:"size:64;not null" json:"fingerprint"`
+	Status      int       `json:"status"`
+	Header      string    `gorm:"type:text" json:"header"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `gorm:"index" json:"expires_at"`
+}
+
+// EnrichmentJob is a queued ML enrichment of a post. Jobs live in the database
+// so they survive restarts; workers claim them by moving them to running with
+// a lease, and failed attempts are retried after RunAfter.
+type EnrichmentJob struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	PostID      uuid.UUID `gorm:"type:uuid;not null;index:idx_enrichment_job_post" json:"post_id"`
+	Status      string    `gorm:"size:16;not null;index:idx_enrichment_job_status_run,priority:1" json:"status"`
+	Attempts    int       `gorm:"not null;default:0" json:"attempts"`
+	RunAfter    time.Time `gorm:"not null;index:idx_enrichment_job_status_run,priority:2" json:"run_after"`
+	LockedUntil time.Time `json:"locked_until"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PostUrgencyExplanation stores the latest explanation of a post's urgency
+// (matched keywords, model vs heuristic scores, comment contributions) as JSON.
+type PostUrgencyExplanation struct {
+	PostID      uuid.UUID `gorm:"type:uuid;primaryKey" json:"post_id"`
+	Explanation string    `gorm:"type:text;not null" json:"explanation"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ScoringProfileVersion is one saved version of the urgency scoring profile
+// (keyword weights, heuristic terms and blend weights) as JSON. At most one
+// version is active at a time; older versions are kept for rollback.
+type ScoringProfileVersion struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Version   int       `gorm:"not null;uniqueIndex" json:"version"`
+	Profile   string    `gorm:"type:text;not null" json:"profile"`
+	Active    bool      `gorm:"not null;default:false;index" json:"active"`
+	Notes     string    `json:"notes,omitempty"`
+	CreatedBy uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Kinds of saved user places.
+const (
+	PlaceHome = "home"
+	PlaceWork = "work"
+	PlaceArea = "area" // a followed neighbourhood
+)
+
+// Role is a named set of permissions. Rank orders roles by privilege; the
+// highest ranked role a user holds is the "role" claim of their tokens.
+type Role struct {
+	ID          uuid.UUID    `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Name        string       `gorm:"size:64;uniqueIndex;not null" json:"name"`
+	Description string       `json:"description,omitempty"`
+	Rank        int          `gorm:"not null;default:0" json:"rank"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// Permission is an action a role allows, such as "posts:update_status".
+type Permission struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Name        string    `gorm:"size:64;uniqueIndex;not null" json:"name"`
+	Description string    `json:"description,omitempty"`
+}
+
+// UserRole assigns a role to a user. GrantedBy is the admin who assigned it,
+// or nil for roles granted from ADMIN_EMAILS / SUPER_ADMIN_EMAILS. Source is
+// set for roles mapped from an identity provider's claims ("oidc:<provider>");
+// those are kept in sync with the claims on every sign-in through it.
+type UserRole struct {
+	UserID    uuid.UUID  `gorm:"type:uuid;primaryKey" json:"user_id"`
+	RoleID    uuid.UUID  `gorm:"type:uuid;primaryKey;index:idx_user_role_role" json:"role_id"`
+	Role      Role       `gorm:"foreignKey:RoleID" json:"role"`
+	GrantedBy *uuid.UUID `gorm:"type:uuid" json:"granted_by,omitempty"`
+	Source    string     `gorm:"size:80" json:"source,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UserIdentity links a user to their account at an external identity
+// provider (Google, a city SSO), identified by the provider's subject.
+type UserIdentity struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index:idx_user_identity_user" json:"user_id"`
+	Provider    string    `gorm:"size:64;not null;uniqueIndex:idx_user_identity_subject" json:"provider"`
+	Subject     string    `gorm:"size:255;not null;uniqueIndex:idx_user_identity_subject" json:"subject"`
+	Email       string    `json:"email,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// Session is a signed-in device. Its refresh token is rotated on every use;
+// all tokens issued for the session form one family, and presenting a token
+// that was already rotated revokes the session.
+type Session struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index:idx_session_user" json:"user_id"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	IP         string     `gorm:"size:64" json:"ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// RefreshToken is one refresh token of a session, stored as the SHA-256 of
+// the token. UsedAt is set when it is exchanged for the next one.
+type RefreshToken struct {
+	TokenHash string     `gorm:"size:64;primaryKey" json:"-"`
+	SessionID uuid.UUID  `gorm:"type:uuid;not null;index:idx_refresh_token_session" json:"session_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// UserPlace is a location a user saved to personalize their feed: home, work
+// or a followed neighbourhood covering RadiusM meters around Lat/Lng.
+type UserPlace struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index:idx_user_place_user" json:"user_id"`
+	Kind      string    `gorm:"size:16;not null" json:"kind"`
+	Name      string    `json:"name,omitempty"`
+	Lat       float64   `gorm:"not null" json:"lat"`
+	Lng       float64   `gorm:"not null" json:"lng"`
+	RadiusM   float64   `gorm:"not null" json:"radius_m"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PostRanking is the materialized feed position of a post. The FeedRanker
+// rescores posts when they change and in a periodic sweep, so the feed is
+// read with one range query over idx_post_ranking_order.
+type PostRanking struct {
+	PostID          uuid.UUID `gorm:"type:uuid;primaryKey;index:idx_post_ranking_order,priority:3,sort:desc" json:"post_id"`
+	Score           float64   `gorm:"not null;index:idx_post_ranking_order,priority:1,sort:desc" json:"score"`
+	PostCreatedAt   time.Time `gorm:"not null;index:idx_post_ranking_order,priority:2,sort:desc" json:"post_created_at"`
+	ComputedUrgency int       `gorm:"not null;default:0" json:"computed_urgency"`
+	ComputedAt      time.Time `gorm:"not null;index" json:"computed_at"`
+}
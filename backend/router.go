@@ -1,32 +1,81 @@
 package main
 
 import (
+	config "crowdsourcedurbanissuereportingwithai/backend/configs"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/auth"
 	"crowdsourcedurbanissuereportingwithai/backend/internal/handlers"
+	"crowdsourcedurbanissuereportingwithai/backend/internal/middleware"
+	"crowdsourcedurbanissuereportingwithai/backend/models"
 	"net/http"
 
 	"github.com/redis/go-redis/v9"
 )
 
 // RegisterRoutes registers public and protected routes. The report route is
-// protected by the provided Auth middleware.
-func RegisterRoutes(feedHandler *handlers.FeedHandler, reportHandler *handlers.ReportHandler, authHandler *handlers.AuthHandler, jwtAuth *auth.JWTService, rdb *redis.Client) {
-	http.HandleFunc("/feed", feedHandler.ServeFeed)
+// protected by the provided Auth middleware; report, comment and upvote
+// submissions also honour Idempotency-Key headers when idem is set.
+func RegisterRoutes(feedHandler *handlers.FeedHandler, reportHandler *handlers.ReportHandler, scoringHandler *handlers.ScoringHandler, roleHandler *handlers.RoleHandler, authHandler *handlers.AuthHandler, jwtAuth *auth.JWTService, rdb *redis.Client, idem *middleware.Idempotency) {
+	idempotent := func(h http.Handler) http.Handler { return h }
+	if idem != nil {
+		idempotent = idem.Wrap
+	}
+	http.Handle("/feed", auth.OptionalAuthMiddleware(jwtAuth, rdb)(http.HandlerFunc(feedHandler.ServeFeed)))
 	http.HandleFunc("/login", authHandler.Login)
 	http.HandleFunc("/register", authHandler.Register)
+	http.HandleFunc("POST /auth/refresh", authHandler.Refresh)
+	http.HandleFunc("GET /auth/providers", authHandler.ServeProviders)
+	http.HandleFunc("GET /auth/oidc/{provider}/login", authHandler.OIDCLogin)
+	http.HandleFunc("GET /auth/oidc/{provider}/callback", authHandler.OIDCCallback)
+	http.HandleFunc("POST /auth/verify-email", authHandler.VerifyEmail)
+	http.HandleFunc("POST /auth/forgot-password", authHandler.ForgotPassword)
+	http.HandleFunc("POST /auth/reset-password", authHandler.ResetPassword)
+	http.HandleFunc("GET /api/posts", feedHandler.ServePosts)
+	http.HandleFunc("GET /api/posts/clusters", feedHandler.ServePostClusters)
+	http.HandleFunc("GET /api/posts/{id}/history", reportHandler.ServeStatusHistory)
+	http.HandleFunc("GET /api/posts/{id}/urgency", reportHandler.ServeUrgencyExplanation)
+	http.HandleFunc("GET /api/posts/{id}/comments", feedHandler.ServePostComments)
 
 	// protect /report with AuthMiddleware
 	authMw := auth.AuthMiddleware(jwtAuth, rdb)
-	http.Handle("/report", authMw(http.HandlerFunc(reportHandler.ServeReport)))
+	report := idempotent(http.HandlerFunc(reportHandler.ServeReport))
+	if config.GetRequireVerifiedEmail() {
+		report = authHandler.RequireVerifiedEmail(report)
+	}
+	http.Handle("/report", authMw(report))
 	// Protected logout route
 	http.Handle("/logout", authMw(http.HandlerFunc(authHandler.Logout)))
+	// Signed-in devices
+	http.Handle("GET /auth/sessions", authMw(http.HandlerFunc(authHandler.ListSessions)))
+	http.Handle("DELETE /auth/sessions/{id}", authMw(http.HandlerFunc(authHandler.RevokeSession)))
+	// Linked identity provider accounts
+	http.Handle("GET /auth/identities", authMw(http.HandlerFunc(authHandler.ListIdentities)))
+	http.Handle("POST /auth/oidc/{provider}/link", authMw(http.HandlerFunc(authHandler.OIDCLink)))
+	http.Handle("POST /auth/verify-email/resend", authMw(http.HandlerFunc(authHandler.ResendVerification)))
 	// Comments and upvotes
-	http.Handle("/comment", authMw(http.HandlerFunc(reportHandler.ServeComment)))
-	http.Handle("/upvote", authMw(http.HandlerFunc(reportHandler.ServeUpvote)))
+	http.Handle("/comment", authMw(idempotent(http.HandlerFunc(reportHandler.ServeComment))))
+	http.Handle("/upvote", authMw(idempotent(http.HandlerFunc(reportHandler.ServeUpvote))))
+	http.Handle("PUT /api/posts/{id}/upvote", authMw(http.HandlerFunc(reportHandler.ServeAddUpvote)))
+	// Saved places for the personalized feed
+	http.Handle("GET /api/me/places", authMw(http.HandlerFunc(feedHandler.ServePlaces)))
+	http.Handle("POST /api/me/places", authMw(http.HandlerFunc(feedHandler.ServeAddPlace)))
+	http.Handle("DELETE /api/me/places/{id}", authMw(http.HandlerFunc(feedHandler.ServeDeletePlace)))
 	
-	// Admin: protect with AuthMiddleware + AdminMiddleware
-	adminMw := auth.AdminMiddleware(http.HandlerFunc(reportHandler.ServeUpdateStatus))
-	http.Handle("/api/admin/post-status", authMw(adminMw))
-	adminMw2 := auth.AdminMiddleware(http.HandlerFunc(feedHandler.ServeAdminFeed))
-	http.Handle("/api/admin/issues", authMw(adminMw2))
+	// Admin: protect with AuthMiddleware + the route's permission
+	requirePerm := func(perm string, h http.HandlerFunc) http.Handler {
+		return authMw(auth.RequirePermission(perm)(h))
+	}
+	http.Handle("/api/admin/post-status", requirePerm(models.PermPostsUpdateStatus, reportHandler.ServeUpdateStatus))
+	http.Handle("/api/admin/issues", requirePerm(models.PermIssuesView, feedHandler.ServeAdminFeed))
+	http.Handle("POST /api/posts/{id}/urgency", requirePerm(models.PermPostsUpdateStatus, reportHandler.ServeRecomputeUrgency))
+	http.Handle("GET /api/admin/scoring", requirePerm(models.PermScoringManage, scoringHandler.ServeActive))
+	http.Handle("POST /api/admin/scoring", requirePerm(models.PermScoringManage, scoringHandler.ServeCreate))
+	http.Handle("PATCH /api/admin/scoring", requirePerm(models.PermScoringManage, scoringHandler.ServePatch))
+	http.Handle("GET /api/admin/scoring/versions", requirePerm(models.PermScoringManage, scoringHandler.ServeVersions))
+	http.Handle("GET /api/admin/scoring/versions/{version}", requirePerm(models.PermScoringManage, scoringHandler.ServeVersion))
+	http.Handle("POST /api/admin/scoring/versions/{version}/activate", requirePerm(models.PermScoringManage, scoringHandler.ServeActivate))
+	http.Handle("DELETE /api/admin/scoring/versions/{version}", requirePerm(models.PermScoringManage, scoringHandler.ServeDelete))
+	http.Handle("GET /api/admin/roles", requirePerm(models.PermUsersManageRoles, roleHandler.ServeRoles))
+	http.Handle("GET /api/admin/users/{id}/roles", requirePerm(models.PermUsersManageRoles, roleHandler.ServeUserRoles))
+	http.Handle("POST /api/admin/users/{id}/roles", requirePerm(models.PermUsersManageRoles, roleHandler.ServeAssignRole))
+	http.Handle("DELETE /api/admin/users/{id}/roles/{role}", requirePerm(models.PermUsersManageRoles, roleHandler.ServeRevokeRole))
 }
@@ -55,7 +55,7 @@ func TestFeedScoring(t *testing.T) {
     for _, p := range posts { if err := db.Create(&p).Error; err != nil { t.Fatalf("create post: %v", err) } }
 
     repo := repository.NewPostRepository(db)
-    feedSvc := services.NewFeedService(repo)
+    feedSvc := services.NewFeedService(repo, nil)
 
     feed, err := feedSvc.GetFeed()
     if err != nil { t.Fatalf("GetFeed error: %v", err) }
@@ -17,7 +17,7 @@ func TestFeedService(t *testing.T) {
 	}
 
 	repo := repository.NewPostRepository(db)
-	service := services.NewFeedService(repo)
+	service := services.NewFeedService(repo, nil)
 
 	// Setup: create a user and issue for fake posts
 	db.Exec("DELETE FROM upvotes")
@@ -18,10 +18,82 @@ function apiUrl(path) {
   return API_BASE.replace(/\/$/, '') + path;
 }
 
-function apiFetch(path, options = {}) {
+async function apiFetch(path, options = {}) {
   // We use Bearer tokens, not cookies, so do NOT force credentials on cross-origin
   // to keep CORS simple (ACAO "*" works without ACAC when no credentials).
-  return fetch(apiUrl(path), options);
+  const resp = await fetch(apiUrl(path), options);
+  // An expired access token is replaced using the refresh token and the
+  // request is retried once
+  const headers = options.headers || {};
+  if (resp.status !== 401 || !headers['Authorization']) return resp;
+  if (!(await refreshTokens())) return resp;
+  return fetch(apiUrl(path), { ...options, headers: { ...headers, 'Authorization': 'Bearer ' + localStorage.getItem('jwt') } });
+}
+
+// Exchange the stored refresh token for a new access and refresh token.
+// Concurrent callers share one request: each refresh token works only once,
+// and using it twice signs the device out.
+let refreshing = null;
+function refreshTokens() {
+  const token = localStorage.getItem('refresh_token');
+  if (!token) return Promise.resolve(false);
+  if (!refreshing) {
+    refreshing = fetch(apiUrl('/auth/refresh'), {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refresh_token: token })
+    })
+      .then(async resp => {
+        if (!resp.ok) {
+          localStorage.removeItem('refresh_token');
+          return false;
+        }
+        const data = await resp.json();
+        localStorage.setItem('jwt', data.access_token);
+        localStorage.setItem('refresh_token', data.refresh_token);
+        return true;
+      })
+      .catch(() => false)
+      .finally(() => { refreshing = null; });
+  }
+  return refreshing;
+}
+
+// Sign-in through an identity provider (/auth/oidc/{provider}/login) ends
+// with a redirect back here carrying the tokens in the URL fragment. Store
+// them and drop the fragment so they don't linger in history.
+(function takeTokensFromFragment() {
+  if (typeof window === 'undefined' || !window.location.hash.includes('access_token=')) return;
+  const params = new URLSearchParams(window.location.hash.slice(1));
+  const token = params.get('access_token');
+  localStorage.setItem('jwt', token);
+  if (params.get('refresh_token')) localStorage.setItem('refresh_token', params.get('refresh_token'));
+  try {
+    const payload = JSON.parse(atob(token.split('.')[1]));
+    localStorage.setItem('uc_role', payload.role || 'user');
+  } catch (e) {
+    localStorage.setItem('uc_role', 'user');
+  }
+  if (!localStorage.getItem('uc_user') || localStorage.getItem('uc_user') === 'Guest') {
+    localStorage.setItem('uc_user', 'Signed in');
+  }
+  history.replaceState(null, '', window.location.pathname + window.location.search);
+})();
+
+// POST a JSON body with an Idempotency-Key, retrying network errors and 5xx
+// responses with the same key so a flaky connection never submits twice.
+async function idempotentPost(path, headers, body, attempts = 3) {
+  const key = (window.crypto && crypto.randomUUID) ? crypto.randomUUID() : Date.now() + '-' + Math.random().toString(36).slice(2);
+  const opts = { method: 'POST', headers: { ...headers, 'Idempotency-Key': key }, body };
+  for (let i = 1; ; i++) {
+    try {
+      const resp = await apiFetch(path, opts);
+      if (resp.status < 500 || i >= attempts) return resp;
+    } catch (err) {
+      if (i >= attempts) throw err;
+    }
+    await new Promise(resolve => setTimeout(resolve, 500 * 2 ** (i - 1)));
+  }
 }
 
 
@@ -73,12 +145,10 @@ async function fetchFeedFromServer() {
       // Backend post shape (models.Post) -> frontend issue shape
       const issue = p.issue || {};
       const user = p.user || {};
-      const comments = Array.isArray(p.comments) ? p.comments.map(c => ({
-        user: c.user?.name || c.user?.email || 'User',
-        text: c.content || '',
-        timestamp: c.created_at || new Date().toISOString()
-      })) : [];
-      const upvoteCount = Array.isArray(p.upvotes) ? p.upvotes.length : 0;
+      // The feed carries counts only; comments are loaded when an issue is opened
+      const comments = Array.isArray(p.comments) ? p.comments.map(mapServerComment) : [];
+      const upvoteCount = typeof p.upvote_count === 'number' ? p.upvote_count : (Array.isArray(p.upvotes) ? p.upvotes.length : 0);
+      const commentCount = typeof p.comment_count === 'number' ? p.comment_count : comments.length;
       
       return {
         id: p.id || (p.ID || Date.now()),
@@ -91,8 +161,11 @@ async function fetchFeedFromServer() {
         lon: p.lng || p.Lng || null,
         votes: upvoteCount,
         status: p.status || p.Status || 'open',
-        reporter: user.name || user.email || (p.reporter || 'Unknown'),
+        reporter: user.name || (p.reporter || 'Unknown'),
         comments: comments,
+        commentCount: commentCount,
+        viewerHasUpvoted: p.viewer_has_upvoted === true,
+        lastActivityAt: p.last_activity_at || null,
         assignedAt: p.assigned_at || p.assignedAt || null,
         // consume backend transient fields if present
         priority_score: typeof p.score === 'number' ? p.score : null,
@@ -122,6 +195,33 @@ async function fetchFeedFromServer() {
   }
 }
 
+function mapServerComment(c) {
+  return {
+    user: c.user?.name || 'User',
+    text: c.content || '',
+    timestamp: c.created_at || new Date().toISOString()
+  };
+}
+
+// Fetch the comments of a server-backed issue and, if its modal is still
+// open, render them into #modal-comments.
+async function loadIssueComments(issue) {
+  if (!issue || !issue.commentCount) return (issue && issue.comments) || [];
+  try {
+    const resp = await apiFetch(`/api/posts/${encodeURIComponent(issue.id)}/comments`, { cache: 'no-store', headers: { 'Accept': 'application/json' } });
+    if (!resp.ok) throw new Error('Failed to fetch comments: ' + resp.status);
+    const list = await resp.json();
+    issue.comments = Array.isArray(list) ? list.map(mapServerComment) : [];
+    const submit = document.getElementById('comment-submit');
+    const box = document.getElementById('modal-comments');
+    if (box && (!submit || submit.dataset.issueId === String(issue.id))) {
+      box.innerHTML = issue.comments.map(c => `<div class="comment"><strong>${c.user}:</strong> ${c.text} <span class="muted small">(${new Date(c.timestamp).toLocaleString()})</span></div>`).join('');
+    }
+  } catch (err) {
+    console.warn('loadIssueComments failed:', err);
+  }
+  return issue.comments;
+}
 
 let issues = [];
 let upvotes = {};
@@ -133,11 +233,28 @@ let profilePic =
   'data:image/svg+xml;utf8,<svg xmlns="http://www.w3.org/2000/svg" width="48" height="48"><circle cx="24" cy="24" r="24" fill="%23e6eef6"/><text x="50%" y="50%" dominant-baseline="middle" text-anchor="middle" fill="%23004d40">User</text></svg>';
 let geoCache = JSON.parse(localStorage.getItem('uc_geo_cache') || '{}');
 
+// Permissions carried by the stored access token (empty when signed out or
+// for tokens issued before roles were stored).
+function tokenPermissions() {
+  const jwt = localStorage.getItem('jwt');
+  if (!jwt) return [];
+  try {
+    const payload = JSON.parse(atob(jwt.split('.')[1].replace(/-/g, '+').replace(/_/g, '/')));
+    return Array.isArray(payload.permissions) ? payload.permissions : [];
+  } catch (e) {
+    return [];
+  }
+}
+
+// Staff (moderators, department staff, admins) can open the admin dashboard.
+function canAccessAdmin() {
+  return tokenPermissions().includes('issues:view_all');
+}
+
 // Authentication status management
 function updateAuthUI() {
   const jwt = localStorage.getItem('jwt');
   const user = localStorage.getItem('uc_user');
-  const role = localStorage.getItem('uc_role');
   const loginBtn = document.getElementById('login-btn');
   const logoutBtn = document.getElementById('logout-btn');
   const userDisplay = document.getElementById('user-display');
@@ -152,9 +269,9 @@ function updateAuthUI() {
     }
     if (userDisplay) userDisplay.textContent = `👤 ${user}`;
     
-    // Show admin link only if user is admin
+    // Show admin link only to staff
     if (adminLink) {
-      adminLink.style.display = role === 'admin' ? 'inline-block' : 'none';
+      adminLink.style.display = canAccessAdmin() ? 'inline-block' : 'none';
     }
   } else {
     // User is not logged in
@@ -170,6 +287,7 @@ async function logout() {
   const jwt = localStorage.getItem('jwt');
   if (!jwt) {
     localStorage.removeItem('jwt');
+    localStorage.removeItem('refresh_token');
     localStorage.removeItem('uc_user');
     updateAuthUI();
     window.location.href = 'login2.html';
@@ -193,6 +311,7 @@ async function logout() {
 
   // Clear local storage and redirect
   localStorage.removeItem('jwt');
+  localStorage.removeItem('refresh_token');
   localStorage.removeItem('uc_user');
   localStorage.removeItem('uc_role');
   localStorage.removeItem('uc_email');
@@ -306,11 +425,7 @@ async function postComment(postID, content) {
   const token = localStorage.getItem('jwt');
   const headers = { 'Content-Type': 'application/json' };
   if (token) headers['Authorization'] = 'Bearer ' + token;
-  const resp = await apiFetch('/comment', {
-    method: 'POST',
-    headers,
-    body: JSON.stringify({ post_id: postID, content })
-  });
+  const resp = await idempotentPost('/comment', headers, JSON.stringify({ post_id: postID, content }));
   if (!resp.ok) {
     const text = await resp.text().catch(() => '');
     throw new Error('Comment failed: ' + resp.status + ' ' + text);
@@ -329,11 +444,7 @@ async function postUpvote(postID) {
   const token = localStorage.getItem('jwt');
   const headers = { 'Content-Type': 'application/json' };
   if (token) headers['Authorization'] = 'Bearer ' + token;
-  const resp = await apiFetch('/upvote', {
-    method: 'POST',
-    headers,
-    body: JSON.stringify({ post_id: postID })
-  });
+  const resp = await idempotentPost('/upvote', headers, JSON.stringify({ post_id: postID }));
   if (!resp.ok) {
     const text = await resp.text().catch(() => '');
     throw new Error('Upvote failed: ' + resp.status + ' ' + text);